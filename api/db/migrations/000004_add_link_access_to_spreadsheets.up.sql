@@ -0,0 +1,5 @@
+-- link_access is the access granted to anyone with a link to the sheet.
+-- 'edit' lets them edit the sheet while 'view' only lets them watch it.
+ALTER TABLE IF EXISTS spreadsheets
+ADD COLUMN link_access VARCHAR(10) NOT NULL DEFAULT 'edit'
+CHECK (link_access IN ('edit', 'view'));
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_spreadsheets_deleted_at;
+
+ALTER TABLE IF EXISTS spreadsheets
+DROP COLUMN IF EXISTS deleted_at;
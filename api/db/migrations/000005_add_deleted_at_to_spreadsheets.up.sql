@@ -0,0 +1,7 @@
+-- deleted_at is set when a sheet is moved to the trash. Trashed sheets can be
+-- restored until they are purged after the retention period.
+ALTER TABLE IF EXISTS spreadsheets
+ADD COLUMN deleted_at TIMESTAMP NULL;
+
+CREATE INDEX IF NOT EXISTS idx_spreadsheets_deleted_at
+ON spreadsheets (deleted_at) WHERE deleted_at IS NOT NULL;
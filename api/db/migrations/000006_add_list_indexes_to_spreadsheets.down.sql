@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_spreadsheets_owner_created_at;
+DROP INDEX IF EXISTS idx_spreadsheets_owner_updated_at;
+DROP INDEX IF EXISTS idx_spreadsheets_owner_deadline;
@@ -0,0 +1,10 @@
+-- indexes for listing the spreadsheets of an owner with keyset pagination,
+-- one per sort column. Trashed sheets are never listed this way.
+CREATE INDEX IF NOT EXISTS idx_spreadsheets_owner_created_at
+ON spreadsheets (owner, created_at, id) WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_spreadsheets_owner_updated_at
+ON spreadsheets (owner, updated_at, id) WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_spreadsheets_owner_deadline
+ON spreadsheets (owner, deadline, id) WHERE deleted_at IS NULL;
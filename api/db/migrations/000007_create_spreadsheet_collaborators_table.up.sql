@@ -0,0 +1,20 @@
+-- collaborators are the users a sheet has been shared with, other than its owner.
+-- user_id is the subject of the user's access token.
+CREATE TABLE IF NOT EXISTS spreadsheet_collaborators (
+    sheet_id VARCHAR(22) NOT NULL REFERENCES spreadsheets (id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('editor', 'viewer')),
+    added_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (sheet_id, user_id)
+);
+
+-- for listing the sheets shared with a user
+CREATE INDEX IF NOT EXISTS idx_spreadsheet_collaborators_user_id
+ON spreadsheet_collaborators (user_id);
+
+CREATE TRIGGER set_updated_at
+BEFORE UPDATE ON spreadsheet_collaborators
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
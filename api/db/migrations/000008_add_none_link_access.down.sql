@@ -0,0 +1,8 @@
+UPDATE spreadsheets SET link_access = 'view' WHERE link_access = 'none';
+
+ALTER TABLE IF EXISTS spreadsheets
+DROP CONSTRAINT IF EXISTS spreadsheets_link_access_check;
+
+ALTER TABLE IF EXISTS spreadsheets
+ADD CONSTRAINT spreadsheets_link_access_check
+CHECK (link_access IN ('edit', 'view'));
@@ -0,0 +1,7 @@
+-- 'none' restricts a sheet to its owner and collaborators.
+ALTER TABLE IF EXISTS spreadsheets
+DROP CONSTRAINT IF EXISTS spreadsheets_link_access_check;
+
+ALTER TABLE IF EXISTS spreadsheets
+ADD CONSTRAINT spreadsheets_link_access_check
+CHECK (link_access IN ('edit', 'view', 'none'));
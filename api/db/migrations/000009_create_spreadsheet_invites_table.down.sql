@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS spreadsheet_invite_redemptions;
+DROP TABLE IF EXISTS spreadsheet_invites;
@@ -0,0 +1,24 @@
+-- invites are links that add whoever redeems them as a collaborator of a sheet.
+-- max_uses is NULL for links that can be redeemed any number of times.
+CREATE TABLE IF NOT EXISTS spreadsheet_invites (
+    id VARCHAR(22) PRIMARY KEY,
+    sheet_id VARCHAR(22) NOT NULL REFERENCES spreadsheets (id) ON DELETE CASCADE,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('editor', 'viewer')),
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    max_uses INTEGER CHECK (max_uses > 0),
+    uses INTEGER NOT NULL DEFAULT 0,
+    revoked_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_spreadsheet_invites_sheet_id
+ON spreadsheet_invites (sheet_id);
+
+-- redemptions record who joined a sheet through which invite.
+CREATE TABLE IF NOT EXISTS spreadsheet_invite_redemptions (
+    invite_id VARCHAR(22) NOT NULL REFERENCES spreadsheet_invites (id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL,
+    redeemed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (invite_id, user_id)
+);
@@ -0,0 +1,4 @@
+-- columns holds the type definitions of the columns of a sheet as a JSON array,
+-- in the same order as its headers. It is NULL for sheets whose columns are all text.
+ALTER TABLE IF EXISTS spreadsheets
+ADD COLUMN columns JSONB NULL;
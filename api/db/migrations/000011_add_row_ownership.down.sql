@@ -0,0 +1,21 @@
+UPDATE spreadsheet_invites SET role = 'editor' WHERE role = 'manager';
+
+ALTER TABLE IF EXISTS spreadsheet_invites
+DROP CONSTRAINT IF EXISTS spreadsheet_invites_role_check;
+
+ALTER TABLE IF EXISTS spreadsheet_invites
+ADD CONSTRAINT spreadsheet_invites_role_check
+CHECK (role IN ('editor', 'viewer'));
+
+UPDATE spreadsheet_collaborators SET role = 'editor' WHERE role = 'manager';
+
+ALTER TABLE IF EXISTS spreadsheet_collaborators
+DROP CONSTRAINT IF EXISTS spreadsheet_collaborators_role_check;
+
+ALTER TABLE IF EXISTS spreadsheet_collaborators
+ADD CONSTRAINT spreadsheet_collaborators_role_check
+CHECK (role IN ('editor', 'viewer'));
+
+ALTER TABLE IF EXISTS spreadsheets
+DROP COLUMN IF EXISTS max_rows_per_user,
+DROP COLUMN IF EXISTS row_ownership;
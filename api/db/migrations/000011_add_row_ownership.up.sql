@@ -0,0 +1,20 @@
+-- in row ownership mode, contributors can only edit the rows they created.
+-- max_rows_per_user limits the rows each contributor can create, NULL for no limit.
+ALTER TABLE IF EXISTS spreadsheets
+ADD COLUMN row_ownership BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN max_rows_per_user INTEGER NULL CHECK (max_rows_per_user > 0);
+
+-- managers are editors who can edit every row of a sheet in row ownership mode.
+ALTER TABLE IF EXISTS spreadsheet_collaborators
+DROP CONSTRAINT IF EXISTS spreadsheet_collaborators_role_check;
+
+ALTER TABLE IF EXISTS spreadsheet_collaborators
+ADD CONSTRAINT spreadsheet_collaborators_role_check
+CHECK (role IN ('editor', 'manager', 'viewer'));
+
+ALTER TABLE IF EXISTS spreadsheet_invites
+DROP CONSTRAINT IF EXISTS spreadsheet_invites_role_check;
+
+ALTER TABLE IF EXISTS spreadsheet_invites
+ADD CONSTRAINT spreadsheet_invites_role_check
+CHECK (role IN ('editor', 'manager', 'viewer'));
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS spreadsheet_template_versions;
+DROP TABLE IF EXISTS spreadsheet_templates;
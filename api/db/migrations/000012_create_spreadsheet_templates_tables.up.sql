@@ -0,0 +1,32 @@
+-- templates are reusable structures of sheets, owned by a user and optionally shared
+-- with every user. Editing a template adds a version rather than changing the
+-- existing ones, so that sheets created from a template are never affected.
+CREATE TABLE IF NOT EXISTS spreadsheet_templates (
+    id VARCHAR(22) PRIMARY KEY,
+    owner VARCHAR(255) NOT NULL,
+    shared BOOLEAN NOT NULL DEFAULT FALSE,
+    latest_version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_spreadsheet_templates_owner
+ON spreadsheet_templates (owner);
+
+CREATE TRIGGER set_updated_at
+BEFORE UPDATE ON spreadsheet_templates
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- columns holds the definitions of the columns of the sheets created from a version,
+-- and deadline_offset_hours how long after their creation their deadline is by default.
+CREATE TABLE IF NOT EXISTS spreadsheet_template_versions (
+    template_id VARCHAR(22) NOT NULL REFERENCES spreadsheet_templates (id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    columns JSONB NOT NULL,
+    deadline_offset_hours INTEGER NOT NULL CHECK (deadline_offset_hours > 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (template_id, version)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS spreadsheet_comments;
+DROP TABLE IF EXISTS spreadsheet_comment_threads;
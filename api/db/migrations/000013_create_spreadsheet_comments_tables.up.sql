@@ -0,0 +1,41 @@
+-- comment threads are discussions anchored to a cell of a sheet, or to a whole row if
+-- col_index is NULL. Rows are indexed the same way as client edits, i.e. without the
+-- header row. created_by is the subject of the access token of the user who started it.
+CREATE TABLE IF NOT EXISTS spreadsheet_comment_threads (
+    id VARCHAR(22) PRIMARY KEY,
+    sheet_id VARCHAR(22) NOT NULL REFERENCES spreadsheets (id) ON DELETE CASCADE,
+    row_index INTEGER NOT NULL CHECK (row_index >= 0),
+    col_index INTEGER CHECK (col_index >= 0),
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolved_by VARCHAR(255) NULL,
+    resolved_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_spreadsheet_comment_threads_sheet_id
+ON spreadsheet_comment_threads (sheet_id);
+
+CREATE TRIGGER set_updated_at
+BEFORE UPDATE ON spreadsheet_comment_threads
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+-- comments are the messages of a thread, the first one being the one that started it.
+CREATE TABLE IF NOT EXISTS spreadsheet_comments (
+    id VARCHAR(22) PRIMARY KEY,
+    thread_id VARCHAR(22) NOT NULL REFERENCES spreadsheet_comment_threads (id) ON DELETE CASCADE,
+    author VARCHAR(255) NOT NULL,
+    author_name VARCHAR(255) NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_spreadsheet_comments_thread_id
+ON spreadsheet_comments (thread_id);
+
+CREATE TRIGGER set_updated_at
+BEFORE UPDATE ON spreadsheet_comments
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,5 @@
+-- row_owners maps the rows of a sheet in row ownership mode to the users who own them,
+-- saved along with the data of its live session. Rows are indexed as in the data, i.e.
+-- with the header row as row 0.
+ALTER TABLE IF EXISTS spreadsheets
+ADD COLUMN row_owners JSONB NULL;
@@ -0,0 +1,5 @@
+-- formats holds the formats of the columns and cells of a sheet, saved along with the
+-- data of its live session. It maps "col:<col>" for columns and "<row>:<col>" for cells,
+-- with the header row as row 0, to their format.
+ALTER TABLE IF EXISTS spreadsheets
+ADD COLUMN formats JSONB NULL;
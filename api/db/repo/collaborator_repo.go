@@ -0,0 +1,148 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/waynekn/tablesync/api/models"
+)
+
+// ErrCollaboratorExists is returned when adding a collaborator a sheet is already shared with.
+var ErrCollaboratorExists = errors.New("collaborator already exists")
+
+type CollaboratorRepo interface {
+	AddCollaborator(sheetID string, collaborator models.CollaboratorInit, addedBy string) (*models.Collaborator, error)
+	GetBySheet(sheetID string) (*[]models.Collaborator, error)
+	GetRole(sheetID, userID string) (string, error)
+	UpdateRole(sheetID, userID, role string) (*models.Collaborator, error)
+	RemoveCollaborator(sheetID, userID string) error
+}
+
+type collaboratorRepo struct {
+	db *sql.DB
+}
+
+// NewCollaboratorRepo creates a new instance of CollaboratorRepo
+// with the provided database connection.
+func NewCollaboratorRepo(db *sql.DB) CollaboratorRepo {
+	return &collaboratorRepo{db: db}
+}
+
+// AddCollaborator shares a spreadsheet with a user and returns the new collaborator.
+// It returns ErrCollaboratorExists if the sheet is already shared with the user.
+func (r *collaboratorRepo) AddCollaborator(sheetID string, collaborator models.CollaboratorInit, addedBy string) (*models.Collaborator, error) {
+	var c models.Collaborator
+
+	err := r.db.QueryRow(`INSERT INTO spreadsheet_collaborators
+		(sheet_id, user_id, role, added_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (sheet_id, user_id) DO NOTHING
+		RETURNING sheet_id, user_id, role, added_by, created_at, updated_at`,
+		sheetID, collaborator.UserID, collaborator.Role, addedBy).
+		Scan(&c.SheetID, &c.UserID, &c.Role, &c.AddedBy, &c.CreatedAt, &c.UpdatedAt)
+
+	if err != nil {
+		// nothing is returned when the insert conflicts with an existing collaborator
+		if err == sql.ErrNoRows {
+			return nil, ErrCollaboratorExists
+		}
+		slog.Error("Failed to add collaborator", "error", err)
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// GetBySheet retrieves the collaborators of a spreadsheet, oldest first.
+func (r *collaboratorRepo) GetBySheet(sheetID string) (*[]models.Collaborator, error) {
+	rows, err := r.db.Query(`SELECT sheet_id, user_id, role, added_by, created_at, updated_at
+		FROM spreadsheet_collaborators WHERE sheet_id = $1
+		ORDER BY created_at, user_id`,
+		sheetID)
+	if err != nil {
+		slog.Error("Failed to query collaborators", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	collaborators := make([]models.Collaborator, 0, 10)
+	for rows.Next() {
+		var c models.Collaborator
+		if err := rows.Scan(&c.SheetID, &c.UserID, &c.Role, &c.AddedBy, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			slog.Error("Failed to scan collaborator row", "error", err)
+			return nil, err
+		}
+		collaborators = append(collaborators, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error occurred during row iteration", "error", err)
+		return nil, err
+	}
+
+	return &collaborators, nil
+}
+
+// GetRole retrieves the role of a user in a spreadsheet.
+// It returns sql.ErrNoRows if the sheet is not shared with the user.
+func (r *collaboratorRepo) GetRole(sheetID, userID string) (string, error) {
+	var role string
+
+	err := r.db.QueryRow(`SELECT role FROM spreadsheet_collaborators
+		WHERE sheet_id = $1 AND user_id = $2`,
+		sheetID, userID).Scan(&role)
+
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("Failed to query collaborator role", "error", err)
+		}
+		return "", err
+	}
+
+	return role, nil
+}
+
+// UpdateRole changes the role of a collaborator and returns the updated collaborator.
+// It returns sql.ErrNoRows if the sheet is not shared with the user.
+func (r *collaboratorRepo) UpdateRole(sheetID, userID, role string) (*models.Collaborator, error) {
+	var c models.Collaborator
+
+	err := r.db.QueryRow(`UPDATE spreadsheet_collaborators SET role = $3
+		WHERE sheet_id = $1 AND user_id = $2
+		RETURNING sheet_id, user_id, role, added_by, created_at, updated_at`,
+		sheetID, userID, role).
+		Scan(&c.SheetID, &c.UserID, &c.Role, &c.AddedBy, &c.CreatedAt, &c.UpdatedAt)
+
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("Failed to update collaborator role", "error", err)
+		}
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// RemoveCollaborator stops sharing a spreadsheet with a user.
+// It returns sql.ErrNoRows if the sheet is not shared with the user.
+func (r *collaboratorRepo) RemoveCollaborator(sheetID, userID string) error {
+	res, err := r.db.Exec(`DELETE FROM spreadsheet_collaborators
+		WHERE sheet_id = $1 AND user_id = $2`,
+		sheetID, userID)
+	if err != nil {
+		slog.Error("Failed to remove collaborator", "error", err)
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to remove collaborator", "error", err)
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,261 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/core/collab"
+)
+
+type CommentRepo interface {
+	CreateThread(id, sheetID string, thread models.CommentThreadInit, commentID string, author collab.Author) (*models.CommentThread, error)
+	GetBySheet(sheetID string, resolved *bool) (*[]models.CommentThread, error)
+	GetThread(sheetID, threadID string) (*models.CommentThread, error)
+	AddComment(id, sheetID, threadID, body string, author collab.Author) (*models.CommentThread, error)
+	SetResolved(sheetID, threadID, resolvedBy string) (*models.CommentThread, error)
+}
+
+type commentRepo struct {
+	db *sql.DB
+}
+
+// NewCommentRepo creates a new instance of CommentRepo
+// with the provided database connection.
+func NewCommentRepo(db *sql.DB) CommentRepo {
+	return &commentRepo{db: db}
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// queryThreads retrieves the comment threads matching `where`, a condition on the
+// threads `t` and their comments `c`, with their comments. Threads are in the order they
+// were started.
+func queryThreads(ctx context.Context, q queryer, where string, args ...any) ([]models.CommentThread, error) {
+	rows, err := q.QueryContext(ctx, `SELECT t.id, t.sheet_id, t.row_index, t.col_index, t.created_by,
+		t.created_at, t.updated_at, t.resolved_by, t.resolved_at,
+		c.id, c.author, c.author_name, c.body, c.created_at, c.updated_at
+		FROM spreadsheet_comment_threads t
+		JOIN spreadsheet_comments c ON c.thread_id = t.id
+		WHERE `+where+`
+		ORDER BY t.created_at, t.id, c.created_at, c.id`,
+		args...)
+	if err != nil {
+		slog.Error("Failed to query comment threads", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	threads := make([]models.CommentThread, 0, 10)
+	for rows.Next() {
+		var thread models.CommentThread
+		var comment models.Comment
+		var col sql.NullInt32
+		var resolvedBy sql.NullString
+		var resolvedAt sql.NullTime
+
+		err := rows.Scan(&thread.ID, &thread.SheetID, &thread.Row, &col, &thread.CreatedBy,
+			&thread.CreatedAt, &thread.UpdatedAt, &resolvedBy, &resolvedAt,
+			&comment.ID, &comment.Author.ID, &comment.Author.Name, &comment.Body,
+			&comment.CreatedAt, &comment.UpdatedAt)
+		if err != nil {
+			slog.Error("Failed to scan comment row", "error", err)
+			return nil, err
+		}
+		comment.ThreadID = thread.ID
+
+		// the comments of a thread are on consecutive rows
+		if n := len(threads); n > 0 && threads[n-1].ID == thread.ID {
+			threads[n-1].Comments = append(threads[n-1].Comments, comment)
+			continue
+		}
+
+		if col.Valid {
+			c := int(col.Int32)
+			thread.Col = &c
+		}
+		if resolvedBy.Valid {
+			thread.ResolvedBy = &resolvedBy.String
+		}
+		if resolvedAt.Valid {
+			thread.ResolvedAt = &resolvedAt.Time
+		}
+		thread.Comments = []models.Comment{comment}
+		threads = append(threads, thread)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error occurred during row iteration", "error", err)
+		return nil, err
+	}
+
+	return threads, nil
+}
+
+// queryThread retrieves a comment thread of a spreadsheet with its comments, returning
+// sql.ErrNoRows if the sheet has no such thread.
+func queryThread(ctx context.Context, q queryer, sheetID, threadID string) (*models.CommentThread, error) {
+	threads, err := queryThreads(ctx, q, `t.sheet_id = $1 AND t.id = $2`, sheetID, threadID)
+	if err != nil {
+		return nil, err
+	}
+	if len(threads) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &threads[0], nil
+}
+
+// CreateThread starts a comment thread on a spreadsheet with a first comment by
+// `author`, and returns it.
+func (r *commentRepo) CreateThread(id, sheetID string, thread models.CommentThreadInit, commentID string, author collab.Author) (*models.CommentThread, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO spreadsheet_comment_threads
+		(id, sheet_id, row_index, col_index, created_by)
+		VALUES ($1, $2, $3, $4, $5)`,
+		id, sheetID, *thread.Row, thread.Col, author.ID)
+	if err != nil {
+		slog.Error("Failed to create comment thread", "error", err)
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO spreadsheet_comments
+		(id, thread_id, author, author_name, body)
+		VALUES ($1, $2, $3, $4, $5)`,
+		commentID, id, author.ID, author.Name, thread.Body)
+	if err != nil {
+		slog.Error("Failed to create comment", "error", err)
+		return nil, err
+	}
+
+	created, err := queryThread(ctx, tx, sheetID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Failed to commit transaction", "error", err)
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// GetBySheet retrieves the comment threads of a spreadsheet with their comments, in the
+// order they were started. If `resolved` is not nil, only the threads that are resolved,
+// or only the ones that are open, are retrieved.
+func (r *commentRepo) GetBySheet(sheetID string, resolved *bool) (*[]models.CommentThread, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	threads, err := queryThreads(ctx, r.db,
+		`t.sheet_id = $1 AND ($2::boolean IS NULL OR (t.resolved_at IS NOT NULL) = $2)`,
+		sheetID, resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	return &threads, nil
+}
+
+// GetThread retrieves a comment thread of a spreadsheet with its comments.
+// It returns sql.ErrNoRows if the sheet has no such thread.
+func (r *commentRepo) GetThread(sheetID, threadID string) (*models.CommentThread, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return queryThread(ctx, r.db, sheetID, threadID)
+}
+
+// AddComment adds a comment by `author` to a comment thread of a spreadsheet and returns
+// the thread. Resolved threads can be replied to, and remain resolved.
+// It returns sql.ErrNoRows if the sheet has no such thread.
+func (r *commentRepo) AddComment(id, sheetID, threadID, body string, author collab.Author) (*models.CommentThread, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// mark the thread as updated, which also checks that it exists
+	res, err := tx.ExecContext(ctx, `UPDATE spreadsheet_comment_threads SET updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND sheet_id = $2`, threadID, sheetID)
+	if err != nil {
+		slog.Error("Failed to update comment thread", "error", err)
+		return nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to update comment thread", "error", err)
+		return nil, err
+	}
+	if n == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO spreadsheet_comments
+		(id, thread_id, author, author_name, body)
+		VALUES ($1, $2, $3, $4, $5)`,
+		id, threadID, author.ID, author.Name, body)
+	if err != nil {
+		slog.Error("Failed to create comment", "error", err)
+		return nil, err
+	}
+
+	thread, err := queryThread(ctx, tx, sheetID, threadID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Failed to commit transaction", "error", err)
+		return nil, err
+	}
+
+	return thread, nil
+}
+
+// SetResolved marks a comment thread of a spreadsheet as resolved by the user
+// `resolvedBy`, or reopens it if `resolvedBy` is empty, and returns the thread.
+// It returns sql.ErrNoRows if the sheet has no such thread.
+func (r *commentRepo) SetResolved(sheetID, threadID, resolvedBy string) (*models.CommentThread, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := r.db.ExecContext(ctx, `UPDATE spreadsheet_comment_threads
+		SET resolved_by = NULLIF($3::text, ''),
+			resolved_at = CASE WHEN $3 = '' THEN NULL ELSE CURRENT_TIMESTAMP END
+		WHERE id = $1 AND sheet_id = $2`,
+		threadID, sheetID, resolvedBy)
+	if err != nil {
+		slog.Error("Failed to update comment thread", "error", err)
+		return nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to update comment thread", "error", err)
+		return nil, err
+	}
+	if n == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return queryThread(ctx, r.db, sheetID, threadID)
+}
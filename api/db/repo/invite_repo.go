@@ -0,0 +1,269 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/waynekn/tablesync/api/models"
+)
+
+// Errors returned when an invite cannot be redeemed.
+var (
+	ErrInviteExpired  = errors.New("invite has expired")
+	ErrInviteRevoked  = errors.New("invite has been revoked")
+	ErrInviteUsedUp   = errors.New("invite has reached its maximum number of uses")
+	ErrInviteOwner    = errors.New("the owner of a sheet cannot redeem its invites")
+	ErrInviteRedeemed = errors.New("invite has already been redeemed by the user")
+)
+
+type InviteRepo interface {
+	CreateInvite(id, sheetID string, invite models.InviteInit, createdBy string) (*models.Invite, error)
+	GetBySheet(sheetID string) (*[]models.Invite, error)
+	RevokeInvite(sheetID, inviteID string) error
+	RedeemInvite(inviteID, userID string) (*models.Invite, error)
+	GetRedemptions(sheetID string) (*[]models.InviteRedemption, error)
+}
+
+type inviteRepo struct {
+	db *sql.DB
+}
+
+// NewInviteRepo creates a new instance of InviteRepo
+// with the provided database connection.
+func NewInviteRepo(db *sql.DB) InviteRepo {
+	return &inviteRepo{db: db}
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanInvite scans a row selected with the columns of inviteColumns, followed by
+// any `extra` columns.
+func scanInvite(row rowScanner, extra ...any) (*models.Invite, error) {
+	var invite models.Invite
+	var maxUses sql.NullInt32
+	var revokedAt sql.NullTime
+
+	dest := []any{&invite.ID, &invite.SheetID, &invite.Role, &invite.CreatedBy, &invite.CreatedAt,
+		&invite.ExpiresAt, &maxUses, &invite.Uses, &revokedAt}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxUses.Valid {
+		n := int(maxUses.Int32)
+		invite.MaxUses = &n
+	}
+	if revokedAt.Valid {
+		invite.RevokedAt = &revokedAt.Time
+	}
+
+	return &invite, nil
+}
+
+const inviteColumns = `id, sheet_id, role, created_by, created_at, expires_at, max_uses, uses, revoked_at`
+
+// CreateInvite creates an invite to the spreadsheet and returns it.
+func (r *inviteRepo) CreateInvite(id, sheetID string, invite models.InviteInit, createdBy string) (*models.Invite, error) {
+	created, err := scanInvite(r.db.QueryRow(`INSERT INTO spreadsheet_invites
+		(id, sheet_id, role, created_by, expires_at, max_uses)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+inviteColumns,
+		id, sheetID, invite.Role, createdBy, invite.ExpiresAt.UTC(), invite.MaxUses))
+
+	if err != nil {
+		slog.Error("Failed to create invite", "error", err)
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// GetBySheet retrieves the invites to a spreadsheet, including the expired and revoked
+// ones, most recent first.
+func (r *inviteRepo) GetBySheet(sheetID string) (*[]models.Invite, error) {
+	rows, err := r.db.Query(`SELECT `+inviteColumns+`
+		FROM spreadsheet_invites WHERE sheet_id = $1
+		ORDER BY created_at DESC, id`,
+		sheetID)
+	if err != nil {
+		slog.Error("Failed to query invites", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := make([]models.Invite, 0, 10)
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			slog.Error("Failed to scan invite row", "error", err)
+			return nil, err
+		}
+		invites = append(invites, *invite)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error occurred during row iteration", "error", err)
+		return nil, err
+	}
+
+	return &invites, nil
+}
+
+// RevokeInvite revokes an invite so that it can no longer be redeemed. Collaborators
+// who already joined through it keep their access.
+// It returns sql.ErrNoRows if the sheet has no such invite that is not yet revoked.
+func (r *inviteRepo) RevokeInvite(sheetID, inviteID string) error {
+	res, err := r.db.Exec(`UPDATE spreadsheet_invites SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND sheet_id = $2 AND revoked_at IS NULL`,
+		inviteID, sheetID)
+	if err != nil {
+		slog.Error("Failed to revoke invite", "error", err)
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to revoke invite", "error", err)
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RedeemInvite adds the user `userID` as a collaborator of the invite's spreadsheet with
+// the role of the invite, records the redemption and returns the invite. Collaborators
+// only get the role of the invite if it ranks higher than theirs, e.g. an editor
+// redeeming a manager invite becomes a manager while one redeeming a viewer invite
+// remains an editor.
+//
+// It returns sql.ErrNoRows if the invite or its sheet does not exist, and one of
+// ErrInviteExpired, ErrInviteRevoked, ErrInviteUsedUp, ErrInviteOwner or
+// ErrInviteRedeemed if the invite cannot be redeemed by the user. Users can only
+// redeem an invite once, so that collaborators removed by the owner cannot rejoin
+// through the same invite.
+func (r *inviteRepo) RedeemInvite(inviteID, userID string) (*models.Invite, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// lock the invite so that concurrent redemptions cannot exceed its maximum uses
+	var owner string
+	invite, err := scanInvite(tx.QueryRowContext(ctx, `SELECT i.id, i.sheet_id, i.role, i.created_by,
+		i.created_at, i.expires_at, i.max_uses, i.uses, i.revoked_at, s.owner
+		FROM spreadsheet_invites i JOIN spreadsheets s ON s.id = i.sheet_id
+		WHERE i.id = $1 AND s.deleted_at IS NULL
+		FOR UPDATE OF i`, inviteID), &owner)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("Failed to query invite", "error", err)
+		}
+		return nil, err
+	}
+
+	if owner == userID {
+		return nil, ErrInviteOwner
+	}
+
+	var redeemed bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM spreadsheet_invite_redemptions
+		WHERE invite_id = $1 AND user_id = $2)`, inviteID, userID).Scan(&redeemed)
+	if err != nil {
+		slog.Error("Failed to query invite redemptions", "error", err)
+		return nil, err
+	}
+	if redeemed {
+		return nil, ErrInviteRedeemed
+	}
+
+	switch {
+	case invite.RevokedAt != nil:
+		return nil, ErrInviteRevoked
+	case !time.Now().UTC().Before(invite.ExpiresAt):
+		return nil, ErrInviteExpired
+	case invite.MaxUses != nil && invite.Uses >= *invite.MaxUses:
+		return nil, ErrInviteUsedUp
+	}
+
+	// roles are ranked by their position in the array
+	_, err = tx.ExecContext(ctx, `INSERT INTO spreadsheet_collaborators
+		(sheet_id, user_id, role, added_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (sheet_id, user_id) DO UPDATE SET role = EXCLUDED.role
+		WHERE array_position(ARRAY['viewer', 'editor', 'manager'], spreadsheet_collaborators.role::text)
+			< array_position(ARRAY['viewer', 'editor', 'manager'], EXCLUDED.role::text)`,
+		invite.SheetID, userID, invite.Role, invite.CreatedBy)
+	if err != nil {
+		slog.Error("Failed to add collaborator from invite", "error", err)
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO spreadsheet_invite_redemptions (invite_id, user_id)
+		VALUES ($1, $2)`, inviteID, userID)
+	if err != nil {
+		slog.Error("Failed to record invite redemption", "error", err)
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE spreadsheet_invites SET uses = uses + 1 WHERE id = $1`, inviteID)
+	if err != nil {
+		slog.Error("Failed to update invite uses", "error", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Failed to commit invite redemption", "error", err)
+		return nil, err
+	}
+
+	invite.Uses++
+	return invite, nil
+}
+
+// GetRedemptions retrieves who joined a spreadsheet through which of its invites,
+// most recent first.
+func (r *inviteRepo) GetRedemptions(sheetID string) (*[]models.InviteRedemption, error) {
+	rows, err := r.db.Query(`SELECT r.invite_id, r.user_id, r.redeemed_at
+		FROM spreadsheet_invite_redemptions r
+		JOIN spreadsheet_invites i ON i.id = r.invite_id
+		WHERE i.sheet_id = $1
+		ORDER BY r.redeemed_at DESC, r.user_id`,
+		sheetID)
+	if err != nil {
+		slog.Error("Failed to query invite redemptions", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	redemptions := make([]models.InviteRedemption, 0, 20)
+	for rows.Next() {
+		var redemption models.InviteRedemption
+		if err := rows.Scan(&redemption.InviteID, &redemption.UserID, &redemption.RedeemedAt); err != nil {
+			slog.Error("Failed to scan invite redemption row", "error", err)
+			return nil, err
+		}
+		redemptions = append(redemptions, redemption)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error occurred during row iteration", "error", err)
+		return nil, err
+	}
+
+	return &redemptions, nil
+}
@@ -0,0 +1,47 @@
+package repo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded or was
+// issued for a listing with a different sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// listCursor identifies the last spreadsheet of a page. The next page starts after
+// the spreadsheet with this sort value and ID, so pages stay consistent while
+// spreadsheets are created or deleted.
+type listCursor struct {
+	Sort  string    `json:"s"`
+	Order string    `json:"o"`
+	Value time.Time `json:"v"`
+	ID    string    `json:"id"`
+}
+
+// encode returns the opaque representation of the cursor handed to clients.
+func (c listCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeListCursor decodes a cursor returned by encode, checking that it was issued
+// for the same sort and order.
+func decodeListCursor(cursor, sort, order string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != sort || c.Order != order {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
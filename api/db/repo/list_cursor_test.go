@@ -0,0 +1,42 @@
+package repo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/waynekn/tablesync/api/models"
+)
+
+func TestListCursor(t *testing.T) {
+	cursor := listCursor{Sort: "created", Order: "desc", Value: time.Now().UTC(), ID: "abc"}
+	encoded := cursor.encode()
+
+	decoded, err := decodeListCursor(encoded, "created", "desc")
+	assert.NoError(t, err)
+	assert.True(t, cursor.Value.Equal(decoded.Value))
+	assert.Equal(t, cursor.ID, decoded.ID)
+
+	_, err = decodeListCursor(encoded, "deadline", "desc")
+	assert.ErrorIs(t, err, ErrInvalidCursor, "a cursor should only be valid for the sort it was issued for")
+
+	_, err = decodeListCursor(encoded, "created", "asc")
+	assert.ErrorIs(t, err, ErrInvalidCursor, "a cursor should only be valid for the order it was issued for")
+
+	_, err = decodeListCursor("not a cursor", "created", "desc")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, `50\% off\_sale \\ more`, escapeLike(`50% off_sale \ more`))
+}
+
+func TestListRejectsUnknownSortAndOrder(t *testing.T) {
+	s := &spreadsheetRepo{}
+
+	_, err := s.list("spreadsheets s", "'owner'", "s.owner = $1", "user", models.SpreadsheetListQuery{Sort: "title"})
+	assert.ErrorContains(t, err, "unknown sort")
+
+	_, err = s.list("spreadsheets s", "'owner'", "s.owner = $1", "user", models.SpreadsheetListQuery{Order: "asc; DROP TABLE spreadsheets"})
+	assert.ErrorContains(t, err, "unknown order", "the order should not reach the query")
+}
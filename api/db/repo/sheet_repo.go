@@ -1,15 +1,32 @@
 package repo
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/api/schema"
+	"github.com/waynekn/tablesync/core/collab"
 )
 
 type SpreadsheetRepo interface {
-	InsertSpreadsheet(sheet models.SpreadsheetInit, columns []byte, owner, id string) error
-	GetByOwner(owner string) (*[]models.Spreadsheet, error)
+	InsertSpreadsheet(sheet models.SpreadsheetInit, data []byte, owner, id string) error
+	GetByOwner(owner string, query models.SpreadsheetListQuery) (*models.SpreadsheetPage, error)
+	GetSharedWith(userID string, query models.SpreadsheetListQuery) (*models.SpreadsheetPage, error)
+	GetByID(id string) (*models.Spreadsheet, error)
+	UpdateSpreadsheet(id string, update models.SpreadsheetUpdate) (*models.Spreadsheet, error)
+	SaveData(id string, data []byte, owners models.RowOwners, formats models.Formats) error
+	ChangeColumns(id string, plan func(columns []collab.Column) (collab.ColumnChange, error)) (*models.Spreadsheet, error)
+	MoveToTrash(id string) error
+	GetTrashByOwner(owner string) ([]models.SpreadsheetSummary, error)
+	RestoreFromTrash(id, owner string) (*models.Spreadsheet, error)
+	PurgeTrash(retention time.Duration) (int64, error)
 }
 
 type spreadsheetRepo struct {
@@ -22,12 +39,19 @@ func NewSpreadsheetRepo(db *sql.DB) SpreadsheetRepo {
 	return &spreadsheetRepo{db: db}
 }
 
-// InsertSpreadsheet inserts a new spreadsheet into the database.
-func (s *spreadsheetRepo) InsertSpreadsheet(sheet models.SpreadsheetInit, columns []byte, owner, id string) error {
+// InsertSpreadsheet inserts a new spreadsheet into the database. `data` holds the headers
+// and initial rows of the sheet as a JSON [][]string.
+func (s *spreadsheetRepo) InsertSpreadsheet(sheet models.SpreadsheetInit, data []byte, owner, id string) error {
+	linkAccess := sheet.LinkAccess
+	if linkAccess == "" {
+		linkAccess = models.LinkAccessEdit
+	}
+
 	_, err := s.db.Exec(`INSERT INTO spreadsheets
-	 (id, owner, title, description, deadline, data)
-	  VALUES ($1, $2, $3, $4, $5, $6)`,
-		id, owner, sheet.Title, sheet.Description, sheet.Deadline, columns)
+	 (id, owner, title, description, deadline, data, link_access, columns, row_ownership, max_rows_per_user)
+	  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		id, owner, sheet.Title, sheet.Description, sheet.Deadline, data, linkAccess, sheet.ColumnDefs(),
+		sheet.RowOwnership, sheet.MaxRowsPerUser)
 
 	if err != nil {
 		slog.Error("Failed to create spreadsheet", "error", err)
@@ -36,22 +60,105 @@ func (s *spreadsheetRepo) InsertSpreadsheet(sheet models.SpreadsheetInit, column
 	return nil
 }
 
-// GetByOwner retrieves spreadsheets created by the `owner` from the db
-func (s *spreadsheetRepo) GetByOwner(owner string) (*[]models.Spreadsheet, error) {
-	rows, err := s.db.Query(`SELECT *
-		FROM spreadsheets WHERE owner = $1`,
-		owner)
+// sortColumns maps the sort options of a listing to the column they sort by.
+var sortColumns = map[string]string{
+	"created":  "created_at",
+	"updated":  "updated_at",
+	"deadline": "deadline",
+}
+
+// GetByOwner retrieves a page of the spreadsheets created by the `owner` from the db,
+// excluding the ones in the trash. The data of the spreadsheets is not retrieved.
+// It returns ErrInvalidCursor if the cursor of the query is invalid.
+func (s *spreadsheetRepo) GetByOwner(owner string, query models.SpreadsheetListQuery) (*models.SpreadsheetPage, error) {
+	return s.list(`spreadsheets s`, `'owner'`, "s.owner = $1", owner, query)
+}
+
+// GetSharedWith retrieves a page of the spreadsheets shared with the user `userID`,
+// along with the user's role in each of them, like GetByOwner.
+func (s *spreadsheetRepo) GetSharedWith(userID string, query models.SpreadsheetListQuery) (*models.SpreadsheetPage, error) {
+	return s.list(`spreadsheets s JOIN spreadsheet_collaborators c ON c.sheet_id = s.id`,
+		"c.role", "c.user_id = $1", userID, query)
+}
+
+// list retrieves a page of the spreadsheets in `from`, which must alias the spreadsheets
+// table as `s`, that match `condition`. `condition` may refer to `user` as $1, and
+// `role` is the expression selected as the role of the user.
+//
+// Pages are paginated with a cursor rather than an offset, and are ordered by the sort
+// column and then by ID so that spreadsheets with equal sort values are never skipped.
+func (s *spreadsheetRepo) list(from, role, condition, user string, query models.SpreadsheetListQuery) (*models.SpreadsheetPage, error) {
+	sort := query.Sort
+	if sort == "" {
+		sort = "created"
+	}
+	order := query.Order
+	if order == "" {
+		order = "desc"
+	}
+	limit := query.Limit
+	if limit <= 0 || limit > models.MaxListLimit {
+		limit = models.DefaultListLimit
+	}
+
+	column := sortColumns[sort]
+	if column == "" {
+		return nil, fmt.Errorf("unknown sort %q", sort)
+	}
+	if order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("unknown order %q", order)
+	}
+
+	conditions := []string{condition, "s.deleted_at IS NULL"}
+	args := []any{user}
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	switch query.Status {
+	case "open":
+		conditions = append(conditions, "s.deadline > "+arg(time.Now().UTC()))
+	case "closed":
+		conditions = append(conditions, "s.deadline <= "+arg(time.Now().UTC()))
+	}
+
+	if query.Search != "" {
+		conditions = append(conditions, "s.title ILIKE "+arg("%"+escapeLike(query.Search)+"%"))
+	}
+
+	if query.Cursor != "" {
+		cursor, err := decodeListCursor(query.Cursor, sort, order)
+		if err != nil {
+			return nil, err
+		}
+		cmp := "<"
+		if order == "asc" {
+			cmp = ">"
+		}
+		conditions = append(conditions,
+			fmt.Sprintf("(s.%s, s.id) %s (%s, %s)", column, cmp, arg(cursor.Value), arg(cursor.ID)))
+	}
+
+	// fetch one more than the limit to know whether there is a next page
+	rows, err := s.db.Query(fmt.Sprintf(`SELECT s.id, s.title, s.description, s.owner, s.created_at, s.updated_at,
+		s.deadline, s.link_access, %s
+		FROM %s WHERE %s
+		ORDER BY s.%s %s, s.id %s
+		LIMIT %s`,
+		role, from, strings.Join(conditions, " AND "), column, order, order, arg(limit+1)),
+		args...)
 	if err != nil {
 		slog.Error("Failed to query spreadsheets", "error", err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	spreadsheets := make([]models.Spreadsheet, 0, 20)
+	spreadsheets := make([]models.SpreadsheetSummary, 0, limit+1)
 	for rows.Next() {
-		var sheet models.Spreadsheet
+		var sheet models.SpreadsheetSummary
 		if err := rows.Scan(&sheet.ID, &sheet.Title, &sheet.Description, &sheet.Owner,
-			&sheet.CreatedAt, &sheet.UpdatedAt, &sheet.Data, &sheet.Deadline); err != nil {
+			&sheet.CreatedAt, &sheet.UpdatedAt, &sheet.Deadline, &sheet.LinkAccess, &sheet.Role); err != nil {
 			slog.Error("Failed to scan spreadsheet row", "error", err)
 			return nil, err
 		}
@@ -63,5 +170,298 @@ func (s *spreadsheetRepo) GetByOwner(owner string) (*[]models.Spreadsheet, error
 		return nil, err
 	}
 
-	return &spreadsheets, nil
+	page := &models.SpreadsheetPage{Items: spreadsheets}
+	if len(spreadsheets) > limit {
+		page.Items = spreadsheets[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = listCursor{Sort: sort, Order: order, Value: sortValue(last, sort), ID: last.ID}.encode()
+	}
+
+	return page, nil
+}
+
+// sortValue returns the value of the sort column of the spreadsheet.
+func sortValue(sheet models.SpreadsheetSummary, sort string) time.Time {
+	switch sort {
+	case "updated":
+		return sheet.UpdatedAt
+	case "deadline":
+		return sheet.Deadline
+	default:
+		return sheet.CreatedAt
+	}
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern so that `s` is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// GetByID retrieves a single spreadsheet by its ID from the db.
+// It returns sql.ErrNoRows if the spreadsheet does not exist or is in the trash.
+func (s *spreadsheetRepo) GetByID(id string) (*models.Spreadsheet, error) {
+	var sheet models.Spreadsheet
+
+	err := s.db.QueryRow(`SELECT id, title, description, owner, created_at, updated_at, data, deadline, link_access, columns,
+		row_ownership, max_rows_per_user, row_owners, formats
+		FROM spreadsheets WHERE id = $1 AND deleted_at IS NULL`, id).
+		Scan(&sheet.ID, &sheet.Title, &sheet.Description, &sheet.Owner,
+			&sheet.CreatedAt, &sheet.UpdatedAt, &sheet.Data, &sheet.Deadline, &sheet.LinkAccess, &sheet.Columns,
+			&sheet.RowOwnership, &sheet.MaxRowsPerUser, &sheet.RowOwners, &sheet.Formats)
+
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("Failed to query spreadsheet", "error", err)
+		}
+		return nil, err
+	}
+
+	return &sheet, nil
+}
+
+// UpdateSpreadsheet updates the metadata of a spreadsheet, leaving the fields that are
+// nil in `update` unchanged, and returns the updated spreadsheet. A MaxRowsPerUser of 0
+// removes the limit on the rows of each contributor.
+func (s *spreadsheetRepo) UpdateSpreadsheet(id string, update models.SpreadsheetUpdate) (*models.Spreadsheet, error) {
+	var sheet models.Spreadsheet
+
+	err := s.db.QueryRow(`UPDATE spreadsheets SET
+		title = COALESCE($2, title),
+		description = COALESCE($3, description),
+		deadline = COALESCE($4, deadline),
+		link_access = COALESCE($5, link_access),
+		row_ownership = COALESCE($6, row_ownership),
+		max_rows_per_user = CASE WHEN $7::INTEGER IS NULL THEN max_rows_per_user ELSE NULLIF($7, 0) END
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id, title, description, owner, created_at, updated_at, data, deadline, link_access, columns,
+		row_ownership, max_rows_per_user, row_owners, formats`,
+		id, update.Title, update.Description, update.Deadline, update.LinkAccess,
+		update.RowOwnership, update.MaxRowsPerUser).
+		Scan(&sheet.ID, &sheet.Title, &sheet.Description, &sheet.Owner,
+			&sheet.CreatedAt, &sheet.UpdatedAt, &sheet.Data, &sheet.Deadline, &sheet.LinkAccess, &sheet.Columns,
+			&sheet.RowOwnership, &sheet.MaxRowsPerUser, &sheet.RowOwners, &sheet.Formats)
+
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("Failed to update spreadsheet", "error", err)
+		}
+		return nil, err
+	}
+
+	return &sheet, nil
+}
+
+// SaveData replaces the data of a spreadsheet, headers included, the owners of its rows
+// and its formats, e.g. with those of its live editing session before the session is
+// removed. Spreadsheets in the trash can be saved too. It returns sql.ErrNoRows if the
+// spreadsheet does not exist.
+func (s *spreadsheetRepo) SaveData(id string, data []byte, owners models.RowOwners, formats models.Formats) error {
+	res, err := s.db.Exec(`UPDATE spreadsheets SET data = $2, row_owners = $3, formats = $4 WHERE id = $1`,
+		id, data, owners, formats)
+	if err != nil {
+		slog.Error("Failed to save spreadsheet data", "error", err)
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to save spreadsheet data", "error", err)
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ChangeColumns changes the columns of a spreadsheet and moves its data and formats along
+// with them, and returns the updated spreadsheet. `plan` is given the current columns of the
+// spreadsheet, titled after its headers, and returns the change to make. The spreadsheet
+// is locked meanwhile, so that concurrent changes are made one after the other.
+//
+// Comment threads on the cells of a column that is moved follow it, and the threads on
+// the cells of a column that is deleted are kept on their rows.
+//
+// Errors returned by `plan` are returned as they are. It returns sql.ErrNoRows if the
+// spreadsheet does not exist or is in the trash.
+func (s *spreadsheetRepo) ChangeColumns(id string, plan func(columns []collab.Column) (collab.ColumnChange, error)) (*models.Spreadsheet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var raw []byte
+	var columns models.Columns
+	var formats models.Formats
+	err = tx.QueryRowContext(ctx, `SELECT data, columns, formats FROM spreadsheets
+		WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, id).Scan(&raw, &columns, &formats)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("Failed to query spreadsheet", "error", err)
+		}
+		return nil, err
+	}
+
+	var data [][]string
+	if err := json.Unmarshal(raw, &data); err != nil {
+		slog.Error("Failed to unmarshal sheet data", "sheetID", id, "error", err)
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("sheet has no column headers")
+	}
+
+	change, err := plan(schema.Of(columns, data[0]))
+	if err != nil {
+		return nil, err
+	}
+
+	data[0] = change.Headers()
+	for i, row := range data[1:] {
+		data[i+1] = change.MoveRow(row)
+	}
+	raw, err = json.Marshal(data)
+	if err != nil {
+		slog.Error("Failed to marshal sheet data", "sheetID", id, "error", err)
+		return nil, err
+	}
+
+	formats = models.FormatsFromFields(change.MoveFormats(formats.Fields()))
+
+	var sheet models.Spreadsheet
+	err = tx.QueryRowContext(ctx, `UPDATE spreadsheets SET data = $2, columns = $3, formats = $4
+		WHERE id = $1
+		RETURNING id, title, description, owner, created_at, updated_at, data, deadline, link_access, columns,
+		row_ownership, max_rows_per_user, row_owners, formats`,
+		id, raw, schema.Stored(change.Columns), formats).
+		Scan(&sheet.ID, &sheet.Title, &sheet.Description, &sheet.Owner,
+			&sheet.CreatedAt, &sheet.UpdatedAt, &sheet.Data, &sheet.Deadline, &sheet.LinkAccess, &sheet.Columns,
+			&sheet.RowOwnership, &sheet.MaxRowsPerUser, &sheet.RowOwners, &sheet.Formats)
+	if err != nil {
+		slog.Error("Failed to update spreadsheet columns", "error", err)
+		return nil, err
+	}
+
+	moves, err := json.Marshal(change.Moves)
+	if err != nil {
+		slog.Error("Failed to marshal column moves", "sheetID", id, "error", err)
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE spreadsheet_comment_threads
+		SET col_index = NULLIF(($2::jsonb ->> col_index)::integer, -1)
+		WHERE sheet_id = $1 AND col_index < jsonb_array_length($2::jsonb)
+		AND ($2::jsonb ->> col_index)::integer <> col_index`,
+		id, string(moves))
+	if err != nil {
+		slog.Error("Failed to move comment threads", "error", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Failed to commit transaction", "error", err)
+		return nil, err
+	}
+
+	return &sheet, nil
+}
+
+// MoveToTrash soft deletes a spreadsheet so that it can be restored until it is purged.
+// It returns sql.ErrNoRows if the spreadsheet does not exist or is already in the trash.
+func (s *spreadsheetRepo) MoveToTrash(id string) error {
+	res, err := s.db.Exec(`UPDATE spreadsheets SET deleted_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		slog.Error("Failed to move spreadsheet to trash", "error", err)
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to move spreadsheet to trash", "error", err)
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetTrashByOwner retrieves the spreadsheets of the `owner` that are in the trash,
+// most recently deleted first. Like GetByOwner, the data of the spreadsheets is not
+// retrieved.
+func (s *spreadsheetRepo) GetTrashByOwner(owner string) ([]models.SpreadsheetSummary, error) {
+	rows, err := s.db.Query(`SELECT id, title, description, owner, created_at, updated_at, deadline, link_access,
+		'owner', deleted_at
+		FROM spreadsheets WHERE owner = $1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC`,
+		owner)
+	if err != nil {
+		slog.Error("Failed to query trashed spreadsheets", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	spreadsheets := make([]models.SpreadsheetSummary, 0, 20)
+	for rows.Next() {
+		var sheet models.SpreadsheetSummary
+		if err := rows.Scan(&sheet.ID, &sheet.Title, &sheet.Description, &sheet.Owner,
+			&sheet.CreatedAt, &sheet.UpdatedAt, &sheet.Deadline, &sheet.LinkAccess,
+			&sheet.Role, &sheet.DeletedAt); err != nil {
+			slog.Error("Failed to scan spreadsheet row", "error", err)
+			return nil, err
+		}
+		spreadsheets = append(spreadsheets, sheet)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error occurred during row iteration", "error", err)
+		return nil, err
+	}
+
+	return spreadsheets, nil
+}
+
+// RestoreFromTrash restores a spreadsheet of the `owner` from the trash and returns it.
+// It returns sql.ErrNoRows if the owner has no such spreadsheet in the trash.
+func (s *spreadsheetRepo) RestoreFromTrash(id, owner string) (*models.Spreadsheet, error) {
+	var sheet models.Spreadsheet
+
+	err := s.db.QueryRow(`UPDATE spreadsheets SET deleted_at = NULL
+		WHERE id = $1 AND owner = $2 AND deleted_at IS NOT NULL
+		RETURNING id, title, description, owner, created_at, updated_at, data, deadline, link_access, columns,
+		row_ownership, max_rows_per_user, row_owners, formats`,
+		id, owner).
+		Scan(&sheet.ID, &sheet.Title, &sheet.Description, &sheet.Owner,
+			&sheet.CreatedAt, &sheet.UpdatedAt, &sheet.Data, &sheet.Deadline, &sheet.LinkAccess, &sheet.Columns,
+			&sheet.RowOwnership, &sheet.MaxRowsPerUser, &sheet.RowOwners, &sheet.Formats)
+
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("Failed to restore spreadsheet", "error", err)
+		}
+		return nil, err
+	}
+
+	return &sheet, nil
+}
+
+// PurgeTrash permanently deletes the spreadsheets that have been in the trash for
+// longer than `retention` and returns how many were deleted.
+func (s *spreadsheetRepo) PurgeTrash(retention time.Duration) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM spreadsheets
+		WHERE deleted_at < CURRENT_TIMESTAMP - make_interval(secs => $1)`,
+		retention.Seconds())
+	if err != nil {
+		slog.Error("Failed to purge trashed spreadsheets", "error", err)
+		return 0, err
+	}
+
+	return res.RowsAffected()
 }
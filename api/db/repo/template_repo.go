@@ -0,0 +1,257 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/waynekn/tablesync/api/models"
+)
+
+type TemplateRepo interface {
+	CreateTemplate(template models.Template) (*models.Template, error)
+	GetTemplate(id string, version int) (*models.Template, error)
+	GetVersions(id string) (*[]models.Template, error)
+	GetAvailable(userID string) (*[]models.Template, error)
+	UpdateTemplate(id string, update models.TemplateUpdate) (*models.Template, error)
+	DeleteTemplate(id string) error
+}
+
+type templateRepo struct {
+	db *sql.DB
+}
+
+// NewTemplateRepo creates a new instance of TemplateRepo
+// with the provided database connection.
+func NewTemplateRepo(db *sql.DB) TemplateRepo {
+	return &templateRepo{db: db}
+}
+
+// templateColumns are the columns of a template `t` joined with one of its versions `v`,
+// as scanned by scanTemplate.
+const templateColumns = `t.id, t.owner, t.shared, t.latest_version, t.created_at,
+	v.version, v.title, v.description, v.columns, v.deadline_offset_hours, v.created_at`
+
+const templateTables = `spreadsheet_templates t
+	JOIN spreadsheet_template_versions v ON v.template_id = t.id`
+
+// scanTemplate scans a row selected with the columns of templateColumns.
+func scanTemplate(row rowScanner) (*models.Template, error) {
+	var template models.Template
+	err := row.Scan(&template.ID, &template.Owner, &template.Shared, &template.LatestVersion,
+		&template.CreatedAt, &template.Version, &template.Title, &template.Description,
+		&template.Columns, &template.DeadlineOffsetHours, &template.VersionCreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// scanTemplates scans every row selected with the columns of templateColumns.
+func scanTemplates(rows *sql.Rows) (*[]models.Template, error) {
+	defer rows.Close()
+
+	templates := make([]models.Template, 0, 10)
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			slog.Error("Failed to scan template row", "error", err)
+			return nil, err
+		}
+		templates = append(templates, *template)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Error occurred during row iteration", "error", err)
+		return nil, err
+	}
+
+	return &templates, nil
+}
+
+// CreateTemplate creates a template with the ID, owner and sharing of `template`, and
+// a first version with its other fields, and returns it.
+func (r *templateRepo) CreateTemplate(template models.Template) (*models.Template, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO spreadsheet_templates (id, owner, shared, latest_version)
+		VALUES ($1, $2, $3, 1)`,
+		template.ID, template.Owner, template.Shared)
+	if err != nil {
+		slog.Error("Failed to create template", "error", err)
+		return nil, err
+	}
+
+	template.Version = 1
+	if err := insertTemplateVersion(ctx, tx, template); err != nil {
+		return nil, err
+	}
+
+	created, err := scanTemplate(tx.QueryRowContext(ctx, `SELECT `+templateColumns+`
+		FROM `+templateTables+` WHERE t.id = $1 AND v.version = 1`, template.ID))
+	if err != nil {
+		slog.Error("Failed to query created template", "error", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Failed to commit transaction", "error", err)
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// insertTemplateVersion inserts the version of `template` with the given number.
+func insertTemplateVersion(ctx context.Context, tx *sql.Tx, template models.Template) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO spreadsheet_template_versions
+		(template_id, version, title, description, columns, deadline_offset_hours)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		template.ID, template.Version, template.Title, template.Description, template.Columns,
+		template.DeadlineOffsetHours)
+	if err != nil {
+		slog.Error("Failed to create template version", "error", err)
+	}
+	return err
+}
+
+// GetTemplate retrieves a version of a template, or its latest version if `version`
+// is 0. It returns sql.ErrNoRows if there is no such template or version.
+func (r *templateRepo) GetTemplate(id string, version int) (*models.Template, error) {
+	template, err := scanTemplate(r.db.QueryRow(`SELECT `+templateColumns+`
+		FROM `+templateTables+`
+		WHERE t.id = $1 AND v.version = CASE WHEN $2 = 0 THEN t.latest_version ELSE $2 END`,
+		id, version))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("Failed to query template", "error", err)
+		}
+		return nil, err
+	}
+	return template, nil
+}
+
+// GetVersions retrieves every version of a template, latest first.
+func (r *templateRepo) GetVersions(id string) (*[]models.Template, error) {
+	rows, err := r.db.Query(`SELECT `+templateColumns+`
+		FROM `+templateTables+` WHERE t.id = $1
+		ORDER BY v.version DESC`,
+		id)
+	if err != nil {
+		slog.Error("Failed to query template versions", "error", err)
+		return nil, err
+	}
+	return scanTemplates(rows)
+}
+
+// GetAvailable retrieves the latest version of the templates the user `userID` can use,
+// i.e. their own and the shared ones, most recently updated first.
+func (r *templateRepo) GetAvailable(userID string) (*[]models.Template, error) {
+	rows, err := r.db.Query(`SELECT `+templateColumns+`
+		FROM `+templateTables+`
+		WHERE v.version = t.latest_version AND (t.owner = $1 OR t.shared)
+		ORDER BY t.updated_at DESC, t.id`,
+		userID)
+	if err != nil {
+		slog.Error("Failed to query templates", "error", err)
+		return nil, err
+	}
+	return scanTemplates(rows)
+}
+
+// UpdateTemplate applies an update to a template and returns its latest version. Updates
+// to fields other than Shared add a version, see models.TemplateUpdate. It returns
+// sql.ErrNoRows if the template does not exist.
+func (r *templateRepo) UpdateTemplate(id string, update models.TemplateUpdate) (*models.Template, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Failed to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// lock the template so that concurrent updates cannot add the same version
+	latest, err := scanTemplate(tx.QueryRowContext(ctx, `SELECT `+templateColumns+`
+		FROM `+templateTables+`
+		WHERE t.id = $1 AND v.version = t.latest_version
+		FOR UPDATE OF t`, id))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("Failed to query template", "error", err)
+		}
+		return nil, err
+	}
+
+	if update.Versioned() {
+		latest.Version++
+		if update.Title != nil {
+			latest.Title = *update.Title
+		}
+		if update.Description != nil {
+			latest.Description = *update.Description
+		}
+		if update.Columns != nil {
+			latest.Columns = update.ColumnDefs()
+		}
+		if update.DeadlineOffsetHours != nil {
+			latest.DeadlineOffsetHours = *update.DeadlineOffsetHours
+		}
+		if err := insertTemplateVersion(ctx, tx, *latest); err != nil {
+			return nil, err
+		}
+	}
+
+	updated, err := scanTemplate(tx.QueryRowContext(ctx, `WITH t AS (
+			UPDATE spreadsheet_templates SET shared = COALESCE($2, shared), latest_version = $3
+			WHERE id = $1
+			RETURNING *
+		)
+		SELECT `+templateColumns+`
+		FROM t JOIN spreadsheet_template_versions v ON v.template_id = t.id
+		WHERE v.version = t.latest_version`,
+		id, update.Shared, latest.Version))
+	if err != nil {
+		slog.Error("Failed to update template", "error", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Failed to commit transaction", "error", err)
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// DeleteTemplate deletes a template and all of its versions. Spreadsheets created from
+// it are not affected. It returns sql.ErrNoRows if the template does not exist.
+func (r *templateRepo) DeleteTemplate(id string) error {
+	res, err := r.db.Exec(`DELETE FROM spreadsheet_templates WHERE id = $1`, id)
+	if err != nil {
+		slog.Error("Failed to delete template", "error", err)
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		slog.Error("Failed to delete template", "error", err)
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
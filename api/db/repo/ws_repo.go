@@ -9,6 +9,7 @@ import (
 
 type WsRepo interface {
 	GetSheetByID(sheetID string) (*models.Spreadsheet, error)
+	GetCollaboratorRole(sheetID, userID string) (string, error)
 }
 
 type wsRepo struct {
@@ -23,13 +24,16 @@ func NewWsRepo(db *sql.DB) WsRepo {
 }
 
 // GetSheetByID retrieves a spreadsheet by its ID from the database.
+// Spreadsheets in the trash are treated as if they do not exist.
 func (ws *wsRepo) GetSheetByID(sheetID string) (*models.Spreadsheet, error) {
 	var sheet models.Spreadsheet
 
-	err := ws.db.QueryRow(`SELECT id, title, description, owner, created_at, updated_at, data, deadline 
-                           FROM spreadsheets WHERE id = $1`, sheetID).
+	err := ws.db.QueryRow(`SELECT id, title, description, owner, created_at, updated_at, data, deadline, link_access, columns,
+                           row_ownership, max_rows_per_user, row_owners, formats
+                           FROM spreadsheets WHERE id = $1 AND deleted_at IS NULL`, sheetID).
 		Scan(&sheet.ID, &sheet.Title, &sheet.Description, &sheet.Owner,
-			&sheet.CreatedAt, &sheet.UpdatedAt, &sheet.Data, &sheet.Deadline)
+			&sheet.CreatedAt, &sheet.UpdatedAt, &sheet.Data, &sheet.Deadline, &sheet.LinkAccess, &sheet.Columns,
+			&sheet.RowOwnership, &sheet.MaxRowsPerUser, &sheet.RowOwners, &sheet.Formats)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -41,3 +45,23 @@ func (ws *wsRepo) GetSheetByID(sheetID string) (*models.Spreadsheet, error) {
 
 	return &sheet, nil
 }
+
+// GetCollaboratorRole retrieves the role of a user the spreadsheet is shared with.
+// It returns sql.ErrNoRows if the sheet is not shared with the user.
+func (ws *wsRepo) GetCollaboratorRole(sheetID, userID string) (string, error) {
+	var role string
+
+	err := ws.db.QueryRow(`SELECT role FROM spreadsheet_collaborators
+                           WHERE sheet_id = $1 AND user_id = $2`, sheetID, userID).
+		Scan(&role)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", err
+		}
+		slog.Error("Failed to query collaborator role", "err", err)
+		return "", err
+	}
+
+	return role, nil
+}
@@ -0,0 +1,116 @@
+// Package export writes the contents of spreadsheets in formats that other
+// applications can read.
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Delimiters supported by CSV exports.
+const (
+	DelimiterComma     = "comma"
+	DelimiterSemicolon = "semicolon"
+	DelimiterTab       = "tab"
+	DelimiterPipe      = "pipe"
+)
+
+// Encodings supported by CSV exports. EncodingUTF8BOM prefixes the output with a byte
+// order mark, which Excel needs to detect UTF-8.
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF8BOM     = "utf-8-bom"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingWindows1252 = "windows-1252"
+)
+
+var ErrUnsupportedOption = errors.New("unsupported export option")
+
+var delimiters = map[string]rune{
+	"":                 ',',
+	DelimiterComma:     ',',
+	DelimiterSemicolon: ';',
+	DelimiterTab:       '\t',
+	DelimiterPipe:      '|',
+}
+
+var encodings = map[string]encoding.Encoding{
+	"":              unicode.UTF8,
+	EncodingUTF8:    unicode.UTF8,
+	EncodingUTF8BOM: unicode.UTF8BOM,
+	// with a byte order mark so that readers can tell the byte order
+	EncodingUTF16LE:     unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	EncodingWindows1252: charmap.Windows1252,
+}
+
+// CSVOptions configures a CSV export. The zero value writes comma separated UTF-8.
+type CSVOptions struct {
+	Delimiter string // one of the Delimiter constants
+	Encoding  string // one of the Encoding constants
+}
+
+// WriteCSV writes the rows of a sheet, headers included, to w as CSV.
+// Cells that a spreadsheet application would evaluate as formulas are escaped with
+// EscapeFormula. It returns ErrUnsupportedOption for unknown options.
+func WriteCSV(w io.Writer, rows [][]string, opts CSVOptions) error {
+	delimiter, ok := delimiters[opts.Delimiter]
+	if !ok {
+		return ErrUnsupportedOption
+	}
+	enc, ok := encodings[opts.Encoding]
+	if !ok {
+		return ErrUnsupportedOption
+	}
+
+	// characters that cannot be encoded are replaced rather than failing the export
+	encoded := encoding.ReplaceUnsupported(enc.NewEncoder()).Writer(w)
+	writer := csv.NewWriter(encoded)
+	writer.Comma = delimiter
+	// Excel expects CRLF line endings
+	writer.UseCRLF = true
+
+	record := make([]string, 0)
+	for _, row := range rows {
+		record = record[:0]
+		for _, cell := range row {
+			record = append(record, EscapeFormula(cell))
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// EscapeFormula protects against formula injection (also known as CSV injection) by
+// prefixing a cell that starts with a character that spreadsheet applications treat as
+// the start of a formula with a single quote, so that it is shown as text.
+// Numbers such as -1 or +254 are left as they are.
+func EscapeFormula(cell string) string {
+	if cell == "" || !strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return cell
+	}
+	if isDecimal(cell) {
+		return cell
+	}
+	return "'" + cell
+}
+
+// isDecimal reports whether s is a number in decimal notation. Unlike strconv.ParseFloat
+// it rejects values such as "-Inf" or hexadecimal floats.
+func isDecimal(s string) bool {
+	if strings.Trim(s, "0123456789.eE+-") != "" {
+		return false
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
@@ -0,0 +1,79 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeFormula(t *testing.T) {
+	tests := []struct {
+		cell string
+		want string
+	}{
+		{"", ""},
+		{"plain text", "plain text"},
+		{"=HYPERLINK(\"http://evil.example\")", "'=HYPERLINK(\"http://evil.example\")"},
+		{"+cmd|' /C calc'!A0", "'+cmd|' /C calc'!A0"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1:A2)", "'@SUM(A1:A2)"},
+		{"\t=1+1", "'\t=1+1"},
+		{"-1", "-1"},
+		{"+254712345678", "+254712345678"},
+		{"-1.5e3", "-1.5e3"},
+		{"-Inf", "'-Inf"},
+		{"a=1", "a=1"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, EscapeFormula(tt.cell), "cell %q", tt.cell)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	rows := [][]string{{"name", "note"}, {"Amélie", "=1+1"}, {"Bob", "says \"hi\", twice"}}
+
+	tests := []struct {
+		name string
+		opts CSVOptions
+		want []byte
+	}{
+		{
+			name: "defaults",
+			opts: CSVOptions{},
+			want: []byte("name,note\r\nAmélie,'=1+1\r\nBob,\"says \"\"hi\"\", twice\"\r\n"),
+		},
+		{
+			name: "semicolon with bom",
+			opts: CSVOptions{Delimiter: DelimiterSemicolon, Encoding: EncodingUTF8BOM},
+			want: []byte("\xef\xbb\xbfname;note\r\nAmélie;'=1+1\r\nBob;\"says \"\"hi\"\", twice\"\r\n"),
+		},
+		{
+			name: "windows-1252",
+			opts: CSVOptions{Delimiter: DelimiterTab, Encoding: EncodingWindows1252},
+			want: []byte("name\tnote\r\nAm\xe9lie\t'=1+1\r\nBob\t\"says \"\"hi\"\", twice\"\r\n"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteCSV(&buf, rows, tt.opts)
+			assert.NoError(t, err, "WriteCSV should not return an error")
+			assert.Equal(t, tt.want, buf.Bytes())
+		})
+	}
+
+	t.Run("utf-16le", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := WriteCSV(&buf, [][]string{{"a"}}, CSVOptions{Encoding: EncodingUTF16LE})
+		assert.NoError(t, err, "WriteCSV should not return an error")
+		assert.Equal(t, []byte{0xff, 0xfe, 'a', 0, '\r', 0, '\n', 0}, buf.Bytes())
+	})
+
+	t.Run("unsupported option", func(t *testing.T) {
+		err := WriteCSV(&bytes.Buffer{}, rows, CSVOptions{Delimiter: "colon"})
+		assert.ErrorIs(t, err, ErrUnsupportedOption)
+	})
+}
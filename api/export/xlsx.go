@@ -0,0 +1,211 @@
+package export
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/waynekn/tablesync/core/collab"
+	"github.com/xuri/excelize/v2"
+)
+
+// Bounds of the column widths of XLSX exports, in characters.
+const (
+	minColumnWidth = 8
+	maxColumnWidth = 60
+)
+
+// maxWorksheetName is the maximum length of a worksheet name allowed by Excel.
+const maxWorksheetName = 31
+
+// textFormat is the built-in "@" number format, which makes Excel treat a cell as
+// text even after it is edited.
+const textFormat = 49
+
+// numberPattern matches the values of cells with a number format that are written as
+// numbers rather than text.
+var numberPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// RowIterator calls fn with the index and cells of each data row of a sheet, in order,
+// stopping at the first error fn returns. Rows are indexed without the header row.
+type RowIterator func(fn func(index int, row []string) error) error
+
+// WriteXLSX writes a sheet with the given headers and rows to w as an Excel workbook
+// with a single worksheet named after `title`.
+//
+// The header row is bold and frozen, the columns are as wide as their content, and every
+// cell is written as text so that values such as IDs with leading zeros are preserved.
+// Cells are styled after their format in `formats` (see collab.Formats.Of), and the
+// numbers and dates of cells with a number format are written as such so that the format
+// applies to them.
+//
+// The rows are iterated twice, once to size the columns and once to write them, and are
+// streamed to a temporary file once the workbook grows large, so that the sheet is never
+// held in memory as a whole.
+func WriteXLSX(w io.Writer, title string, headers []string, rows RowIterator, formats collab.Formats) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	name := worksheetName(title)
+	if err := f.SetSheetName("Sheet1", name); err != nil {
+		return err
+	}
+
+	sw, err := f.NewStreamWriter(name)
+	if err != nil {
+		return err
+	}
+
+	textStyle, err := f.NewStyle(&excelize.Style{NumFmt: textFormat})
+	if err != nil {
+		return err
+	}
+	headerStyle, err := f.NewStyle(&excelize.Style{NumFmt: textFormat, Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+
+	// cells with the same format share a style
+	styles := map[collab.Format]int{{}: textStyle}
+	styleOf := func(format collab.Format) (int, error) {
+		if id, ok := styles[format]; ok {
+			return id, nil
+		}
+		id, err := f.NewStyle(cellStyle(format))
+		if err != nil {
+			return 0, err
+		}
+		styles[format] = id
+		return id, nil
+	}
+
+	// column widths must be set before the first row is written
+	widths := columnWidths(nil, headers)
+	err = rows(func(_ int, row []string) error {
+		widths = columnWidths(widths, row)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, width := range widths {
+		if err := sw.SetColWidth(i+1, i+1, width); err != nil {
+			return err
+		}
+	}
+	err = sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+	if err != nil {
+		return err
+	}
+
+	values := make([]any, len(headers))
+	for j, header := range headers {
+		values[j] = excelize.Cell{StyleID: headerStyle, Value: header}
+	}
+	if err := sw.SetRow("A1", values); err != nil {
+		return err
+	}
+
+	err = rows(func(index int, row []string) error {
+		// the headers are the first row of both the sheet and the worksheet
+		i := index + 1
+		values := make([]any, len(row))
+		for j, cell := range row {
+			format := formats.Of(i, j)
+			style, err := styleOf(format)
+			if err != nil {
+				return err
+			}
+			values[j] = excelize.Cell{StyleID: style, Value: cellValue(cell, format)}
+		}
+
+		ref, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return err
+		}
+		return sw.SetRow(ref, values)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+
+	_, err = f.WriteTo(w)
+	return err
+}
+
+// cellStyle returns the style of cells with the given format.
+func cellStyle(format collab.Format) *excelize.Style {
+	style := &excelize.Style{NumFmt: textFormat, Font: &excelize.Font{Bold: format.Bold}}
+	if format.NumberFormat != "" {
+		style.CustomNumFmt = &format.NumberFormat
+	}
+	if format.Color != "" {
+		style.Font.Color = strings.TrimPrefix(format.Color, "#")
+	}
+	if format.Background != "" {
+		style.Fill = excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{strings.TrimPrefix(format.Background, "#")}}
+	}
+	if format.Align != "" {
+		style.Alignment = &excelize.Alignment{Horizontal: format.Align}
+	}
+	return style
+}
+
+// cellValue returns the value a cell is written with. Cells are written as text, except
+// for the numbers and dates (see collab.DateFormat) of cells with a number format.
+func cellValue(value string, format collab.Format) any {
+	if format.NumberFormat == "" {
+		return value
+	}
+	if numberPattern.MatchString(value) {
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	}
+	if date, err := time.Parse(collab.DateFormat, value); err == nil {
+		return date
+	}
+	return value
+}
+
+// columnWidths widens the columns of `widths` to fit the cells of a row, within the
+// bounds of minColumnWidth and maxColumnWidth, adding the columns it does not have yet.
+func columnWidths(widths []float64, row []string) []float64 {
+	for i, cell := range row {
+		if i == len(widths) {
+			widths = append(widths, minColumnWidth)
+		}
+		// leave room for padding around the content
+		width := float64(utf8.RuneCountInString(cell) + 2)
+		widths[i] = min(max(widths[i], width), maxColumnWidth)
+	}
+	return widths
+}
+
+// worksheetName returns a worksheet name for a sheet titled `title`, with the characters
+// Excel does not allow in worksheet names replaced and shortened to its maximum length.
+func worksheetName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	// worksheet names cannot start or end with an apostrophe
+	name = strings.Trim(name, "'")
+
+	if utf8.RuneCountInString(name) > maxWorksheetName {
+		name = strings.TrimSpace(string([]rune(name)[:maxWorksheetName]))
+	}
+	if name == "" {
+		return "Sheet1"
+	}
+	return name
+}
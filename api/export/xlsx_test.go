@@ -0,0 +1,132 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/waynekn/tablesync/core/collab"
+	"github.com/xuri/excelize/v2"
+)
+
+// eachRow returns a RowIterator over the data rows of `rows`, whose first row holds the
+// headers.
+func eachRow(rows [][]string) RowIterator {
+	return func(fn func(index int, row []string) error) error {
+		for i, row := range rows[1:] {
+			if err := fn(i, row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	rows := [][]string{{"id", "name"}, {"007", "=1+1"}, {"12", strings.Repeat("x", 100)}}
+
+	var buf bytes.Buffer
+	err := WriteXLSX(&buf, "Class list: 2025", rows[0], eachRow(rows), collab.Formats{})
+	assert.NoError(t, err, "WriteXLSX should not return an error")
+
+	f, err := excelize.OpenReader(&buf)
+	assert.NoError(t, err, "Failed to open the workbook")
+	defer f.Close()
+
+	assert.Equal(t, []string{"Class list_ 2025"}, f.GetSheetList())
+	sheet := f.GetSheetList()[0]
+
+	got, err := f.GetRows(sheet)
+	assert.NoError(t, err, "Failed to read the rows")
+	assert.Equal(t, rows, got)
+
+	cellType, err := f.GetCellType(sheet, "A2")
+	assert.NoError(t, err, "Failed to read the cell type")
+	assert.Equal(t, excelize.CellTypeInlineString, cellType, "cells should be written as text")
+
+	formula, err := f.GetCellFormula(sheet, "B2")
+	assert.NoError(t, err, "Failed to read the cell formula")
+	assert.Empty(t, formula, "cell values should never be written as formulas")
+
+	styleID, err := f.GetCellStyle(sheet, "A1")
+	assert.NoError(t, err, "Failed to read the header style")
+	style, err := f.GetStyle(styleID)
+	assert.NoError(t, err, "Failed to read the header style")
+	assert.True(t, style.Font.Bold, "the header row should be bold")
+
+	panes, err := f.GetPanes(sheet)
+	assert.NoError(t, err, "Failed to read the panes")
+	assert.True(t, panes.Freeze, "the header row should be frozen")
+	assert.Equal(t, 1, panes.YSplit)
+
+	width, err := f.GetColWidth(sheet, "A")
+	assert.NoError(t, err, "Failed to read the column width")
+	assert.Equal(t, float64(minColumnWidth), width)
+	width, err = f.GetColWidth(sheet, "B")
+	assert.NoError(t, err, "Failed to read the column width")
+	assert.Equal(t, float64(maxColumnWidth), width)
+}
+
+func TestWriteXLSXFormats(t *testing.T) {
+	rows := [][]string{{"name", "score", "date"}, {"Amina", "12.5", "2025-03-01"}, {"Baraka", "n/a", "soon"}}
+	formats := collab.Formats{
+		Columns: map[int]collab.Format{1: {NumberFormat: "0.00", Align: collab.AlignRight}},
+		Cells: map[collab.CellPos]collab.Format{
+			{Row: 1, Col: 0}: {Bold: true, Color: "#ff0000", Background: "#00ff00"},
+			{Row: 1, Col: 2}: {NumberFormat: "dd/mm/yyyy"},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := WriteXLSX(&buf, "Results", rows[0], eachRow(rows), formats)
+	assert.NoError(t, err, "WriteXLSX should not return an error")
+
+	f, err := excelize.OpenReader(&buf)
+	assert.NoError(t, err, "Failed to open the workbook")
+	defer f.Close()
+
+	style := func(cell string) *excelize.Style {
+		id, err := f.GetCellStyle("Results", cell)
+		assert.NoError(t, err, "Failed to read the style of %s", cell)
+		style, err := f.GetStyle(id)
+		assert.NoError(t, err, "Failed to read the style of %s", cell)
+		return style
+	}
+
+	a2 := style("A2")
+	assert.True(t, a2.Font.Bold)
+	assert.Equal(t, "FF0000", strings.ToUpper(a2.Font.Color))
+	assert.Equal(t, []string{"00FF00"}, a2.Fill.Color)
+	assert.False(t, style("A3").Font.Bold, "formats of other cells should not apply")
+
+	assert.Equal(t, "right", style("B3").Alignment.Horizontal, "column formats should apply to every row")
+	assert.True(t, style("B1").Font.Bold, "column formats should not apply to the headers")
+
+	value, err := f.GetCellValue("Results", "B2")
+	assert.NoError(t, err)
+	assert.Equal(t, "12.50", value, "numbers should be displayed with their number format")
+	value, err = f.GetCellValue("Results", "C2")
+	assert.NoError(t, err)
+	assert.Equal(t, "01/03/2025", value, "dates should be displayed with their number format")
+	value, err = f.GetCellValue("Results", "B3")
+	assert.NoError(t, err)
+	assert.Equal(t, "n/a", value, "text should be kept as it is")
+}
+
+func TestWorksheetName(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Results", "Results"},
+		{"Q1/Q2 [draft]", "Q1_Q2 _draft_"},
+		{"'quoted'", "quoted"},
+		{"   ", "Sheet1"},
+		{strings.Repeat("a", 40), strings.Repeat("a", 31)},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, worksheetName(tt.title), "title %q", tt.title)
+	}
+}
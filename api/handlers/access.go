@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/api/utils"
+	"github.com/waynekn/tablesync/core/collab"
+)
+
+// Connection modes a client can request through the `mode` query parameter.
+const (
+	modeEdit = "edit"
+	modeView = "view"
+)
+
+// subjectFromContext returns the subject of the access token in the context,
+// or an empty string for anonymous requests.
+func subjectFromContext(c *gin.Context) string {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		return ""
+	}
+	return token.Subject()
+}
+
+// authorFromContext returns the identity of the user making the request,
+// or nil for anonymous requests. The name is taken from the `name` claim of
+// the access token, falling back to the `email` claim.
+func authorFromContext(c *gin.Context) *collab.Author {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		return nil
+	}
+
+	author := &collab.Author{ID: token.Subject()}
+	for _, claim := range []string{"name", "email"} {
+		if val, ok := token.Get(claim); ok {
+			if name, ok := val.(string); ok && name != "" {
+				author.Name = name
+				break
+			}
+		}
+	}
+	return author
+}
+
+// rowPolicy returns the row ownership mode of the spreadsheet. In this mode each row
+// belongs to the user who created it, and only the owner of the spreadsheet and its
+// managers can edit the rows of others.
+func rowPolicy(sheet *models.Spreadsheet) collab.RowOwnership {
+	policy := collab.RowOwnership{Enabled: sheet.RowOwnership}
+	if sheet.MaxRowsPerUser != nil {
+		policy.MaxRows = *sheet.MaxRowsPerUser
+	}
+	return policy
+}
+
+// roleLookup retrieves the collaborator role of a user in a sheet, returning
+// sql.ErrNoRows if the sheet is not shared with the user.
+type roleLookup func(sheetID, userID string) (string, error)
+
+// sheetRole resolves the role of the user `subject` in a sheet, or an empty role if the
+// user has no access to it. Anonymous users have an empty subject.
+//
+// The owner of the sheet has the owner role. Everyone else gets the highest of their
+// collaborator role, looked up with `lookup`, and the link access of the sheet. The
+// collaborator role is looked up even if the link access grants editing, since managers
+// can do more than editors.
+func sheetRole(sheet *models.Spreadsheet, subject string, lookup roleLookup) (collab.Role, error) {
+	if subject != "" && subject == sheet.Owner {
+		return collab.RoleOwner, nil
+	}
+
+	var role collab.Role
+	switch sheet.LinkAccess {
+	case models.LinkAccessEdit:
+		role = collab.RoleEditor
+	case models.LinkAccessView:
+		role = collab.RoleViewer
+	}
+
+	if subject == "" {
+		return role, nil
+	}
+
+	collaboratorRole, err := lookup(sheet.ID, subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return role, nil
+		}
+		return "", err
+	}
+
+	if r := collab.Role(collaboratorRole); r.AtLeast(role) {
+		role = r
+	}
+	return role, nil
+}
+
+// connectionRole resolves the role of a live connection to a sheet from the role the
+// user is entitled to (see sheetRole).
+//
+// A connection may request the `mode` it wants, but only the modes the user is entitled
+// to are granted, e.g. anyone can request to view a sheet they can edit but only editors
+// can request to edit it. An empty mode grants the role the user is entitled to.
+func connectionRole(entitled collab.Role, mode string) (collab.Role, error) {
+	if !entitled.AtLeast(collab.RoleViewer) {
+		return "", &sessionError{http.StatusForbidden, "You do not have access to this sheet."}
+	}
+
+	switch mode {
+	case "":
+		return entitled, nil
+	case modeView:
+		return collab.RoleViewer, nil
+	case modeEdit:
+		if !entitled.CanEdit() {
+			return "", &sessionError{http.StatusForbidden, "You do not have permission to edit this sheet."}
+		}
+		return entitled, nil
+	default:
+		return "", &sessionError{http.StatusBadRequest, "Invalid connection mode."}
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/core/collab"
+)
+
+func TestSheetRole(t *testing.T) {
+	editable := &models.Spreadsheet{ID: "sheet", Owner: "owner", LinkAccess: models.LinkAccessEdit}
+	viewOnly := &models.Spreadsheet{ID: "sheet", Owner: "owner", LinkAccess: models.LinkAccessView}
+	restricted := &models.Spreadsheet{ID: "sheet", Owner: "owner", LinkAccess: models.LinkAccessNone}
+
+	collaborators := map[string]string{
+		"editor":  models.CollaboratorRoleEditor,
+		"manager": models.CollaboratorRoleManager,
+		"viewer":  models.CollaboratorRoleViewer,
+	}
+	lookup := func(sheetID, userID string) (string, error) {
+		role, ok := collaborators[userID]
+		if !ok {
+			return "", sql.ErrNoRows
+		}
+		return role, nil
+	}
+
+	tests := []struct {
+		name     string
+		sheet    *models.Spreadsheet
+		subject  string
+		wantRole collab.Role
+	}{
+		{"owner", restricted, "owner", collab.RoleOwner},
+		{"anonymous on editable sheet", editable, "", collab.RoleEditor},
+		{"anonymous on view only sheet", viewOnly, "", collab.RoleViewer},
+		{"anonymous on restricted sheet", restricted, "", ""},
+		{"user on restricted sheet", restricted, "someone", ""},
+		{"editor on restricted sheet", restricted, "editor", collab.RoleEditor},
+		{"viewer on restricted sheet", restricted, "viewer", collab.RoleViewer},
+		{"editor on view only sheet", viewOnly, "editor", collab.RoleEditor},
+		{"viewer on editable sheet", editable, "viewer", collab.RoleEditor},
+		{"manager on editable sheet", editable, "manager", collab.RoleManager},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, err := sheetRole(tt.sheet, tt.subject, lookup)
+			assert.NoError(t, err, "sheetRole should not return an error")
+			assert.Equal(t, tt.wantRole, role)
+		})
+	}
+
+	t.Run("lookup error", func(t *testing.T) {
+		failing := func(sheetID, userID string) (string, error) {
+			return "", errors.New("connection refused")
+		}
+		_, err := sheetRole(restricted, "someone", failing)
+		assert.Error(t, err, "sheetRole should return lookup errors")
+	})
+}
+
+func TestConnectionRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		entitled collab.Role
+		mode     string
+		wantRole collab.Role
+		wantErr  bool
+	}{
+		{"editor", collab.RoleEditor, "", collab.RoleEditor, false},
+		{"editor requests view", collab.RoleEditor, modeView, collab.RoleViewer, false},
+		{"viewer", collab.RoleViewer, "", collab.RoleViewer, false},
+		{"viewer requests edit", collab.RoleViewer, modeEdit, "", true},
+		{"owner requests edit", collab.RoleOwner, modeEdit, collab.RoleOwner, false},
+		{"owner requests view", collab.RoleOwner, modeView, collab.RoleViewer, false},
+		{"no access", "", "", "", true},
+		{"no access requests view", "", modeView, "", true},
+		{"invalid mode", collab.RoleEditor, "admin", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, err := connectionRole(tt.entitled, tt.mode)
+			if tt.wantErr {
+				assert.Error(t, err, "connectionRole should return an error")
+			} else {
+				assert.NoError(t, err, "connectionRole should not return an error")
+			}
+			assert.Equal(t, tt.wantRole, role)
+		})
+	}
+}
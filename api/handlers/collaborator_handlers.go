@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/waynekn/tablesync/api/db/repo"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/api/utils"
+	"github.com/waynekn/tablesync/core/collab"
+	"github.com/waynekn/tablesync/core/ws"
+)
+
+// accessChangedReason is the reason given to clients disconnected because their
+// access to a sheet changed.
+const accessChangedReason = "Your access to this sheet has changed, please reconnect."
+
+// GetCollaboratorsHandler handles requests to list the collaborators of a spreadsheet.
+// Anyone with a role in the sheet may list them.
+func (h *SpreadsheetHandler) GetCollaboratorsHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	sheet, _, ok := h.accessibleSheet(c, token.Subject(), collab.RoleViewer)
+	if !ok {
+		return
+	}
+
+	collaborators, err := h.collaborators.GetBySheet(sheet.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving collaborators. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, collaborators)
+}
+
+// AddCollaboratorHandler handles requests by the owner of a spreadsheet to share it
+// with a user as an editor or a viewer.
+func (h *SpreadsheetHandler) AddCollaboratorHandler(c *gin.Context) {
+	var collaborator models.CollaboratorInit
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&collaborator); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+
+	sheet, ok := ownedSheet(c, h.repo, token.Subject())
+	if !ok {
+		return
+	}
+
+	if collaborator.UserID == sheet.Owner {
+		c.JSON(http.StatusBadRequest, gin.H{"userId": "The owner of the spreadsheet cannot be added as a collaborator"})
+		return
+	}
+
+	added, err := h.collaborators.AddCollaborator(sheet.ID, collaborator, token.Subject())
+	if err != nil {
+		if errors.Is(err, repo.ErrCollaboratorExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "The spreadsheet is already shared with this user"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while adding the collaborator. Please try again later."})
+		return
+	}
+
+	// the user may already be connected through the link access of the sheet
+	h.hub.CloseSheet <- ws.SheetClosure{SheetID: sheet.ID, UserID: added.UserID, Reason: accessChangedReason}
+
+	c.JSON(http.StatusCreated, added)
+}
+
+// UpdateCollaboratorHandler handles requests by the owner of a spreadsheet to change
+// the role of a collaborator. The collaborator's live connections are closed so that
+// they reconnect with their new role.
+func (h *SpreadsheetHandler) UpdateCollaboratorHandler(c *gin.Context) {
+	var update models.CollaboratorUpdate
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&update); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+
+	sheet, ok := ownedSheet(c, h.repo, token.Subject())
+	if !ok {
+		return
+	}
+
+	updated, err := h.collaborators.UpdateRole(sheet.ID, c.Param("userID"), update.Role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collaborator not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while updating the collaborator. Please try again later."})
+		return
+	}
+
+	h.hub.CloseSheet <- ws.SheetClosure{SheetID: sheet.ID, UserID: updated.UserID, Reason: accessChangedReason}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// RemoveCollaboratorHandler handles requests to stop sharing a spreadsheet with a user.
+// The owner may remove any collaborator, and collaborators may remove themselves.
+// The removed user's live connections are closed.
+func (h *SpreadsheetHandler) RemoveCollaboratorHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userID := c.Param("userID")
+
+	var sheet *models.Spreadsheet
+	var ok bool
+	if userID == token.Subject() {
+		sheet, _, ok = h.accessibleSheet(c, token.Subject(), collab.RoleViewer)
+	} else {
+		sheet, ok = ownedSheet(c, h.repo, token.Subject())
+	}
+	if !ok {
+		return
+	}
+
+	if err := h.collaborators.RemoveCollaborator(sheet.ID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collaborator not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while removing the collaborator. Please try again later."})
+		return
+	}
+
+	h.hub.CloseSheet <- ws.SheetClosure{SheetID: sheet.ID, UserID: userID, Reason: accessChangedReason}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Collaborator removed successfully"})
+}
+
+// GetSharedSpreadsheetsHandler handles requests to retrieve the spreadsheets shared
+// with the authenticated user, along with their role in each of them. It is paginated,
+// sorted and filtered like GetOwnSpreadsheetsHandler.
+func (h *SpreadsheetHandler) GetSharedSpreadsheetsHandler(c *gin.Context) {
+	h.listSpreadsheets(c, h.repo.GetSharedWith)
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/waynekn/tablesync/api/db/repo"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/api/utils"
+	"github.com/waynekn/tablesync/core/ws"
+)
+
+// setUpCollaboratorCtx creates a test context for a request by `subject` to the
+// collaborators of a sheet, with `body` encoded as JSON if it is not nil.
+func setUpCollaboratorCtx(subject, method, sheetID, userID string, body any) (*gin.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	ctx := utils.CreateTestCtxWithToken(rec)
+	token, _ := utils.TokenFromContext(ctx)
+	token.Set("sub", subject)
+
+	var jsonBytes []byte
+	if body != nil {
+		jsonBytes, _ = json.Marshal(body)
+	}
+
+	ctx.Request = httptest.NewRequest(method, "/spreadsheet/"+sheetID+"/collaborators/", bytes.NewReader(jsonBytes))
+	ctx.Params = gin.Params{{Key: "sheetID", Value: sheetID}, {Key: "userID", Value: userID}}
+	return ctx, rec
+}
+
+func TestCollaboratorHandlers(t *testing.T) {
+	hub := ws.NewHub()
+	h := NewSpreadsheetHandler(repo.NewSpreadsheetRepo(testDb), repo.NewCollaboratorRepo(testDb), testStore, hub)
+
+	sheetID := insertTestSheet(t, "header1", "header2")
+	restricted := models.LinkAccessNone
+	_, err := repo.NewSpreadsheetRepo(testDb).UpdateSpreadsheet(sheetID, models.SpreadsheetUpdate{LinkAccess: &restricted})
+	assert.NoError(t, err, "Failed to restrict the test sheet")
+
+	collaborator := utils.GenerateID()
+
+	t.Run("no access before sharing", func(t *testing.T) {
+		ctx, rec := setUpCollaboratorCtx(collaborator, "GET", sheetID, "", nil)
+		h.GetSpreadsheetHandler(ctx)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("only the owner can share", func(t *testing.T) {
+		body := models.CollaboratorInit{UserID: collaborator, Role: models.CollaboratorRoleEditor}
+		ctx, rec := setUpCollaboratorCtx(collaborator, "POST", sheetID, "", body)
+		h.AddCollaboratorHandler(ctx)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("add collaborator", func(t *testing.T) {
+		body := models.CollaboratorInit{UserID: collaborator, Role: models.CollaboratorRoleViewer}
+		ctx, rec := setUpCollaboratorCtx("test-user", "POST", sheetID, "", body)
+		h.AddCollaboratorHandler(ctx)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var result models.Collaborator
+		err := json.Unmarshal(rec.Body.Bytes(), &result)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		assert.Equal(t, collaborator, result.UserID)
+		assert.Equal(t, models.CollaboratorRoleViewer, result.Role)
+		assert.Equal(t, "test-user", result.AddedBy)
+
+		ctx, rec = setUpCollaboratorCtx(collaborator, "GET", sheetID, "", nil)
+		h.GetSpreadsheetHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code, "collaborators should be able to retrieve the sheet")
+	})
+
+	t.Run("add collaborator twice", func(t *testing.T) {
+		body := models.CollaboratorInit{UserID: collaborator, Role: models.CollaboratorRoleEditor}
+		ctx, rec := setUpCollaboratorCtx("test-user", "POST", sheetID, "", body)
+		h.AddCollaboratorHandler(ctx)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("add the owner", func(t *testing.T) {
+		body := models.CollaboratorInit{UserID: "test-user", Role: models.CollaboratorRoleEditor}
+		ctx, rec := setUpCollaboratorCtx("test-user", "POST", sheetID, "", body)
+		h.AddCollaboratorHandler(ctx)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("invalid role", func(t *testing.T) {
+		body := map[string]string{"userId": utils.GenerateID(), "role": "owner"}
+		ctx, rec := setUpCollaboratorCtx("test-user", "POST", sheetID, "", body)
+		h.AddCollaboratorHandler(ctx)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Role must be one of editor, manager or viewer")
+	})
+
+	t.Run("list collaborators", func(t *testing.T) {
+		ctx, rec := setUpCollaboratorCtx(collaborator, "GET", sheetID, "", nil)
+		h.GetCollaboratorsHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var result []models.Collaborator
+		err := json.Unmarshal(rec.Body.Bytes(), &result)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		assert.Len(t, result, 1)
+	})
+
+	t.Run("shared with me", func(t *testing.T) {
+		rec := listSharedSpreadsheets(h, collaborator)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var result []models.SpreadsheetSummary
+		err := json.Unmarshal(rec.Body.Bytes(), &result)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		assert.Len(t, result, 1)
+		assert.Equal(t, sheetID, result[0].ID)
+		assert.Equal(t, models.CollaboratorRoleViewer, result[0].Role)
+	})
+
+	t.Run("change role disconnects the collaborator", func(t *testing.T) {
+		viewer := ws.NewViewer(sheetID, collaborator)
+		hub.Register <- viewer
+		time.Sleep(50 * time.Millisecond)
+
+		body := models.CollaboratorUpdate{Role: models.CollaboratorRoleEditor}
+		ctx, rec := setUpCollaboratorCtx("test-user", "PATCH", sheetID, collaborator, body)
+		h.UpdateCollaboratorHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), models.CollaboratorRoleEditor)
+
+		select {
+		case <-viewer.Done():
+		case <-time.After(time.Second):
+			t.Fatal("the collaborator should be disconnected")
+		}
+	})
+
+	t.Run("collaborators can leave", func(t *testing.T) {
+		ctx, rec := setUpCollaboratorCtx(collaborator, "DELETE", sheetID, collaborator, nil)
+		h.RemoveCollaboratorHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		ctx, rec = setUpCollaboratorCtx(collaborator, "GET", sheetID, "", nil)
+		h.GetSpreadsheetHandler(ctx)
+		assert.Equal(t, http.StatusForbidden, rec.Code, "removed collaborators should lose access")
+	})
+
+	t.Run("remove unknown collaborator", func(t *testing.T) {
+		ctx, rec := setUpCollaboratorCtx("test-user", "DELETE", sheetID, utils.GenerateID(), nil)
+		h.RemoveCollaboratorHandler(ctx)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+// listSharedSpreadsheets lists the spreadsheets shared with `user` and returns the
+// recorded response.
+func listSharedSpreadsheets(h *SpreadsheetHandler, user string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	ctx := utils.CreateTestCtxWithToken(rec)
+	token, _ := utils.TokenFromContext(ctx)
+	token.Set("sub", user)
+
+	ctx.Request = httptest.NewRequest("GET", "/spreadsheets/shared/", nil)
+	h.GetSharedSpreadsheetsHandler(ctx)
+	return rec
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/api/schema"
+	"github.com/waynekn/tablesync/api/utils"
+	"github.com/waynekn/tablesync/core/collab"
+)
+
+const (
+	columnsChangedReason   = "The columns of this sheet have changed, please reconnect."
+	columnsChangingMessage = "The columns of this sheet are being changed. Please try again in a moment."
+)
+
+// AddColumnHandler handles requests by the owner of a spreadsheet to add a column to it,
+// after its last column unless a position is given. The column must be well defined
+// (see collab.Column.Check), and its cells start out blank.
+func (h *SpreadsheetHandler) AddColumnHandler(c *gin.Context) {
+	var add models.ColumnAdd
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&add); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+
+	column := schema.Column(add.Column())
+	if err := column.Check(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid column: " + err.Error()})
+		return
+	}
+
+	h.changeColumns(c, token.Subject(), func(columns []collab.Column) (collab.ColumnChange, error) {
+		at := len(columns)
+		if add.Position != nil {
+			at = *add.Position
+		}
+		return collab.AddColumn(columns, column, at)
+	})
+}
+
+// UpdateColumnHandler handles requests by the owner of a spreadsheet to rename or hide
+// one of its columns. Hidden columns keep their cells, and clients are expected not to
+// show them.
+func (h *SpreadsheetHandler) UpdateColumnHandler(c *gin.Context) {
+	var update models.ColumnUpdate
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	col, ok := columnParam(c)
+	if !ok {
+		return
+	}
+
+	if err := c.ShouldBindJSON(&update); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+
+	h.changeColumns(c, token.Subject(), func(columns []collab.Column) (collab.ColumnChange, error) {
+		return collab.EditColumn(columns, col, func(column *collab.Column) {
+			if update.Title != nil {
+				column.Title = *update.Title
+			}
+			if update.Hidden != nil {
+				column.Hidden = *update.Hidden
+			}
+		})
+	})
+}
+
+// ReorderColumnsHandler handles requests by the owner of a spreadsheet to reorder its
+// columns. Formulas are rewritten to keep referencing the same cells.
+func (h *SpreadsheetHandler) ReorderColumnsHandler(c *gin.Context) {
+	var order models.ColumnOrder
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&order); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+
+	h.changeColumns(c, token.Subject(), func(columns []collab.Column) (collab.ColumnChange, error) {
+		return collab.ReorderColumns(columns, order.Order)
+	})
+}
+
+// DeleteColumnHandler handles requests by the owner of a spreadsheet to delete one of its
+// columns along with its cells. References to the column in formulas become #REF!.
+func (h *SpreadsheetHandler) DeleteColumnHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	col, ok := columnParam(c)
+	if !ok {
+		return
+	}
+
+	h.changeColumns(c, token.Subject(), func(columns []collab.Column) (collab.ColumnChange, error) {
+		return collab.DeleteColumn(columns, col)
+	})
+}
+
+// columnParam returns the index of the column in the request path. If it is not a valid
+// index, it responds with an error and returns false.
+func columnParam(c *gin.Context) (int, bool) {
+	col, err := strconv.Atoi(c.Param("col"))
+	if err != nil || col < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"col": "Column must be a non-negative integer"})
+		return 0, false
+	}
+	return col, true
+}
+
+// changeColumns makes the change to the columns of the spreadsheet in the request path
+// that `plan` returns, see repo.SpreadsheetRepo.ChangeColumns, and responds with the
+// updated spreadsheet. Only the owner of the spreadsheet can change its columns.
+//
+// The columns are locked meanwhile (see collab.Store.LockColumns), so that the live
+// editing session of the sheet can neither be edited nor loaded with the previous
+// columns, and every client connected to the sheet is disconnected, to reconnect with the
+// new columns. The session is saved to the database before the change, which is then
+// applied to the session once it is saved. If the session cannot be updated, it is
+// removed, to be loaded again from the database.
+func (h *SpreadsheetHandler) changeColumns(c *gin.Context, subject string,
+	plan func(columns []collab.Column) (collab.ColumnChange, error)) {
+	sheet, ok := ownedSheet(c, h.repo, subject)
+	if !ok {
+		return
+	}
+
+	unlockColumns, err := h.collab.LockColumns(sheet.ID)
+	if errors.Is(err, collab.ErrColumnsLocked) {
+		c.JSON(http.StatusConflict, gin.H{"error": "The columns of this sheet are already being changed. Please try again in a moment."})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while changing the columns. Please try again later."})
+		return
+	}
+	defer unlockColumns()
+
+	// the columns may have changed before they were locked
+	sheet, ok = ownedSheet(c, h.repo, subject)
+	if !ok {
+		return
+	}
+
+	// check the change against the current columns before disconnecting anyone
+	headers, err := sheetHeaders(sheet)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while changing the columns. Please try again later."})
+		return
+	}
+	if _, err := plan(schema.Of(sheet.Columns, headers)); err != nil {
+		respondWithColumnChangeError(c, err)
+		return
+	}
+
+	// wait for the edits being applied, e.g. by AppendRowHandler
+	unlockEdits := h.hub.LockEdits(sheet.ID)
+	defer unlockEdits()
+	h.hub.ResetSheet(sheet.ID, columnsChangedReason)
+
+	if err := saveSession(h.collab, h.repo, sheet); err != nil {
+		slog.Error("Failed to save sheet session", "sheetID", sheet.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while changing the columns. Please try again later."})
+		return
+	}
+
+	sheetID := sheet.ID
+	var change collab.ColumnChange
+	sheet, err = h.repo.ChangeColumns(sheetID, func(columns []collab.Column) (collab.ColumnChange, error) {
+		change, err = plan(columns)
+		return change, err
+	})
+	if err != nil {
+		respondWithColumnChangeError(c, err)
+		return
+	}
+
+	if err := h.collab.ChangeColumns(sheetID, change); err != nil {
+		// the saved session holds every edit, as the session could not be edited since
+		if err := h.collab.DeleteSheet(sheetID); err != nil {
+			slog.Error("Failed to remove sheet session after changing its columns", "sheetID", sheetID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while changing the columns. Please try again later."})
+			return
+		}
+	}
+	// disconnect the clients that loaded the sheet before its columns were locked and
+	// registered meanwhile
+	h.hub.ResetSheet(sheetID, columnsChangedReason)
+
+	c.JSON(http.StatusOK, sheet)
+}
+
+// respondWithColumnChangeError responds with the error of a change to the columns of a
+// spreadsheet that failed.
+func respondWithColumnChangeError(c *gin.Context, err error) {
+	var changeErr *collab.ColumnChangeError
+	switch {
+	case errors.As(err, &changeErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": changeErr.Message})
+	case err == sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Spreadsheet not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while changing the columns. Please try again later."})
+	}
+}
+
+// sheetHeaders returns the headers of the spreadsheet, as stored in the database.
+func sheetHeaders(sheet *models.Spreadsheet) ([]string, error) {
+	var data [][]string
+	if err := json.Unmarshal(sheet.Data, &data); err != nil {
+		slog.Error("error unmarshalling sheet data", "sheetID", sheet.ID, "err", err)
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("sheet has no column headers")
+	}
+	return data[0], nil
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/waynekn/tablesync/api/db/repo"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/core/collab"
+	"github.com/waynekn/tablesync/core/ws"
+)
+
+func TestColumnHandlers(t *testing.T) {
+	hub := ws.NewHub()
+	h := NewSpreadsheetHandler(repo.NewSpreadsheetRepo(testDb), repo.NewCollaboratorRepo(testDb), testStore, hub)
+	sheetID := insertTestSheet(t, "name", "score")
+
+	data := [][]string{{"name", "score"}, {"Amina", "12"}, {"Total", "=B2*2"}}
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(time.Hour), &data)
+	assert.NoError(t, err, "Failed to start a session for the test sheet")
+	t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+	change := func(t *testing.T, subject string, handler gin.HandlerFunc, col string, body any) (*models.Spreadsheet, int) {
+		params := gin.Params{{Key: "sheetID", Value: sheetID}, {Key: "col", Value: col}}
+		ctx, rec := setUpInviteCtx(subject, "POST", params, body)
+		handler(ctx)
+
+		var sheet models.Spreadsheet
+		if rec.Code == http.StatusOK {
+			err := json.Unmarshal(rec.Body.Bytes(), &sheet)
+			assert.NoError(t, err, "Failed to unmarshal response body")
+		}
+		return &sheet, rec.Code
+	}
+	liveRows := func(t *testing.T, colNum int) [][]string {
+		rows, err := testStore.GetRows(sheetID, 0, 3, colNum)
+		assert.NoError(t, err)
+		return rows
+	}
+
+	t.Run("only the owner can change columns", func(t *testing.T) {
+		_, code := change(t, "another-user", h.DeleteColumnHandler, "0", nil)
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+
+	t.Run("add column", func(t *testing.T) {
+		position := 0
+		body := models.ColumnAdd{ColumnInit: models.ColumnInit{Title: "id", Type: "integer"}, Position: &position}
+
+		viewer := ws.NewViewer(sheetID, "")
+		hub.Register <- viewer
+		time.Sleep(50 * time.Millisecond)
+		err := testStore.SetColumnFormat(sheetID, 1, collab.Format{Bold: true})
+		assert.NoError(t, err)
+
+		sheet, code := change(t, "test-user", h.AddColumnHandler, "", body)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Len(t, sheet.Columns, 3)
+		assert.JSONEq(t, `[["id","name","score"],["","Amina","12"],["","Total","=C2*2"]]`, string(sheet.Data),
+			"the session should be saved along with the change")
+		assert.Equal(t, [][]string{{"id", "name", "score"}, {"", "Amina", "12"}, {"", "Total", "=C2*2"}}, liveRows(t, 3))
+
+		saved, err := h.repo.GetByID(sheetID)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"col:2": `{"bold":true}`}, saved.Formats.Fields(),
+			"the saved formats should follow their column")
+		formats, err := testStore.GetFormats(sheetID)
+		assert.NoError(t, err)
+		assert.Equal(t, map[int]collab.Format{2: {Bold: true}}, formats.Columns, "the live formats should follow their column")
+
+		select {
+		case <-viewer.Done():
+			assert.Equal(t, columnsChangedReason, viewer.Reason())
+		case <-time.After(time.Second):
+			t.Fatal("connected clients should be disconnected")
+		}
+	})
+
+	t.Run("columns being changed", func(t *testing.T) {
+		unlock, err := testStore.LockColumns(sheetID)
+		assert.NoError(t, err)
+
+		title := "student"
+		_, code := change(t, "test-user", h.UpdateColumnHandler, "1", models.ColumnUpdate{Title: &title})
+		assert.Equal(t, http.StatusConflict, code, "changes should be made one after the other")
+
+		_, err = initSession(testStore, &models.Spreadsheet{ID: sheetID, Data: []byte(`[["id","name","score"]]`)}, 0)
+		var serr *sessionError
+		if assert.ErrorAs(t, err, &serr, "sessions should not be loaded while the columns change") {
+			assert.Equal(t, http.StatusConflict, serr.status)
+		}
+		unlock()
+	})
+
+	t.Run("rename and hide column", func(t *testing.T) {
+		title, hidden := "student", true
+		sheet, code := change(t, "test-user", h.UpdateColumnHandler, "1", models.ColumnUpdate{Title: &title, Hidden: &hidden})
+		assert.Equal(t, http.StatusOK, code)
+		assert.True(t, sheet.Columns[1].Hidden)
+		assert.Equal(t, []string{"id", "student", "score"}, liveRows(t, 3)[0])
+	})
+
+	t.Run("reorder columns", func(t *testing.T) {
+		_, code := change(t, "test-user", h.ReorderColumnsHandler, "", models.ColumnOrder{Order: []int{2, 1, 0}})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, [][]string{{"score", "student", "id"}, {"12", "Amina", ""}, {"=A2*2", "Total", ""}}, liveRows(t, 3))
+
+		_, code = change(t, "test-user", h.ReorderColumnsHandler, "", models.ColumnOrder{Order: []int{0, 0, 1}})
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("delete column", func(t *testing.T) {
+		sheet, code := change(t, "test-user", h.DeleteColumnHandler, "0", nil)
+		assert.Equal(t, http.StatusOK, code)
+		assert.JSONEq(t, `[["student","id"],["Amina",""],["Total",""]]`, string(sheet.Data))
+		assert.Equal(t, [][]string{{"student", "id"}, {"Amina", ""}, {"Total", ""}}, liveRows(t, 2))
+
+		_, code = change(t, "test-user", h.DeleteColumnHandler, "5", nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/waynekn/tablesync/api/db/repo"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/api/utils"
+	"github.com/waynekn/tablesync/core/collab"
+	"github.com/waynekn/tablesync/core/ws"
+)
+
+type CommentHandler struct {
+	sheets        repo.SpreadsheetRepo
+	collaborators repo.CollaboratorRepo
+	comments      repo.CommentRepo
+	hub           *ws.Hub
+}
+
+// NewCommentHandler creates a new instance of CommentHandler with the provided
+// repositories and hub.
+func NewCommentHandler(sheets repo.SpreadsheetRepo, collaborators repo.CollaboratorRepo,
+	comments repo.CommentRepo, hub *ws.Hub) *CommentHandler {
+	return &CommentHandler{sheets: sheets, collaborators: collaborators, comments: comments, hub: hub}
+}
+
+// GetCommentThreadsHandler handles requests to list the comment threads of a spreadsheet
+// with their comments. The resolved query parameter restricts the list to the resolved
+// or to the open threads. Anyone with access to the sheet can read its comments.
+func (h *CommentHandler) GetCommentThreadsHandler(c *gin.Context) {
+	var query models.CommentThreadsQuery
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+
+	sheet, _, ok := sheetWithRole(c, h.sheets, h.collaborators.GetRole, token.Subject(), collab.RoleViewer)
+	if !ok {
+		return
+	}
+
+	threads, err := h.comments.GetBySheet(sheet.ID, query.Resolved)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving the comments. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, threads)
+}
+
+// CreateCommentThreadHandler handles requests to start a comment thread on a cell of a
+// spreadsheet, or on a whole row if no column is given. Anyone with access to the sheet
+// can comment on it, including viewers, and the clients connected to the sheet are
+// notified of the new thread.
+func (h *CommentHandler) CreateCommentThreadHandler(c *gin.Context) {
+	var thread models.CommentThreadInit
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&thread); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+
+	sheet, _, ok := sheetWithRole(c, h.sheets, h.collaborators.GetRole, token.Subject(), collab.RoleViewer)
+	if !ok {
+		return
+	}
+
+	if thread.Col != nil {
+		headers, err := sheetHeaders(sheet)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while creating the comment. Please try again later."})
+			return
+		}
+		if *thread.Col >= len(headers) {
+			c.JSON(http.StatusBadRequest, gin.H{"col": "Column does not exist"})
+			return
+		}
+	}
+
+	created, err := h.comments.CreateThread(utils.GenerateID(), sheet.ID, thread, utils.GenerateID(), *authorFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while creating the comment. Please try again later."})
+		return
+	}
+
+	h.notify(sheet.ID, ws.CommentThreadCreated, created)
+	c.JSON(http.StatusCreated, created)
+}
+
+// ReplyToCommentThreadHandler handles requests to add a comment to a comment thread of a
+// spreadsheet. Anyone with access to the sheet can reply, and the clients connected to
+// the sheet are notified of the reply.
+func (h *CommentHandler) ReplyToCommentThreadHandler(c *gin.Context) {
+	var comment models.CommentInit
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&comment); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+
+	sheet, _, ok := sheetWithRole(c, h.sheets, h.collaborators.GetRole, token.Subject(), collab.RoleViewer)
+	if !ok {
+		return
+	}
+
+	thread, err := h.comments.AddComment(utils.GenerateID(), sheet.ID, c.Param("threadID"), comment.Body, *authorFromContext(c))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment thread not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while creating the comment. Please try again later."})
+		return
+	}
+
+	h.notify(sheet.ID, ws.CommentThreadReplied, thread)
+	c.JSON(http.StatusCreated, thread)
+}
+
+// ResolveCommentThreadHandler handles requests to mark a comment thread of a spreadsheet
+// as resolved, see setResolved.
+func (h *CommentHandler) ResolveCommentThreadHandler(c *gin.Context) {
+	h.setResolved(c, true)
+}
+
+// ReopenCommentThreadHandler handles requests to reopen a resolved comment thread of a
+// spreadsheet, see setResolved.
+func (h *CommentHandler) ReopenCommentThreadHandler(c *gin.Context) {
+	h.setResolved(c, false)
+}
+
+// setResolved resolves or reopens the comment thread in the request path and responds
+// with it. Threads can be resolved and reopened by the user who started them and by
+// anyone who can edit the sheet. The clients connected to the sheet are notified of
+// the change.
+func (h *CommentHandler) setResolved(c *gin.Context, resolved bool) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	sheet, role, ok := sheetWithRole(c, h.sheets, h.collaborators.GetRole, token.Subject(), collab.RoleViewer)
+	if !ok {
+		return
+	}
+
+	thread, err := h.comments.GetThread(sheet.ID, c.Param("threadID"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment thread not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while updating the comment thread. Please try again later."})
+		return
+	}
+
+	if thread.CreatedBy != token.Subject() && !role.CanEdit() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author of the thread or an editor of the spreadsheet can do this."})
+		return
+	}
+
+	resolvedBy, action := "", ws.CommentThreadReopened
+	if resolved {
+		resolvedBy, action = token.Subject(), ws.CommentThreadResolved
+	}
+
+	thread, err = h.comments.SetResolved(sheet.ID, thread.ID, resolvedBy)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment thread not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while updating the comment thread. Please try again later."})
+		return
+	}
+
+	h.notify(sheet.ID, action, thread)
+	c.JSON(http.StatusOK, thread)
+}
+
+// notify broadcasts a change to a comment thread to the clients connected to the sheet.
+func (h *CommentHandler) notify(sheetID, action string, thread *models.CommentThread) {
+	h.hub.Broadcast <- collab.BroadCastMsg{
+		SheetID: sheetID,
+		Event:   ws.NewCommentThreadMsg(action, thread),
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/waynekn/tablesync/api/db/repo"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/core/ws"
+)
+
+func TestCommentHandlers(t *testing.T) {
+	hub := ws.NewHub()
+	h := NewCommentHandler(repo.NewSpreadsheetRepo(testDb), repo.NewCollaboratorRepo(testDb), repo.NewCommentRepo(testDb), hub)
+	sheets := NewSpreadsheetHandler(repo.NewSpreadsheetRepo(testDb), repo.NewCollaboratorRepo(testDb), testStore, hub)
+
+	sheetID := insertTestSheet(t, "name", "score", "grade")
+	viewOnly := models.LinkAccessView
+	_, err := repo.NewSpreadsheetRepo(testDb).UpdateSpreadsheet(sheetID, models.SpreadsheetUpdate{LinkAccess: &viewOnly})
+	assert.NoError(t, err, "Failed to restrict the test sheet")
+
+	sheetParams := gin.Params{{Key: "sheetID", Value: sheetID}}
+	threadParams := func(threadID string) gin.Params {
+		return gin.Params{{Key: "sheetID", Value: sheetID}, {Key: "threadID", Value: threadID}}
+	}
+	decode := func(t *testing.T, rec *httptest.ResponseRecorder) models.CommentThread {
+		var thread models.CommentThread
+		err := json.Unmarshal(rec.Body.Bytes(), &thread)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		return thread
+	}
+	listThreads := func(t *testing.T, query string) []models.CommentThread {
+		ctx, rec := setUpInviteCtx("test-user", "GET", sheetParams, nil)
+		ctx.Request = httptest.NewRequest("GET", "/spreadsheet/"+sheetID+"/comments/"+query, nil)
+		h.GetCommentThreadsHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var threads []models.CommentThread
+		err := json.Unmarshal(rec.Body.Bytes(), &threads)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		return threads
+	}
+
+	row, col := 2, 1
+	var threadID string
+
+	t.Run("start a thread on a cell", func(t *testing.T) {
+		viewer := ws.NewViewer(sheetID, "")
+		hub.Register <- viewer
+		time.Sleep(50 * time.Millisecond)
+		defer func() { hub.Unregister <- viewer }()
+
+		ctx, rec := setUpInviteCtx("another-user", "POST", sheetParams,
+			models.CommentThreadInit{Row: &row, Col: &col, Body: "Is this figure correct?"})
+		h.CreateCommentThreadHandler(ctx)
+		assert.Equal(t, http.StatusCreated, rec.Code, "viewers can comment")
+
+		thread := decode(t, rec)
+		threadID = thread.ID
+		assert.Equal(t, 2, thread.Row)
+		assert.Equal(t, &col, thread.Col)
+		assert.Equal(t, "another-user", thread.CreatedBy)
+		assert.Nil(t, thread.ResolvedAt)
+		if assert.Len(t, thread.Comments, 1) {
+			assert.Equal(t, "Is this figure correct?", thread.Comments[0].Body)
+			assert.Equal(t, "another-user", thread.Comments[0].Author.ID)
+		}
+
+		select {
+		case msg := <-viewer.Send:
+			event, ok := msg.(ws.CommentThreadMsg)
+			assert.True(t, ok, "connected clients should receive a comment thread event")
+			assert.Equal(t, ws.CommentThreadCreated, event.Action)
+		case <-time.After(time.Second):
+			t.Fatal("connected clients should be notified of the new thread")
+		}
+	})
+
+	t.Run("invalid anchors", func(t *testing.T) {
+		outside := 3
+		ctx, rec := setUpInviteCtx("test-user", "POST", sheetParams,
+			models.CommentThreadInit{Row: &row, Col: &outside, Body: "Hello"})
+		h.CreateCommentThreadHandler(ctx)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		ctx, rec = setUpInviteCtx("test-user", "POST", sheetParams, models.CommentThreadInit{Body: "Hello"})
+		h.CreateCommentThreadHandler(ctx)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "the row is required")
+	})
+
+	t.Run("reply", func(t *testing.T) {
+		ctx, rec := setUpInviteCtx("test-user", "POST", threadParams(threadID), models.CommentInit{Body: "Yes, I checked it."})
+		h.ReplyToCommentThreadHandler(ctx)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Len(t, decode(t, rec).Comments, 2)
+
+		ctx, rec = setUpInviteCtx("test-user", "POST", threadParams("missing-thread"), models.CommentInit{Body: "Hello"})
+		h.ReplyToCommentThreadHandler(ctx)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("resolve and reopen", func(t *testing.T) {
+		ownRow := 0
+		ctx, rec := setUpInviteCtx("test-user", "POST", sheetParams, models.CommentThreadInit{Row: &ownRow, Body: "Whole row"})
+		h.CreateCommentThreadHandler(ctx)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		ownerThread := decode(t, rec)
+		assert.Nil(t, ownerThread.Col, "threads without a column are anchored to the row")
+
+		ctx, rec = setUpInviteCtx("another-user", "POST", threadParams(ownerThread.ID), nil)
+		h.ResolveCommentThreadHandler(ctx)
+		assert.Equal(t, http.StatusForbidden, rec.Code, "viewers can only resolve their own threads")
+
+		ctx, rec = setUpInviteCtx("another-user", "POST", threadParams(threadID), nil)
+		h.ResolveCommentThreadHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		resolved := decode(t, rec)
+		assert.NotNil(t, resolved.ResolvedAt)
+		assert.Equal(t, "another-user", *resolved.ResolvedBy)
+
+		open := listThreads(t, "?resolved=false")
+		if assert.Len(t, open, 1) {
+			assert.Equal(t, ownerThread.ID, open[0].ID)
+		}
+
+		ctx, rec = setUpInviteCtx("test-user", "POST", threadParams(threadID), nil)
+		h.ReopenCommentThreadHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Nil(t, decode(t, rec).ResolvedAt)
+		assert.Len(t, listThreads(t, ""), 2)
+	})
+
+	t.Run("anchors follow column changes", func(t *testing.T) {
+		ctx, rec := setUpInviteCtx("test-user", "PUT", sheetParams, models.ColumnOrder{Order: []int{1, 2, 0}})
+		sheets.ReorderColumnsHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 0, *listThreads(t, "")[0].Col, "the thread should stay on the score column")
+
+		ctx, rec = setUpInviteCtx("test-user", "DELETE", gin.Params{{Key: "sheetID", Value: sheetID}, {Key: "col", Value: "0"}}, nil)
+		sheets.DeleteColumnHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		thread := listThreads(t, "")[0]
+		assert.Nil(t, thread.Col, "threads on deleted columns should be kept on their row")
+		assert.Equal(t, 2, thread.Row)
+	})
+}
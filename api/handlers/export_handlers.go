@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bytes"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/waynekn/tablesync/api/export"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/api/utils"
+	"github.com/waynekn/tablesync/core/collab"
+)
+
+// csvCharsets maps the encodings of CSV exports to the charset of their Content-Type.
+var csvCharsets = map[string]string{
+	"":                         "utf-8",
+	export.EncodingUTF8:        "utf-8",
+	export.EncodingUTF8BOM:     "utf-8",
+	export.EncodingUTF16LE:     "utf-16le",
+	export.EncodingWindows1252: "windows-1252",
+}
+
+// ExportCSVHandler handles requests to download the current contents of a spreadsheet,
+// headers included, as a CSV file. The contents come from the live session of the sheet
+// if there is one, and from the database otherwise. Formula cells hold the values of
+// their formulas, as other applications cannot compute them, see sheetRows.
+//
+// The delimiter and encoding of the file can be chosen with the query parameters of
+// models.CSVExportQuery. Cells that would be evaluated as formulas when the file is opened
+// in a spreadsheet application are escaped (see export.EscapeFormula). CSV files cannot
+// hold the formats of the cells, which are left out.
+func (h *SpreadsheetHandler) ExportCSVHandler(c *gin.Context) {
+	var query models.CSVExportQuery
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+
+	sheet, _, ok := h.accessibleSheet(c, token.Subject(), collab.RoleViewer)
+	if !ok {
+		return
+	}
+
+	rows, err := newSheetRows(h.collab, h.hub, sheet)
+	if err != nil {
+		slog.Error("Failed to read spreadsheet rows", "sheetID", sheet.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while exporting the spreadsheet. Please try again later."})
+		return
+	}
+	data := [][]string{rows.headers}
+	err = rows.each(func(index int, row []string) error {
+		data = append(data, row)
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to read spreadsheet rows", "sheetID", sheet.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while exporting the spreadsheet. Please try again later."})
+		return
+	}
+
+	var buf bytes.Buffer
+	opts := export.CSVOptions{Delimiter: query.Delimiter, Encoding: query.Encoding}
+	if err := export.WriteCSV(&buf, data, opts); err != nil {
+		slog.Error("Failed to export spreadsheet as CSV", "sheetID", sheet.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while exporting the spreadsheet. Please try again later."})
+		return
+	}
+
+	c.Header("Content-Disposition", attachment(sheet.Title, ".csv"))
+	c.Data(http.StatusOK, "text/csv; charset="+csvCharsets[query.Encoding], buf.Bytes())
+}
+
+// xlsxContentType is the media type of Excel workbooks.
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// ExportXLSXHandler handles requests to download the current contents of a spreadsheet
+// as an Excel workbook, with a frozen, bold header row and cells styled after their
+// formats (see export.WriteXLSX). The contents and formats come from the live session of
+// the sheet if there is one, and from the database otherwise. Formula cells hold the
+// values of their formulas, like in CSV exports.
+//
+// The rows of live sheets are read from Redis in batches (see ws.EachRow) and the
+// workbook is streamed to the client as it is written, so an error that occurs once the
+// download has started can only be logged.
+func (h *SpreadsheetHandler) ExportXLSXHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	sheet, _, ok := h.accessibleSheet(c, token.Subject(), collab.RoleViewer)
+	if !ok {
+		return
+	}
+
+	rows, err := newSheetRows(h.collab, h.hub, sheet)
+	if err != nil {
+		slog.Error("Failed to read spreadsheet rows", "sheetID", sheet.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while exporting the spreadsheet. Please try again later."})
+		return
+	}
+
+	formats, err := currentFormats(h.collab, sheet, rows.live)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while exporting the spreadsheet. Please try again later."})
+		return
+	}
+
+	c.Header("Content-Disposition", attachment(sheet.Title, ".xlsx"))
+	c.Header("Content-Type", xlsxContentType)
+	c.Status(http.StatusOK)
+
+	if err := export.WriteXLSX(c.Writer, sheet.Title, rows.headers, rows.each, collab.ParseFormats(formats.Fields())); err != nil {
+		slog.Error("Failed to export spreadsheet as XLSX", "sheetID", sheet.ID, "error", err)
+	}
+}
+
+// attachment returns the Content-Disposition header of a download named after the title
+// of a sheet, with characters that are not allowed in file names replaced.
+func attachment(title, ext string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	if name == "" {
+		name = "spreadsheet"
+	}
+
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name + ext})
+}
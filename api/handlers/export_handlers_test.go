@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/waynekn/tablesync/api/db/repo"
+	"github.com/waynekn/tablesync/core/collab"
+	"github.com/waynekn/tablesync/core/ws"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestExportCSVHandler(t *testing.T) {
+	h := NewSpreadsheetHandler(repo.NewSpreadsheetRepo(testDb), repo.NewCollaboratorRepo(testDb), testStore, ws.NewHub())
+	sheetID := insertTestSheet(t, "name", "=total")
+
+	t.Run("stored data", func(t *testing.T) {
+		ctx, rec := setUpSheetCtx("GET", "/spreadsheet/"+sheetID+"/export/csv/", sheetID)
+		h.ExportCSVHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Header().Get("Content-Disposition"), "attachment")
+		assert.Equal(t, "name,'=total\r\n", rec.Body.String())
+	})
+
+	t.Run("live data with options", func(t *testing.T) {
+		data := [][]string{{"name", "=total"}, {"Amina", "12"}}
+		err := testStore.InitRedisSheet(sheetID, time.Now().Add(time.Hour), &data)
+		assert.NoError(t, err, "Failed to start a session for the test sheet")
+		t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+		ctx, rec := setUpSheetCtx("GET", "/spreadsheet/"+sheetID+"/export/csv/?delimiter=semicolon&encoding=utf-8-bom", sheetID)
+		h.ExportCSVHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "\xef\xbb\xbfname;'=total\r\nAmina;12\r\n", rec.Body.String())
+	})
+
+	t.Run("formulas are exported as their values", func(t *testing.T) {
+		err := testStore.ApplyEdit(sheetID, collab.EditMsg{Row: 1, Col: 0, Data: "=B1*2"})
+		assert.NoError(t, err, "Failed to edit the test sheet")
+
+		ctx, rec := setUpSheetCtx("GET", "/spreadsheet/"+sheetID+"/export/csv/", sheetID)
+		h.ExportCSVHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "name,'=total\r\n24,12\r\n", rec.Body.String())
+	})
+
+	t.Run("invalid delimiter", func(t *testing.T) {
+		ctx, rec := setUpSheetCtx("GET", "/spreadsheet/"+sheetID+"/export/csv/?delimiter=colon", sheetID)
+		h.ExportCSVHandler(ctx)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Delimiter must be one of")
+	})
+}
+
+func TestExportXLSXHandler(t *testing.T) {
+	h := NewSpreadsheetHandler(repo.NewSpreadsheetRepo(testDb), repo.NewCollaboratorRepo(testDb), testStore, ws.NewHub())
+	sheetID := insertTestSheet(t, "id", "name")
+
+	exportRows := func() [][]string {
+		t.Helper()
+		ctx, rec := setUpSheetCtx("GET", "/spreadsheet/"+sheetID+"/export/xlsx/", sheetID)
+		h.ExportXLSXHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, xlsxContentType, rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Header().Get("Content-Disposition"), ".xlsx")
+
+		f, err := excelize.OpenReader(rec.Body)
+		assert.NoError(t, err, "the response should be a workbook")
+		defer f.Close()
+
+		rows, err := f.GetRows(f.GetSheetList()[0])
+		assert.NoError(t, err, "Failed to read the rows")
+		return rows
+	}
+
+	t.Run("stored data", func(t *testing.T) {
+		assert.Equal(t, [][]string{{"id", "name"}}, exportRows())
+	})
+
+	t.Run("live data", func(t *testing.T) {
+		data := [][]string{{"id", "name"}, {"007", "Amina"}, {"12", "Baraka"}}
+		err := testStore.InitRedisSheet(sheetID, time.Now().Add(time.Hour), &data)
+		assert.NoError(t, err, "Failed to start a session for the test sheet")
+		t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+		assert.Equal(t, data, exportRows())
+
+		err = testStore.ApplyEdit(sheetID, collab.EditMsg{Row: 2, Col: 0, Data: "=A1*3"})
+		assert.NoError(t, err, "Failed to edit the test sheet")
+		assert.Equal(t, []string{"21", "Baraka"}, exportRows()[2], "formulas should be exported as their values")
+	})
+}
+
+func TestAttachment(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Class list", `attachment; filename="Class list.csv"`},
+		{"Q1/Q2: results", `attachment; filename="Q1_Q2_ results.csv"`},
+		{"  ", `attachment; filename=spreadsheet.csv`},
+		{"Résultats", `attachment; filename*=utf-8''R%C3%A9sultats.csv`},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, attachment(tt.title, ".csv"), "title %q", tt.title)
+	}
+}
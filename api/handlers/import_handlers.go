@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/waynekn/tablesync/api/importer"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/api/utils"
+)
+
+// maxImportSize is the maximum size of a request to import a spreadsheet, file included.
+const maxImportSize = 10 << 20
+
+// importReaders maps the extensions of the files that can be imported to their reader.
+var importReaders = map[string]func(io.Reader) ([][]string, error){
+	".csv":  importer.ReadCSV,
+	".xlsx": importer.ReadXLSX,
+}
+
+// ImportSpreadsheetHandler handles the creation of a new spreadsheet from a CSV or XLSX
+// file (see models.SpreadsheetImport).
+//
+// The headers of the sheet are taken from the first row of the file, or from another
+// row or the colTitles field if the user chooses so, and the rows below them become the
+// initial data of the sheet. Rows that had to be fixed to fit the sheet, such as ragged
+// rows or oversized cells, are reported in the `problems` of the response.
+func (h *SpreadsheetHandler) ImportSpreadsheetHandler(c *gin.Context) {
+	var form models.SpreadsheetImport
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	if err := c.ShouldBindWith(&form, binding.FormMultipart); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"file": fmt.Sprintf("File must be %d MB or less", maxImportSize>>20)})
+			return
+		}
+		respondWithBindingError(c, err)
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"file": "File is required"})
+		return
+	}
+
+	read, ok := importReaders[strings.ToLower(filepath.Ext(fileHeader.Filename))]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"file": "File must be a CSV or XLSX file"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		slog.Error("Failed to open imported file", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import spreadsheet"})
+		return
+	}
+	defer file.Close()
+
+	rows, err := read(file)
+	if err != nil {
+		if errors.Is(err, importer.ErrTooManyRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"file": fmt.Sprintf("File must have at most %d rows", importer.MaxRows)})
+			return
+		}
+		if errors.Is(err, importer.ErrTooManyColumns) {
+			c.JSON(http.StatusBadRequest, gin.H{"file": fmt.Sprintf("File must have at most %d columns", importer.MaxColumns)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"file": "File could not be read: " + err.Error()})
+		return
+	}
+
+	opts := importer.Options{HeaderRow: 1, Headers: form.ColTitles}
+	if form.HeaderRow != nil {
+		opts.HeaderRow = *form.HeaderRow
+	}
+	data, problems, err := importer.Build(rows, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, importer.ErrNoHeaders):
+			c.JSON(http.StatusBadRequest, gin.H{"colTitles": "The file has no headers, choose a header row or provide column titles"})
+		case errors.Is(err, importer.ErrTooManyRows):
+			c.JSON(http.StatusBadRequest, gin.H{"file": fmt.Sprintf("File must have at most %d rows", importer.MaxRows)})
+		case errors.Is(err, importer.ErrTooManyColumns):
+			c.JSON(http.StatusBadRequest, gin.H{"file": fmt.Sprintf("File must have at most %d columns", importer.MaxColumns)})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import spreadsheet"})
+		}
+		return
+	}
+
+	dataJson, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("Failed to marshal imported data", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import spreadsheet"})
+		return
+	}
+
+	sheet := models.SpreadsheetInit{
+		Title:       form.Title,
+		Description: form.Description,
+		Deadline:    form.Deadline,
+		ColTitles:   data[0],
+		LinkAccess:  form.LinkAccess,
+	}
+	id := utils.GenerateID()
+	if err := h.repo.InsertSpreadsheet(sheet, dataJson, token.Subject(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import spreadsheet"})
+		return
+	}
+
+	if problems == nil {
+		problems = []importer.Problem{}
+	}
+
+	c.Header("Location", "/spreadsheet/"+id+"/")
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Spreadsheet imported successfully",
+		"id":       id,
+		"rows":     len(data) - 1,
+		"problems": problems,
+	})
+}
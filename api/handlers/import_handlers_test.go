@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/waynekn/tablesync/api/db/repo"
+	"github.com/waynekn/tablesync/api/utils"
+	"github.com/waynekn/tablesync/core/ws"
+)
+
+// setUpImportCtx creates a test context for a multipart request to import the file
+// `filename` with the given form fields.
+func setUpImportCtx(fields map[string]string, filename, content string) (*gin.Context, *httptest.ResponseRecorder) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for key, val := range fields {
+		writer.WriteField(key, val)
+	}
+	if filename != "" {
+		file, _ := writer.CreateFormFile("file", filename)
+		file.Write([]byte(content))
+	}
+	writer.Close()
+
+	rec := httptest.NewRecorder()
+	ctx := utils.CreateTestCtxWithToken(rec)
+	ctx.Request = httptest.NewRequest("POST", "/spreadsheet/import/", &body)
+	ctx.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	return ctx, rec
+}
+
+func TestImportSpreadsheetHandler(t *testing.T) {
+	h := NewSpreadsheetHandler(repo.NewSpreadsheetRepo(testDb), repo.NewCollaboratorRepo(testDb), testStore, ws.NewHub())
+	fields := map[string]string{
+		"title":       "Imported sheet",
+		"description": "Imported from a CSV file",
+		"deadline":    "2030-01-01T00:00:00Z",
+	}
+
+	t.Run("import csv", func(t *testing.T) {
+		ctx, rec := setUpImportCtx(fields, "class.csv", "id;name\n007;Amina\n008\n")
+		h.ImportSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var result struct {
+			ID       string `json:"id"`
+			Rows     int    `json:"rows"`
+			Problems []struct {
+				Row  int    `json:"row"`
+				Kind string `json:"kind"`
+			} `json:"problems"`
+		}
+		err := json.Unmarshal(rec.Body.Bytes(), &result)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		assert.Equal(t, 2, result.Rows)
+		assert.Len(t, result.Problems, 1)
+		assert.Equal(t, 3, result.Problems[0].Row)
+
+		sheet, err := repo.NewSpreadsheetRepo(testDb).GetByID(result.ID)
+		assert.NoError(t, err, "Failed to retrieve the imported sheet")
+		var data [][]string
+		json.Unmarshal(sheet.Data, &data)
+		assert.Equal(t, [][]string{{"id", "name"}, {"007", "Amina"}, {"008", ""}}, data)
+	})
+
+	t.Run("no header row", func(t *testing.T) {
+		noHeaders := map[string]string{"headerRow": "0"}
+		for key, val := range fields {
+			noHeaders[key] = val
+		}
+		ctx, rec := setUpImportCtx(noHeaders, "class.csv", "007,Amina\n")
+		h.ImportSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "colTitles")
+	})
+
+	t.Run("unsupported file", func(t *testing.T) {
+		ctx, rec := setUpImportCtx(fields, "class.ods", "")
+		h.ImportSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "File must be a CSV or XLSX file")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		ctx, rec := setUpImportCtx(fields, "", "")
+		h.ImportSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "File is required")
+	})
+}
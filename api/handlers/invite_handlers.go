@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/waynekn/tablesync/api/db/repo"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/api/utils"
+	"github.com/waynekn/tablesync/core/ws"
+)
+
+type InviteHandler struct {
+	sheets  repo.SpreadsheetRepo
+	invites repo.InviteRepo
+	hub     *ws.Hub
+	key     []byte
+}
+
+// NewInviteHandler creates a new instance of InviteHandler with the provided repositories
+// and hub. Invite tokens are signed with `signingKey`.
+func NewInviteHandler(sheets repo.SpreadsheetRepo, invites repo.InviteRepo, hub *ws.Hub, signingKey []byte) *InviteHandler {
+	return &InviteHandler{sheets: sheets, invites: invites, hub: hub, key: signingKey}
+}
+
+// CreateInviteHandler handles requests by the owner of a spreadsheet to create an invite
+// link that adds whoever redeems it as a collaborator with the role of the invite.
+// The response contains the signed token to redeem the invite with.
+func (h *InviteHandler) CreateInviteHandler(c *gin.Context) {
+	var invite models.InviteInit
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&invite); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+
+	if !invite.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"expiresAt": "Expiry must be in the future"})
+		return
+	}
+
+	sheet, ok := ownedSheet(c, h.sheets, token.Subject())
+	if !ok {
+		return
+	}
+
+	created, err := h.invites.CreateInvite(utils.GenerateID(), sheet.ID, invite, token.Subject())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while creating the invite. Please try again later."})
+		return
+	}
+
+	created.Token = utils.SignInviteToken(created.ID, h.key)
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetInvitesHandler handles requests by the owner of a spreadsheet to list its invites,
+// including the expired and revoked ones.
+func (h *InviteHandler) GetInvitesHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	sheet, ok := ownedSheet(c, h.sheets, token.Subject())
+	if !ok {
+		return
+	}
+
+	invites, err := h.invites.GetBySheet(sheet.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving invites. Please try again later."})
+		return
+	}
+
+	for i := range *invites {
+		(*invites)[i].Token = utils.SignInviteToken((*invites)[i].ID, h.key)
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// RevokeInviteHandler handles requests by the owner of a spreadsheet to revoke one of its
+// invites. Collaborators who already joined through the invite keep their access.
+func (h *InviteHandler) RevokeInviteHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	sheet, ok := ownedSheet(c, h.sheets, token.Subject())
+	if !ok {
+		return
+	}
+
+	if err := h.invites.RevokeInvite(sheet.ID, c.Param("inviteID")); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while revoking the invite. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite revoked successfully"})
+}
+
+// GetRedemptionsHandler handles requests by the owner of a spreadsheet to see who joined
+// it through which invite.
+func (h *InviteHandler) GetRedemptionsHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	sheet, ok := ownedSheet(c, h.sheets, token.Subject())
+	if !ok {
+		return
+	}
+
+	redemptions, err := h.invites.GetRedemptions(sheet.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving redemptions. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, redemptions)
+}
+
+// RedeemInviteHandler handles requests to redeem the invite token in the request path,
+// adding the authenticated user as a collaborator of the invite's spreadsheet.
+// The user's live connections to the sheet are closed so that they reconnect with
+// their new role.
+func (h *InviteHandler) RedeemInviteHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	inviteID, err := utils.ParseInviteToken(c.Param("token"), h.key)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+
+	invite, err := h.invites.RedeemInvite(inviteID, token.Subject())
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		case errors.Is(err, repo.ErrInviteExpired):
+			c.JSON(http.StatusGone, gin.H{"error": "This invite has expired"})
+		case errors.Is(err, repo.ErrInviteRevoked):
+			c.JSON(http.StatusGone, gin.H{"error": "This invite has been revoked"})
+		case errors.Is(err, repo.ErrInviteUsedUp):
+			c.JSON(http.StatusGone, gin.H{"error": "This invite has reached its maximum number of uses"})
+		case errors.Is(err, repo.ErrInviteOwner):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You own this spreadsheet"})
+		case errors.Is(err, repo.ErrInviteRedeemed):
+			c.JSON(http.StatusConflict, gin.H{"error": "You have already used this invite"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while redeeming the invite. Please try again later."})
+		}
+		return
+	}
+
+	h.hub.CloseSheet <- ws.SheetClosure{SheetID: invite.SheetID, UserID: token.Subject(), Reason: accessChangedReason}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite redeemed successfully", "sheetId": invite.SheetID, "role": invite.Role})
+}
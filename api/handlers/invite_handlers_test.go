@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/waynekn/tablesync/api/db/repo"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/api/utils"
+	"github.com/waynekn/tablesync/core/ws"
+)
+
+// setUpInviteCtx creates a test context for a request by `subject` with the given path
+// params, and `body` encoded as JSON if it is not nil.
+func setUpInviteCtx(subject, method string, params gin.Params, body any) (*gin.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	ctx := utils.CreateTestCtxWithToken(rec)
+	token, _ := utils.TokenFromContext(ctx)
+	token.Set("sub", subject)
+
+	var jsonBytes []byte
+	if body != nil {
+		jsonBytes, _ = json.Marshal(body)
+	}
+
+	ctx.Request = httptest.NewRequest(method, "/invites/", bytes.NewReader(jsonBytes))
+	ctx.Params = params
+	return ctx, rec
+}
+
+func TestInviteHandlers(t *testing.T) {
+	hub := ws.NewHub()
+	h := NewInviteHandler(repo.NewSpreadsheetRepo(testDb), repo.NewInviteRepo(testDb), hub, []byte("test-key"))
+	sheets := NewSpreadsheetHandler(repo.NewSpreadsheetRepo(testDb), repo.NewCollaboratorRepo(testDb), testStore, hub)
+
+	sheetID := insertTestSheet(t, "header1", "header2")
+	restricted := models.LinkAccessNone
+	_, err := repo.NewSpreadsheetRepo(testDb).UpdateSpreadsheet(sheetID, models.SpreadsheetUpdate{LinkAccess: &restricted})
+	assert.NoError(t, err, "Failed to restrict the test sheet")
+
+	sheetParams := gin.Params{{Key: "sheetID", Value: sheetID}}
+	createInvite := func(t *testing.T, body any) models.Invite {
+		ctx, rec := setUpInviteCtx("test-user", "POST", sheetParams, body)
+		h.CreateInviteHandler(ctx)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var invite models.Invite
+		err := json.Unmarshal(rec.Body.Bytes(), &invite)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		return invite
+	}
+	redeem := func(user, token string) *httptest.ResponseRecorder {
+		ctx, rec := setUpInviteCtx(user, "POST", gin.Params{{Key: "token", Value: token}}, nil)
+		h.RedeemInviteHandler(ctx)
+		return rec
+	}
+
+	maxUses := 1
+	invite := createInvite(t, models.InviteInit{
+		Role:      models.CollaboratorRoleEditor,
+		ExpiresAt: time.Now().Add(time.Hour),
+		MaxUses:   &maxUses,
+	})
+	student := utils.GenerateID()
+
+	t.Run("only the owner can create invites", func(t *testing.T) {
+		body := models.InviteInit{Role: models.CollaboratorRoleViewer, ExpiresAt: time.Now().Add(time.Hour)}
+		ctx, rec := setUpInviteCtx(student, "POST", sheetParams, body)
+		h.CreateInviteHandler(ctx)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("expiry in the past", func(t *testing.T) {
+		body := models.InviteInit{Role: models.CollaboratorRoleViewer, ExpiresAt: time.Now().Add(-time.Hour)}
+		ctx, rec := setUpInviteCtx("test-user", "POST", sheetParams, body)
+		h.CreateInviteHandler(ctx)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("tampered token", func(t *testing.T) {
+		rec := redeem(student, invite.ID+".forged")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("owner cannot redeem", func(t *testing.T) {
+		rec := redeem("test-user", invite.Token)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("redeem invite", func(t *testing.T) {
+		rec := redeem(student, invite.Token)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), models.CollaboratorRoleEditor)
+
+		ctx, rec := setUpCollaboratorCtx(student, "GET", sheetID, "", nil)
+		sheets.GetSpreadsheetHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code, "users who redeem an invite should be able to retrieve the sheet")
+	})
+
+	t.Run("redeem twice", func(t *testing.T) {
+		rec := redeem(student, invite.Token)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("used up invite", func(t *testing.T) {
+		rec := redeem(utils.GenerateID(), invite.Token)
+		assert.Equal(t, http.StatusGone, rec.Code)
+	})
+
+	t.Run("list redemptions", func(t *testing.T) {
+		ctx, rec := setUpInviteCtx("test-user", "GET", sheetParams, nil)
+		h.GetRedemptionsHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var result []models.InviteRedemption
+		err := json.Unmarshal(rec.Body.Bytes(), &result)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		assert.Len(t, result, 1)
+		assert.Equal(t, invite.ID, result[0].InviteID)
+		assert.Equal(t, student, result[0].UserID)
+	})
+
+	t.Run("revoked invite", func(t *testing.T) {
+		revoked := createInvite(t, models.InviteInit{Role: models.CollaboratorRoleViewer, ExpiresAt: time.Now().Add(time.Hour)})
+
+		params := gin.Params{{Key: "sheetID", Value: sheetID}, {Key: "inviteID", Value: revoked.ID}}
+		ctx, rec := setUpInviteCtx("test-user", "DELETE", params, nil)
+		h.RevokeInviteHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = redeem(utils.GenerateID(), revoked.Token)
+		assert.Equal(t, http.StatusGone, rec.Code)
+	})
+
+	t.Run("list invites", func(t *testing.T) {
+		ctx, rec := setUpInviteCtx("test-user", "GET", sheetParams, nil)
+		h.GetInvitesHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var result []models.Invite
+		err := json.Unmarshal(rec.Body.Bytes(), &result)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		assert.Len(t, result, 2)
+	})
+
+	t.Run("redeem invites of other roles", func(t *testing.T) {
+		collaborators := repo.NewCollaboratorRepo(testDb)
+
+		manager := createInvite(t, models.InviteInit{Role: models.CollaboratorRoleManager, ExpiresAt: time.Now().Add(time.Hour)})
+		rec := redeem(student, manager.Token)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		role, err := collaborators.GetRole(sheetID, student)
+		assert.NoError(t, err)
+		assert.Equal(t, models.CollaboratorRoleManager, role, "editors should be upgraded by higher invites")
+
+		viewer := createInvite(t, models.InviteInit{Role: models.CollaboratorRoleViewer, ExpiresAt: time.Now().Add(time.Hour)})
+		rec = redeem(student, viewer.Token)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		role, err = collaborators.GetRole(sheetID, student)
+		assert.NoError(t, err)
+		assert.Equal(t, models.CollaboratorRoleManager, role, "collaborators should never be downgraded")
+	})
+}
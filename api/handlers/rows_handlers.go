@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/waynekn/tablesync/api/importer"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/api/schema"
+	"github.com/waynekn/tablesync/api/utils"
+	"github.com/waynekn/tablesync/core/collab"
+)
+
+// ndjsonContentType is the media type of newline delimited JSON.
+const ndjsonContentType = "application/x-ndjson"
+
+// maxRowSize is the maximum size of a request to add a row to a spreadsheet.
+const maxRowSize = 1 << 20
+
+// GetRowsHandler handles requests to retrieve the current data rows of a spreadsheet as
+// JSON objects keyed by column title (see recordKeys), in the order of the rows. Rows
+// are indexed the same way as client edits, so the record at position i is row i.
+// Formula cells hold the values of their formulas, see sheetRows.
+//
+// With the format query parameter set to ndjson, the records are streamed one per line
+// instead of as an array, so that big sheets are never held in memory as a whole. An
+// error that occurs once the stream has started can only be logged.
+func (h *SpreadsheetHandler) GetRowsHandler(c *gin.Context) {
+	var query models.RowsQuery
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+
+	sheet, _, ok := h.accessibleSheet(c, token.Subject(), collab.RoleViewer)
+	if !ok {
+		return
+	}
+
+	rows, err := newSheetRows(h.collab, h.hub, sheet)
+	if err != nil {
+		slog.Error("Failed to read sheet rows", "sheetID", sheet.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving the rows. Please try again later."})
+		return
+	}
+	keys := recordKeys(rows.headers)
+
+	if query.Format == models.RowsFormatNDJSON {
+		c.Header("Content-Type", ndjsonContentType)
+		c.Status(http.StatusOK)
+
+		// json.Encoder ends each record with a newline
+		enc := json.NewEncoder(c.Writer)
+		err := rows.each(func(index int, row []string) error {
+			return enc.Encode(record{keys: keys, values: row})
+		})
+		if err != nil {
+			slog.Error("Failed to stream sheet rows", "sheetID", sheet.ID, "error", err)
+		}
+		return
+	}
+
+	records := make([]record, 0)
+	err = rows.each(func(index int, row []string) error {
+		records = append(records, record{keys: keys, values: row})
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to read sheet rows", "sheetID", sheet.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving the rows. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, records)
+}
+
+// GetRowHandler handles requests to retrieve a single data row of a spreadsheet, by the
+// index in the request path, as a JSON object keyed by column title. Rows are indexed
+// the same way as client edits and GetRowsHandler, and formulas are replaced by their
+// values in the same way.
+func (h *SpreadsheetHandler) GetRowHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	index, err := strconv.Atoi(c.Param("row"))
+	if err != nil || index < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"row": "Row must be a non-negative integer"})
+		return
+	}
+
+	sheet, _, ok := h.accessibleSheet(c, token.Subject(), collab.RoleViewer)
+	if !ok {
+		return
+	}
+
+	rows, err := newSheetRows(h.collab, h.hub, sheet)
+	if err != nil {
+		slog.Error("Failed to read sheet rows", "sheetID", sheet.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving the row. Please try again later."})
+		return
+	}
+
+	row, found, err := rows.row(index)
+	if err != nil {
+		slog.Error("Failed to read sheet row", "sheetID", sheet.ID, "row", index, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving the row. Please try again later."})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Row not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, record{keys: recordKeys(rows.headers), values: row})
+}
+
+// AppendRowHandler handles requests to add a row to a spreadsheet without joining its
+// live editing session, e.g. from a form. The row is given as a JSON object keyed by
+// column title (see recordKeys), and columns missing from it are left blank. Rows without
+// any value are rejected, as they would only take up a row, and so are cells longer
+// than the cells of imported files (see importer.MaxCellLength).
+//
+// The row is validated like the edits of live clients, including the row ownership mode
+// of the sheet, and is stored in the live editing session of the sheet, which is
+// initialized if needed. Clients connected to the sheet receive its cells as edits.
+// It responds with the index of the new row, counted the same way as GetRowHandler.
+func (h *SpreadsheetHandler) AppendRowHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var values map[string]any
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxRowSize)
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil || values == nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("The row must be %d MB or less", maxRowSize>>20)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The row must be a JSON object keyed by column title"})
+		return
+	}
+
+	// read before the sheet, see initSession
+	version, err := columnsVersion(h.collab, c.Param("sheetID"))
+	if err != nil {
+		respondWithSessionError(c, err)
+		return
+	}
+
+	sheet, role, ok := h.accessibleSheet(c, token.Subject(), collab.RoleEditor)
+	if !ok {
+		return
+	}
+	if time.Now().After(sheet.Deadline) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The deadline to edit this sheet has passed."})
+		return
+	}
+
+	headers, err := initSession(h.collab, sheet, version)
+	if err != nil {
+		respondWithSessionError(c, err)
+		return
+	}
+
+	keys := recordKeys(headers)
+	columns := schema.Of(sheet.Columns, headers)
+	cells, detail := recordCells(keys, values)
+	for col, value := range cells {
+		if _, ok := detail[keys[col]]; ok {
+			continue
+		}
+		if err := collab.ValidateCell(columns, col, value); err != nil {
+			detail[keys[col]] = err.Error()
+		}
+	}
+	if len(detail) > 0 {
+		c.JSON(http.StatusBadRequest, detail)
+		return
+	}
+	if !slices.ContainsFunc(cells, func(value string) bool { return value != "" }) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The row must have at least one value"})
+		return
+	}
+
+	var claim *collab.RowClaim
+	if policy := rowPolicy(sheet); policy.Enabled {
+		claim = &collab.RowClaim{
+			UserID:     token.Subject(),
+			ColNum:     len(headers),
+			MaxRows:    policy.MaxRows,
+			Restricted: !role.AtLeast(collab.RoleManager),
+		}
+	}
+
+	// formulas must see the cells of the row before any later edit to them, and the
+	// columns cannot change meanwhile, see changeColumns
+	unlock := h.hub.LockEdits(sheet.ID)
+	defer unlock()
+	if changed, err := columnsChanged(h.collab, sheet.ID, version); changed || err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": columnsChangingMessage})
+		return
+	}
+
+	row, err := h.collab.AppendRow(sheet.ID, columns, cells, claim)
+	var cellErr *collab.CellError
+	if errors.As(err, &cellErr) {
+		if cellErr.Rule == collab.RuleRowOwner || cellErr.Rule == collab.RuleRowLimit {
+			c.JSON(http.StatusForbidden, gin.H{"error": cellErr.Message})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{keys[cellErr.Col]: cellErr.Message})
+		return
+	}
+	if errors.Is(err, collab.ErrNoSession) {
+		c.JSON(http.StatusConflict, gin.H{"error": "The sheet was closed while the row was being added. Please try again."})
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to append row", "sheetID", sheet.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while adding the row. Please try again later."})
+		return
+	}
+
+	author := authorFromContext(c)
+	for col, value := range cells {
+		if value == "" {
+			continue
+		}
+		edit := collab.EditMsg{Row: row, Col: col, Data: value}
+		// clients count rows without the header row
+		h.hub.Broadcast <- collab.BroadCastMsg{
+			SheetID: sheet.ID,
+			Author:  author,
+			Edit:    collab.EditMsg{Row: row - 1, Col: col, Data: value},
+		}
+		if err := h.hub.Recalculate(h.collab, sheet.ID, edit); err != nil {
+			slog.Error("Failed to recalculate formulas", "sheetID", sheet.ID, "error", err)
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"row": row - 1})
+}
+
+// recordCells returns the cells of a row given as a record keyed by the `keys` of the
+// columns (see recordKeys). Strings are taken as they are, while numbers and booleans
+// are written out, and null is blank. Keys that are not columns and values of other
+// types are reported by key.
+func recordCells(keys []string, values map[string]any) ([]string, map[string]string) {
+	cols := make(map[string]int, len(keys))
+	for i, key := range keys {
+		cols[key] = i
+	}
+
+	cells := make([]string, len(keys))
+	detail := make(map[string]string)
+	for key, value := range values {
+		col, ok := cols[key]
+		if !ok {
+			detail[key] = "Unknown column"
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			cells[col] = v
+		case json.Number:
+			cells[col] = v.String()
+		case bool:
+			cells[col] = strconv.FormatBool(v)
+		case nil:
+		default:
+			detail[key] = "Value must be a string, number or boolean"
+		}
+		if utf8.RuneCountInString(cells[col]) > importer.MaxCellLength {
+			detail[key] = fmt.Sprintf("Value must be at most %d characters long", importer.MaxCellLength)
+		}
+	}
+	return cells, detail
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/waynekn/tablesync/api/db/repo"
+	"github.com/waynekn/tablesync/api/importer"
+	"github.com/waynekn/tablesync/core/collab"
+	"github.com/waynekn/tablesync/core/formula"
+	"github.com/waynekn/tablesync/core/ws"
+)
+
+func TestGetRowsHandler(t *testing.T) {
+	h := NewSpreadsheetHandler(repo.NewSpreadsheetRepo(testDb), repo.NewCollaboratorRepo(testDb), testStore, ws.NewHub())
+	sheetID := insertTestSheet(t, "id", "name")
+
+	data := [][]string{{"id", "name"}, {"007", "Amina"}, {"008", "Brian"}}
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(time.Hour), &data)
+	assert.NoError(t, err, "Failed to start a session for the test sheet")
+	t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+	t.Run("json", func(t *testing.T) {
+		ctx, rec := setUpSheetCtx("GET", "/spreadsheet/"+sheetID+"/rows/", sheetID)
+		h.GetRowsHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `[{"id":"007","name":"Amina"},{"id":"008","name":"Brian"}]`, rec.Body.String())
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		ctx, rec := setUpSheetCtx("GET", "/spreadsheet/"+sheetID+"/rows/?format=ndjson", sheetID)
+		h.GetRowsHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, ndjsonContentType, rec.Header().Get("Content-Type"))
+		lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+		assert.Len(t, lines, 2)
+		assert.JSONEq(t, `{"id":"008","name":"Brian"}`, lines[1])
+	})
+
+	t.Run("single row", func(t *testing.T) {
+		err := testStore.ApplyEdit(sheetID, collab.EditMsg{Row: 2, Col: 1, Data: "Brenda"})
+		assert.NoError(t, err, "Failed to edit the test sheet")
+
+		ctx, rec := setUpSheetCtx("GET", "/spreadsheet/"+sheetID+"/rows/1/", sheetID)
+		ctx.Params = append(ctx.Params, gin.Param{Key: "row", Value: "1"})
+		h.GetRowHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id":"008","name":"Brenda"}`, rec.Body.String())
+	})
+
+	t.Run("formulas", func(t *testing.T) {
+		err := testStore.ApplyEdit(sheetID, collab.EditMsg{Row: 2, Col: 0, Data: "=CONCAT(B1:B2)"})
+		assert.NoError(t, err, "Failed to edit the test sheet")
+		t.Cleanup(func() { testStore.ApplyEdit(sheetID, collab.EditMsg{Row: 2, Col: 0, Data: "008"}) })
+
+		ctx, rec := setUpSheetCtx("GET", "/spreadsheet/"+sheetID+"/rows/", sheetID)
+		h.GetRowsHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `[{"id":"007","name":"Amina"},{"id":"AminaBrenda","name":"Brenda"}]`,
+			rec.Body.String(), "formulas should be replaced by their values")
+	})
+
+	t.Run("row out of range", func(t *testing.T) {
+		ctx, rec := setUpSheetCtx("GET", "/spreadsheet/"+sheetID+"/rows/2/", sheetID)
+		ctx.Params = append(ctx.Params, gin.Param{Key: "row", Value: "2"})
+		h.GetRowHandler(ctx)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestAppendRowHandler(t *testing.T) {
+	hub := ws.NewHub()
+	h := NewSpreadsheetHandler(repo.NewSpreadsheetRepo(testDb), repo.NewCollaboratorRepo(testDb), testStore, hub)
+	sheetID := insertTestSheet(t, "id", "name")
+	t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+	appendRow := func(body string) *httptest.ResponseRecorder {
+		ctx, rec := setUpSheetCtx("POST", "/spreadsheet/"+sheetID+"/rows/", sheetID)
+		ctx.Request = httptest.NewRequest("POST", "/spreadsheet/"+sheetID+"/rows/", strings.NewReader(body))
+		h.AppendRowHandler(ctx)
+		return rec
+	}
+
+	t.Run("appends rows", func(t *testing.T) {
+		viewer := ws.NewViewer(sheetID, "")
+		hub.Register <- viewer
+		time.Sleep(50 * time.Millisecond)
+		defer func() { hub.Unregister <- viewer }()
+
+		rec := appendRow(`{"id": 7, "name": "Amina"}`)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"row":0}`, rec.Body.String())
+
+		rec = appendRow(`{"name": "Brian"}`)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"row":1}`, rec.Body.String())
+
+		rows, err := testStore.GetRows(sheetID, 1, 3, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"7", "Amina"}, {"", "Brian"}}, rows)
+
+		select {
+		case msg := <-viewer.Send:
+			body, _ := json.Marshal(msg)
+			var edit struct {
+				Type string `json:"type"`
+				Row  int    `json:"row"`
+				Col  int    `json:"col"`
+				Data string `json:"data"`
+			}
+			_ = json.Unmarshal(body, &edit)
+			assert.Equal(t, "edit", edit.Type)
+			assert.Equal(t, []any{0, 0, "7"}, []any{edit.Row, edit.Col, edit.Data})
+		case <-time.After(time.Second):
+			t.Fatal("connected clients should receive the cells of the row")
+		}
+	})
+
+	t.Run("unknown column", func(t *testing.T) {
+		rec := appendRow(`{"id": "9", "email": "chen@example.com"}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"email":"Unknown column"}`, rec.Body.String())
+	})
+
+	t.Run("not an object", func(t *testing.T) {
+		rec := appendRow(`["9", "Chen"]`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("empty record", func(t *testing.T) {
+		for _, body := range []string{`{}`, `{"id": "", "name": null}`} {
+			rec := appendRow(body)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, "%s should not take up a row", body)
+		}
+
+		rec := appendRow(`{"name": "Chen"}`)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"row":2}`, rec.Body.String(), "empty records should not reserve rows")
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		rec := appendRow(`{"name": "` + strings.Repeat("x", maxRowSize) + `"}`)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+}
+
+func TestStoredFormulaValues(t *testing.T) {
+	data := [][]string{{"a", "b"}, {"2", "=A1*3"}, {"=B1+A1", "text"}}
+	values, err := storedFormulaValues(data)
+	assert.NoError(t, err)
+	assert.Equal(t, map[formula.Cell]string{{Row: 1, Col: 1}: "6", {Row: 2, Col: 0}: "8"}, values)
+
+	rows := &sheetRows{headers: data[0], stored: data[1:], computed: values}
+	row, found, err := rows.row(1)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []string{"8", "text"}, row)
+	assert.Equal(t, "=B1+A1", data[2][0], "the stored data should be left as it is")
+}
+
+func TestRecordCells(t *testing.T) {
+	values := map[string]any{"name": "Amina", "score": json.Number("12.5"), "active": true, "notes": nil}
+	cells, detail := recordCells([]string{"name", "score", "active", "notes", "team"}, values)
+	assert.Empty(t, detail)
+	assert.Equal(t, []string{"Amina", "12.5", "true", "", ""}, cells)
+
+	_, detail = recordCells([]string{"name"}, map[string]any{"name": []any{"a"}, "age": "3"})
+	assert.Equal(t, map[string]string{
+		"name": "Value must be a string, number or boolean",
+		"age":  "Unknown column",
+	}, detail)
+
+	_, detail = recordCells([]string{"name"}, map[string]any{"name": strings.Repeat("é", importer.MaxCellLength+1)})
+	assert.Contains(t, detail, "name", "cells longer than imported cells should be rejected")
+
+	_, detail = recordCells([]string{"name"}, map[string]any{"name": strings.Repeat("é", importer.MaxCellLength)})
+	assert.Empty(t, detail)
+}
+
+func TestRecordKeys(t *testing.T) {
+	keys := recordKeys([]string{"name", "", "name", "name (2)", "score"})
+	assert.Equal(t, []string{"name", "Column 2", "name (2)", "name (2) (2)", "score"}, keys)
+}
+
+func TestRecordMarshalJSON(t *testing.T) {
+	body, err := json.Marshal(record{keys: []string{"z", "a", "m"}, values: []string{"1", "2"}})
+	assert.NoError(t, err, "record should marshal")
+	assert.Equal(t, `{"z":"1","a":"2","m":""}`, string(body), "keys should keep the order of the columns")
+}
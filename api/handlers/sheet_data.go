@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"github.com/waynekn/tablesync/api/db/repo"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/core/collab"
+	"github.com/waynekn/tablesync/core/ws"
+)
+
+// currentSheetData returns the current contents of the sheet, headers included.
+// While a collaborative session is live its Redis data is newer than the data in the
+// database, so it is used instead. The returned bool reports whether the data is live.
+func currentSheetData(store *collab.Store, sheet *models.Spreadsheet) ([][]string, bool, error) {
+	var sheetData [][]string
+	if err := json.Unmarshal(sheet.Data, &sheetData); err != nil {
+		slog.Error("error unmarshalling sheet data", "sheetID", sheet.ID, "err", err)
+		return nil, false, err
+	}
+	if len(sheetData) == 0 {
+		return nil, false, errors.New("sheet has no column headers")
+	}
+
+	exists, err := store.SheetExists(sheet.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	if !exists {
+		return sheetData, false, nil
+	}
+
+	liveData, err := ws.LoadSheetData(store, sheet.ID, len(sheetData[0]))
+	if err != nil {
+		return nil, false, err
+	}
+	return liveData, true, nil
+}
+
+// currentFormats returns the current formats of the sheet, see currentSheetData. `live`
+// reports whether the sheet has a live session.
+func currentFormats(store *collab.Store, sheet *models.Spreadsheet, live bool) (models.Formats, error) {
+	if !live {
+		return sheet.Formats, nil
+	}
+	fields, err := store.FormatFields(sheet.ID)
+	if err != nil {
+		return nil, err
+	}
+	return models.FormatsFromFields(fields), nil
+}
+
+// saveSession saves the data of the live session of the sheet, the owners of its rows and
+// its formats to the database, so that they outlive the session. It does nothing if the
+// sheet has no session.
+func saveSession(store *collab.Store, sheets repo.SpreadsheetRepo, sheet *models.Spreadsheet) error {
+	data, live, err := currentSheetData(store, sheet)
+	if err != nil || !live {
+		return err
+	}
+
+	owners, err := store.RowOwners(sheet.ID)
+	if err != nil {
+		return err
+	}
+	formats, err := currentFormats(store, sheet, live)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("error marshalling sheet data", "sheetID", sheet.ID, "err", err)
+		return err
+	}
+	return sheets.SaveData(sheet.ID, raw, owners, formats)
+}
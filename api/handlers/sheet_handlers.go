@@ -1,30 +1,42 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/waynekn/tablesync/api/db/repo"
 	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/api/schema"
 	"github.com/waynekn/tablesync/api/utils"
+	"github.com/waynekn/tablesync/core/collab"
+	"github.com/waynekn/tablesync/core/ws"
 )
 
 type SpreadsheetHandler struct {
-	repo repo.SpreadsheetRepo
+	repo          repo.SpreadsheetRepo
+	collaborators repo.CollaboratorRepo
+	collab        *collab.Store
+	hub           *ws.Hub
 }
 
 // NewSpreadsheetHandler creates a new instance of SpreadsheetHandler
-// with the provided repository.
-func NewSpreadsheetHandler(repo repo.SpreadsheetRepo) *SpreadsheetHandler {
-	return &SpreadsheetHandler{repo: repo}
+// with the provided repositories, collaboration store and hub.
+func NewSpreadsheetHandler(repo repo.SpreadsheetRepo, collaborators repo.CollaboratorRepo,
+	collabStore *collab.Store, hub *ws.Hub) *SpreadsheetHandler {
+	return &SpreadsheetHandler{repo: repo, collaborators: collaborators, collab: collabStore, hub: hub}
 }
 
-// CreateSpreadsheetHandler handles the creation of a new spreadsheet.
+// CreateSpreadsheetHandler handles the creation of a new spreadsheet. Columns given
+// with types must be well defined (see collab.Column.Check), and every edit made to
+// them is then validated against their type.
 func (h *SpreadsheetHandler) CreateSpreadsheetHandler(c *gin.Context) {
 	var sheet models.SpreadsheetInit
 
@@ -36,45 +48,21 @@ func (h *SpreadsheetHandler) CreateSpreadsheetHandler(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&sheet); err != nil {
-		// Handle validation errors
-		var verr validator.ValidationErrors
-		if errors.As(err, &verr) {
-			detail := make(map[string]string)
-			for _, fieldErr := range verr {
-				detail[fieldErr.Field()] = utils.GetValidationErrorMessage(fieldErr)
-			}
-			c.JSON(http.StatusBadRequest, detail)
-			return
-		}
-
-		// Handle time parsing errors
-		var jsonErr *json.UnmarshalTypeError
-		var timeErr *time.ParseError
-		if (errors.As(err, &jsonErr) && jsonErr.Field == "deadline") ||
-			errors.As(err, &timeErr) {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"deadline": "Invalid deadline time format.",
-			})
-			return
-		}
+		respondWithBindingError(c, err)
+		return
+	}
 
-		// Handle other JSON parsing errors
-		var syntaxErr *json.SyntaxError
-		if errors.As(err, &syntaxErr) {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Invalid JSON syntax",
-			})
+	for i, column := range sheet.ColumnDefs() {
+		if err := schema.Column(column).Check(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{fmt.Sprintf("columns[%d]", i): "Invalid column: " + err.Error()})
 			return
 		}
-		// If it's not a validation error, return a generic message
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
-		return
 	}
 
 	id := utils.GenerateID()
 	// Convert to a 2D array representation
 	columns := make([][]string, 1)
-	columns[0] = append(columns[0], sheet.ColTitles...)
+	columns[0] = append(columns[0], sheet.Headers()...)
 	columnsJson, err := json.Marshal(columns)
 	if err != nil {
 		slog.Error("Failed to marshal columns", "error", err)
@@ -89,12 +77,26 @@ func (h *SpreadsheetHandler) CreateSpreadsheetHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Spreadsheet created successfully"})
+	c.Header("Location", "/spreadsheet/"+id+"/")
+	c.JSON(http.StatusCreated, gin.H{"message": "Spreadsheet created successfully", "id": id})
 }
 
 // GetOwnSpreadsheetsHandler handles requests to retrieve spreadsheets owned by
-// the authenticated user.
+// the authenticated user, without their data.
+//
+// The spreadsheets are paginated, sorted and filtered according to the query parameters
+// (see models.SpreadsheetListQuery). The body is the list of spreadsheets in the page,
+// and the cursor of the next page, if there is one, is sent in the X-Next-Cursor header.
 func (h *SpreadsheetHandler) GetOwnSpreadsheetsHandler(c *gin.Context) {
+	h.listSpreadsheets(c, h.repo.GetByOwner)
+}
+
+// listSpreadsheets responds with a page of the spreadsheets `list` retrieves for the
+// authenticated user, see GetOwnSpreadsheetsHandler.
+func (h *SpreadsheetHandler) listSpreadsheets(c *gin.Context,
+	list func(user string, query models.SpreadsheetListQuery) (*models.SpreadsheetPage, error)) {
+	var query models.SpreadsheetListQuery
+
 	token, err := utils.TokenFromContext(c)
 	if err != nil {
 		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
@@ -102,7 +104,195 @@ func (h *SpreadsheetHandler) GetOwnSpreadsheetsHandler(c *gin.Context) {
 		return
 	}
 
-	spreadsheets, err := h.repo.GetByOwner(token.Subject())
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+
+	page, err := list(token.Subject(), query)
+	if err != nil {
+		if errors.Is(err, repo.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"cursor": "Invalid cursor"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving spreadsheets. Please try again later."})
+		return
+	}
+
+	if page.NextCursor != "" {
+		c.Header("X-Next-Cursor", page.NextCursor)
+	}
+	c.JSON(http.StatusOK, page.Items)
+}
+
+// GetSpreadsheetHandler handles requests to retrieve a single spreadsheet along with
+// its current contents and formats, which are read from the live editing session if
+// there is one.
+//
+// Like the live view, it may be retrieved by anyone with a role in the sheet (see
+// sheetRole). Responses carry an ETag, and requests whose If-None-Match header matches
+// it get a 304 Not Modified.
+func (h *SpreadsheetHandler) GetSpreadsheetHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	sheet, _, ok := h.accessibleSheet(c, token.Subject(), collab.RoleViewer)
+	if !ok {
+		return
+	}
+
+	data, live, err := currentSheetData(h.collab, sheet)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving the spreadsheet. Please try again later."})
+		return
+	}
+	formats, err := currentFormats(h.collab, sheet, live)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving the spreadsheet. Please try again later."})
+		return
+	}
+	if formats == nil {
+		formats = models.Formats{}
+	}
+
+	sheet.Columns = sheet.Columns.Schema(data[0])
+	body, err := json.Marshal(models.SpreadsheetWithData{Spreadsheet: *sheet, Data: data, Formats: formats, Live: live})
+	if err != nil {
+		slog.Error("Failed to marshal spreadsheet", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving the spreadsheet. Please try again later."})
+		return
+	}
+
+	etag := utils.ETag(body)
+	c.Header("ETag", etag)
+	// the contents change while the sheet is being edited, so always revalidate
+	c.Header("Cache-Control", "no-cache")
+
+	if utils.ETagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// UpdateSpreadsheetHandler handles requests by the owner of a spreadsheet to update
+// its title, description, deadline, link access or row ownership mode.
+//
+// Changing the deadline also changes when the live editing session expires, and every
+// client connected to the sheet is notified of the new metadata. Changing the link access
+// or the row ownership mode disconnects every client so that they reconnect with their
+// new role and rights.
+func (h *SpreadsheetHandler) UpdateSpreadsheetHandler(c *gin.Context) {
+	var update models.SpreadsheetUpdate
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&update); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+
+	if update.Deadline != nil && !update.Deadline.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"deadline": "Deadline must be in the future"})
+		return
+	}
+
+	sheet, ok := ownedSheet(c, h.repo, token.Subject())
+	if !ok {
+		return
+	}
+
+	previousLinkAccess, previousRows := sheet.LinkAccess, rowPolicy(sheet)
+	sheet, err = h.repo.UpdateSpreadsheet(sheet.ID, update)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while updating the spreadsheet. Please try again later."})
+		return
+	}
+
+	if update.Deadline != nil {
+		// the session would otherwise expire at the previous deadline. Failing to
+		// update it is not fatal as the session is recreated when a client reconnects.
+		if err := h.collab.SetDeadline(sheet.ID, sheet.Deadline); err != nil {
+			slog.Error("Failed to update the session deadline", "sheetID", sheet.ID, "error", err)
+		}
+	}
+
+	h.hub.Broadcast <- collab.BroadCastMsg{
+		SheetID: sheet.ID,
+		Event:   ws.NewSheetUpdatedMsg(sheet.Title, sheet.Description, sheet.Deadline, sheet.LinkAccess),
+	}
+
+	// the role of connections that rely on the link access, or what they may edit, may
+	// have changed
+	if sheet.LinkAccess != previousLinkAccess || rowPolicy(sheet) != previousRows {
+		h.hub.CloseSheet <- ws.SheetClosure{SheetID: sheet.ID, Reason: accessChangedReason}
+	}
+
+	c.JSON(http.StatusOK, sheet)
+}
+
+// DeleteSpreadsheetHandler handles requests by the owner of a spreadsheet to move it to
+// the trash. Every client connected to the sheet is disconnected, and its live editing
+// session is saved to the database and removed. The sheet can be restored, with its live
+// edits, until the trash is purged.
+func (h *SpreadsheetHandler) DeleteSpreadsheetHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	sheet, ok := ownedSheet(c, h.repo, token.Subject())
+	if !ok {
+		return
+	}
+
+	if err := h.repo.MoveToTrash(sheet.ID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Spreadsheet not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while deleting the spreadsheet. Please try again later."})
+		return
+	}
+
+	// disconnect clients before removing the session. Edits they make meanwhile are
+	// refused once the session is removed, see collab.ErrNoSession.
+	h.hub.CloseSheet <- ws.SheetClosure{SheetID: sheet.ID, Reason: "This sheet was deleted by its owner."}
+
+	// keep the live edits so that they are not lost if the sheet is restored. If they
+	// cannot be saved the session is kept, to be picked up again by a restore while it lasts.
+	if err := saveSession(h.collab, h.repo, sheet); err != nil {
+		slog.Error("Failed to save the session of a deleted sheet", "sheetID", sheet.ID, "error", err)
+	} else if err := h.collab.DeleteSheet(sheet.ID); err != nil {
+		slog.Error("Failed to delete the session of a deleted sheet", "sheetID", sheet.ID, "error", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Spreadsheet moved to trash"})
+}
+
+// GetTrashHandler handles requests to retrieve the spreadsheets the authenticated user
+// has moved to the trash.
+func (h *SpreadsheetHandler) GetTrashHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	spreadsheets, err := h.repo.GetTrashByOwner(token.Subject())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving spreadsheets. Please try again later."})
 		return
@@ -110,3 +300,187 @@ func (h *SpreadsheetHandler) GetOwnSpreadsheetsHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, spreadsheets)
 }
+
+// RestoreSpreadsheetHandler handles requests by the owner of a spreadsheet to restore
+// it from the trash.
+func (h *SpreadsheetHandler) RestoreSpreadsheetHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	sheet, err := h.repo.RestoreFromTrash(c.Param("sheetID"), token.Subject())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Spreadsheet not found in trash"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while restoring the spreadsheet. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, sheet)
+}
+
+// DuplicateSpreadsheetHandler handles requests to copy a spreadsheet the authenticated
+// user can view into a new spreadsheet they own, with a new title and deadline. The
+// copy has the columns and settings of the original, and its rows too if they are
+// asked for, in which case they are read from the live session of the sheet if there
+// is one.
+func (h *SpreadsheetHandler) DuplicateSpreadsheetHandler(c *gin.Context) {
+	var cp models.SpreadsheetCopy
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&cp); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+
+	if !cp.Deadline.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"deadline": "Deadline must be in the future"})
+		return
+	}
+
+	source, _, ok := h.accessibleSheet(c, token.Subject(), collab.RoleViewer)
+	if !ok {
+		return
+	}
+
+	data, _, err := currentSheetData(h.collab, source)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while duplicating the spreadsheet. Please try again later."})
+		return
+	}
+	if !cp.IncludeData {
+		data = data[:1]
+	}
+
+	dataJson, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("Failed to marshal sheet data", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to duplicate spreadsheet"})
+		return
+	}
+
+	id := utils.GenerateID()
+	if err := h.repo.InsertSpreadsheet(source.Copy(cp, data[0]), dataJson, token.Subject(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to duplicate spreadsheet"})
+		return
+	}
+
+	c.Header("Location", "/spreadsheet/"+id+"/")
+	c.JSON(http.StatusCreated, gin.H{"message": "Spreadsheet duplicated successfully", "id": id})
+}
+
+// ownedSheet retrieves the spreadsheet in the request path from `sheets` and checks that
+// it is owned by `subject`. If it isn't, or it cannot be retrieved, it responds with an
+// error and returns false.
+func ownedSheet(c *gin.Context, sheets repo.SpreadsheetRepo, subject string) (*models.Spreadsheet, bool) {
+	sheet, err := sheets.GetByID(c.Param("sheetID"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Spreadsheet not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving the spreadsheet. Please try again later."})
+		return nil, false
+	}
+
+	if sheet.Owner != subject {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner of the spreadsheet can do this."})
+		return nil, false
+	}
+
+	return sheet, true
+}
+
+// accessibleSheet retrieves the spreadsheet in the request path and the role of `subject`
+// in it, see sheetWithRole.
+func (h *SpreadsheetHandler) accessibleSheet(c *gin.Context, subject string, minRole collab.Role) (*models.Spreadsheet, collab.Role, bool) {
+	return sheetWithRole(c, h.repo, h.collaborators.GetRole, subject, minRole)
+}
+
+// sheetWithRole retrieves the spreadsheet in the request path and the role of `subject`
+// in it (see sheetRole), checking that the role grants at least the access of `minRole`.
+// If it doesn't, or the sheet cannot be retrieved, it responds with an error and returns false.
+func sheetWithRole(c *gin.Context, sheets repo.SpreadsheetRepo, lookup roleLookup, subject string,
+	minRole collab.Role) (*models.Spreadsheet, collab.Role, bool) {
+	sheet, err := sheets.GetByID(c.Param("sheetID"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Spreadsheet not found"})
+			return nil, "", false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving the spreadsheet. Please try again later."})
+		return nil, "", false
+	}
+
+	role, err := sheetRole(sheet, subject, lookup)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving the spreadsheet. Please try again later."})
+		return nil, "", false
+	}
+
+	if !role.AtLeast(minRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this spreadsheet."})
+		return nil, "", false
+	}
+
+	return sheet, role, true
+}
+
+// respondWithBindingError responds with a 400 Bad Request describing why the request
+// body could not be bound to a model. Validation errors are reported per field.
+func respondWithBindingError(c *gin.Context, err error) {
+	// Handle validation errors
+	var verr validator.ValidationErrors
+	if errors.As(err, &verr) {
+		detail := make(map[string]string)
+		for _, fieldErr := range verr {
+			detail[fieldKey(fieldErr)] = utils.GetValidationErrorMessage(fieldErr)
+		}
+		c.JSON(http.StatusBadRequest, detail)
+		return
+	}
+
+	// Handle time parsing errors
+	var jsonErr *json.UnmarshalTypeError
+	var timeErr *time.ParseError
+	if (errors.As(err, &jsonErr) && jsonErr.Field == "deadline") ||
+		errors.As(err, &timeErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"deadline": "Invalid deadline time format.",
+		})
+		return
+	}
+
+	// Handle other JSON parsing errors
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid JSON syntax",
+		})
+		return
+	}
+	// If it's not a validation error, return a generic message
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+}
+
+// fieldKey returns the key of a field in the details of a binding error, which is its
+// path in the payload, e.g. "title" or "columns[1].type" for nested fields.
+func fieldKey(fieldErr validator.FieldError) string {
+	// the namespace starts with the name of the bound struct
+	_, key, found := strings.Cut(fieldErr.Namespace(), ".")
+	if !found {
+		return fieldErr.Field()
+	}
+	return key
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/json"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,17 +15,22 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/lestrrat-go/jwx/jwt"
 	"github.com/stretchr/testify/assert"
 	"github.com/waynekn/tablesync/api"
 	"github.com/waynekn/tablesync/api/db"
 	"github.com/waynekn/tablesync/api/db/repo"
 	"github.com/waynekn/tablesync/api/models"
 	"github.com/waynekn/tablesync/api/utils"
+	"github.com/waynekn/tablesync/core/collab"
+	"github.com/waynekn/tablesync/core/rdb"
+	"github.com/waynekn/tablesync/core/ws"
 )
 
 var testDb *sql.DB
+var testStore *collab.Store
 
-// TestMain establishes a connection to the test database
+// TestMain establishes a connection to the test database and redis
 func TestMain(m *testing.M) {
 	_ = godotenv.Load("../../.env.test")
 	conn, err := db.Connect()
@@ -32,6 +39,14 @@ func TestMain(m *testing.M) {
 	}
 	defer conn.Close()
 	testDb = conn
+
+	redisDB, _ := strconv.Atoi(os.Getenv("REDIS_DB"))
+	redisClient, err := rdb.Connect(os.Getenv("REDIS_ADDR"), os.Getenv("REDIS_PASSWORD"), redisDB)
+	if err != nil {
+		panic(err.Error())
+	}
+	defer redisClient.Close()
+	testStore = collab.NewStore(redisClient)
 	gin.SetMode(gin.TestMode)
 	api.RegisterJSONTagNameFormatter()
 
@@ -72,7 +87,7 @@ func setUpGetOwnSpreadsheetCtx() (*gin.Context, *httptest.ResponseRecorder) {
 // HTTP status codes are returned for each case.
 func TestCreateSpreadsheet(t *testing.T) {
 	testRepo := repo.NewSpreadsheetRepo(testDb)
-	h := NewSpreadsheetHandler(testRepo)
+	h := NewSpreadsheetHandler(testRepo, repo.NewCollaboratorRepo(testDb), testStore, ws.NewHub())
 
 	data := models.SpreadsheetInit{
 		Title:       "Test Spreadsheet",
@@ -85,8 +100,40 @@ func TestCreateSpreadsheet(t *testing.T) {
 		ctx, rec := setupCreateSpreadsheetTestContext(data)
 		h.CreateSpreadsheetHandler(ctx)
 		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var resp map[string]string
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.NotEmpty(t, resp["id"], "response should contain the new sheet's ID")
+		assert.Equal(t, "/spreadsheet/"+resp["id"]+"/", rec.Header().Get("Location"))
+	})
+
+	t.Run("Should create spreadsheet with typed columns", func(t *testing.T) {
+		input := data
+		input.ColTitles = nil
+		input.Columns = []models.ColumnInit{
+			{Title: "Name", Type: "text"},
+			{Title: "Status", Type: "select", Options: []string{"open", "closed"}},
+		}
+		ctx, rec := setupCreateSpreadsheetTestContext(input)
+		h.CreateSpreadsheetHandler(ctx)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var resp map[string]string
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		sheet, err := testRepo.GetByID(resp["id"])
+		assert.NoError(t, err, "created sheet should be retrievable")
+		assert.JSONEq(t, `[["Name","Status"]]`, string(sheet.Data))
+		assert.Equal(t, "select", sheet.Columns[1].Type)
+		assert.Equal(t, []string{"open", "closed"}, sheet.Columns[1].Options)
 	})
 
+	typed := func(columns ...models.ColumnInit) func(m *models.SpreadsheetInit) {
+		return func(m *models.SpreadsheetInit) {
+			m.ColTitles = nil
+			m.Columns = columns
+		}
+	}
+
 	tests := []struct {
 		name    string
 		modify  func(m *models.SpreadsheetInit)
@@ -97,6 +144,15 @@ func TestCreateSpreadsheet(t *testing.T) {
 		{"missing description", func(m *models.SpreadsheetInit) { m.Description = "" }, "description"},
 		{"invalid deadline", func(m *models.SpreadsheetInit) { m.Deadline = time.Time{} }, "deadline"},
 		{"no col titles", func(m *models.SpreadsheetInit) { m.ColTitles = []string{} }, "colTitles"},
+		{"invalid link access", func(m *models.SpreadsheetInit) { m.LinkAccess = "admin" }, "linkAccess"},
+		{"col titles and columns", func(m *models.SpreadsheetInit) {
+			m.Columns = []models.ColumnInit{{Title: "Name", Type: "text"}}
+		}, "colTitles"},
+		{"unknown column type", typed(models.ColumnInit{Title: "Age", Type: "number"}), "columns[0].type"},
+		{"select column without options", typed(models.ColumnInit{Title: "Status", Type: "select"}), "columns[0]"},
+		{"invalid column pattern", typed(models.ColumnInit{Title: "ID", Type: "text", Pattern: "("}), "columns[0]"},
+		{"range on text column", typed(models.ColumnInit{Title: "Name", Type: "text", Min: new(float64)}), "columns[0]"},
+		{"no rows per user", func(m *models.SpreadsheetInit) { m.MaxRowsPerUser = new(int) }, "maxRowsPerUser"},
 	}
 
 	for _, tt := range tests {
@@ -118,7 +174,7 @@ func TestCreateSpreadsheet(t *testing.T) {
 
 func TestGetOwnSpreadsheetsHandler(t *testing.T) {
 	testRepo := repo.NewSpreadsheetRepo(testDb)
-	h := NewSpreadsheetHandler(testRepo)
+	h := NewSpreadsheetHandler(testRepo, repo.NewCollaboratorRepo(testDb), testStore, ws.NewHub())
 	t.Run("with valid token and existing sheets", func(t *testing.T) {
 		ctx, rec := setUpGetOwnSpreadsheetCtx()
 		h.GetOwnSpreadsheetsHandler(ctx)
@@ -126,12 +182,12 @@ func TestGetOwnSpreadsheetsHandler(t *testing.T) {
 		assert.Equal(t, http.StatusOK, rec.Code)
 
 		body := rec.Body.Bytes()
-		var result []models.Spreadsheet
+		var result []models.SpreadsheetSummary
 
 		err := json.Unmarshal(body, &result)
 		assert.NoError(t, err, "Failed to unmarshal response body")
 		assert.NotEmpty(t, result)
-		assert.IsType(t, models.Spreadsheet{}, result[0])
+		assert.NotContains(t, rec.Body.String(), `"data"`, "the list should not include the data of the sheets")
 	})
 
 	t.Run("with valid token but no sheets", func(t *testing.T) {
@@ -146,7 +202,7 @@ func TestGetOwnSpreadsheetsHandler(t *testing.T) {
 		assert.Equal(t, http.StatusOK, rec.Code)
 
 		body := rec.Body.Bytes()
-		var result []models.Spreadsheet
+		var result []models.SpreadsheetSummary
 		err := json.Unmarshal(body, &result)
 
 		assert.NoError(t, err, "Failed to unmarshal response body")
@@ -161,3 +217,487 @@ func TestGetOwnSpreadsheetsHandler(t *testing.T) {
 		assert.Equal(t, http.StatusUnauthorized, rec.Code)
 	})
 }
+
+// insertTestSheet inserts a spreadsheet owned by "test-user" with the provided column
+// titles and returns its ID.
+func insertTestSheet(t *testing.T, colTitles ...string) string {
+	id := utils.GenerateID()
+	cols, _ := json.Marshal([][]string{colTitles})
+	sheet := models.SpreadsheetInit{
+		Title:       "test sheet",
+		Description: "Test sheet",
+		Deadline:    time.Now().Add(time.Hour),
+		ColTitles:   colTitles,
+	}
+	err := repo.NewSpreadsheetRepo(testDb).InsertSpreadsheet(sheet, cols, "test-user", id)
+	assert.NoError(t, err, "Failed to insert test sheet")
+	return id
+}
+
+func setUpGetSpreadsheetCtx(sheetID string) (*gin.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	ctx := utils.CreateTestCtxWithToken(rec)
+
+	ctx.Request = httptest.NewRequest("GET", "/spreadsheet/"+sheetID+"/", nil)
+	ctx.Params = gin.Params{{Key: "sheetID", Value: sheetID}}
+	return ctx, rec
+}
+
+func TestGetSpreadsheetHandler(t *testing.T) {
+	h := NewSpreadsheetHandler(repo.NewSpreadsheetRepo(testDb), repo.NewCollaboratorRepo(testDb), testStore, ws.NewHub())
+	sheetID := insertTestSheet(t, "header1", "header2")
+
+	t.Run("existing sheet", func(t *testing.T) {
+		ctx, rec := setUpGetSpreadsheetCtx(sheetID)
+		h.GetSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("ETag"), "response should have an ETag")
+
+		var result models.SpreadsheetWithData
+		err := json.Unmarshal(rec.Body.Bytes(), &result)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		assert.Equal(t, sheetID, result.ID)
+		assert.Equal(t, [][]string{{"header1", "header2"}}, result.Data)
+		assert.False(t, result.Live)
+	})
+
+	t.Run("matching If-None-Match", func(t *testing.T) {
+		ctx, rec := setUpGetSpreadsheetCtx(sheetID)
+		h.GetSpreadsheetHandler(ctx)
+		etag := rec.Header().Get("ETag")
+
+		ctx, rec = setUpGetSpreadsheetCtx(sheetID)
+		ctx.Request.Header.Set("If-None-Match", etag)
+		h.GetSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Empty(t, rec.Body.Bytes())
+	})
+
+	t.Run("live session", func(t *testing.T) {
+		data := [][]string{{"header1", "header2"}}
+		err := testStore.InitRedisSheet(sheetID, time.Now().Add(time.Hour), &data)
+		assert.NoError(t, err)
+		err = testStore.ApplyEdit(sheetID, collab.EditMsg{Row: 1, Col: 1, Data: "live"})
+		assert.NoError(t, err)
+
+		ctx, rec := setUpGetSpreadsheetCtx(sheetID)
+		h.GetSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var result models.SpreadsheetWithData
+		err = json.Unmarshal(rec.Body.Bytes(), &result)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		assert.True(t, result.Live)
+		assert.Equal(t, [][]string{{"header1", "header2"}, {"", "live"}}, result.Data)
+		assert.Empty(t, result.Formats)
+
+		err = testStore.SetColumnFormat(sheetID, 1, collab.Format{Align: collab.AlignRight})
+		assert.NoError(t, err)
+		ctx, rec = setUpGetSpreadsheetCtx(sheetID)
+		h.GetSpreadsheetHandler(ctx)
+		assert.Contains(t, rec.Body.String(), `"formats":{"col:1":{"align":"right"}}`, "the live formats should be included")
+	})
+
+	t.Run("non existent sheet", func(t *testing.T) {
+		ctx, rec := setUpGetSpreadsheetCtx(utils.GenerateID())
+		h.GetSpreadsheetHandler(ctx)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("without token", func(t *testing.T) {
+		ctx, rec := setUpGetSpreadsheetCtx(sheetID)
+		ctx.Set("token", nil)
+		h.GetSpreadsheetHandler(ctx)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func setUpUpdateSpreadsheetCtx(sheetID string, body any) (*gin.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	ctx := utils.CreateTestCtxWithToken(rec)
+
+	jsonBytes, _ := json.Marshal(body)
+	ctx.Request = httptest.NewRequest("PATCH", "/spreadsheet/"+sheetID+"/", bytes.NewReader(jsonBytes))
+	ctx.Params = gin.Params{{Key: "sheetID", Value: sheetID}}
+	return ctx, rec
+}
+
+func TestUpdateSpreadsheetHandler(t *testing.T) {
+	hub := ws.NewHub()
+	h := NewSpreadsheetHandler(repo.NewSpreadsheetRepo(testDb), repo.NewCollaboratorRepo(testDb), testStore, hub)
+	sheetID := insertTestSheet(t, "header1", "header2")
+
+	t.Run("update title and deadline", func(t *testing.T) {
+		data := [][]string{{"header1", "header2"}}
+		err := testStore.InitRedisSheet(sheetID, time.Now().Add(time.Hour), &data)
+		assert.NoError(t, err)
+
+		viewer := ws.NewViewer(sheetID, "")
+		hub.Register <- viewer
+		time.Sleep(50 * time.Millisecond)
+		defer func() { hub.Unregister <- viewer }()
+
+		deadline := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+		ctx, rec := setUpUpdateSpreadsheetCtx(sheetID, map[string]any{
+			"title":    "renamed sheet",
+			"deadline": deadline.Format(time.RFC3339),
+		})
+		h.UpdateSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var result models.Spreadsheet
+		err = json.Unmarshal(rec.Body.Bytes(), &result)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		assert.Equal(t, "renamed sheet", result.Title)
+		assert.Equal(t, "Test sheet", result.Description, "fields that are not provided should be unchanged")
+		assert.True(t, deadline.Equal(result.Deadline))
+
+		select {
+		case msg := <-viewer.Send:
+			assert.Equal(t, ws.NewSheetUpdatedMsg("renamed sheet", "Test sheet", result.Deadline, models.LinkAccessEdit), msg)
+		case <-time.After(time.Second):
+			t.Fatal("connected clients should be notified of the update")
+		}
+	})
+
+	t.Run("row ownership mode", func(t *testing.T) {
+		ctx, rec := setUpUpdateSpreadsheetCtx(sheetID, map[string]any{"rowOwnership": true, "maxRowsPerUser": 3})
+		h.UpdateSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var result models.Spreadsheet
+		_ = json.Unmarshal(rec.Body.Bytes(), &result)
+		assert.Equal(t, collab.RowOwnership{Enabled: true, MaxRows: 3}, rowPolicy(&result))
+
+		ctx, rec = setUpUpdateSpreadsheetCtx(sheetID, map[string]any{"maxRowsPerUser": 0})
+		h.UpdateSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		_ = json.Unmarshal(rec.Body.Bytes(), &result)
+		assert.True(t, result.RowOwnership, "fields that are not provided should be unchanged")
+		assert.Nil(t, result.MaxRowsPerUser, "a limit of 0 should remove the limit")
+	})
+
+	t.Run("deadline in the past", func(t *testing.T) {
+		ctx, rec := setUpUpdateSpreadsheetCtx(sheetID, map[string]any{
+			"deadline": time.Now().Add(-time.Hour).Format(time.RFC3339),
+		})
+		h.UpdateSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Deadline must be in the future")
+	})
+
+	t.Run("empty title", func(t *testing.T) {
+		ctx, rec := setUpUpdateSpreadsheetCtx(sheetID, map[string]any{"title": ""})
+		h.UpdateSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Title cannot be empty")
+	})
+
+	t.Run("empty description", func(t *testing.T) {
+		ctx, rec := setUpUpdateSpreadsheetCtx(sheetID, map[string]any{"description": ""})
+		h.UpdateSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Description cannot be empty")
+	})
+
+	t.Run("not the owner", func(t *testing.T) {
+		ctx, rec := setUpUpdateSpreadsheetCtx(sheetID, map[string]any{"title": "stolen"})
+		token := jwt.New()
+		token.Set("sub", "another-user")
+		ctx.Set("token", token)
+		h.UpdateSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("non existent sheet", func(t *testing.T) {
+		ctx, rec := setUpUpdateSpreadsheetCtx(utils.GenerateID(), map[string]any{"title": "new title"})
+		h.UpdateSpreadsheetHandler(ctx)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func setUpSheetCtx(method, path, sheetID string) (*gin.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	ctx := utils.CreateTestCtxWithToken(rec)
+
+	ctx.Request = httptest.NewRequest(method, path, nil)
+	ctx.Params = gin.Params{{Key: "sheetID", Value: sheetID}}
+	return ctx, rec
+}
+
+func TestDeleteSpreadsheetHandler(t *testing.T) {
+	hub := ws.NewHub()
+	h := NewSpreadsheetHandler(repo.NewSpreadsheetRepo(testDb), repo.NewCollaboratorRepo(testDb), testStore, hub)
+	sheetID := insertTestSheet(t, "header1", "header2")
+
+	t.Run("not the owner", func(t *testing.T) {
+		ctx, rec := setUpSheetCtx("DELETE", "/spreadsheet/"+sheetID+"/", sheetID)
+		token := jwt.New()
+		token.Set("sub", "another-user")
+		ctx.Set("token", token)
+		h.DeleteSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("move to trash", func(t *testing.T) {
+		data := [][]string{{"header1", "header2"}}
+		err := testStore.InitRedisSheet(sheetID, time.Now().Add(time.Hour), &data)
+		assert.NoError(t, err)
+		err = testStore.ApplyEdit(sheetID, collab.EditMsg{Row: 1, Col: 0, Data: "live edit"})
+		assert.NoError(t, err)
+		err = testStore.ClaimRow(sheetID, collab.RowClaim{Row: 1, UserID: "test-user", ColNum: 2})
+		assert.NoError(t, err)
+		err = testStore.SetCellFormat(sheetID, 1, 0, collab.Format{Bold: true})
+		assert.NoError(t, err)
+
+		viewer := ws.NewViewer(sheetID, "")
+		hub.Register <- viewer
+		time.Sleep(50 * time.Millisecond)
+
+		ctx, rec := setUpSheetCtx("DELETE", "/spreadsheet/"+sheetID+"/", sheetID)
+		h.DeleteSpreadsheetHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		select {
+		case <-viewer.Done():
+			assert.NotEmpty(t, viewer.Reason(), "clients should be told why they were disconnected")
+		case <-time.After(time.Second):
+			t.Fatal("connected clients should be disconnected")
+		}
+
+		exists, err := testStore.SheetExists(sheetID)
+		assert.NoError(t, err)
+		assert.False(t, exists, "the live session should be removed")
+
+		err = testStore.ApplyEdit(sheetID, collab.EditMsg{Row: 1, Col: 1, Data: "late edit"})
+		assert.ErrorIs(t, err, collab.ErrNoSession, "edits should not recreate the removed session")
+
+		ctx, rec = setUpGetSpreadsheetCtx(sheetID)
+		h.GetSpreadsheetHandler(ctx)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "trashed sheets should not be retrievable")
+	})
+
+	t.Run("list trash", func(t *testing.T) {
+		ctx, rec := setUpSheetCtx("GET", "/spreadsheets/trash/", "")
+		h.GetTrashHandler(ctx)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var result []models.SpreadsheetSummary
+		err := json.Unmarshal(rec.Body.Bytes(), &result)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		assert.NotContains(t, rec.Body.String(), `"data"`, "the data of trashed sheets should not be listed")
+
+		found := false
+		for _, sheet := range result {
+			if sheet.ID == sheetID {
+				found = true
+				assert.NotNil(t, sheet.DeletedAt)
+			}
+		}
+		assert.True(t, found, "the trashed sheet should be listed")
+	})
+
+	t.Run("delete twice", func(t *testing.T) {
+		ctx, rec := setUpSheetCtx("DELETE", "/spreadsheet/"+sheetID+"/", sheetID)
+		h.DeleteSpreadsheetHandler(ctx)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		ctx, rec := setUpSheetCtx("POST", "/spreadsheet/"+sheetID+"/restore/", sheetID)
+		h.RestoreSpreadsheetHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		ctx, rec = setUpGetSpreadsheetCtx(sheetID)
+		h.GetSpreadsheetHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code, "restored sheets should be retrievable")
+
+		var result models.SpreadsheetWithData
+		err := json.Unmarshal(rec.Body.Bytes(), &result)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		assert.Equal(t, [][]string{{"header1", "header2"}, {"live edit", ""}}, result.Data,
+			"the live edits of the sheet should be kept in the trash")
+
+		sheet, err := h.repo.GetByID(sheetID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.RowOwners{1: "test-user"}, sheet.RowOwners,
+			"the owners of the rows should be kept in the trash")
+		formats, err := json.Marshal(result.Formats)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"1:0":{"bold":true}}`, string(formats), "the formats should be kept in the trash")
+	})
+
+	t.Run("restore a sheet that is not in the trash", func(t *testing.T) {
+		ctx, rec := setUpSheetCtx("POST", "/spreadsheet/"+sheetID+"/restore/", sheetID)
+		h.RestoreSpreadsheetHandler(ctx)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+// listSpreadsheets lists the spreadsheets of `owner` with the provided query string
+// and returns the recorded response.
+func listSpreadsheets(h *SpreadsheetHandler, owner, query string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	ctx := utils.CreateTestCtxWithToken(rec)
+	token, _ := utils.TokenFromContext(ctx)
+	token.Set("sub", owner)
+
+	ctx.Request = httptest.NewRequest("GET", "/spreadsheets/?"+query, nil)
+	h.GetOwnSpreadsheetsHandler(ctx)
+	return rec
+}
+
+func TestGetOwnSpreadsheetsHandlerPagination(t *testing.T) {
+	testRepo := repo.NewSpreadsheetRepo(testDb)
+	h := NewSpreadsheetHandler(testRepo, repo.NewCollaboratorRepo(testDb), testStore, ws.NewHub())
+
+	// a fresh owner so that sheets inserted by other tests are not listed
+	owner := utils.GenerateID()
+	deadlines := map[string]time.Duration{
+		"alpha report": time.Hour,
+		"beta report":  2 * time.Hour,
+		"gamma_notes":  -time.Hour,
+	}
+	for title, offset := range deadlines {
+		cols, _ := json.Marshal([][]string{{"header"}})
+		sheet := models.SpreadsheetInit{Title: title, Description: "", Deadline: time.Now().Add(offset), ColTitles: []string{"header"}}
+		err := testRepo.InsertSpreadsheet(sheet, cols, owner, utils.GenerateID())
+		assert.NoError(t, err, "Failed to insert test sheet")
+	}
+
+	titles := func(rec *httptest.ResponseRecorder) []string {
+		var result []models.SpreadsheetSummary
+		err := json.Unmarshal(rec.Body.Bytes(), &result)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		titles := make([]string, 0, len(result))
+		for _, sheet := range result {
+			titles = append(titles, sheet.Title)
+		}
+		return titles
+	}
+
+	t.Run("pages follow the cursor", func(t *testing.T) {
+		rec := listSpreadsheets(h, owner, "sort=deadline&order=asc&limit=2")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []string{"gamma_notes", "alpha report"}, titles(rec))
+
+		cursor := rec.Header().Get("X-Next-Cursor")
+		assert.NotEmpty(t, cursor, "the first page should have a next cursor")
+
+		rec = listSpreadsheets(h, owner, "sort=deadline&order=asc&limit=2&cursor="+cursor)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []string{"beta report"}, titles(rec))
+		assert.Empty(t, rec.Header().Get("X-Next-Cursor"), "the last page should not have a next cursor")
+	})
+
+	t.Run("filter by status", func(t *testing.T) {
+		rec := listSpreadsheets(h, owner, "status=closed")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []string{"gamma_notes"}, titles(rec))
+
+		rec = listSpreadsheets(h, owner, "status=open&sort=deadline&order=desc")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []string{"beta report", "alpha report"}, titles(rec))
+	})
+
+	t.Run("search by title", func(t *testing.T) {
+		rec := listSpreadsheets(h, owner, "q=REPORT&sort=deadline&order=asc")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []string{"alpha report", "beta report"}, titles(rec))
+
+		// wildcards are matched literally
+		rec = listSpreadsheets(h, owner, "q=a_")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, []string{"gamma_notes"}, titles(rec))
+	})
+
+	t.Run("cursor for another sort", func(t *testing.T) {
+		rec := listSpreadsheets(h, owner, "sort=deadline&limit=1")
+		cursor := rec.Header().Get("X-Next-Cursor")
+
+		rec = listSpreadsheets(h, owner, "sort=created&limit=1&cursor="+cursor)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Invalid cursor")
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		rec := listSpreadsheets(h, owner, "sort=title")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = listSpreadsheets(h, owner, "limit=1000")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Limit must be between 1 and 100")
+	})
+}
+
+func TestDuplicateSpreadsheetHandler(t *testing.T) {
+	sheets := repo.NewSpreadsheetRepo(testDb)
+	h := NewSpreadsheetHandler(sheets, repo.NewCollaboratorRepo(testDb), testStore, ws.NewHub())
+	sheetID := insertTestSheet(t, "name", "score")
+
+	data := [][]string{{"name", "score"}, {"Amina", "12"}}
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(time.Hour), &data)
+	assert.NoError(t, err, "Failed to start a session for the test sheet")
+	t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+	duplicate := func(body models.SpreadsheetCopy) *httptest.ResponseRecorder {
+		ctx, rec := setUpSheetCtx("POST", "/spreadsheet/"+sheetID+"/duplicate/", sheetID)
+		jsonBytes, _ := json.Marshal(body)
+		ctx.Request = httptest.NewRequest("POST", "/spreadsheet/"+sheetID+"/duplicate/", bytes.NewReader(jsonBytes))
+		h.DuplicateSpreadsheetHandler(ctx)
+		return rec
+	}
+	copied := func(t *testing.T, rec *httptest.ResponseRecorder) *models.Spreadsheet {
+		var created struct{ ID string }
+		err := json.Unmarshal(rec.Body.Bytes(), &created)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		assert.NotEqual(t, sheetID, created.ID)
+
+		sheet, err := sheets.GetByID(created.ID)
+		assert.NoError(t, err, "Failed to retrieve the copy")
+		return sheet
+	}
+
+	t.Run("with live data", func(t *testing.T) {
+		deadline := time.Now().Add(48 * time.Hour)
+		rec := duplicate(models.SpreadsheetCopy{Title: "Copy", Deadline: deadline, IncludeData: true})
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		sheet := copied(t, rec)
+		assert.Equal(t, "Copy", sheet.Title)
+		assert.WithinDuration(t, deadline, sheet.Deadline, time.Second)
+		assert.JSONEq(t, `[["name","score"],["Amina","12"]]`, string(sheet.Data))
+	})
+
+	t.Run("without data", func(t *testing.T) {
+		rec := duplicate(models.SpreadsheetCopy{Title: "Empty copy", Deadline: time.Now().Add(time.Hour)})
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		sheet := copied(t, rec)
+		assert.JSONEq(t, `[["name","score"]]`, string(sheet.Data))
+	})
+
+	t.Run("deadline in the past", func(t *testing.T) {
+		rec := duplicate(models.SpreadsheetCopy{Title: "Copy", Deadline: time.Now().Add(-time.Hour)})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "deadline")
+	})
+
+	t.Run("missing title", func(t *testing.T) {
+		rec := duplicate(models.SpreadsheetCopy{Deadline: time.Now().Add(time.Hour)})
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Title is required")
+	})
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/core/collab"
+	"github.com/waynekn/tablesync/core/formula"
+	"github.com/waynekn/tablesync/core/ws"
+)
+
+// sheetRows gives access to the current data rows of a sheet, without its header row.
+// Rows are indexed the same way as client edits. While a collaborative session is live
+// the rows are read from Redis in batches, otherwise from the data in the database.
+//
+// Formula cells hold the values of their formulas rather than the formulas themselves,
+// as computed when the rows were requested.
+type sheetRows struct {
+	store    *collab.Store
+	sheetID  string
+	headers  []string
+	stored   [][]string // data rows in the database, nil while the sheet is live
+	live     bool
+	computed map[formula.Cell]string // values of the formulas, keyed as in the collab store
+}
+
+// newSheetRows returns the rows of the sheet, computing the values of its formulas with
+// the formulas of `hub` while it is live.
+func newSheetRows(store *collab.Store, hub *ws.Hub, sheet *models.Spreadsheet) (*sheetRows, error) {
+	var data [][]string
+	if err := json.Unmarshal(sheet.Data, &data); err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("sheet %s has no column headers", sheet.ID)
+	}
+
+	live, err := store.SheetExists(sheet.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := &sheetRows{store: store, sheetID: sheet.ID, headers: data[0], live: live}
+	if live {
+		rows.computed, err = hub.FormulaValues(store, sheet.ID)
+	} else {
+		rows.stored = data[1:]
+		rows.computed, err = storedFormulaValues(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// storedFormulaValues returns the values of the formulas among the contents of a sheet,
+// headers included, keyed as in the collab store.
+func storedFormulaValues(data [][]string) (map[formula.Cell]string, error) {
+	contents := make(map[formula.Cell]string)
+	for row := 1; row < len(data); row++ {
+		for col, raw := range data[row] {
+			if formula.IsFormula(raw) {
+				contents[formula.Cell{Row: row, Col: col}] = raw
+			}
+		}
+	}
+	if len(contents) == 0 {
+		return nil, nil
+	}
+
+	sheet := formula.NewSheet()
+	err := sheet.Load(contents, func(cells []formula.Cell) (map[formula.Cell]string, error) {
+		found := make(map[formula.Cell]string, len(cells))
+		for _, c := range cells {
+			if c.Row < len(data) && c.Col < len(data[c.Row]) {
+				found[c] = data[c.Row][c.Col]
+			}
+		}
+		return found, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sheet.Values(), nil
+}
+
+// withValues returns the row at `index` with the values of its formulas in place of the
+// formulas. Formulas entered after the values were computed are left as they are.
+func (r *sheetRows) withValues(index int, row []string) []string {
+	if len(r.computed) == 0 {
+		return row
+	}
+	var computed []string
+	for col := range row {
+		// the first row holds the headers
+		value, ok := r.computed[formula.Cell{Row: index + 1, Col: col}]
+		if !ok || !formula.IsFormula(row[col]) {
+			continue
+		}
+		if computed == nil {
+			computed = slices.Clone(row)
+		}
+		computed[col] = value
+	}
+	if computed == nil {
+		return row
+	}
+	return computed
+}
+
+// each calls fn with the index and cells of each row, stopping at the first error fn
+// returns.
+func (r *sheetRows) each(fn func(index int, row []string) error) error {
+	if r.live {
+		return ws.EachRow(r.store, r.sheetID, len(r.headers), func(index int, row []string) error {
+			return fn(index, r.withValues(index, row))
+		})
+	}
+
+	for i, row := range r.stored {
+		if err := fn(i, r.withValues(i, row)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// row returns the row at `index`, and false if the sheet has no such row.
+func (r *sheetRows) row(index int) ([]string, bool, error) {
+	if !r.live {
+		if index < 0 || index >= len(r.stored) {
+			return nil, false, nil
+		}
+		return r.withValues(index, r.stored[index]), true, nil
+	}
+
+	rowNum, err := ws.CountRows(r.store, r.sheetID)
+	if err != nil {
+		return nil, false, err
+	}
+	// the first row holds the headers
+	if index < 0 || index+1 >= rowNum {
+		return nil, false, nil
+	}
+
+	rows, err := r.store.GetRows(r.sheetID, index+1, index+2, len(r.headers))
+	if err != nil {
+		return nil, false, err
+	}
+	return r.withValues(index, rows[0]), true, nil
+}
+
+// recordKeys returns the keys of the records of a sheet with the given headers. They are
+// the column titles, except that untitled columns are named after their position
+// (e.g. "Column 3") and repeated titles are numbered (e.g. "Name (2)"), so that every
+// key is unique.
+func recordKeys(headers []string) []string {
+	keys := make([]string, len(headers))
+	seen := make(map[string]bool, len(headers))
+	for i, header := range headers {
+		base := header
+		if base == "" {
+			base = fmt.Sprintf("Column %d", i+1)
+		}
+		key := base
+		for n := 2; seen[key]; n++ {
+			key = fmt.Sprintf("%s (%d)", base, n)
+		}
+		seen[key] = true
+		keys[i] = key
+	}
+	return keys
+}
+
+// record is a row of a sheet encoded as a JSON object keyed by column title, with its
+// keys in the order of the columns.
+type record struct {
+	keys   []string
+	values []string
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r record) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range r.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		var value string
+		if i < len(r.values) {
+			value = r.values[i]
+		}
+		v, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/waynekn/tablesync/core/ws"
+)
+
+// sseKeepAliveInterval is how often a comment is written to an idle stream so that
+// proxies do not close it.
+const sseKeepAliveInterval = 15 * time.Second
+
+// LiveViewHandler streams a read-only live view of a spreadsheet using Server-Sent Events.
+// It applies the same checks as EditSessionHandler for a connection in view mode, then
+// sends a chunked snapshot of the sheet (see ws.StreamSnapshot), the values of its
+// formulas and its formats, followed by every edit broadcasted to the sheet.
+// The data of each event is the same JSON message a websocket client would receive.
+//
+// The stream ends once the deadline of the sheet passes. If it is ended by the server for
+// another reason, e.g. because the sheet was deleted, a final "close" event carries it.
+func (h *WsHandler) LiveViewHandler(c *gin.Context) {
+	sheetID := c.Param("sheetID")
+	sheet, headers, version, err := h.loadSession(sheetID)
+	if err == nil {
+		_, err = h.connectionRole(c, sheet, modeView)
+	}
+	if err != nil {
+		respondWithSessionError(c, err)
+		return
+	}
+
+	// register before sending the snapshot so that no edits are missed while it is sent
+	viewer := ws.NewViewer(sheetID, subjectFromContext(c))
+	h.hub.Register <- viewer
+	defer func() {
+		viewer.Close()
+		h.hub.Unregister <- viewer
+	}()
+
+	// the columns may have changed after they were loaded, see EditSessionHandler
+	if changed, err := columnsChanged(h.collab, sheetID, version); changed || err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": columnsChangingMessage})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// stop proxies such as nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	ctx := c.Request.Context()
+	write := func(msg any) error {
+		c.SSEvent("message", msg)
+		c.Writer.Flush()
+		return ctx.Err()
+	}
+
+	if err := ws.StreamSnapshot(h.collab, sheetID, len(headers), write); err != nil {
+		slog.Error("failed to stream sheet snapshot", "sheetID", sheetID, "err", err)
+		return
+	}
+
+	computed, err := h.hub.ComputedValues(h.collab, sheetID)
+	if err != nil {
+		slog.Error("failed to compute sheet formulas", "sheetID", sheetID, "err", err)
+		return
+	}
+	if computed != nil {
+		if err := write(computed); err != nil {
+			return
+		}
+	}
+
+	formats, err := ws.SheetFormats(h.collab, sheetID)
+	if err != nil {
+		slog.Error("failed to retrieve sheet formats", "sheetID", sheetID, "err", err)
+		return
+	}
+	if formats != nil {
+		if err := write(formats); err != nil {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	deadline := time.NewTimer(time.Until(sheet.Deadline))
+	defer deadline.Stop()
+
+	for {
+		select {
+		case edit := <-viewer.Send:
+			if err := write(edit); err != nil {
+				return
+			}
+			// keep streaming until the new deadline if it has changed
+			if update, ok := edit.(ws.SheetUpdatedMsg); ok {
+				deadline.Reset(time.Until(update.Deadline))
+			}
+		case <-keepAlive.C:
+			// lines starting with a colon are comments and are ignored by clients
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+			c.Writer.Flush()
+		case <-deadline.C:
+			return
+		case <-viewer.Done():
+			if reason := viewer.Reason(); reason != "" {
+				c.SSEvent("close", gin.H{"reason": reason})
+				c.Writer.Flush()
+			}
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/waynekn/tablesync/api/db/repo"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/api/schema"
+	"github.com/waynekn/tablesync/api/utils"
+)
+
+type TemplateHandler struct {
+	sheets    repo.SpreadsheetRepo
+	templates repo.TemplateRepo
+}
+
+// NewTemplateHandler creates a new instance of TemplateHandler with the provided repositories.
+func NewTemplateHandler(sheets repo.SpreadsheetRepo, templates repo.TemplateRepo) *TemplateHandler {
+	return &TemplateHandler{sheets: sheets, templates: templates}
+}
+
+// SaveTemplateHandler handles requests by the owner of a spreadsheet to save its structure,
+// i.e. its columns and their types, its description and the time it had until its
+// deadline, as a template. The contents of the spreadsheet are not saved.
+func (h *TemplateHandler) SaveTemplateHandler(c *gin.Context) {
+	var init models.TemplateInit
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&init); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+	if !checkDeadlineOffset(c, init.DeadlineOffsetHours) {
+		return
+	}
+
+	sheet, ok := ownedSheet(c, h.sheets, token.Subject())
+	if !ok {
+		return
+	}
+
+	var data [][]string
+	if err := json.Unmarshal(sheet.Data, &data); err != nil || len(data) == 0 {
+		slog.Error("Failed to read the headers of the spreadsheet", "sheetID", sheet.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while saving the template. Please try again later."})
+		return
+	}
+
+	template := models.Template{
+		ID:                  utils.GenerateID(),
+		Owner:               token.Subject(),
+		Shared:              init.Shared,
+		Title:               sheet.Title,
+		Description:         sheet.Description,
+		Columns:             sheet.Columns.Schema(data[0]),
+		DeadlineOffsetHours: deadlineOffsetHours(sheet),
+	}
+	if init.Title != "" {
+		template.Title = init.Title
+	}
+	if init.DeadlineOffsetHours != nil {
+		template.DeadlineOffsetHours = *init.DeadlineOffsetHours
+	}
+
+	created, err := h.templates.CreateTemplate(template)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while saving the template. Please try again later."})
+		return
+	}
+
+	c.Header("Location", "/templates/"+created.ID+"/")
+	c.JSON(http.StatusCreated, created)
+}
+
+// deadlineOffsetHours returns the time the spreadsheet had from its creation until its
+// deadline, in whole hours rounded up, within the offsets a template can have.
+func deadlineOffsetHours(sheet *models.Spreadsheet) int {
+	hours := math.Ceil(sheet.Deadline.Sub(sheet.CreatedAt).Hours())
+	return int(min(max(hours, 1), models.MaxDeadlineOffsetHours))
+}
+
+// checkDeadlineOffset checks that a deadline offset of a template is no longer than
+// models.MaxDeadlineOffsetHours, which the binding of the payload does not check. If it
+// is, it responds with an error and returns false.
+func checkDeadlineOffset(c *gin.Context, hours *int) bool {
+	if hours != nil && *hours > models.MaxDeadlineOffsetHours {
+		c.JSON(http.StatusBadRequest, gin.H{"deadlineOffsetHours": utils.DeadlineOffsetMessage})
+		return false
+	}
+	return true
+}
+
+// GetTemplatesHandler handles requests to list the latest version of the templates the
+// authenticated user can use, i.e. their own and the shared ones.
+func (h *TemplateHandler) GetTemplatesHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	templates, err := h.templates.GetAvailable(token.Subject())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving templates. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+// GetTemplateHandler handles requests to retrieve a template. The latest version is
+// returned unless the `version` query parameter asks for another one.
+func (h *TemplateHandler) GetTemplateHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	version := 0
+	if v := c.Query("version"); v != "" {
+		version, err = strconv.Atoi(v)
+		if err != nil || version < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"version": "Version must be at least 1"})
+			return
+		}
+	}
+
+	template, ok := h.usableTemplate(c, token.Subject(), version)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// GetTemplateVersionsHandler handles requests to list every version of a template,
+// latest first.
+func (h *TemplateHandler) GetTemplateVersionsHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	template, ok := h.usableTemplate(c, token.Subject(), 0)
+	if !ok {
+		return
+	}
+
+	versions, err := h.templates.GetVersions(template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving the template. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// UpdateTemplateHandler handles requests by the owner of a template to edit it. Edits
+// other than sharing the template add a version of it, and spreadsheets already created
+// from the template are not affected.
+func (h *TemplateHandler) UpdateTemplateHandler(c *gin.Context) {
+	var update models.TemplateUpdate
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&update); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+	if !checkDeadlineOffset(c, update.DeadlineOffsetHours) {
+		return
+	}
+
+	for i, column := range update.ColumnDefs() {
+		if err := schema.Column(column).Check(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{fmt.Sprintf("columns[%d]", i): "Invalid column: " + err.Error()})
+			return
+		}
+	}
+
+	template, ok := h.ownedTemplate(c, token.Subject())
+	if !ok {
+		return
+	}
+
+	updated, err := h.templates.UpdateTemplate(template.ID, update)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while updating the template. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteTemplateHandler handles requests by the owner of a template to delete it, along
+// with all of its versions.
+func (h *TemplateHandler) DeleteTemplateHandler(c *gin.Context) {
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	template, ok := h.ownedTemplate(c, token.Subject())
+	if !ok {
+		return
+	}
+
+	if err := h.templates.DeleteTemplate(template.ID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while deleting the template. Please try again later."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted successfully"})
+}
+
+// CreateFromTemplateHandler handles the creation of a new spreadsheet from a version of
+// a template the authenticated user can use. The spreadsheet gets a copy of the columns
+// of the template, so later edits to the template do not change it. Its title,
+// description and deadline default to those of the template.
+func (h *TemplateHandler) CreateFromTemplateHandler(c *gin.Context) {
+	var init models.TemplateSpreadsheetInit
+
+	token, err := utils.TokenFromContext(c)
+	if err != nil {
+		slog.Error("Unauthorized request gained access to a protected endpoint", "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := c.ShouldBindJSON(&init); err != nil {
+		respondWithBindingError(c, err)
+		return
+	}
+
+	now := time.Now()
+	if init.Deadline != nil && !init.Deadline.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"deadline": "Deadline must be in the future"})
+		return
+	}
+
+	template, ok := h.usableTemplate(c, token.Subject(), init.Version)
+	if !ok {
+		return
+	}
+
+	sheet := template.SpreadsheetInit(init, now)
+
+	id := utils.GenerateID()
+	columnsJson, err := json.Marshal([][]string{sheet.Headers()})
+	if err != nil {
+		slog.Error("Failed to marshal columns", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create spreadsheet"})
+		return
+	}
+
+	if err := h.sheets.InsertSpreadsheet(sheet, columnsJson, token.Subject(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create spreadsheet"})
+		return
+	}
+
+	c.Header("Location", "/spreadsheet/"+id+"/")
+	c.JSON(http.StatusCreated, gin.H{"message": "Spreadsheet created successfully", "id": id})
+}
+
+// usableTemplate retrieves a version of the template in the request path, or its latest
+// version if `version` is 0, checking that `subject` owns it or that it is shared. If
+// they don't, or the template cannot be retrieved, it responds with an error and
+// returns false.
+func (h *TemplateHandler) usableTemplate(c *gin.Context, subject string, version int) (*models.Template, bool) {
+	template, err := h.templates.GetTemplate(c.Param("templateID"), version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving the template. Please try again later."})
+		return nil, false
+	}
+
+	if template.Owner != subject && !template.Shared {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this template."})
+		return nil, false
+	}
+
+	return template, true
+}
+
+// ownedTemplate retrieves the latest version of the template in the request path,
+// checking that `subject` owns it. If they don't, or the template cannot be retrieved,
+// it responds with an error and returns false.
+func (h *TemplateHandler) ownedTemplate(c *gin.Context, subject string) (*models.Template, bool) {
+	template, err := h.templates.GetTemplate(c.Param("templateID"), 0)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "An unexpected error occurred while retrieving the template. Please try again later."})
+		return nil, false
+	}
+
+	if template.Owner != subject {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner of the template can do this."})
+		return nil, false
+	}
+
+	return template, true
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/waynekn/tablesync/api/db/repo"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/api/utils"
+)
+
+// setUpTemplateCtx creates a test context for a request by `subject` to `target` with the
+// given path params, and `body` encoded as JSON if it is not nil.
+func setUpTemplateCtx(subject, method, target string, params gin.Params, body any) (*gin.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	ctx := utils.CreateTestCtxWithToken(rec)
+	token, _ := utils.TokenFromContext(ctx)
+	token.Set("sub", subject)
+
+	var jsonBytes []byte
+	if body != nil {
+		jsonBytes, _ = json.Marshal(body)
+	}
+
+	ctx.Request = httptest.NewRequest(method, target, bytes.NewReader(jsonBytes))
+	ctx.Params = params
+	return ctx, rec
+}
+
+func TestTemplateHandlers(t *testing.T) {
+	sheets := repo.NewSpreadsheetRepo(testDb)
+	h := NewTemplateHandler(sheets, repo.NewTemplateRepo(testDb))
+
+	sheetID := insertTestSheet(t, "name", "score")
+	other := utils.GenerateID()
+
+	var template models.Template
+	t.Run("only the owner can save a template", func(t *testing.T) {
+		ctx, rec := setUpTemplateCtx(other, "POST", "/", gin.Params{{Key: "sheetID", Value: sheetID}}, models.TemplateInit{})
+		h.SaveTemplateHandler(ctx)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("save template", func(t *testing.T) {
+		ctx, rec := setUpTemplateCtx("test-user", "POST", "/", gin.Params{{Key: "sheetID", Value: sheetID}}, models.TemplateInit{})
+		h.SaveTemplateHandler(ctx)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		err := json.Unmarshal(rec.Body.Bytes(), &template)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		assert.Equal(t, 1, template.Version)
+		assert.Equal(t, "test sheet", template.Title)
+		assert.Equal(t, 1, template.DeadlineOffsetHours)
+		assert.Equal(t, models.Columns{{Title: "name", Type: "text"}, {Title: "score", Type: "text"}}, template.Columns)
+	})
+
+	templateParams := gin.Params{{Key: "templateID", Value: template.ID}}
+
+	t.Run("unshared template", func(t *testing.T) {
+		ctx, rec := setUpTemplateCtx(other, "GET", "/", templateParams, nil)
+		h.GetTemplateHandler(ctx)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("only the owner can edit a template", func(t *testing.T) {
+		shared := true
+		ctx, rec := setUpTemplateCtx(other, "PATCH", "/", templateParams, models.TemplateUpdate{Shared: &shared})
+		h.UpdateTemplateHandler(ctx)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("edit template", func(t *testing.T) {
+		shared := true
+		body := models.TemplateUpdate{
+			Columns: []models.ColumnInit{{Title: "name", Type: "text"}, {Title: "score", Type: "integer"}},
+			Shared:  &shared,
+		}
+		ctx, rec := setUpTemplateCtx("test-user", "PATCH", "/", templateParams, body)
+		h.UpdateTemplateHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var updated models.Template
+		err := json.Unmarshal(rec.Body.Bytes(), &updated)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		assert.Equal(t, 2, updated.Version)
+		assert.True(t, updated.Shared)
+		assert.Equal(t, "integer", updated.Columns[1].Type)
+	})
+
+	t.Run("invalid columns", func(t *testing.T) {
+		body := models.TemplateUpdate{Columns: []models.ColumnInit{{Title: "choice", Type: "select"}}}
+		ctx, rec := setUpTemplateCtx("test-user", "PATCH", "/", templateParams, body)
+		h.UpdateTemplateHandler(ctx)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "columns[0]")
+	})
+
+	t.Run("deadline offset out of range", func(t *testing.T) {
+		for _, hours := range []int{0, models.MaxDeadlineOffsetHours + 1} {
+			body := models.TemplateUpdate{DeadlineOffsetHours: &hours}
+			ctx, rec := setUpTemplateCtx("test-user", "PATCH", "/", templateParams, body)
+			h.UpdateTemplateHandler(ctx)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, "%d hours should be rejected", hours)
+			assert.JSONEq(t, `{"deadlineOffsetHours":"`+utils.DeadlineOffsetMessage+`"}`, rec.Body.String())
+		}
+
+		hours := models.MaxDeadlineOffsetHours
+		body := models.TemplateInit{DeadlineOffsetHours: &hours}
+		ctx, rec := setUpTemplateCtx("test-user", "POST", "/", gin.Params{{Key: "sheetID", Value: sheetID}}, body)
+		h.SaveTemplateHandler(ctx)
+		assert.Equal(t, http.StatusCreated, rec.Code, "the longest offset should be accepted")
+	})
+
+	t.Run("shared templates are listed", func(t *testing.T) {
+		ctx, rec := setUpTemplateCtx(other, "GET", "/", nil, nil)
+		h.GetTemplatesHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), template.ID)
+	})
+
+	t.Run("list versions", func(t *testing.T) {
+		ctx, rec := setUpTemplateCtx(other, "GET", "/", templateParams, nil)
+		h.GetTemplateVersionsHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var versions []models.Template
+		err := json.Unmarshal(rec.Body.Bytes(), &versions)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+		assert.Len(t, versions, 2)
+	})
+
+	t.Run("create spreadsheet from an earlier version", func(t *testing.T) {
+		body := models.TemplateSpreadsheetInit{Title: "From template", Version: 1}
+		ctx, rec := setUpTemplateCtx(other, "POST", "/", templateParams, body)
+		h.CreateFromTemplateHandler(ctx)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var created struct{ ID string }
+		err := json.Unmarshal(rec.Body.Bytes(), &created)
+		assert.NoError(t, err, "Failed to unmarshal response body")
+
+		sheet, err := sheets.GetByID(created.ID)
+		assert.NoError(t, err, "Failed to retrieve the created sheet")
+		assert.Equal(t, "From template", sheet.Title)
+		assert.Equal(t, other, sheet.Owner)
+		assert.Equal(t, "text", sheet.Columns[1].Type)
+		assert.JSONEq(t, `[["name","score"]]`, string(sheet.Data))
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		body := models.TemplateSpreadsheetInit{Version: 3}
+		ctx, rec := setUpTemplateCtx(other, "POST", "/", templateParams, body)
+		h.CreateFromTemplateHandler(ctx)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("delete template", func(t *testing.T) {
+		ctx, rec := setUpTemplateCtx("test-user", "DELETE", "/", templateParams, nil)
+		h.DeleteTemplateHandler(ctx)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		ctx, rec = setUpTemplateCtx("test-user", "GET", "/", templateParams, nil)
+		h.GetTemplateHandler(ctx)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
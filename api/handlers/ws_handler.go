@@ -3,13 +3,17 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/waynekn/tablesync/api/db/repo"
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/api/schema"
 	"github.com/waynekn/tablesync/core/collab"
 	"github.com/waynekn/tablesync/core/ws"
 )
@@ -18,8 +22,13 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return r.Header.Get("Origin") == "http://localhost:5173"
 	},
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
+	Subprotocols:      ws.Subprotocols,
+	EnableCompression: true,
+	ReadBufferSize:    1024,
+	// snapshots of large sheets are written in a single message, so use a larger
+	// write buffer and share it between connections that are not writing.
+	WriteBufferSize: 16 * 1024,
+	WriteBufferPool: &sync.Pool{},
 }
 
 type WsHandler struct {
@@ -36,6 +45,12 @@ func NewWsHandler(repo repo.WsRepo, collabStore *collab.Store, hub *ws.Hub) *WsH
 // EditSessionHandler initializes WebSocket connections for editing a spreadsheet.
 // It upgrades the HTTP connection to a WebSocket connection and checks if the
 // specified spreadsheet exists and is still editable (i.e., the deadline has not passed).
+//
+// The optional `snapshot` query parameter selects how the initial sheet data is sent,
+// see ws.SnapshotMode. It defaults to sending the whole sheet in one message.
+// The optional `mode` query parameter, either "edit" or "view", requests the role of
+// the connection, see connectionRole. Connections in view mode cannot edit the sheet,
+// and users without access to the sheet (see sheetRole) cannot connect.
 func (h *WsHandler) EditSessionHandler(c *gin.Context) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -43,52 +58,189 @@ func (h *WsHandler) EditSessionHandler(c *gin.Context) {
 		return
 	}
 
+	snapshot := ws.SnapshotMode(c.DefaultQuery("snapshot", string(ws.SnapshotFull)))
+	if !snapshot.Valid() {
+		closeWsConn("Invalid snapshot mode.", conn)
+		return
+	}
+
 	sheetID := c.Param("sheetID")
+	sheet, headers, version, err := h.loadSession(sheetID)
+	if err != nil {
+		closeWsConn(sessionErrorMessage(err), conn)
+		return
+	}
+
+	role, err := h.connectionRole(c, sheet, c.Query("mode"))
+	if err != nil {
+		closeWsConn(sessionErrorMessage(err), conn)
+		return
+	}
+
+	opts := ws.ClientOptions{
+		Snapshot: snapshot,
+		Role:     role,
+		Author:   authorFromContext(c),
+		Columns:  schema.Of(sheet.Columns, headers),
+		Rows:     rowPolicy(sheet),
+	}
+	client := ws.NewClient(sheetID, len(headers), conn, h.collab, h.hub, opts)
+	h.hub.Register <- client
+
+	// the columns may have changed after they were loaded, before the client registered
+	// and could be disconnected by the change, see changeColumns
+	if changed, err := columnsChanged(h.collab, sheetID, version); changed || err != nil {
+		client.Close(columnsChangedReason)
+	}
+}
+
+// connectionRole resolves the role of the user making the request in the sheet and the
+// role of their connection in the requested `mode`, see connectionRole.
+// Errors are of type *sessionError.
+func (h *WsHandler) connectionRole(c *gin.Context, sheet *models.Spreadsheet, mode string) (collab.Role, error) {
+	entitled, err := sheetRole(sheet, subjectFromContext(c), h.repo.GetCollaboratorRole)
+	if err != nil {
+		return "", &sessionError{http.StatusInternalServerError, "An unexpected error occurred while connecting. Please try again later."}
+	}
+	return connectionRole(entitled, mode)
+}
+
+// sessionError is an error that occurred while loading a collaborative session,
+// with a message that can be shown to the user.
+type sessionError struct {
+	status  int
+	message string
+}
+
+func (e *sessionError) Error() string {
+	return e.message
+}
+
+// sessionErrorMessage returns the user facing message of an error returned by loadSession.
+func sessionErrorMessage(err error) string {
+	var serr *sessionError
+	if errors.As(err, &serr) {
+		return serr.message
+	}
+	return "An unexpected error occurred while connecting. Please try again later."
+}
+
+// respondWithSessionError responds with the status and message of an error returned by
+// loadSession.
+func respondWithSessionError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	var serr *sessionError
+	if errors.As(err, &serr) {
+		status = serr.status
+	}
+	c.JSON(status, gin.H{"error": sessionErrorMessage(err)})
+}
+
+// loadSession checks that the sheet exists and is still editable, and initializes its
+// collaborative session in Redis if there is none yet. It returns the sheet, its column
+// headers and the version of its columns, see collab.Store.ColumnsVersion. Errors are of
+// type *sessionError.
+func (h *WsHandler) loadSession(sheetID string) (*models.Spreadsheet, []string, int64, error) {
+	version, err := columnsVersion(h.collab, sheetID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
 	sheet, err := h.repo.GetSheetByID(sheetID)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			closeWsConn("The sheet you're trying to edit does not exist.", conn)
-		} else {
-			closeWsConn("An unexpected error occurred while connecting. Please try again later.", conn)
+			return nil, nil, 0, &sessionError{http.StatusNotFound, "The sheet you're trying to edit does not exist."}
 		}
-		return
+		return nil, nil, 0, &sessionError{http.StatusInternalServerError, "An unexpected error occurred while connecting. Please try again later."}
 	}
 
 	now := time.Now().UTC()
 
 	if now.After(sheet.Deadline) {
-		closeWsConn("The deadline to edit this sheet has passed.", conn)
-		return
+		return nil, nil, 0, &sessionError{http.StatusForbidden, "The deadline to edit this sheet has passed."}
 	}
 
-	exists, err := h.collab.SheetExists(sheetID)
+	headers, err := initSession(h.collab, sheet, version)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return sheet, headers, version, nil
+}
 
+// columnsVersion returns the version of the columns of the sheet, which must be read
+// before the sheet is read from the database, see initSession. Errors are of type
+// *sessionError.
+func columnsVersion(store *collab.Store, sheetID string) (int64, error) {
+	version, err := store.ColumnsVersion(sheetID)
+	if errors.Is(err, collab.ErrColumnsLocked) {
+		return 0, &sessionError{http.StatusConflict, columnsChangingMessage}
+	}
 	if err != nil {
-		closeWsConn("An error occurred during initialization. Please try again later.", conn)
-		return
+		return 0, &sessionError{http.StatusInternalServerError, "An error occurred during initialization. Please try again later."}
+	}
+	return version, nil
+}
+
+// columnsChanged reports whether the columns of the sheet have changed or are being
+// changed since they were at `version`, see columnsVersion. Errors are of type
+// *sessionError.
+func columnsChanged(store *collab.Store, sheetID string, version int64) (bool, error) {
+	current, err := store.ColumnsVersion(sheetID)
+	if errors.Is(err, collab.ErrColumnsLocked) {
+		return true, nil
+	}
+	if err != nil {
+		return false, &sessionError{http.StatusInternalServerError, "An error occurred during initialization. Please try again later."}
+	}
+	return current != version, nil
+}
+
+// initSession initializes the collaborative session of the sheet in Redis from its data,
+// the owners of its rows and its formats in the database if there is none yet, and returns its
+// column headers. `version` is the version of the columns read before the sheet, and the
+// session is refused if the columns have changed since. Errors are of
+// type *sessionError.
+func initSession(store *collab.Store, sheet *models.Spreadsheet, version int64) ([]string, error) {
+	exists, err := store.SheetExists(sheet.ID)
+
+	if err != nil {
+		return nil, &sessionError{http.StatusInternalServerError, "An error occurred during initialization. Please try again later."}
 	}
 
 	var sheetData [][]string
 	err = json.Unmarshal(sheet.Data, &sheetData)
 	if err != nil {
 		slog.Error("error unmarshalling sheet data", "err", err)
-		closeWsConn("Could not process sheet data. Please try again in a while", conn)
-		return
+		return nil, &sessionError{http.StatusInternalServerError, "Could not process sheet data. Please try again in a while"}
 	}
 
-	if !exists {
-		err = h.collab.InitRedisSheet(sheetID, sheet.Deadline, &sheetData)
+	if exists {
+		changed, err := columnsChanged(store, sheet.ID, version)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			return nil, &sessionError{http.StatusConflict, columnsChangingMessage}
+		}
+	} else {
+		session := collab.Session{
+			Data:           sheetData,
+			RowOwners:      sheet.RowOwners,
+			Formats:        sheet.Formats.Fields(),
+			ColumnsVersion: version,
+		}
+		err = store.InitSession(sheet.ID, sheet.Deadline, session)
+		if errors.Is(err, collab.ErrColumnsLocked) {
+			return nil, &sessionError{http.StatusConflict, columnsChangingMessage}
+		}
 		if err != nil {
 			slog.Error("error initializing redis sheet", "err", err)
-			closeWsConn("Could not initialize collaborative session.", conn)
-			return
+			return nil, &sessionError{http.StatusInternalServerError, "Could not initialize collaborative session."}
 		}
 	}
 
-	cols := sheetData[0]
-	client := ws.NewClient(sheetID, len(cols), conn, h.collab, h.hub)
-	h.hub.Register <- client
+	return sheetData[0], nil
 }
 
 // closeWsConn closes the WebSocket connection with the provided reason.
@@ -0,0 +1,69 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// delimiters are the delimiters ReadCSV can detect, in order of preference.
+var delimiters = []rune{',', ';', '\t', '|'}
+
+// ReadCSV reads the rows of a CSV file.
+//
+// The file is decoded as UTF-8 unless it starts with a UTF-16 byte order mark, and its
+// delimiter is detected from the first line. Rows may have different numbers of cells,
+// and the empty rows at the end of the file are skipped. It stops with ErrTooManyRows or
+// ErrTooManyColumns once the file has more rows or columns than a sheet can hold.
+func ReadCSV(r io.Reader) ([][]string, error) {
+	// the byte order mark, if any, is removed along the way
+	br := bufio.NewReader(transform.NewReader(r, unicode.BOMOverride(unicode.UTF8.NewDecoder())))
+
+	reader := csv.NewReader(br)
+	reader.Comma = detectDelimiter(br)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var rows rowCollector
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows.rows, nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return nil, fmt.Errorf("invalid CSV on line %d: %w", parseErr.Line, parseErr.Err)
+			}
+			return nil, err
+		}
+
+		if err := rows.add(record); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// detectDelimiter returns the delimiter that occurs most often in the first line
+// buffered by br, or a comma if there is none.
+func detectDelimiter(br *bufio.Reader) rune {
+	// Peek returns what it could buffer along with an error for short files
+	head, _ := br.Peek(br.Size())
+	if i := bytes.IndexByte(head, '\n'); i >= 0 {
+		head = head[:i]
+	}
+
+	best, count := delimiters[0], 0
+	for _, d := range delimiters {
+		if n := bytes.Count(head, []byte(string(d))); n > count {
+			best, count = d, n
+		}
+	}
+	return best
+}
@@ -0,0 +1,175 @@
+// Package importer reads the rows of spreadsheets created by other applications so that
+// they can be imported as the initial data of a sheet.
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"unicode/utf8"
+)
+
+// Limits on the size of imported sheets.
+const (
+	MaxRows       = 10000
+	MaxColumns    = 200
+	MaxCellLength = 32767 // the maximum length of a cell in Excel
+)
+
+var (
+	ErrNoHeaders      = errors.New("no headers to import")
+	ErrTooManyRows    = fmt.Errorf("sheets cannot have more than %d rows", MaxRows)
+	ErrTooManyColumns = fmt.Errorf("sheets cannot have more than %d columns", MaxColumns)
+)
+
+// Kinds of problems found in imported rows.
+const (
+	ProblemRagged    = "ragged"
+	ProblemOversized = "oversized"
+)
+
+// Problem describes a row that could not be imported as it is, and how it was fixed.
+// Rows are numbered from 1 as in the imported file.
+type Problem struct {
+	Row     int    `json:"row"`
+	Col     *int   `json:"col,omitempty"` // numbered from 1, if the problem is with a single cell
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// Options configures how the rows of a file become the data of a sheet.
+type Options struct {
+	// HeaderRow is the row of the file holding the headers, numbered from 1. Rows above
+	// it are skipped. It is 0 if the file has no header row, in which case every row is
+	// imported and Headers must be set.
+	HeaderRow int
+	// Headers, if set, are used as the headers instead of the header row.
+	Headers []string
+}
+
+// Build returns the data of a sheet, headers included, from the rows of a file.
+//
+// Every row is made as wide as the headers: short rows are padded with empty cells and
+// the extra cells of long rows are dropped. Cells longer than MaxCellLength are cut short.
+// Such fixes are reported as problems, except for empty rows and when only empty cells
+// are dropped. Empty rows at the end of the file are skipped.
+//
+// It returns ErrNoHeaders if there are no headers, and ErrTooManyRows or
+// ErrTooManyColumns if the sheet would be too large.
+func Build(rows [][]string, opts Options) ([][]string, []Problem, error) {
+	headers := opts.Headers
+	first := opts.HeaderRow
+	if opts.HeaderRow > 0 {
+		if opts.HeaderRow > len(rows) {
+			return nil, nil, ErrNoHeaders
+		}
+		if headers == nil {
+			headers = rows[opts.HeaderRow-1]
+		}
+	}
+	headers = trimTrailingEmpty(headers)
+	if len(headers) == 0 {
+		return nil, nil, ErrNoHeaders
+	}
+	if len(headers) > MaxColumns {
+		return nil, nil, ErrTooManyColumns
+	}
+
+	last := len(rows)
+	for last > first && len(trimTrailingEmpty(rows[last-1])) == 0 {
+		last--
+	}
+	if last-first > MaxRows {
+		return nil, nil, ErrTooManyRows
+	}
+
+	var problems []Problem
+	data := make([][]string, 0, last-first+1)
+	data = append(data, fitRow(headers, len(headers), opts.HeaderRow, &problems))
+	for i := first; i < last; i++ {
+		data = append(data, fitRow(rows[i], len(headers), i+1, &problems))
+	}
+
+	return data, problems, nil
+}
+
+// fitRow returns row `n` of the file with `width` cells, recording what was changed in
+// `problems`.
+func fitRow(row []string, width, n int, problems *[]Problem) []string {
+	cells := make([]string, width)
+	copy(cells, row)
+
+	filled := trimTrailingEmpty(row)
+	if len(row) < width && len(filled) > 0 {
+		*problems = append(*problems, Problem{
+			Row:     n,
+			Kind:    ProblemRagged,
+			Message: fmt.Sprintf("Row has %d cells but there are %d columns, the missing cells were left empty", len(row), width),
+		})
+	} else if len(filled) > width {
+		*problems = append(*problems, Problem{
+			Row:     n,
+			Kind:    ProblemRagged,
+			Message: fmt.Sprintf("Row has %d cells but there are %d columns, the extra cells were dropped", len(filled), width),
+		})
+	}
+
+	for i, cell := range cells {
+		if utf8.RuneCountInString(cell) > MaxCellLength {
+			cells[i] = string([]rune(cell)[:MaxCellLength])
+			col := i + 1
+			*problems = append(*problems, Problem{
+				Row:     n,
+				Col:     &col,
+				Kind:    ProblemOversized,
+				Message: fmt.Sprintf("Cell is longer than %d characters and was cut short", MaxCellLength),
+			})
+		}
+	}
+
+	return cells
+}
+
+// rowCollector collects the rows of a file. Empty rows are only kept once a row with
+// content follows them, so that the empty rows at the end of a file are never held.
+type rowCollector struct {
+	rows  [][]string
+	empty int
+}
+
+// add adds the next row of the file. It returns ErrTooManyRows once there are more
+// rows than a sheet with a header row can hold, and ErrTooManyColumns as soon as a row
+// has more cells than a sheet can hold. Empty cells past the columns a sheet can hold
+// are dropped.
+func (c *rowCollector) add(row []string) error {
+	filled := len(trimTrailingEmpty(row))
+	if filled == 0 {
+		c.empty++
+		return nil
+	}
+	if filled > MaxColumns {
+		return ErrTooManyColumns
+	}
+	if len(row) > MaxColumns {
+		row = slices.Clone(row[:MaxColumns])
+	}
+
+	for ; c.empty > 0; c.empty-- {
+		c.rows = append(c.rows, nil)
+	}
+	c.rows = append(c.rows, row)
+
+	if len(c.rows) > MaxRows+1 {
+		return ErrTooManyRows
+	}
+	return nil
+}
+
+// trimTrailingEmpty returns row without its trailing empty cells.
+func trimTrailingEmpty(row []string) []string {
+	n := len(row)
+	for n > 0 && row[n-1] == "" {
+		n--
+	}
+	return row[:n]
+}
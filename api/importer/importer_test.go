@@ -0,0 +1,147 @@
+package importer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestBuild(t *testing.T) {
+	rows := [][]string{
+		{"Class list", "", ""},
+		{"id", "name", ""},
+		{"007", "Amina", ""},
+		{"008"},
+		{"009", "Brian", "extra"},
+		{"", "", ""},
+	}
+
+	t.Run("header row", func(t *testing.T) {
+		data, problems, err := Build(rows, Options{HeaderRow: 2})
+		assert.NoError(t, err, "Build should not return an error")
+		assert.Equal(t, [][]string{{"id", "name"}, {"007", "Amina"}, {"008", ""}, {"009", "Brian"}}, data)
+		assert.Len(t, problems, 2)
+		assert.Equal(t, Problem{Row: 4, Kind: ProblemRagged, Message: problems[0].Message}, problems[0])
+		assert.Equal(t, 5, problems[1].Row)
+		assert.Equal(t, ProblemRagged, problems[1].Kind)
+	})
+
+	t.Run("chosen headers", func(t *testing.T) {
+		data, _, err := Build(rows, Options{HeaderRow: 2, Headers: []string{"ID", "Name", "Note"}})
+		assert.NoError(t, err, "Build should not return an error")
+		assert.Equal(t, []string{"ID", "Name", "Note"}, data[0])
+		assert.Equal(t, []string{"009", "Brian", "extra"}, data[3])
+	})
+
+	t.Run("no header row", func(t *testing.T) {
+		data, _, err := Build(rows[2:], Options{Headers: []string{"ID", "Name"}})
+		assert.NoError(t, err, "Build should not return an error")
+		assert.Len(t, data, 4)
+		assert.Equal(t, []string{"007", "Amina"}, data[1])
+	})
+
+	t.Run("no headers", func(t *testing.T) {
+		_, _, err := Build(rows, Options{})
+		assert.ErrorIs(t, err, ErrNoHeaders)
+
+		_, _, err = Build(rows, Options{HeaderRow: 10})
+		assert.ErrorIs(t, err, ErrNoHeaders)
+	})
+
+	t.Run("oversized cell", func(t *testing.T) {
+		long := strings.Repeat("x", MaxCellLength+1)
+		data, problems, err := Build([][]string{{"a", "b"}, {"1", long}}, Options{HeaderRow: 1})
+		assert.NoError(t, err, "Build should not return an error")
+		assert.Len(t, data[1][1], MaxCellLength)
+		assert.Len(t, problems, 1)
+		assert.Equal(t, ProblemOversized, problems[0].Kind)
+		assert.Equal(t, 2, *problems[0].Col)
+	})
+
+	t.Run("too many columns", func(t *testing.T) {
+		headers := make([]string, MaxColumns+1)
+		for i := range headers {
+			headers[i] = "header"
+		}
+		_, _, err := Build(nil, Options{Headers: headers})
+		assert.ErrorIs(t, err, ErrTooManyColumns)
+	})
+}
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  [][]string
+	}{
+		{"comma", "id,name\n007,Amina\n", [][]string{{"id", "name"}, {"007", "Amina"}}},
+		{"semicolon", "id;name\r\n007;\"Smith, J\"\r\n", [][]string{{"id", "name"}, {"007", "Smith, J"}}},
+		{"tab", "id\tname\n", [][]string{{"id", "name"}}},
+		{"byte order mark", "\xef\xbb\xbfid,name\n", [][]string{{"id", "name"}}},
+		{"ragged", "id,name\n007\n", [][]string{{"id", "name"}, {"007"}}},
+		{"trailing empty rows", "id,name\n,\n007,Amina\n,\n,\n", [][]string{{"id", "name"}, nil, {"007", "Amina"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := ReadCSV(strings.NewReader(tt.input))
+			assert.NoError(t, err, "ReadCSV should not return an error")
+			assert.Equal(t, tt.want, rows)
+		})
+	}
+
+	t.Run("utf-16", func(t *testing.T) {
+		rows, err := ReadCSV(bytes.NewReader([]byte{0xff, 0xfe, 'a', 0, ',', 0, 'b', 0}))
+		assert.NoError(t, err, "ReadCSV should not return an error")
+		assert.Equal(t, [][]string{{"a", "b"}}, rows)
+	})
+
+	t.Run("too many rows", func(t *testing.T) {
+		_, err := ReadCSV(strings.NewReader(strings.Repeat("x\n", MaxRows+2)))
+		assert.ErrorIs(t, err, ErrTooManyRows)
+	})
+
+	t.Run("too many columns", func(t *testing.T) {
+		_, err := ReadCSV(strings.NewReader("id\n" + strings.Repeat("x,", MaxColumns) + "x\n"))
+		assert.ErrorIs(t, err, ErrTooManyColumns)
+
+		rows, err := ReadCSV(strings.NewReader("id\nx" + strings.Repeat(",", 2*MaxColumns) + "\n"))
+		assert.NoError(t, err, "empty cells past the last column should be ignored")
+		assert.Len(t, rows[1], MaxColumns, "empty cells past the last column should be dropped")
+	})
+}
+
+func TestReadXLSX(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+	f.SetSheetRow("Sheet1", "A1", &[]any{"id", "name", "note"})
+	f.SetSheetRow("Sheet1", "A2", &[]any{"007", "Amina"})
+	// a formatted but empty row at the end of the worksheet
+	f.SetRowHeight("Sheet1", 5, 30)
+
+	var buf bytes.Buffer
+	_, err := f.WriteTo(&buf)
+	assert.NoError(t, err, "Failed to write the workbook")
+
+	rows, err := ReadXLSX(&buf)
+	assert.NoError(t, err, "ReadXLSX should not return an error")
+	assert.Equal(t, [][]string{{"id", "name", "note"}, {"007", "Amina", ""}}, rows)
+
+	_, err = ReadXLSX(strings.NewReader("not a workbook"))
+	assert.Error(t, err, "ReadXLSX should fail on other files")
+
+	wide := excelize.NewFile()
+	defer wide.Close()
+	cell, _ := excelize.CoordinatesToCellName(MaxColumns+1, 2)
+	wide.SetCellValue("Sheet1", "A1", "id")
+	wide.SetCellValue("Sheet1", cell, "x")
+	buf.Reset()
+	_, err = wide.WriteTo(&buf)
+	assert.NoError(t, err, "Failed to write the workbook")
+
+	_, err = ReadXLSX(&buf)
+	assert.ErrorIs(t, err, ErrTooManyColumns)
+}
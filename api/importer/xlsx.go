@@ -0,0 +1,56 @@
+package importer
+
+import (
+	"io"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// maxUnzipSize is the maximum size of the contents of an imported workbook once it is
+// unzipped, so that small files cannot expand to fill the memory.
+const maxUnzipSize = 100 << 20
+
+// ReadXLSX reads the rows of the first worksheet of an Excel workbook.
+//
+// Every row is made as wide as the widest row of the worksheet, as workbooks do not
+// store the empty cells at the end of a row. The empty rows at the end of the worksheet
+// are skipped. It stops with ErrTooManyRows or ErrTooManyColumns once the worksheet has
+// more rows or columns than a sheet can hold.
+func ReadXLSX(r io.Reader) ([][]string, error) {
+	f, err := excelize.OpenReader(r, excelize.Options{UnzipSizeLimit: maxUnzipSize})
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	iter, err := f.Rows(f.GetSheetName(0))
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var collector rowCollector
+	width := 0
+	for iter.Next() {
+		row, err := iter.Columns()
+		if err != nil {
+			return nil, err
+		}
+		if err := collector.add(row); err != nil {
+			return nil, err
+		}
+		width = max(width, len(trimTrailingEmpty(row)))
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	rows := collector.rows
+	for i, row := range rows {
+		if len(row) < width {
+			rows[i] = append(row, make([]string, width-len(row))...)
+		}
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/waynekn/tablesync/api/db/repo"
+)
+
+// DefaultTrashRetention is how long spreadsheets stay in the trash before they are
+// permanently deleted when no retention period is configured.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// trashPurgeInterval is how often the trash is purged.
+const trashPurgeInterval = time.Hour
+
+// PurgeTrash permanently deletes the spreadsheets that have been in the trash for
+// longer than `retention`, once immediately and then every `trashPurgeInterval`,
+// until ctx is done. It is meant to be run in its own goroutine.
+func PurgeTrash(ctx context.Context, sheets repo.SpreadsheetRepo, retention time.Duration) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := sheets.PurgeTrash(retention)
+		if err != nil {
+			slog.Error("Failed to purge the trash", "error", err)
+		} else if n > 0 {
+			slog.Info("Purged trashed spreadsheets", "count", n)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
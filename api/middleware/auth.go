@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/lestrrat-go/jwx/jwt"
 	"github.com/redis/go-redis/v9"
@@ -20,11 +21,6 @@ import (
 // If the token is missing or invalid, the request is aborted.
 func RequireAuth(rdb *redis.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		pubKeyUrl := os.Getenv("PUB_KEY_URL")
-
 		authHeader := c.GetHeader("Authorization")
 		splitAuthHeader := strings.Split(authHeader, " ")
 
@@ -36,49 +32,109 @@ func RequireAuth(rdb *redis.Client) gin.HandlerFunc {
 			return
 		}
 
-		keySet, err := getKeySetFromRedis(ctx, rdb)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		if !authenticate(c, rdb, splitAuthHeader[1]) {
 			return
 		}
 
-		// If the key set is not cached, fetch it from the public key URL
-		if keySet == nil {
-			keySet, err = jwk.Fetch(c.Request.Context(), pubKeyUrl)
-			if err != nil {
-				slog.Error("Failed to fetch JWK", "error", err)
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-				return
+		c.Next()
+	}
+}
+
+// accessTokenProtocol prefixes the access token when it is offered as a websocket
+// subprotocol, e.g. "access_token.<token>".
+const accessTokenProtocol = "access_token."
+
+// accessTokenCookie is the cookie the access token can be sent in.
+const accessTokenCookie = "access_token"
+
+// OptionalAuth is a Gin middleware for endpoints that can be used anonymously, such as
+// websocket and Server-Sent Events connections. Since browsers cannot set headers on
+// those connections, the access token can also be offered as a websocket subprotocol
+// prefixed with "access_token." next to the subprotocols of the server, or sent in the
+// `access_token` cookie. Tokens are never read from the URL, which ends up in logs.
+//
+// If no token is provided, the request proceeds without a token in the context.
+// If a token is provided but is invalid, the request is aborted.
+func OptionalAuth(rdb *redis.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rawToken, _ := c.Cookie(accessTokenCookie)
+
+		for _, protocol := range websocket.Subprotocols(c.Request) {
+			if token, ok := strings.CutPrefix(protocol, accessTokenProtocol); ok {
+				rawToken = token
+				break
 			}
-			// Store the fetched key set in Redis for future use
-			jsonKeySet, err := json.Marshal(keySet)
-			if err != nil {
-				slog.Error("Failed to marshal jwk key set", "error", err)
-			} else {
-				if err := rdb.Set(ctx, "jwk_keySet", jsonKeySet, 24*time.Hour).Err(); err != nil {
-					slog.Error("Failed to store pub keys in Redis", "error", err)
-				}
+		}
+
+		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+			splitAuthHeader := strings.Split(authHeader, " ")
+			if len(splitAuthHeader) != 2 || strings.ToLower(splitAuthHeader[0]) != "bearer" {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error": "Missing or invalid Authorization header",
+				})
+				return
 			}
+			rawToken = splitAuthHeader[1]
+		}
+
+		if rawToken != "" && !authenticate(c, rdb, rawToken) {
+			return
 		}
 
-		token, err := jwt.Parse(
-			[]byte(splitAuthHeader[1]),
-			jwt.WithKeySet(keySet),
-			jwt.WithValidate(true),
-		)
+		c.Next()
+	}
+}
+
+// authenticate validates the raw access token against the public key set and stores
+// the parsed token in the context under the "token" key.
+// If the token can't be validated, the request is aborted and false is returned.
+func authenticate(c *gin.Context, rdb *redis.Client, rawToken string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pubKeyUrl := os.Getenv("PUB_KEY_URL")
 
+	keySet, err := getKeySetFromRedis(ctx, rdb)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return false
+	}
+
+	// If the key set is not cached, fetch it from the public key URL
+	if keySet == nil {
+		keySet, err = jwk.Fetch(c.Request.Context(), pubKeyUrl)
 		if err != nil {
-			slog.Info("Invalid token", "error", err)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid token",
-			})
-			return
+			slog.Error("Failed to fetch JWK", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return false
+		}
+		// Store the fetched key set in Redis for future use
+		jsonKeySet, err := json.Marshal(keySet)
+		if err != nil {
+			slog.Error("Failed to marshal jwk key set", "error", err)
+		} else {
+			if err := rdb.Set(ctx, "jwk_keySet", jsonKeySet, 24*time.Hour).Err(); err != nil {
+				slog.Error("Failed to store pub keys in Redis", "error", err)
+			}
 		}
+	}
 
-		c.Set("token", token)
+	token, err := jwt.Parse(
+		[]byte(rawToken),
+		jwt.WithKeySet(keySet),
+		jwt.WithValidate(true),
+	)
 
-		c.Next()
+	if err != nil {
+		slog.Info("Invalid token", "error", err)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid token",
+		})
+		return false
 	}
+
+	c.Set("token", token)
+	return true
 }
 
 // getKeySetFromRedis retrieves the JWK Set from Redis.
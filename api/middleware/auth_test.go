@@ -85,3 +85,71 @@ func TestAuthMiddleWare(t *testing.T) {
 	})
 
 }
+
+func TestOptionalAuthMiddleWare(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+            "keys": [{
+                "kty": "RSA",
+                "kid": "test-key",
+                "n": "test-modulus",
+                "e": "AQAB"
+            }]
+        }`))
+	}))
+	defer testServer.Close()
+
+	t.Setenv("PUB_KEY_URL", testServer.URL)
+
+	router := gin.Default()
+	router.GET("/optional", OptionalAuth(testRdb), func(ctx *gin.Context) {
+		_, hasToken := ctx.Get("token")
+		ctx.JSON(200, gin.H{"authenticated": hasToken})
+	})
+
+	t.Run("Without Token", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/optional", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{"authenticated": false}`, resp.Body.String())
+	})
+
+	t.Run("Bad Authorization Header", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/optional", nil)
+		req.Header.Set("Authorization", "BadFormatToken")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	})
+
+	t.Run("Query Token Is Ignored", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/optional?access_token=token", nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{"authenticated": false}`, resp.Body.String())
+	})
+
+	t.Run("Invalid Subprotocol Token", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/optional", nil)
+		req.Header.Set("Sec-WebSocket-Protocol", "tablesync.json, access_token.token")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	})
+
+	t.Run("Invalid Cookie Token", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/optional", nil)
+		req.AddCookie(&http.Cookie{Name: "access_token", Value: "token"})
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	})
+}
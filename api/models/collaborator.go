@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Roles a collaborator can be given. The owner of a sheet is not a collaborator.
+// Managers are editors who can also edit the rows of others in row ownership mode.
+const (
+	CollaboratorRoleEditor  = "editor"
+	CollaboratorRoleManager = "manager"
+	CollaboratorRoleViewer  = "viewer"
+)
+
+// CollaboratorInit represents the payload to share a spreadsheet with a user.
+type CollaboratorInit struct {
+	UserID string `json:"userId" binding:"required,max=255"` // subject of the user's access token
+	Role   string `json:"role" binding:"required,oneof=editor manager viewer"`
+}
+
+// CollaboratorUpdate represents the payload to change the role of a collaborator.
+type CollaboratorUpdate struct {
+	Role string `json:"role" binding:"required,oneof=editor manager viewer"`
+}
+
+// Collaborator represents a user a spreadsheet is shared with.
+type Collaborator struct {
+	SheetID   string    `json:"sheetId"`
+	UserID    string    `json:"userId"`
+	Role      string    `json:"role"`
+	AddedBy   string    `json:"addedBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// ColumnInit represents the definition of a column in the payload to create a spreadsheet,
+// with the constraints on its values. See Column for the meaning of each field.
+type ColumnInit struct {
+	Title    string   `json:"title" binding:"required,max=255"`
+	Type     string   `json:"type" binding:"required,oneof=text integer decimal date boolean select email url"`
+	Options  []string `json:"options"` // values accepted by select columns
+	Required bool     `json:"required"`
+	Pattern  string   `json:"pattern" binding:"max=255"`
+	Min      *float64 `json:"min"`
+	Max      *float64 `json:"max"`
+	Unique   bool     `json:"unique"`
+	Hidden   bool     `json:"hidden"`
+}
+
+// Column returns the definition of the column.
+func (c ColumnInit) Column() Column {
+	return Column(c)
+}
+
+// columnInits returns the payload defining each of the `columns`.
+func columnInits(columns Columns) []ColumnInit {
+	inits := make([]ColumnInit, len(columns))
+	for i, column := range columns {
+		inits[i] = ColumnInit(column)
+	}
+	return inits
+}
+
+// ColumnAdd represents the payload to add a column to an existing spreadsheet.
+type ColumnAdd struct {
+	ColumnInit
+	Position *int `json:"position" binding:"omitnil,min=0"` // Index of the column once added. Defaults to after the last column
+}
+
+// ColumnUpdate represents the payload to rename or hide a column of a spreadsheet.
+// Fields that are not provided are left unchanged.
+type ColumnUpdate struct {
+	Title  *string `json:"title" binding:"omitnil,min=1,max=255"`
+	Hidden *bool   `json:"hidden"`
+}
+
+// ColumnOrder represents the payload to reorder the columns of a spreadsheet. Order
+// lists the current index of every column, in their new order.
+type ColumnOrder struct {
+	Order []int `json:"order" binding:"required,min=1"`
+}
+
+// columnText is the type of columns that accept any value.
+const columnText = "text"
+
+// Column represents the definition of a column of a spreadsheet, as stored in the
+// database. It is converted to a collab.Column to validate edits, which documents each
+// field.
+type Column struct {
+	Title    string   `json:"title"`
+	Type     string   `json:"type"`
+	Options  []string `json:"options,omitempty"`
+	Required bool     `json:"required,omitempty"`
+	Pattern  string   `json:"pattern,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Unique   bool     `json:"unique,omitempty"`
+	Hidden   bool     `json:"hidden,omitempty"`
+}
+
+// Columns are the column definitions of a spreadsheet, stored as jsonb. They are nil
+// for spreadsheets whose columns are all text.
+type Columns []Column
+
+// Scan implements sql.Scanner.
+func (c *Columns) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, c)
+	case string:
+		return json.Unmarshal([]byte(src), c)
+	default:
+		return fmt.Errorf("cannot scan %T into Columns", src)
+	}
+}
+
+// Value implements driver.Valuer.
+func (c Columns) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	return json.Marshal(c)
+}
+
+// Schema returns the columns of a spreadsheet with the given headers, titled after the
+// headers. Columns without a definition, which includes every column of spreadsheets
+// created without types, are text columns.
+func (c Columns) Schema(headers []string) Columns {
+	schema := make(Columns, len(headers))
+	for i, header := range headers {
+		if i < len(c) {
+			schema[i] = c[i]
+		} else {
+			schema[i].Type = columnText
+		}
+		schema[i].Title = header
+	}
+	return schema
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// CommentThreadInit represents the payload to start a comment thread on a cell of a
+// spreadsheet, or on a whole row if no column is given. Rows are indexed the same way as
+// client edits, i.e. without the header row.
+type CommentThreadInit struct {
+	Row  *int   `json:"row" binding:"required,min=0"`
+	Col  *int   `json:"col" binding:"omitnil,min=0"`
+	Body string `json:"body" binding:"required,max=5000"`
+}
+
+// CommentInit represents the payload to reply to a comment thread.
+type CommentInit struct {
+	Body string `json:"body" binding:"required,max=5000"`
+}
+
+// CommentThreadsQuery represents the query parameters of a request for the comment
+// threads of a spreadsheet.
+type CommentThreadsQuery struct {
+	Resolved *bool `form:"resolved"` // nil for both open and resolved threads
+}
+
+// Comment represents a message of a comment thread.
+type Comment struct {
+	ID        string    `json:"id"`
+	ThreadID  string    `json:"threadId"`
+	Author    Author    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Author represents the user who wrote a comment.
+type Author struct {
+	ID   string `json:"id"` // subject of the user's access token
+	Name string `json:"name,omitempty"`
+}
+
+// CommentThread represents a discussion anchored to a cell of a spreadsheet, or to a
+// whole row if Col is nil. Comments are in the order they were made, the first one
+// being the one that started the thread.
+type CommentThread struct {
+	ID         string     `json:"id"`
+	SheetID    string     `json:"sheetId"`
+	Row        int        `json:"row"`
+	Col        *int       `json:"col"`
+	CreatedBy  string     `json:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	ResolvedBy *string    `json:"resolvedBy"`
+	ResolvedAt *time.Time `json:"resolvedAt"`
+	Comments   []Comment  `json:"comments"`
+}
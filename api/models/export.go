@@ -0,0 +1,7 @@
+package models
+
+// CSVExportQuery represents the query parameters of a CSV export.
+type CSVExportQuery struct {
+	Delimiter string `form:"delimiter" json:"delimiter" binding:"omitempty,oneof=comma semicolon tab pipe"`            // Defaults to comma
+	Encoding  string `form:"encoding" json:"encoding" binding:"omitempty,oneof=utf-8 utf-8-bom utf-16le windows-1252"` // Defaults to utf-8
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Formats maps the columns and cells of a spreadsheet to their format, stored as jsonb.
+// Columns are keyed "col:<col>" and cells "<row>:<col>", with the header row as row 0.
+// The format of a cell replaces the format of its column.
+type Formats map[string]json.RawMessage
+
+// Scan implements sql.Scanner.
+func (f *Formats) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, f)
+	case string:
+		return json.Unmarshal([]byte(src), f)
+	default:
+		return fmt.Errorf("cannot scan %T into Formats", src)
+	}
+}
+
+// Value implements driver.Valuer.
+func (f Formats) Value() (driver.Value, error) {
+	if len(f) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(f)
+}
+
+// Fields returns the formats as JSON keyed by field, the way live editing sessions keep
+// them.
+func (f Formats) Fields() map[string]string {
+	fields := make(map[string]string, len(f))
+	for field, format := range f {
+		fields[field] = string(format)
+	}
+	return fields
+}
+
+// FormatsFromFields returns the formats kept as JSON keyed by field, see Formats.Fields.
+// Formats that are not valid JSON are skipped.
+func FormatsFromFields(fields map[string]string) Formats {
+	formats := make(Formats, len(fields))
+	for field, format := range fields {
+		if json.Valid([]byte(format)) {
+			formats[field] = json.RawMessage(format)
+		}
+	}
+	return formats
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// SpreadsheetImport represents the multipart form to create a spreadsheet from a CSV or
+// XLSX file, which is sent in the `file` field.
+type SpreadsheetImport struct {
+	Title       string    `form:"title" json:"title" binding:"required,max=255"`
+	Description string    `form:"description" json:"description" binding:"required"`
+	Deadline    time.Time `form:"deadline" json:"deadline" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"` // Deadline in RFC3339 format
+	LinkAccess  string    `form:"linkAccess" json:"linkAccess" binding:"omitempty,oneof=edit view none"`               // Defaults to LinkAccessEdit
+	HeaderRow   *int      `form:"headerRow" json:"headerRow" binding:"omitnil,min=0"`                                  // Row of the file with the headers, from 1. Defaults to 1, 0 if there is none
+	ColTitles   []string  `form:"colTitles" json:"colTitles"`                                                          // Headers to use instead of the header row
+}
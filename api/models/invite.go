@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// InviteInit represents the payload to create an invite link to a spreadsheet.
+type InviteInit struct {
+	Role      string    `json:"role" binding:"required,oneof=editor manager viewer"`
+	ExpiresAt time.Time `json:"expiresAt" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"` // Expiry in RFC3339 format
+	MaxUses   *int      `json:"maxUses" binding:"omitnil,min=1"`                                      // nil for unlimited uses
+}
+
+// Invite represents an invite link that adds whoever redeems it as a collaborator of
+// a spreadsheet.
+type Invite struct {
+	ID        string     `json:"id"`
+	SheetID   string     `json:"sheetId"`
+	Role      string     `json:"role"`
+	CreatedBy string     `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	MaxUses   *int       `json:"maxUses"`
+	Uses      int        `json:"uses"`
+	RevokedAt *time.Time `json:"revokedAt"`
+	Token     string     `json:"token"` // signed token to redeem the invite with
+}
+
+// InviteRedemption records that a user joined a spreadsheet through an invite.
+type InviteRedemption struct {
+	InviteID   string    `json:"inviteId"`
+	UserID     string    `json:"userId"`
+	RedeemedAt time.Time `json:"redeemedAt"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Formats of the rows of a spreadsheet.
+const (
+	RowsFormatJSON   = "json"
+	RowsFormatNDJSON = "ndjson"
+)
+
+// RowsQuery represents the query parameters of a request for the rows of a spreadsheet.
+type RowsQuery struct {
+	Format string `form:"format" json:"format" binding:"omitempty,oneof=json ndjson"` // Defaults to RowsFormatJSON
+}
+
+// RowOwners maps the rows of a spreadsheet in row ownership mode to the users who own
+// them, stored as jsonb. Rows are indexed as in the data of the spreadsheet, i.e. with
+// the header row as row 0.
+type RowOwners map[int]string
+
+// Scan implements sql.Scanner.
+func (o *RowOwners) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*o = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, o)
+	case string:
+		return json.Unmarshal([]byte(src), o)
+	default:
+		return fmt.Errorf("cannot scan %T into RowOwners", src)
+	}
+}
+
+// Value implements driver.Valuer.
+func (o RowOwners) Value() (driver.Value, error) {
+	if len(o) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(o)
+}
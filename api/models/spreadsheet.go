@@ -2,22 +2,155 @@ package models
 
 import "time"
 
+// Link access levels, i.e. what anyone with a link to a sheet may do with it.
+// With LinkAccessNone, only the owner and the collaborators of the sheet can access it.
+const (
+	LinkAccessEdit = "edit"
+	LinkAccessView = "view"
+	LinkAccessNone = "none"
+)
+
 // SpreadsheetInit represents the payload required to create a new spreadsheet.
+// Its columns are either given as titles, in which case they are all text columns,
+// or as definitions with types. Exactly one of ColTitles and Columns must be provided.
 type SpreadsheetInit struct {
+	Title       string       `json:"title" binding:"required,max=255"`
+	Description string       `json:"description" binding:"required"`
+	Deadline    time.Time    `json:"deadline" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"` // Deadline in RFC3339 format
+	ColTitles   []string     `json:"colTitles" binding:"required_without=Columns,excluded_with=Columns,omitempty,min=1"`
+	Columns     []ColumnInit `json:"columns" binding:"required_without=ColTitles,omitempty,min=1,dive"`
+	LinkAccess  string       `json:"linkAccess" binding:"omitempty,oneof=edit view none"` // Defaults to LinkAccessEdit
+
+	// RowOwnership enables the row ownership mode, see Spreadsheet.RowPolicy.
+	RowOwnership   bool `json:"rowOwnership"`
+	MaxRowsPerUser *int `json:"maxRowsPerUser" binding:"omitnil,min=1"` // no limit if nil
+}
+
+// Headers returns the titles of the columns of the spreadsheet.
+func (s SpreadsheetInit) Headers() []string {
+	if len(s.Columns) == 0 {
+		return s.ColTitles
+	}
+	headers := make([]string, len(s.Columns))
+	for i, column := range s.Columns {
+		headers[i] = column.Title
+	}
+	return headers
+}
+
+// ColumnDefs returns the definitions of the columns of the spreadsheet, or nil if its
+// columns were given as titles.
+func (s SpreadsheetInit) ColumnDefs() Columns {
+	if len(s.Columns) == 0 {
+		return nil
+	}
+	columns := make(Columns, len(s.Columns))
+	for i, column := range s.Columns {
+		columns[i] = column.Column()
+	}
+	return columns
+}
+
+// SpreadsheetUpdate represents the payload to update the metadata of a spreadsheet.
+// Fields that are not provided are left unchanged.
+type SpreadsheetUpdate struct {
+	Title       *string    `json:"title" binding:"omitnil,min=1,max=255"`
+	Description *string    `json:"description" binding:"omitnil,min=1"`
+	Deadline    *time.Time `json:"deadline" time_format:"2006-01-02T15:04:05Z07:00"` // Deadline in RFC3339 format
+	LinkAccess  *string    `json:"linkAccess" binding:"omitnil,oneof=edit view none"`
+
+	RowOwnership   *bool `json:"rowOwnership"`
+	MaxRowsPerUser *int  `json:"maxRowsPerUser" binding:"omitnil,min=0"` // 0 removes the limit
+}
+
+// SpreadsheetCopy represents the payload to duplicate a spreadsheet.
+type SpreadsheetCopy struct {
 	Title       string    `json:"title" binding:"required,max=255"`
-	Description string    `json:"description" binding:"required"`
 	Deadline    time.Time `json:"deadline" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"` // Deadline in RFC3339 format
-	ColTitles   []string  `json:"colTitles" binding:"required,min=1"`
+	IncludeData bool      `json:"includeData"`                                                         // whether the rows are copied along with the headers
 }
 
 // Spreadsheet represents a spreadsheet stored in the database.
 type Spreadsheet struct {
-	ID          string    `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Owner       string    `json:"owner"`
-	CreatedAt   time.Time `json:"createdAt"`
-	UpdatedAt   time.Time `json:"updatedAt"`
-	Data        []byte    `json:"data"` // [][]string stored as jsonb
-	Deadline    time.Time `json:"deadline"`
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Owner       string     `json:"owner"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	Data        []byte     `json:"data"` // [][]string stored as jsonb
+	Deadline    time.Time  `json:"deadline"`
+	LinkAccess  string     `json:"linkAccess"`
+	Columns     Columns    `json:"columns"`             // nil if the columns are all text, see Columns.Schema
+	DeletedAt   *time.Time `json:"deletedAt,omitempty"` // set while the sheet is in the trash
+
+	RowOwnership   bool      `json:"rowOwnership"`
+	MaxRowsPerUser *int      `json:"maxRowsPerUser"` // nil if contributors can create any number of rows
+	RowOwners      RowOwners `json:"-"`              // as of the last time the live data was saved
+	Formats        Formats   `json:"-"`              // as of the last time the live data was saved
+}
+
+// Copy returns the payload creating a copy of the spreadsheet, with the given headers,
+// as described by `cp`. Everything but the contents of the spreadsheet is copied.
+func (s Spreadsheet) Copy(cp SpreadsheetCopy, headers []string) SpreadsheetInit {
+	sheet := SpreadsheetInit{
+		Title:          cp.Title,
+		Description:    s.Description,
+		Deadline:       cp.Deadline,
+		LinkAccess:     s.LinkAccess,
+		RowOwnership:   s.RowOwnership,
+		MaxRowsPerUser: s.MaxRowsPerUser,
+	}
+	if s.Columns == nil {
+		sheet.ColTitles = headers
+	} else {
+		sheet.Columns = columnInits(s.Columns.Schema(headers))
+	}
+	return sheet
+}
+
+// SpreadsheetSummary represents a spreadsheet without its data, as shown in lists.
+type SpreadsheetSummary struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Owner       string     `json:"owner"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	Deadline    time.Time  `json:"deadline"`
+	LinkAccess  string     `json:"linkAccess"`
+	Role        string     `json:"role"`                // role of the user the sheet is listed for
+	DeletedAt   *time.Time `json:"deletedAt,omitempty"` // set for the sheets listed in the trash
+}
+
+// Limits on the number of spreadsheets listed per page.
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 100
+)
+
+// SpreadsheetListQuery represents the query parameters for listing spreadsheets.
+// Empty fields fall back to listing the most recently created spreadsheets first.
+type SpreadsheetListQuery struct {
+	Cursor string `form:"cursor" json:"cursor"` // NextCursor of the previous page
+	Limit  int    `form:"limit" json:"limit" binding:"omitempty,min=1,max=100"`
+	Sort   string `form:"sort" json:"sort" binding:"omitempty,oneof=created updated deadline"`
+	Order  string `form:"order" json:"order" binding:"omitempty,oneof=asc desc"`
+	Status string `form:"status" json:"status" binding:"omitempty,oneof=open closed"` // whether the deadline has passed
+	Search string `form:"q" json:"q" binding:"max=255"`                               // matched against the title
+}
+
+// SpreadsheetPage represents a page of listed spreadsheets. NextCursor is empty on
+// the last page.
+type SpreadsheetPage struct {
+	Items      []SpreadsheetSummary
+	NextCursor string
+}
+
+// SpreadsheetWithData represents a spreadsheet along with its current contents.
+type SpreadsheetWithData struct {
+	Spreadsheet
+	Data    [][]string `json:"data"`    // headers are the first row
+	Formats Formats    `json:"formats"` // rows are indexed as in Data
+	Live    bool       `json:"live"`    // whether Data and Formats were read from a live editing session
 }
@@ -0,0 +1,91 @@
+package models
+
+import "time"
+
+// MaxDeadlineOffsetHours is the longest time, in hours, from the creation of a spreadsheet
+// created from a template to its default deadline.
+const MaxDeadlineOffsetHours = 366 * 24
+
+// TemplateInit represents the payload to save the structure of a spreadsheet as a
+// template. The columns and description of the template are those of the spreadsheet.
+type TemplateInit struct {
+	Title               string `json:"title" binding:"max=255"`                     // Defaults to the title of the spreadsheet
+	DeadlineOffsetHours *int   `json:"deadlineOffsetHours" binding:"omitnil,min=1"` // At most MaxDeadlineOffsetHours. Defaults to the time the spreadsheet had until its deadline
+	Shared              bool   `json:"shared"`
+}
+
+// TemplateUpdate represents the payload to edit a template. Editing any of its fields
+// other than Shared adds a version of the template, which the fields that are not
+// provided are carried over to from the latest version.
+type TemplateUpdate struct {
+	Title               *string      `json:"title" binding:"omitnil,min=1,max=255"`
+	Description         *string      `json:"description"`
+	Columns             []ColumnInit `json:"columns" binding:"omitnil,min=1,dive"`
+	DeadlineOffsetHours *int         `json:"deadlineOffsetHours" binding:"omitnil,min=1"` // At most MaxDeadlineOffsetHours
+	Shared              *bool        `json:"shared"`
+}
+
+// Versioned reports whether the update adds a version of the template.
+func (u TemplateUpdate) Versioned() bool {
+	return u.Title != nil || u.Description != nil || u.Columns != nil || u.DeadlineOffsetHours != nil
+}
+
+// ColumnDefs returns the definitions of the columns of the update, or nil if the columns
+// are not updated.
+func (u TemplateUpdate) ColumnDefs() Columns {
+	if u.Columns == nil {
+		return nil
+	}
+	columns := make(Columns, len(u.Columns))
+	for i, column := range u.Columns {
+		columns[i] = column.Column()
+	}
+	return columns
+}
+
+// Template represents a version of a template, along with the template itself.
+type Template struct {
+	ID                  string    `json:"id"`
+	Owner               string    `json:"owner"`
+	Shared              bool      `json:"shared"` // whether every user can use the template
+	LatestVersion       int       `json:"latestVersion"`
+	CreatedAt           time.Time `json:"createdAt"`
+	Version             int       `json:"version"`
+	Title               string    `json:"title"`
+	Description         string    `json:"description"`
+	Columns             Columns   `json:"columns"`
+	DeadlineOffsetHours int       `json:"deadlineOffsetHours"`
+	VersionCreatedAt    time.Time `json:"versionCreatedAt"`
+}
+
+// TemplateSpreadsheetInit represents the payload to create a spreadsheet from a
+// template. Fields that are not provided are taken from the template.
+type TemplateSpreadsheetInit struct {
+	Title       string     `json:"title" binding:"max=255"`
+	Description *string    `json:"description"`
+	Deadline    *time.Time `json:"deadline" time_format:"2006-01-02T15:04:05Z07:00"` // Defaults to the deadline offset of the template from now
+	Version     int        `json:"version" binding:"omitempty,min=1"`                // Defaults to the latest version
+	LinkAccess  string     `json:"linkAccess" binding:"omitempty,oneof=edit view none"`
+}
+
+// SpreadsheetInit returns the payload creating the spreadsheet described by `init` from
+// the template, at time `now`.
+func (t Template) SpreadsheetInit(init TemplateSpreadsheetInit, now time.Time) SpreadsheetInit {
+	sheet := SpreadsheetInit{
+		Title:       t.Title,
+		Description: t.Description,
+		Deadline:    now.Add(time.Duration(t.DeadlineOffsetHours) * time.Hour),
+		Columns:     columnInits(t.Columns),
+		LinkAccess:  init.LinkAccess,
+	}
+	if init.Title != "" {
+		sheet.Title = init.Title
+	}
+	if init.Description != nil {
+		sheet.Description = *init.Description
+	}
+	if init.Deadline != nil {
+		sheet.Deadline = *init.Deadline
+	}
+	return sheet
+}
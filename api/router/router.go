@@ -1,7 +1,10 @@
 package router
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"log/slog"
+	"os"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -38,7 +41,10 @@ func New(db *sql.DB, redis *redis.Client) *Router {
 func (r *Router) setupMiddleware() {
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"http://localhost:5173"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "If-None-Match"}
+	config.ExposeHeaders = []string{"ETag", "Location", "X-Next-Cursor"}
+	// lets live views send the access_token cookie, see middleware.OptionalAuth
+	config.AllowCredentials = true
 	r.engine.Use(cors.New(config))
 }
 
@@ -50,23 +56,112 @@ func (r *Router) registerRoutes() {
 	// Initialize repositories
 	spreadsheetRepo := repo.NewSpreadsheetRepo(r.db)
 	wsRepo := repo.NewWsRepo(r.db)
+	collaboratorRepo := repo.NewCollaboratorRepo(r.db)
+	inviteRepo := repo.NewInviteRepo(r.db)
+	templateRepo := repo.NewTemplateRepo(r.db)
+	commentRepo := repo.NewCommentRepo(r.db)
 
 	// Initialize handlers
-	spreadsheetHandler := handlers.NewSpreadsheetHandler(spreadsheetRepo)
+	spreadsheetHandler := handlers.NewSpreadsheetHandler(spreadsheetRepo, collaboratorRepo, collabStore, hub)
 	wsHandler := handlers.NewWsHandler(wsRepo, collabStore, hub)
+	inviteHandler := handlers.NewInviteHandler(spreadsheetRepo, inviteRepo, hub, inviteSigningKey())
+	templateHandler := handlers.NewTemplateHandler(spreadsheetRepo, templateRepo)
+	commentHandler := handlers.NewCommentHandler(spreadsheetRepo, collaboratorRepo, commentRepo, hub)
 
 	// Register routes
 	r.registerSpreadsheetRoutes(spreadsheetHandler)
+	r.registerColumnRoutes(spreadsheetHandler)
+	r.registerCollaboratorRoutes(spreadsheetHandler)
+	r.registerInviteRoutes(inviteHandler)
+	r.registerTemplateRoutes(templateHandler)
+	r.registerCommentRoutes(commentHandler)
 	r.registerWebSocketRoutes(wsHandler)
+	r.registerLiveViewRoutes(wsHandler)
 }
 
 func (r *Router) registerSpreadsheetRoutes(h *handlers.SpreadsheetHandler) {
 	r.engine.POST("spreadsheet/create/", middleware.RequireAuth(r.redis), h.CreateSpreadsheetHandler)
+	r.engine.POST("spreadsheet/import/", middleware.RequireAuth(r.redis), h.ImportSpreadsheetHandler)
 	r.engine.GET("spreadsheets/", middleware.RequireAuth(r.redis), h.GetOwnSpreadsheetsHandler)
+	r.engine.GET("spreadsheet/:sheetID/", middleware.RequireAuth(r.redis), h.GetSpreadsheetHandler)
+	r.engine.PATCH("spreadsheet/:sheetID/", middleware.RequireAuth(r.redis), h.UpdateSpreadsheetHandler)
+	r.engine.DELETE("spreadsheet/:sheetID/", middleware.RequireAuth(r.redis), h.DeleteSpreadsheetHandler)
+	r.engine.GET("spreadsheets/trash/", middleware.RequireAuth(r.redis), h.GetTrashHandler)
+	r.engine.POST("spreadsheet/:sheetID/restore/", middleware.RequireAuth(r.redis), h.RestoreSpreadsheetHandler)
+	r.engine.POST("spreadsheet/:sheetID/duplicate/", middleware.RequireAuth(r.redis), h.DuplicateSpreadsheetHandler)
+	r.engine.GET("spreadsheets/shared/", middleware.RequireAuth(r.redis), h.GetSharedSpreadsheetsHandler)
+	r.engine.GET("spreadsheet/:sheetID/export/csv/", middleware.RequireAuth(r.redis), h.ExportCSVHandler)
+	r.engine.GET("spreadsheet/:sheetID/export/xlsx/", middleware.RequireAuth(r.redis), h.ExportXLSXHandler)
+	r.engine.GET("spreadsheet/:sheetID/rows/", middleware.RequireAuth(r.redis), h.GetRowsHandler)
+	r.engine.POST("spreadsheet/:sheetID/rows/", middleware.RequireAuth(r.redis), h.AppendRowHandler)
+	r.engine.GET("spreadsheet/:sheetID/rows/:row/", middleware.RequireAuth(r.redis), h.GetRowHandler)
+}
+
+func (r *Router) registerColumnRoutes(h *handlers.SpreadsheetHandler) {
+	r.engine.POST("spreadsheet/:sheetID/columns/", middleware.RequireAuth(r.redis), h.AddColumnHandler)
+	r.engine.PUT("spreadsheet/:sheetID/columns/order/", middleware.RequireAuth(r.redis), h.ReorderColumnsHandler)
+	r.engine.PATCH("spreadsheet/:sheetID/columns/:col/", middleware.RequireAuth(r.redis), h.UpdateColumnHandler)
+	r.engine.DELETE("spreadsheet/:sheetID/columns/:col/", middleware.RequireAuth(r.redis), h.DeleteColumnHandler)
+}
+
+func (r *Router) registerCollaboratorRoutes(h *handlers.SpreadsheetHandler) {
+	r.engine.GET("spreadsheet/:sheetID/collaborators/", middleware.RequireAuth(r.redis), h.GetCollaboratorsHandler)
+	r.engine.POST("spreadsheet/:sheetID/collaborators/", middleware.RequireAuth(r.redis), h.AddCollaboratorHandler)
+	r.engine.PATCH("spreadsheet/:sheetID/collaborators/:userID/", middleware.RequireAuth(r.redis), h.UpdateCollaboratorHandler)
+	r.engine.DELETE("spreadsheet/:sheetID/collaborators/:userID/", middleware.RequireAuth(r.redis), h.RemoveCollaboratorHandler)
+}
+
+func (r *Router) registerInviteRoutes(h *handlers.InviteHandler) {
+	r.engine.GET("spreadsheet/:sheetID/invites/", middleware.RequireAuth(r.redis), h.GetInvitesHandler)
+	r.engine.POST("spreadsheet/:sheetID/invites/", middleware.RequireAuth(r.redis), h.CreateInviteHandler)
+	r.engine.GET("spreadsheet/:sheetID/invites/redemptions/", middleware.RequireAuth(r.redis), h.GetRedemptionsHandler)
+	r.engine.DELETE("spreadsheet/:sheetID/invites/:inviteID/", middleware.RequireAuth(r.redis), h.RevokeInviteHandler)
+	r.engine.POST("invites/:token/redeem/", middleware.RequireAuth(r.redis), h.RedeemInviteHandler)
+}
+
+func (r *Router) registerTemplateRoutes(h *handlers.TemplateHandler) {
+	r.engine.POST("spreadsheet/:sheetID/template/", middleware.RequireAuth(r.redis), h.SaveTemplateHandler)
+	r.engine.GET("templates/", middleware.RequireAuth(r.redis), h.GetTemplatesHandler)
+	r.engine.GET("templates/:templateID/", middleware.RequireAuth(r.redis), h.GetTemplateHandler)
+	r.engine.PATCH("templates/:templateID/", middleware.RequireAuth(r.redis), h.UpdateTemplateHandler)
+	r.engine.DELETE("templates/:templateID/", middleware.RequireAuth(r.redis), h.DeleteTemplateHandler)
+	r.engine.GET("templates/:templateID/versions/", middleware.RequireAuth(r.redis), h.GetTemplateVersionsHandler)
+	r.engine.POST("templates/:templateID/spreadsheet/", middleware.RequireAuth(r.redis), h.CreateFromTemplateHandler)
+}
+
+func (r *Router) registerCommentRoutes(h *handlers.CommentHandler) {
+	r.engine.GET("spreadsheet/:sheetID/comments/", middleware.RequireAuth(r.redis), h.GetCommentThreadsHandler)
+	r.engine.POST("spreadsheet/:sheetID/comments/", middleware.RequireAuth(r.redis), h.CreateCommentThreadHandler)
+	r.engine.POST("spreadsheet/:sheetID/comments/:threadID/replies/", middleware.RequireAuth(r.redis), h.ReplyToCommentThreadHandler)
+	r.engine.POST("spreadsheet/:sheetID/comments/:threadID/resolve/", middleware.RequireAuth(r.redis), h.ResolveCommentThreadHandler)
+	r.engine.POST("spreadsheet/:sheetID/comments/:threadID/reopen/", middleware.RequireAuth(r.redis), h.ReopenCommentThreadHandler)
 }
 
 func (r *Router) registerWebSocketRoutes(h *handlers.WsHandler) {
-	r.engine.GET("ws/sheet/:sheetID/edit/", h.EditSessionHandler)
+	r.engine.GET("ws/sheet/:sheetID/edit/", middleware.OptionalAuth(r.redis), h.EditSessionHandler)
+}
+
+func (r *Router) registerLiveViewRoutes(h *handlers.WsHandler) {
+	r.engine.GET("sse/sheet/:sheetID/view/", middleware.OptionalAuth(r.redis), h.LiveViewHandler)
+}
+
+// inviteSigningKey returns the key invite tokens are signed with, read from the
+// INVITE_SIGNING_KEY environment variable. If it is not set a random key is used,
+// and invite links stop working when the server restarts. The server exits if no random
+// key can be generated.
+func inviteSigningKey() []byte {
+	if key := os.Getenv("INVITE_SIGNING_KEY"); key != "" {
+		return []byte(key)
+	}
+
+	slog.Warn("INVITE_SIGNING_KEY is not set, invite links will not survive a restart")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		// never sign invites with a predictable key
+		slog.Error("Failed to generate an invite signing key, shutting down", "error", err)
+		os.Exit(1)
+	}
+	return key
 }
 
 // Run starts the server
@@ -0,0 +1,54 @@
+// Package schema converts the column definitions of spreadsheets, as they are stored in
+// the database (see models.Columns), to and from the columns that edits are validated
+// against in editing sessions (see collab.Column).
+package schema
+
+import (
+	"github.com/waynekn/tablesync/api/models"
+	"github.com/waynekn/tablesync/core/collab"
+)
+
+// Column returns the definition of a column that edits are validated against.
+func Column(c models.Column) collab.Column {
+	return collab.Column{
+		Title:    c.Title,
+		Type:     collab.ColumnType(c.Type),
+		Options:  c.Options,
+		Required: c.Required,
+		Pattern:  c.Pattern,
+		Min:      c.Min,
+		Max:      c.Max,
+		Unique:   c.Unique,
+		Hidden:   c.Hidden,
+	}
+}
+
+// Of returns the columns of a spreadsheet with the given headers, titled after the
+// headers. See models.Columns.Schema.
+func Of(columns models.Columns, headers []string) []collab.Column {
+	schema := columns.Schema(headers)
+	converted := make([]collab.Column, len(schema))
+	for i, column := range schema {
+		converted[i] = Column(column)
+	}
+	return converted
+}
+
+// Stored returns the definitions of the `columns` to store in the database.
+func Stored(columns []collab.Column) models.Columns {
+	stored := make(models.Columns, len(columns))
+	for i, c := range columns {
+		stored[i] = models.Column{
+			Title:    c.Title,
+			Type:     string(c.Type),
+			Options:  c.Options,
+			Required: c.Required,
+			Pattern:  c.Pattern,
+			Min:      c.Min,
+			Max:      c.Max,
+			Unique:   c.Unique,
+			Hidden:   c.Hidden,
+		}
+	}
+	return stored
+}
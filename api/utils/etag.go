@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// ETag returns a strong entity tag for the response body.
+func ETag(body []byte) string {
+	return fmt.Sprintf("%q", fmt.Sprintf("%x", sha256.Sum256(body)))
+}
+
+// ETagMatches reports whether the value of an If-None-Match header matches the entity tag.
+// Weak comparison is used as recommended for If-None-Match, so the W/ prefix is ignored.
+func ETagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
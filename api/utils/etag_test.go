@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETag(t *testing.T) {
+	etag := ETag([]byte("body"))
+
+	assert.Equal(t, etag, ETag([]byte("body")), "the same body should have the same ETag")
+	assert.NotEqual(t, etag, ETag([]byte("other body")), "different bodies should have different ETags")
+	assert.Regexp(t, `^"[0-9a-f]{64}"$`, etag, "ETag should be a quoted hex digest")
+}
+
+func TestETagMatches(t *testing.T) {
+	etag := `"abc"`
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        bool
+	}{
+		{"empty header", "", false},
+		{"same tag", `"abc"`, true},
+		{"weak tag", `W/"abc"`, true},
+		{"list of tags", `"xyz", "abc"`, true},
+		{"wildcard", "*", true},
+		{"different tag", `"xyz"`, false},
+		{"unquoted tag", "abc", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ETagMatches(tt.ifNoneMatch, etag))
+		})
+	}
+}
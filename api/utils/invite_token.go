@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidInviteToken is returned when an invite token is malformed or its signature
+// does not match.
+var ErrInvalidInviteToken = errors.New("invalid invite token")
+
+// SignInviteToken returns the token of the invite with the ID `inviteID`, i.e. the ID
+// followed by its HMAC-SHA256 signature with `key`.
+func SignInviteToken(inviteID string, key []byte) string {
+	return inviteID + "." + inviteSignature(inviteID, key)
+}
+
+// ParseInviteToken verifies the signature of an invite token created with
+// SignInviteToken and returns the ID of the invite.
+func ParseInviteToken(token string, key []byte) (string, error) {
+	inviteID, signature, ok := strings.Cut(token, ".")
+	if !ok || inviteID == "" {
+		return "", ErrInvalidInviteToken
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(inviteSignature(inviteID, key))) {
+		return "", ErrInvalidInviteToken
+	}
+
+	return inviteID, nil
+}
+
+func inviteSignature(inviteID string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(inviteID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInviteToken(t *testing.T) {
+	key := []byte("test-key")
+	inviteID := GenerateID()
+
+	token := SignInviteToken(inviteID, key)
+
+	id, err := ParseInviteToken(token, key)
+	assert.NoError(t, err, "a signed token should be valid")
+	assert.Equal(t, inviteID, id)
+
+	_, err = ParseInviteToken(token, []byte("another-key"))
+	assert.ErrorIs(t, err, ErrInvalidInviteToken, "a token signed with another key should be invalid")
+
+	_, err = ParseInviteToken(GenerateID()+token[len(inviteID):], key)
+	assert.ErrorIs(t, err, ErrInvalidInviteToken, "a signature should only be valid for its invite")
+
+	_, err = ParseInviteToken(inviteID, key)
+	assert.ErrorIs(t, err, ErrInvalidInviteToken, "a token without a signature should be invalid")
+}
@@ -4,8 +4,13 @@ import (
 	"fmt"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/waynekn/tablesync/api/models"
 )
 
+// DeadlineOffsetMessage is the error message of a deadline offset of a template that is
+// out of range. The upper bound is checked by the handlers, see models.MaxDeadlineOffsetHours.
+var DeadlineOffsetMessage = fmt.Sprintf("Deadline offset must be between 1 and %d hours", models.MaxDeadlineOffsetHours)
+
 // GetValidationErrorMessage returns a user-friendly error message for validation errors that occur
 // durinb creation of a spreadsheet.
 // It uses field-specific messages for known fields and falls back to generic messages for other fields.
@@ -17,17 +22,95 @@ func GetValidationErrorMessage(fieldErr validator.FieldError) string {
 		"title": {
 			"required": "Title is required",
 			"max":      "Title must be 255 characters or less",
+			"min":      "Title cannot be empty",
 		},
 		"description": {
 			"required": "Description is required",
+			"min":      "Description cannot be empty",
 		},
 		"deadline": {
 			"required":    "Deadline is required",
 			"time_format": "Deadline must be in format YYYY-MM-DDTHH:MM:SSZ",
 		},
 		"colTitles": {
-			"required": "Column titles are required",
-			"min":      "At least one column title is required",
+			"required":         "Column titles are required",
+			"required_without": "Column titles or columns are required",
+			"excluded_with":    "Provide either column titles or columns, not both",
+			"min":              "At least one column title is required",
+		},
+		"columns": {
+			"required_without": "Column titles or columns are required",
+			"min":              "At least one column is required",
+		},
+		"pattern": {
+			"max": "Pattern must be 255 characters or less",
+		},
+		"type": {
+			"required": "Column type is required",
+			"oneof":    "Column type must be one of text, integer, decimal, date, boolean, select, email or url",
+		},
+		"linkAccess": {
+			"oneof": "Link access must be one of edit, view or none",
+		},
+		"maxRowsPerUser": {
+			"min": "Maximum rows per user must be at least 1",
+		},
+		"deadlineOffsetHours": {
+			"min": DeadlineOffsetMessage,
+		},
+		"version": {
+			"min": "Version must be at least 1",
+		},
+		"position": {
+			"min": "Position must be 0 or more",
+		},
+		"order": {
+			"required": "Order is required",
+			"min":      "Order must list every column",
+		},
+		"row": {
+			"required": "Row is required",
+			"min":      "Row must be 0 or more",
+		},
+		"col": {
+			"min": "Column must be 0 or more",
+		},
+		"body": {
+			"required": "Comment cannot be empty",
+			"max":      "Comment must be 5000 characters or less",
+		},
+		"userId": {
+			"required": "User ID is required",
+			"max":      "User ID must be 255 characters or less",
+		},
+		"role": {
+			"required": "Role is required",
+			"oneof":    "Role must be one of editor, manager or viewer",
+		},
+		"limit": {
+			"min": "Limit must be between 1 and 100",
+			"max": "Limit must be between 1 and 100",
+		},
+		"q": {
+			"max": "Search must be 255 characters or less",
+		},
+		"expiresAt": {
+			"required": "Expiry is required",
+		},
+		"maxUses": {
+			"min": "Maximum uses must be at least 1",
+		},
+		"headerRow": {
+			"min": "Header row must be 0 or more",
+		},
+		"format": {
+			"oneof": "Format must be either json or ndjson",
+		},
+		"delimiter": {
+			"oneof": "Delimiter must be one of comma, semicolon, tab or pipe",
+		},
+		"encoding": {
+			"oneof": "Encoding must be one of utf-8, utf-8-bom, utf-16le or windows-1252",
 		},
 	}
 
@@ -37,6 +120,7 @@ func GetValidationErrorMessage(fieldErr validator.FieldError) string {
 		"max":         "Must be %v characters or less",
 		"min":         "Must have at least %v items",
 		"time_format": "Invalid time format",
+		"oneof":       "Must be one of: %v",
 	}
 
 	// 1. Check for field-specific message first
@@ -0,0 +1,292 @@
+package collab
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ColumnType is the type of the values of a column.
+type ColumnType string
+
+const (
+	ColumnText    ColumnType = "text"
+	ColumnInteger ColumnType = "integer"
+	ColumnDecimal ColumnType = "decimal"
+	ColumnDate    ColumnType = "date" // formatted as YYYY-MM-DD
+	ColumnBoolean ColumnType = "boolean"
+	ColumnSelect  ColumnType = "select" // one of the options of the column
+	ColumnEmail   ColumnType = "email"
+	ColumnURL     ColumnType = "url"
+)
+
+// DateFormat is the layout of the values of date columns.
+const DateFormat = "2006-01-02"
+
+// Rules a value can break, as reported by CellError.
+const (
+	RuleColumn   = "column" // the column does not exist
+	RuleType     = "type"
+	RuleRequired = "required"
+	RulePattern  = "pattern"
+	RuleMin      = "min"
+	RuleMax      = "max"
+	RuleUnique   = "unique"
+
+	RuleRowOwner = "rowOwner" // the row belongs to another user, see Store.ClaimRow
+	RuleRowLimit = "rowLimit" // the user cannot create more rows
+)
+
+var (
+	integerPattern = regexp.MustCompile(`^-?[0-9]+$`)
+	decimalPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+)
+
+// Column describes a column of a sheet and the values its cells accept.
+type Column struct {
+	Title   string     `json:"title"`
+	Type    ColumnType `json:"type"`
+	Options []string   `json:"options,omitempty"` // values accepted by select columns
+
+	// Constraints on the values of the column, on top of its type.
+	Required bool     `json:"required,omitempty"` // cells cannot be cleared
+	Pattern  string   `json:"pattern,omitempty"`  // regular expression whole values must match
+	Min      *float64 `json:"min,omitempty"`      // smallest value of a number column
+	Max      *float64 `json:"max,omitempty"`      // largest value of a number column
+	Unique   bool     `json:"unique,omitempty"`   // no two rows can have the same value
+
+	Hidden bool `json:"hidden,omitempty"` // not shown by clients, although its cells keep their values
+}
+
+// CellError reports a value that a column does not accept, or an edit to a row the
+// user may not edit. Message describes the problem to the user in the style of the
+// validation errors of the API.
+type CellError struct {
+	Col     int    `json:"col"`
+	Rule    string `json:"rule"`            // one of the Rule constants
+	Param   string `json:"param,omitempty"` // e.g. the bound of a min or max rule
+	Message string `json:"message"`
+}
+
+func (e *CellError) Error() string {
+	return e.Message
+}
+
+// TextColumns returns columns of type text with the given titles, which is what the
+// columns of sheets created without types are.
+func TextColumns(titles []string) []Column {
+	columns := make([]Column, len(titles))
+	for i, title := range titles {
+		columns[i] = Column{Title: title, Type: ColumnText}
+	}
+	return columns
+}
+
+// isNumber reports whether the column holds numbers.
+func (c Column) isNumber() bool {
+	return c.Type == ColumnInteger || c.Type == ColumnDecimal
+}
+
+// Check reports whether the column is well defined, i.e. that select columns have
+// distinct, non-empty options and that other columns have none, and that its
+// constraints apply to its type.
+func (c Column) Check() error {
+	if c.Type != ColumnSelect && len(c.Options) > 0 {
+		return errors.New("only select columns can have options")
+	}
+	if c.Type == ColumnSelect {
+		if len(c.Options) == 0 {
+			return errors.New("select columns must have at least one option")
+		}
+		for i, option := range c.Options {
+			if option == "" {
+				return errors.New("options cannot be empty")
+			}
+			if slices.Contains(c.Options[:i], option) {
+				return fmt.Errorf("option %q is repeated", option)
+			}
+		}
+	}
+
+	if c.Pattern != "" {
+		if c.Type != ColumnText && c.Type != ColumnEmail && c.Type != ColumnURL {
+			return errors.New("only text, email and url columns can have a pattern")
+		}
+		if _, err := compilePattern(c.Pattern); err != nil {
+			return errors.New("pattern is not a valid regular expression")
+		}
+	}
+
+	if (c.Min != nil || c.Max != nil) && !c.isNumber() {
+		return errors.New("only integer and decimal columns can have a minimum or maximum")
+	}
+	if c.Min != nil && c.Max != nil && *c.Min > *c.Max {
+		return errors.New("minimum cannot be greater than maximum")
+	}
+	return nil
+}
+
+// Validate checks that `value` is accepted by the column, apart from its uniqueness,
+// which only the store can check (see Store.ApplyCellEdit). Empty values are accepted
+// so that cells can be cleared, unless the column is required. Errors are of type
+// *CellError.
+func (c Column) Validate(value string) error {
+	if value == "" {
+		if c.Required {
+			return c.cellError(RuleRequired, "", "%s is required", c.name())
+		}
+		return nil
+	}
+
+	if err := c.validateType(value); err != nil {
+		return err
+	}
+
+	if c.Pattern != "" {
+		re, err := compilePattern(c.Pattern)
+		if err != nil || !re.MatchString(value) {
+			return c.cellError(RulePattern, c.Pattern, "%s must match the pattern %s", c.name(), c.Pattern)
+		}
+	}
+
+	if c.isNumber() && (c.Min != nil || c.Max != nil) {
+		// the type has been validated, so the value parses
+		n, _ := strconv.ParseFloat(value, 64)
+		switch {
+		case c.Min != nil && c.Max != nil && (n < *c.Min || n > *c.Max):
+			rule, param := RuleMin, formatBound(*c.Min)
+			if n > *c.Max {
+				rule, param = RuleMax, formatBound(*c.Max)
+			}
+			return c.cellError(rule, param, "%s must be between %s and %s", c.name(), formatBound(*c.Min), formatBound(*c.Max))
+		case c.Min != nil && n < *c.Min:
+			return c.cellError(RuleMin, formatBound(*c.Min), "%s must be at least %s", c.name(), formatBound(*c.Min))
+		case c.Max != nil && n > *c.Max:
+			return c.cellError(RuleMax, formatBound(*c.Max), "%s must be %s or less", c.name(), formatBound(*c.Max))
+		}
+	}
+	return nil
+}
+
+// validateType checks that a non-empty `value` is of the type of the column.
+func (c Column) validateType(value string) error {
+	switch c.Type {
+	case ColumnInteger:
+		if !integerPattern.MatchString(value) {
+			return c.cellError(RuleType, string(c.Type), "%s must be a whole number", c.name())
+		}
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return c.cellError(RuleType, string(c.Type), "%s is too large a number", c.name())
+		}
+	case ColumnDecimal:
+		if !decimalPattern.MatchString(value) {
+			return c.cellError(RuleType, string(c.Type), "%s must be a number, use a dot for decimals as in 12.5", c.name())
+		}
+	case ColumnDate:
+		if _, err := time.Parse(DateFormat, value); err != nil {
+			return c.cellError(RuleType, string(c.Type), "%s must be a date in the format YYYY-MM-DD", c.name())
+		}
+	case ColumnBoolean:
+		if value != "true" && value != "false" {
+			return c.cellError(RuleType, string(c.Type), "%s must be either true or false", c.name())
+		}
+	case ColumnSelect:
+		if !slices.Contains(c.Options, value) {
+			return c.cellError(RuleType, string(c.Type), "%s must be one of %s", c.name(), oneOf(c.Options))
+		}
+	case ColumnEmail:
+		addr, err := mail.ParseAddress(value)
+		if err != nil || addr.Address != value {
+			return c.cellError(RuleType, string(c.Type), "%s must be an email address", c.name())
+		}
+	case ColumnURL:
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return c.cellError(RuleType, string(c.Type), "%s must be a web address starting with http:// or https://", c.name())
+		}
+	}
+	return nil
+}
+
+// duplicateError returns the error of a value of a unique column that is already in
+// row `row` of the sheet, counting the header row as row 0. The row is reported the way
+// clients index rows, i.e. without the header row.
+func (c Column) duplicateError(value string, row int) error {
+	row--
+	return c.cellError(RuleUnique, strconv.Itoa(row), "%s must be unique, %q is already in row %d", c.name(), value, row)
+}
+
+// cellError returns a *CellError for the column. Col is set by ValidateCell.
+func (c Column) cellError(rule, param, format string, args ...any) error {
+	return &CellError{Rule: rule, Param: param, Message: fmt.Sprintf(format, args...)}
+}
+
+// name returns how the column is called in error messages.
+func (c Column) name() string {
+	if c.Title == "" {
+		return "Value"
+	}
+	return c.Title
+}
+
+// ValidateCell checks that `value` is accepted by the column at index `col`, see
+// Column.Validate. Errors are of type *CellError.
+func ValidateCell(columns []Column, col int, value string) error {
+	if col < 0 || col >= len(columns) {
+		return &CellError{Col: col, Rule: RuleColumn, Message: fmt.Sprintf("Column %d does not exist", col+1)}
+	}
+	if err := columns[col].Validate(value); err != nil {
+		err.(*CellError).Col = col
+		return err
+	}
+	return nil
+}
+
+// maxPatterns is the number of compiled patterns kept in the cache. The cache is emptied
+// once it is full, so that patterns of sheets that are no longer edited are not kept.
+const maxPatterns = 1024
+
+// patterns caches the compiled patterns of columns, which are matched on every edit.
+var patterns = struct {
+	sync.Mutex
+	compiled map[string]*regexp.Regexp
+}{compiled: make(map[string]*regexp.Regexp)}
+
+// compilePattern compiles a pattern of a column so that it matches whole values.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	patterns.Lock()
+	defer patterns.Unlock()
+
+	if re, ok := patterns.compiled[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns.compiled) >= maxPatterns {
+		clear(patterns.compiled)
+	}
+	patterns.compiled[pattern] = re
+	return re, nil
+}
+
+// formatBound formats a bound of a number column without trailing zeros.
+func formatBound(bound float64) string {
+	return strconv.FormatFloat(bound, 'f', -1, 64)
+}
+
+// oneOf lists options as in "a, b or c".
+func oneOf(options []string) string {
+	if len(options) == 1 {
+		return options[0]
+	}
+	return strings.Join(options[:len(options)-1], ", ") + " or " + options[len(options)-1]
+}
@@ -0,0 +1,121 @@
+package collab
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumnValidate(t *testing.T) {
+	tests := []struct {
+		column  Column
+		value   string
+		wantErr bool
+	}{
+		{Column{Type: ColumnText}, "N/A", false},
+		{Column{Type: ColumnInteger}, "", false},
+		{Column{Type: ColumnInteger}, "-42", false},
+		{Column{Type: ColumnInteger}, "N/A", true},
+		{Column{Type: ColumnInteger}, "4.2", true},
+		{Column{Type: ColumnInteger}, "99999999999999999999", true},
+		{Column{Type: ColumnDecimal}, "12.5", false},
+		{Column{Type: ColumnDecimal}, "12,5", true},
+		{Column{Type: ColumnDecimal}, "NaN", true},
+		{Column{Type: ColumnDate}, "2025-02-28", false},
+		{Column{Type: ColumnDate}, "2025-02-30", true},
+		{Column{Type: ColumnDate}, "28/02/2025", true},
+		{Column{Type: ColumnBoolean}, "true", false},
+		{Column{Type: ColumnBoolean}, "yes", true},
+		{Column{Type: ColumnSelect, Options: []string{"red", "green"}}, "green", false},
+		{Column{Type: ColumnSelect, Options: []string{"red", "green"}}, "tbd", true},
+		{Column{Type: ColumnEmail}, "amina@example.com", false},
+		{Column{Type: ColumnEmail}, "Amina <amina@example.com>", true},
+		{Column{Type: ColumnEmail}, "amina", true},
+		{Column{Type: ColumnURL}, "https://example.com/form", false},
+		{Column{Type: ColumnURL}, "example.com", true},
+		{Column{Type: ColumnURL}, "javascript:alert(1)", true},
+	}
+
+	for _, tt := range tests {
+		err := tt.column.Validate(tt.value)
+		if tt.wantErr {
+			assert.Error(t, err, "%s column should reject %q", tt.column.Type, tt.value)
+		} else {
+			assert.NoError(t, err, "%s column should accept %q", tt.column.Type, tt.value)
+		}
+	}
+}
+
+func TestColumnCheck(t *testing.T) {
+	assert.NoError(t, Column{Type: ColumnText}.Check())
+	assert.NoError(t, Column{Type: ColumnSelect, Options: []string{"a", "b"}}.Check())
+	assert.Error(t, Column{Type: ColumnSelect}.Check(), "select columns need options")
+	assert.Error(t, Column{Type: ColumnSelect, Options: []string{"a", "a"}}.Check(), "options must be distinct")
+	assert.Error(t, Column{Type: ColumnSelect, Options: []string{""}}.Check(), "options cannot be empty")
+	assert.Error(t, Column{Type: ColumnText, Options: []string{"a"}}.Check(), "only select columns have options")
+}
+
+func TestColumnConstraints(t *testing.T) {
+	one, hundred := 1.0, 100.0
+	tests := []struct {
+		column   Column
+		value    string
+		wantRule string
+	}{
+		{Column{Type: ColumnText, Required: true}, "", RuleRequired},
+		{Column{Type: ColumnText, Required: true}, "x", ""},
+		{Column{Type: ColumnText, Pattern: `EMP-[0-9]{4}`}, "EMP-0042", ""},
+		{Column{Type: ColumnText, Pattern: `EMP-[0-9]{4}`}, "EMP-0042x", RulePattern},
+		{Column{Type: ColumnText, Pattern: `EMP-[0-9]{4}`}, "", ""},
+		{Column{Type: ColumnInteger, Min: &one, Max: &hundred}, "100", ""},
+		{Column{Type: ColumnInteger, Min: &one, Max: &hundred}, "0", RuleMin},
+		{Column{Type: ColumnInteger, Min: &one, Max: &hundred}, "101", RuleMax},
+		{Column{Type: ColumnDecimal, Min: &one}, "0.5", RuleMin},
+		{Column{Type: ColumnDecimal, Max: &hundred}, "100.5", RuleMax},
+		{Column{Type: ColumnInteger, Min: &one}, "abc", RuleType},
+	}
+
+	for _, tt := range tests {
+		err := tt.column.Validate(tt.value)
+		if tt.wantRule == "" {
+			assert.NoError(t, err, "%q should be accepted", tt.value)
+			continue
+		}
+		var cellErr *CellError
+		if assert.ErrorAs(t, err, &cellErr, "%q should be rejected", tt.value) {
+			assert.Equal(t, tt.wantRule, cellErr.Rule, "%q should break the %s rule", tt.value, tt.wantRule)
+		}
+	}
+}
+
+func TestColumnCheckConstraints(t *testing.T) {
+	one, hundred := 1.0, 100.0
+	assert.NoError(t, Column{Type: ColumnInteger, Min: &one, Max: &hundred, Unique: true, Required: true}.Check())
+	assert.Error(t, Column{Type: ColumnInteger, Min: &hundred, Max: &one}.Check(), "min cannot exceed max")
+	assert.Error(t, Column{Type: ColumnText, Min: &one}.Check(), "only number columns have a range")
+	assert.Error(t, Column{Type: ColumnText, Pattern: "("}.Check(), "patterns must compile")
+	assert.Error(t, Column{Type: ColumnDate, Pattern: ".*"}.Check(), "only text-like columns have a pattern")
+}
+
+func TestValidateCell(t *testing.T) {
+	hundred := 100.0
+	columns := []Column{{Title: "Name", Type: ColumnText}, {Title: "Score", Type: ColumnInteger, Max: &hundred}}
+
+	assert.NoError(t, ValidateCell(columns, 1, "12"))
+	assert.EqualError(t, ValidateCell(columns, 1, "N/A"), "Score must be a whole number")
+	assert.Equal(t, &CellError{Col: 1, Rule: RuleMax, Param: "100", Message: "Score must be 100 or less"},
+		ValidateCell(columns, 1, "150"))
+	assert.Error(t, ValidateCell(columns, 2, "x"), "edits to missing columns should be rejected")
+}
+
+func TestCompilePatternCacheIsBounded(t *testing.T) {
+	for i := range maxPatterns + 10 {
+		_, err := compilePattern("E" + strconv.Itoa(i))
+		assert.NoError(t, err)
+	}
+
+	patterns.Lock()
+	defer patterns.Unlock()
+	assert.LessOrEqual(t, len(patterns.compiled), maxPatterns, "should not keep more than maxPatterns patterns")
+}
@@ -0,0 +1,227 @@
+package collab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Alignments of the contents of a cell.
+const (
+	AlignLeft   = "left"
+	AlignCenter = "center"
+	AlignRight  = "right"
+)
+
+// maxNumberFormat is the length of the longest number format a cell can have.
+const maxNumberFormat = 64
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Format is the presentation of a cell or of a column, stored separately from the
+// values of the sheet. The zero Format is the default presentation.
+type Format struct {
+	Bold       bool   `json:"bold,omitempty"`
+	Color      string `json:"color,omitempty"`      // text colour, as #rrggbb
+	Background string `json:"background,omitempty"` // background colour, as #rrggbb
+	// NumberFormat is how numbers and dates are displayed, as an Excel number format
+	// such as "0.00" or "dd/mm/yyyy". Other values are displayed as they are.
+	NumberFormat string `json:"numberFormat,omitempty"`
+	Align        string `json:"align,omitempty"` // one of the Align constants, empty for the default
+}
+
+// IsZero reports whether the format is the default presentation.
+func (f Format) IsZero() bool {
+	return f == Format{}
+}
+
+// Check reports whether the format is well defined.
+func (f Format) Check() error {
+	if f.Color != "" && !colorPattern.MatchString(f.Color) {
+		return errors.New("text colour must be a hex colour such as #1a2b3c")
+	}
+	if f.Background != "" && !colorPattern.MatchString(f.Background) {
+		return errors.New("background colour must be a hex colour such as #1a2b3c")
+	}
+
+	switch f.Align {
+	case "", AlignLeft, AlignCenter, AlignRight:
+	default:
+		return errors.New("alignment must be one of left, center or right")
+	}
+
+	if len(f.NumberFormat) > maxNumberFormat {
+		return fmt.Errorf("number format must be %d characters or less", maxNumberFormat)
+	}
+	if strings.IndexFunc(f.NumberFormat, unicode.IsControl) >= 0 {
+		return errors.New("number format cannot contain control characters")
+	}
+	return nil
+}
+
+// CellPos is the position of a cell in a sheet, with the headers in row 0.
+type CellPos struct {
+	Row int
+	Col int
+}
+
+// Formats are the formats of the columns and of the cells of a sheet.
+type Formats struct {
+	Columns map[int]Format
+	Cells   map[CellPos]Format
+}
+
+// Of returns the format of a cell, with the headers in row 0. The format of a cell, if
+// it has one, replaces the format of its column as a whole. Column formats do not apply
+// to the headers.
+func (f Formats) Of(row, col int) Format {
+	if format, ok := f.Cells[CellPos{Row: row, Col: col}]; ok {
+		return format
+	}
+	if row == 0 {
+		return Format{}
+	}
+	return f.Columns[col]
+}
+
+// IsZero reports whether no column or cell of the sheet has a format.
+func (f Formats) IsZero() bool {
+	return len(f.Columns) == 0 && len(f.Cells) == 0
+}
+
+// formatsKey returns the key of the hash holding the formats of a sheet as JSON. Its
+// fields are "<row>:<col>" for cells, like the fields of the sheet, and "col:<col>" for
+// columns.
+func formatsKey(sheetID string) string {
+	return sheetID + ":formats"
+}
+
+// columnFormatField returns the field of the format of a column in the formats of a sheet.
+func columnFormatField(col int) string {
+	return "col:" + strconv.Itoa(col)
+}
+
+// SetCellFormat sets the format of a cell of a sheet, or clears it if `format` is the
+// zero Format so that the cell gets the format of its column again. The headers cannot
+// be formatted. It returns ErrNoSession if the sheet has no session.
+func (s *Store) SetCellFormat(sheetID string, row, col int, format Format) error {
+	if row == 0 {
+		return errors.New("cannot format column headers")
+	}
+	return s.setFormat(sheetID, fmt.Sprintf("%d:%d", row, col), format)
+}
+
+// SetColumnFormat sets the format of a column of a sheet, or clears it if `format` is
+// the zero Format. It returns ErrNoSession if the sheet has no session.
+func (s *Store) SetColumnFormat(sheetID string, col int, format Format) error {
+	return s.setFormat(sheetID, columnFormatField(col), format)
+}
+
+// setFormat sets the format in the field `field` of the formats of a sheet.
+func (s *Store) setFormat(sheetID, field string, format Format) error {
+	var value []byte
+	if !format.IsZero() {
+		var err error
+		if value, err = json.Marshal(format); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	keys := []string{sheetID, formatsKey(sheetID), columnsLockKey(sheetID)}
+	set, err := setFormat.Run(ctx, s.rdb, keys, field, value).Int()
+	if err != nil {
+		slog.Error("failed to set format", "sheetID", sheetID, "err", err)
+		return fmt.Errorf("could not set format in redis: %w", err)
+	}
+	if set == 0 {
+		return ErrNoSession
+	}
+	return nil
+}
+
+// setFormat sets a field of the formats of a sheet, or deletes it if the format is
+// empty, keeping the formats until the session of the sheet expires, and returns 1. It
+// returns 0 without changing anything if the sheet has no session or its columns are
+// locked.
+//
+// KEYS[1] is the sheet, KEYS[2] its formats and KEYS[3] the lock of its columns. ARGV
+// holds the field and the format.
+var setFormat = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 or redis.call('EXISTS', KEYS[3]) == 1 then
+	return 0
+end
+if ARGV[2] == '' then
+	redis.call('HDEL', KEYS[2], ARGV[1])
+	return 1
+end
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[2], ttl)
+end
+return 1
+`)
+
+// GetFormats retrieves the formats of the columns and cells of a sheet. Formats that
+// cannot be read are skipped.
+func (s *Store) GetFormats(sheetID string) (Formats, error) {
+	fields, err := s.FormatFields(sheetID)
+	if err != nil {
+		return Formats{}, err
+	}
+	return ParseFormats(fields), nil
+}
+
+// FormatFields retrieves the formats of the columns and cells of a sheet as they are
+// stored, i.e. as JSON keyed by field (see formatsKey), so that they can be saved along
+// with the session and restored by InitSession.
+func (s *Store) FormatFields(sheetID string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	fields, err := s.rdb.HGetAll(ctx, formatsKey(sheetID)).Result()
+	if err != nil {
+		slog.Error("unable to get sheet formats", "sheetID", sheetID, "err", err)
+		return nil, err
+	}
+	return fields, nil
+}
+
+// ParseFormats reads formats stored as fields, see FormatFields. Formats that cannot be
+// read are skipped.
+func ParseFormats(fields map[string]string) Formats {
+	formats := Formats{Columns: make(map[int]Format), Cells: make(map[CellPos]Format)}
+	for field, value := range fields {
+		var format Format
+		if err := json.Unmarshal([]byte(value), &format); err != nil {
+			slog.Warn("skipping unreadable format", "field", field, "err", err)
+			continue
+		}
+
+		if col, ok := strings.CutPrefix(field, "col:"); ok {
+			if c, err := strconv.Atoi(col); err == nil {
+				formats.Columns[c] = format
+			}
+			continue
+		}
+		row, col, ok := strings.Cut(field, ":")
+		r, rowErr := strconv.Atoi(row)
+		c, colErr := strconv.Atoi(col)
+		if ok && rowErr == nil && colErr == nil {
+			formats.Cells[CellPos{Row: r, Col: c}] = format
+		}
+	}
+	return formats
+}
@@ -0,0 +1,253 @@
+package collab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/waynekn/tablesync/core/formula"
+)
+
+// ColumnChange is a change to the columns of a sheet, made with AddColumn, EditColumn,
+// DeleteColumn or ReorderColumns.
+type ColumnChange struct {
+	// Columns are the columns of the sheet after the change, titled after its headers.
+	Columns []Column
+	// Moves maps each column of the sheet before the change to its index after it, or to
+	// -1 if the column was deleted.
+	Moves []int
+}
+
+// ColumnChangeError reports a change to the columns of a sheet that cannot be made, e.g.
+// to a column that does not exist. Message describes the problem to the user.
+type ColumnChangeError struct {
+	Message string
+}
+
+func (e *ColumnChangeError) Error() string {
+	return e.Message
+}
+
+// columnNotFound returns the error of a change to the column `col`, which does not exist.
+func columnNotFound(col int) error {
+	return &ColumnChangeError{Message: fmt.Sprintf("Column %d does not exist", col)}
+}
+
+// AddColumn returns the change adding `column` to `columns` at index `at`, which may be
+// the number of columns to add it after the last one. Errors are of type
+// *ColumnChangeError, and so are the errors of the other changes.
+func AddColumn(columns []Column, column Column, at int) (ColumnChange, error) {
+	if at < 0 || at > len(columns) {
+		return ColumnChange{}, &ColumnChangeError{Message: fmt.Sprintf("Position must be between 0 and %d", len(columns))}
+	}
+
+	change := ColumnChange{Columns: make([]Column, 0, len(columns)+1), Moves: make([]int, len(columns))}
+	change.Columns = append(change.Columns, columns[:at]...)
+	change.Columns = append(change.Columns, column)
+	change.Columns = append(change.Columns, columns[at:]...)
+	for i := range columns {
+		change.Moves[i] = i
+		if i >= at {
+			change.Moves[i]++
+		}
+	}
+	return change, nil
+}
+
+// EditColumn returns the change making `edit` to the column at index `col`, e.g. to
+// rename or hide it. The cells of the column are left as they are.
+func EditColumn(columns []Column, col int, edit func(column *Column)) (ColumnChange, error) {
+	if col < 0 || col >= len(columns) {
+		return ColumnChange{}, columnNotFound(col)
+	}
+
+	change := ColumnChange{Columns: append([]Column(nil), columns...), Moves: make([]int, len(columns))}
+	edit(&change.Columns[col])
+	for i := range columns {
+		change.Moves[i] = i
+	}
+	return change, nil
+}
+
+// DeleteColumn returns the change deleting the column at index `col`, along with its
+// cells. The last column of a sheet cannot be deleted.
+func DeleteColumn(columns []Column, col int) (ColumnChange, error) {
+	if col < 0 || col >= len(columns) {
+		return ColumnChange{}, columnNotFound(col)
+	}
+	if len(columns) == 1 {
+		return ColumnChange{}, &ColumnChangeError{Message: "The only column of a sheet cannot be deleted"}
+	}
+
+	change := ColumnChange{Columns: make([]Column, 0, len(columns)-1), Moves: make([]int, len(columns))}
+	change.Columns = append(change.Columns, columns[:col]...)
+	change.Columns = append(change.Columns, columns[col+1:]...)
+	for i := range columns {
+		switch {
+		case i < col:
+			change.Moves[i] = i
+		case i == col:
+			change.Moves[i] = -1
+		default:
+			change.Moves[i] = i - 1
+		}
+	}
+	return change, nil
+}
+
+// ReorderColumns returns the change putting the columns in the given order, which lists
+// the index of every column exactly once.
+func ReorderColumns(columns []Column, order []int) (ColumnChange, error) {
+	invalid := &ColumnChangeError{Message: fmt.Sprintf("The order must list each of the %d columns once", len(columns))}
+	if len(order) != len(columns) {
+		return ColumnChange{}, invalid
+	}
+
+	change := ColumnChange{Columns: make([]Column, len(columns)), Moves: make([]int, len(columns))}
+	for i := range change.Moves {
+		change.Moves[i] = -1
+	}
+	for i, col := range order {
+		if col < 0 || col >= len(columns) || change.Moves[col] >= 0 {
+			return ColumnChange{}, invalid
+		}
+		change.Moves[col] = i
+		change.Columns[i] = columns[col]
+	}
+	return change, nil
+}
+
+// column returns the index of a column after the change, or -1 if it was deleted.
+// Columns beyond the ones the change was made to keep their index.
+func (c ColumnChange) column(col int) int {
+	if col >= len(c.Moves) {
+		return col
+	}
+	return c.Moves[col]
+}
+
+// Headers returns the headers of the sheet after the change.
+func (c ColumnChange) Headers() []string {
+	headers := make([]string, len(c.Columns))
+	for i, column := range c.Columns {
+		headers[i] = column.Title
+	}
+	return headers
+}
+
+// Value returns the contents of a cell after the change, i.e. its formula rewritten to
+// reference the moved columns if it holds one (see formula.MoveColumns).
+func (c ColumnChange) Value(raw string) string {
+	return formula.MoveColumns(raw, c.Moves)
+}
+
+// MoveRow returns a row of the sheet, without its headers, after the change.
+func (c ColumnChange) MoveRow(row []string) []string {
+	moved := make([]string, len(c.Columns))
+	for i, value := range row {
+		if i < len(c.Moves) && c.Moves[i] >= 0 {
+			moved[c.Moves[i]] = c.Value(value)
+		}
+	}
+	return moved
+}
+
+// MoveFormats returns the formats of a sheet, stored as fields (see
+// Store.FormatFields), moved along with their columns. The formats of deleted columns
+// and their cells are dropped.
+func (c ColumnChange) MoveFormats(fields map[string]string) map[string]string {
+	moved := make(map[string]string, len(fields))
+	for field, format := range fields {
+		// cell fields are "<row>:<col>" and column fields "col:<col>"
+		prefix, col, ok := strings.Cut(field, ":")
+		n, err := strconv.Atoi(col)
+		if !ok || err != nil {
+			continue
+		}
+		if n = c.column(n); n >= 0 {
+			moved[prefix+":"+strconv.Itoa(n)] = format
+		}
+	}
+	return moved
+}
+
+// ChangeColumns applies a change to the columns of a sheet to its collaborative editing
+// session: the cells and their formats are moved to their new columns, formulas are
+// rewritten and the headers are replaced. It does nothing if the sheet has no session.
+//
+// The session is rewritten in a single transaction, which is retried if an edit is made
+// in the meantime. The index of unique columns is dropped, and rebuilt the next time
+// each unique column is edited.
+func (s *Store) ChangeColumns(sheetID string, change ColumnChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rewrite := func(tx *redis.Tx) error {
+		cells, err := tx.HGetAll(ctx, sheetID).Result()
+		if err != nil {
+			return err
+		}
+		if len(cells) == 0 {
+			return nil
+		}
+		formats, err := tx.HGetAll(ctx, formatsKey(sheetID)).Result()
+		if err != nil {
+			return err
+		}
+		ttl, err := tx.PTTL(ctx, sheetID).Result()
+		if err != nil {
+			return err
+		}
+
+		moved := make(map[string]string, len(cells))
+		for key, value := range cells {
+			row, col, ok := strings.Cut(key, ":")
+			c, err := strconv.Atoi(col)
+			if !ok || err != nil || row == "0" {
+				continue
+			}
+			if c = change.column(c); c >= 0 {
+				moved[row+":"+strconv.Itoa(c)] = change.Value(value)
+			}
+		}
+		for col, header := range change.Headers() {
+			moved["0:"+strconv.Itoa(col)] = header
+		}
+
+		movedFormats := change.MoveFormats(formats)
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, sheetID, uniqueIndexKey(sheetID), formatsKey(sheetID))
+			pipe.HSet(ctx, sheetID, moved)
+			if len(movedFormats) > 0 {
+				pipe.HSet(ctx, formatsKey(sheetID), movedFormats)
+			}
+			if ttl > 0 {
+				pipe.PExpire(ctx, sheetID, ttl)
+				pipe.PExpire(ctx, formatsKey(sheetID), ttl)
+			}
+			return nil
+		})
+		return err
+	}
+
+	for range 3 {
+		err := s.rdb.Watch(ctx, rewrite, sheetID, formatsKey(sheetID))
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			slog.Error("failed to change columns of sheet", "sheetID", sheetID, "err", err)
+			return fmt.Errorf("could not change columns of sheet in redis: %w", err)
+		}
+		return nil
+	}
+
+	slog.Error("failed to change columns of sheet: too many concurrent edits", "sheetID", sheetID)
+	return errors.New("could not change columns of sheet in redis: too many concurrent edits")
+}
@@ -0,0 +1,58 @@
+package collab
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumnChanges(t *testing.T) {
+	columns := TextColumns([]string{"a", "b", "c"})
+
+	t.Run("add", func(t *testing.T) {
+		change, err := AddColumn(columns, Column{Title: "x", Type: ColumnInteger}, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "x", "b", "c"}, change.Headers())
+		assert.Equal(t, []int{0, 2, 3}, change.Moves)
+		assert.Equal(t, []string{"1", "", "2", "=A1+C1"}, change.MoveRow([]string{"1", "2", "=A1+B1"}))
+
+		_, err = AddColumn(columns, Column{Title: "x", Type: ColumnText}, 4)
+		assert.IsType(t, &ColumnChangeError{}, err)
+	})
+
+	t.Run("edit", func(t *testing.T) {
+		change, err := EditColumn(columns, 2, func(column *Column) { column.Title = "z" })
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "z"}, change.Headers())
+		assert.Equal(t, []int{0, 1, 2}, change.Moves)
+		assert.Equal(t, "c", columns[2].Title, "the columns should not be modified")
+
+		_, err = EditColumn(columns, 3, func(*Column) {})
+		assert.IsType(t, &ColumnChangeError{}, err)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		change, err := DeleteColumn(columns, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"b", "c"}, change.Headers())
+		assert.Equal(t, []string{"2", "=#REF!+A1"}, change.MoveRow([]string{"1", "2", "=A1+B1"}))
+		formats := map[string]string{"col:0": `{"bold":true}`, "1:0": `{"bold":true}`, "1:2": `{"color":"#ff0000"}`}
+		assert.Equal(t, map[string]string{"1:1": `{"color":"#ff0000"}`}, change.MoveFormats(formats),
+			"formats should follow their column and be dropped with it")
+
+		_, err = DeleteColumn(columns[:1], 0)
+		assert.IsType(t, &ColumnChangeError{}, err, "the only column should not be deletable")
+	})
+
+	t.Run("reorder", func(t *testing.T) {
+		change, err := ReorderColumns(columns, []int{2, 0, 1})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"c", "a", "b"}, change.Headers())
+		assert.Equal(t, []int{1, 2, 0}, change.Moves)
+
+		for _, order := range [][]int{{0, 1}, {0, 0, 1}, {0, 1, 3}} {
+			_, err = ReorderColumns(columns, order)
+			assert.IsType(t, &ColumnChangeError{}, err, "order %v should be rejected", order)
+		}
+	})
+}
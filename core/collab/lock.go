@@ -0,0 +1,122 @@
+package collab
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrColumnsLocked is returned while the columns of a sheet are being changed, see
+// Store.LockColumns.
+var ErrColumnsLocked = errors.New("the columns of the sheet are being changed")
+
+const (
+	// columnsLockTTL is how long the columns of a sheet stay locked if the lock is not
+	// released, e.g. because the server stopped while changing them.
+	columnsLockTTL = 30 * time.Second
+	// columnsVersionTTL is how long the version of the columns of a sheet is kept after
+	// they were last locked. It only has to outlast the loading of a session.
+	columnsVersionTTL = 24 * time.Hour
+)
+
+// LockColumns locks the columns of a sheet while they are being changed, and returns the
+// function releasing the lock. Meanwhile, the session of the sheet is treated as if it
+// did not exist by edits, which return ErrNoSession, and it cannot be initialized (see
+// InitSession). It returns ErrColumnsLocked if the columns are already locked.
+//
+// Each lock increments the version of the columns, see ColumnsVersion.
+func (s *Store) LockColumns(sheetID string) (func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	token := uuid.NewString()
+	keys := []string{columnsLockKey(sheetID), columnsVersionKey(sheetID)}
+	locked, err := lockColumns.Run(ctx, s.rdb, keys, token,
+		columnsLockTTL.Milliseconds(), columnsVersionTTL.Milliseconds()).Int()
+	if err != nil {
+		slog.Error("failed to lock sheet columns", "sheetID", sheetID, "err", err)
+		return nil, err
+	}
+	if locked == 0 {
+		return nil, ErrColumnsLocked
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		if err := unlockColumns.Run(ctx, s.rdb, keys[:1], token).Err(); err != nil {
+			slog.Error("failed to unlock sheet columns", "sheetID", sheetID, "err", err)
+		}
+	}, nil
+}
+
+// ColumnsVersion returns the version of the columns of a sheet, which changes every time
+// they are locked. Comparing the versions from before and after reading the columns of
+// a sheet from the database tells whether they were changed meanwhile. It returns
+// ErrColumnsLocked while the columns are locked.
+func (s *Store) ColumnsVersion(sheetID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	values, err := s.rdb.MGet(ctx, columnsLockKey(sheetID), columnsVersionKey(sheetID)).Result()
+	if err != nil {
+		slog.Error("failed to get sheet columns version", "sheetID", sheetID, "err", err)
+		return 0, err
+	}
+	return columnsVersion(values[0], values[1])
+}
+
+// columnsVersion returns the version of the columns from the values of their lock and
+// version keys.
+func columnsVersion(lock, version any) (int64, error) {
+	if lock != nil {
+		return 0, ErrColumnsLocked
+	}
+	if version == nil {
+		return 0, nil
+	}
+	return strconv.ParseInt(version.(string), 10, 64)
+}
+
+// columnsLockKey returns the key locking the columns of a sheet, see Store.LockColumns.
+func columnsLockKey(sheetID string) string {
+	return sheetID + ":columnslock"
+}
+
+// columnsVersionKey returns the key holding the version of the columns of a sheet, see
+// Store.ColumnsVersion. It is not part of the session, so that the version does not go
+// back when the session is removed.
+func columnsVersionKey(sheetID string) string {
+	return sheetID + ":columnsversion"
+}
+
+// lockColumns sets the lock of the columns of a sheet unless it is already set, and
+// increments their version. It returns 1 if the columns were locked, and 0 otherwise.
+//
+// KEYS[1] is the lock, KEYS[2] the version. ARGV holds the token of the lock and the
+// expiry of the lock and of the version, in milliseconds.
+var lockColumns = redis.NewScript(`
+if not redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 0
+end
+redis.call('INCR', KEYS[2])
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+return 1
+`)
+
+// unlockColumns releases the lock of the columns of a sheet if it still holds the token,
+// i.e. unless it expired and was taken by another change.
+//
+// KEYS[1] is the lock. ARGV holds the token of the lock.
+var unlockColumns = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+end
+return 0
+`)
@@ -0,0 +1,434 @@
+package collab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RowOwnership is the row ownership mode of a sheet. In this mode each row belongs to
+// the user who first edited it, and contributors can only edit their own rows.
+type RowOwnership struct {
+	Enabled bool
+	MaxRows int // rows each contributor can create, 0 for no limit
+}
+
+// RowClaim is an edit to a row of a sheet in row ownership mode, see Store.ClaimRow.
+type RowClaim struct {
+	Row     int
+	UserID  string // empty for anonymous users
+	ColNum  int    // number of columns of the sheet
+	MaxRows int    // see RowOwnership
+
+	// Restricted is whether the user can only edit their own rows. The rows created
+	// by users who are not restricted are recorded all the same.
+	Restricted bool
+}
+
+// ClaimRow checks that a user may edit a row of a sheet in row ownership mode, and
+// records the user as the owner of the row if it has none.
+//
+// Restricted users can only edit the rows they own and claim blank rows that have no
+// owner, up to `MaxRows` rows. Rows that have no owner but are not blank, such as the
+// rows the sheet was created with, cannot be claimed by restricted users. Edits that
+// are not allowed are reported as a *CellError. It returns ErrNoSession if the sheet has
+// no session.
+func (s *Store) ClaimRow(sheetID string, claim RowClaim) error {
+	_, err := s.claim(sheetID, claim)
+	return err
+}
+
+// ApplyRowEdit applies an edit to a sheet in row ownership mode. The row of the edit is
+// claimed for the user like ClaimRow, ignoring the Row of the claim, and the edit is
+// applied like ApplyCellEdit. Values are validated before the row is claimed, and if the
+// edit is still rejected, e.g. because a unique column already has the value, the claim
+// made for it is given up, so that rejected edits do not count towards the rows of the
+// user.
+func (s *Store) ApplyRowEdit(sheetID string, columns []Column, claim RowClaim, edit EditMsg) error {
+	if columns != nil {
+		if err := ValidateCell(columns, edit.Col, edit.Data); err != nil {
+			return err
+		}
+	}
+
+	claim.Row = edit.Row
+	claimed, err := s.claim(sheetID, claim)
+	if err != nil {
+		return err
+	}
+
+	err = s.ApplyCellEdit(sheetID, columns, edit)
+	var cellErr *CellError
+	if claimed && errors.As(err, &cellErr) {
+		s.releaseClaim(sheetID, edit.Row, claim.UserID)
+	}
+	return err
+}
+
+// claim claims a row like ClaimRow, and reports whether the user became its owner.
+func (s *Store) claim(sheetID string, claim RowClaim) (bool, error) {
+	if claim.Row == 0 {
+		return false, errors.New("cannot edit column headers")
+	}
+	if claim.Restricted && claim.UserID == "" {
+		return false, &CellError{Rule: RuleRowOwner, Message: "Sign in to edit the rows of this sheet"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	restricted := 0
+	if claim.Restricted {
+		restricted = 1
+	}
+	res, err := claimRow.Run(ctx, s.rdb, []string{sheetID, rowOwnersKey(sheetID), rowCountsKey(sheetID), columnsLockKey(sheetID)},
+		claim.Row, claim.UserID, restricted, claim.MaxRows, claim.ColNum).Int()
+	if err != nil {
+		slog.Error("failed to claim row", "err", err)
+		return false, err
+	}
+
+	switch res {
+	case claimNoSession:
+		return false, ErrNoSession
+	case claimOwned:
+		return false, &CellError{Rule: RuleRowOwner, Message: "You can only edit the rows you created"}
+	case claimLimit:
+		return false, rowLimitError(claim.MaxRows)
+	}
+	return res == claimClaimed, nil
+}
+
+// releaseClaim gives up the claim of a user on a row, made for an edit that was rejected.
+// Failures are only logged, as they merely leave the row to the user.
+func (s *Store) releaseClaim(sheetID string, row int, userID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	keys := []string{rowOwnersKey(sheetID), rowCountsKey(sheetID)}
+	if err := unclaimRow.Run(ctx, s.rdb, keys, row, userID).Err(); err != nil {
+		slog.Error("failed to give up row claim", "sheetID", sheetID, "row", row, "err", err)
+	}
+}
+
+// RowOwner returns the user who owns a row of a sheet in row ownership mode, or an
+// empty string if the row has no owner.
+func (s *Store) RowOwner(sheetID string, row int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	owner, err := s.rdb.HGet(ctx, rowOwnersKey(sheetID), strconv.Itoa(row)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		slog.Error("failed to get row owner", "err", err)
+		return "", err
+	}
+	return owner, nil
+}
+
+// RowOwners returns the owner of each row of a sheet in row ownership mode, by row.
+// Rows without an owner are left out.
+func (s *Store) RowOwners(sheetID string) (map[int]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	fields, err := s.rdb.HGetAll(ctx, rowOwnersKey(sheetID)).Result()
+	if err != nil {
+		slog.Error("failed to get row owners", "err", err)
+		return nil, err
+	}
+
+	owners := make(map[int]string, len(fields))
+	for field, user := range fields {
+		row, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid row owner field %q: %w", field, err)
+		}
+		owners[row] = user
+	}
+	return owners, nil
+}
+
+// rowLimitError returns the *CellError of a user who cannot create more than `maxRows`
+// rows.
+func rowLimitError(maxRows int) *CellError {
+	rows := "rows"
+	if maxRows == 1 {
+		rows = "row"
+	}
+	return &CellError{
+		Rule:    RuleRowLimit,
+		Param:   strconv.Itoa(maxRows),
+		Message: fmt.Sprintf("You cannot create more than %d %s", maxRows, rows),
+	}
+}
+
+// AppendRow stores `cells` as a new row after the last row of the sheet and returns the
+// index of the row, counted as in the store, i.e. with the headers as row 0. There must
+// be one cell per column.
+//
+// The values are validated like ApplyCellEdit, and the first value that is rejected is
+// reported as a *CellError, in which case the row is not stored. With a non-nil claim,
+// the row is claimed for the user like ClaimRow, ignoring its Row.
+//
+// Rows are appended at the first blank row without an owner after the last row, which
+// is reserved in a single script so that concurrent appends never share a row. It
+// returns ErrNoSession if the sheet has no session.
+func (s *Store) AppendRow(sheetID string, columns []Column, cells []string, claim *RowClaim) (int, error) {
+	if len(cells) != len(columns) {
+		return 0, fmt.Errorf("row has %d cells, expected %d", len(cells), len(columns))
+	}
+	for col, value := range cells {
+		if err := ValidateCell(columns, col, value); err != nil {
+			return 0, err
+		}
+	}
+
+	userID, restricted, maxRows := "", 0, 0
+	if claim != nil {
+		userID, maxRows = claim.UserID, claim.MaxRows
+		if claim.Restricted {
+			if userID == "" {
+				return 0, &CellError{Rule: RuleRowOwner, Message: "Sign in to edit the rows of this sheet"}
+			}
+			restricted = 1
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	keys := []string{sheetID, nextRowKey(sheetID), rowOwnersKey(sheetID), rowCountsKey(sheetID), columnsLockKey(sheetID)}
+	row, err := reserveRow.Run(ctx, s.rdb, keys, len(columns), userID, restricted, maxRows).Int()
+	if err != nil {
+		slog.Error("failed to reserve row", "err", err)
+		return 0, err
+	}
+	switch row {
+	case reserveLimit:
+		return 0, rowLimitError(maxRows)
+	case reserveNoSession:
+		return 0, ErrNoSession
+	}
+
+	for col, value := range cells {
+		if value == "" {
+			continue
+		}
+		err := s.setCell(sheetID, columns[col], EditMsg{Row: row, Col: col, Data: value})
+		if err != nil {
+			s.releaseRow(sheetID, columns, cells[:col], row, userID)
+			return 0, err
+		}
+	}
+	return row, nil
+}
+
+// releaseRow clears the cells of a row that could not be appended and gives up the
+// reservation of the row, so that it can be reused by the next append. Failures are
+// only logged, as they merely leave a blank row behind.
+func (s *Store) releaseRow(sheetID string, columns []Column, cells []string, row int, userID string) {
+	for col, value := range cells {
+		if value == "" {
+			continue
+		}
+		if err := s.setCell(sheetID, columns[col], EditMsg{Row: row, Col: col}); err != nil {
+			slog.Error("failed to clear cell of released row", "sheetID", sheetID, "row", row, "err", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	keys := []string{nextRowKey(sheetID), rowOwnersKey(sheetID), rowCountsKey(sheetID)}
+	if err := unreserveRow.Run(ctx, s.rdb, keys, row, userID).Err(); err != nil {
+		slog.Error("failed to release row", "sheetID", sheetID, "row", row, "err", err)
+	}
+}
+
+// rowOwnersKey returns the key of the hash holding the owner of each row of a sheet.
+func rowOwnersKey(sheetID string) string {
+	return sheetID + ":owners"
+}
+
+// rowCountsKey returns the key of the hash holding the number of rows each user owns
+// in a sheet.
+func rowCountsKey(sheetID string) string {
+	return sheetID + ":rowcounts"
+}
+
+// nextRowKey returns the key holding the index of the row after the last row appended to
+// a sheet, see Store.AppendRow.
+func nextRowKey(sheetID string) string {
+	return sheetID + ":nextrow"
+}
+
+// Results of the claimRow script.
+const (
+	claimAllowed = iota
+	claimOwned
+	claimLimit
+	claimNoSession
+	claimClaimed // allowed, and the user became the owner of the row
+)
+
+// claimRow checks that a user may edit a row and records them as its owner if it has
+// none, see Store.ClaimRow. It returns one of the claim results.
+//
+// KEYS[1] is the sheet, KEYS[2] its row owners, KEYS[3] its row counts and KEYS[4] the
+// lock of its columns. ARGV holds the row, the user, whether the user is restricted, the
+// maximum number of rows and the number of columns.
+var claimRow = redis.NewScript(`
+local row, user, restricted = ARGV[1], ARGV[2], ARGV[3] == '1'
+if redis.call('EXISTS', KEYS[1]) == 0 or redis.call('EXISTS', KEYS[4]) == 1 then
+	return 3
+end
+
+local owner = redis.call('HGET', KEYS[2], row)
+if owner then
+	if owner == user or not restricted then
+		return 0
+	end
+	return 1
+end
+
+if restricted then
+	for col = 0, tonumber(ARGV[5]) - 1 do
+		local val = redis.call('HGET', KEYS[1], row .. ':' .. col)
+		if val and val ~= '' then
+			return 1
+		end
+	end
+	local max = tonumber(ARGV[4])
+	if max > 0 and tonumber(redis.call('HGET', KEYS[3], user) or '0') >= max then
+		return 2
+	end
+end
+
+if user == '' then
+	return 0
+end
+redis.call('HSET', KEYS[2], row, user)
+redis.call('HINCRBY', KEYS[3], user, 1)
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[2], ttl)
+	redis.call('PEXPIRE', KEYS[3], ttl)
+end
+return 4
+`)
+
+// unclaimRow gives up the claim of a user on a row, see Store.releaseClaim. Rows
+// that the user does not own are left alone.
+//
+// KEYS[1] is the row owners and KEYS[2] the row counts. ARGV holds the row and the user.
+var unclaimRow = redis.NewScript(`
+local row, user = ARGV[1], ARGV[2]
+if redis.call('HGET', KEYS[1], row) == user then
+	redis.call('HDEL', KEYS[1], row)
+	redis.call('HINCRBY', KEYS[2], user, -1)
+end
+return 0
+`)
+
+// Results of the reserveRow script other than the index of the row.
+const (
+	reserveLimit     = -1
+	reserveNoSession = -2
+)
+
+// reserveRow reserves the row a new row is appended at and returns its index, or one of
+// the reserve results if the user cannot create more rows or the sheet has no session.
+// The row is the first blank row without an owner after the last row appended, or after
+// the last row of the sheet the first time. It is claimed for the user unless the user
+// is empty.
+//
+// KEYS[1] is the sheet, KEYS[2] the next row, KEYS[3] the row owners, KEYS[4] the row
+// counts and KEYS[5] the lock of its columns. ARGV holds the number of columns, the user,
+// whether the user is restricted and the maximum number of rows.
+var reserveRow = redis.NewScript(`
+local colNum, user, restricted = tonumber(ARGV[1]), ARGV[2], ARGV[3] == '1'
+if redis.call('EXISTS', KEYS[1]) == 0 or redis.call('EXISTS', KEYS[5]) == 1 then
+	return -2
+end
+
+if restricted then
+	local max = tonumber(ARGV[4])
+	if max > 0 and tonumber(redis.call('HGET', KEYS[4], user) or '0') >= max then
+		return -1
+	end
+end
+
+local row = tonumber(redis.call('GET', KEYS[2]) or '0')
+if row == 0 then
+	row = 1
+	local cursor = '0'
+	repeat
+		local res = redis.call('HSCAN', KEYS[1], cursor, 'COUNT', 1000)
+		cursor = res[1]
+		local cells = res[2]
+		for i = 1, #cells, 2 do
+			local r = tonumber(string.match(cells[i], '^(%d+):'))
+			if r and r >= row then
+				row = r + 1
+			end
+		end
+	until cursor == '0'
+end
+
+local function taken(r)
+	if redis.call('HEXISTS', KEYS[3], r) == 1 then
+		return true
+	end
+	for col = 0, colNum - 1 do
+		local val = redis.call('HGET', KEYS[1], r .. ':' .. col)
+		if val and val ~= '' then
+			return true
+		end
+	end
+	return false
+end
+while taken(row) do
+	row = row + 1
+end
+
+redis.call('SET', KEYS[2], row + 1)
+local ttl = redis.call('PTTL', KEYS[1])
+if user ~= '' then
+	redis.call('HSET', KEYS[3], row, user)
+	redis.call('HINCRBY', KEYS[4], user, 1)
+	if ttl > 0 then
+		redis.call('PEXPIRE', KEYS[3], ttl)
+		redis.call('PEXPIRE', KEYS[4], ttl)
+	end
+end
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[2], ttl)
+end
+return row
+`)
+
+// unreserveRow gives up a row reserved by reserveRow. The next row only moves back if
+// no other row has been reserved since.
+//
+// KEYS[1] is the next row, KEYS[2] the row owners and KEYS[3] the row counts. ARGV
+// holds the row and the user it was claimed for.
+var unreserveRow = redis.NewScript(`
+local row, user = ARGV[1], ARGV[2]
+
+if user ~= '' and redis.call('HGET', KEYS[2], row) == user then
+	redis.call('HDEL', KEYS[2], row)
+	redis.call('HINCRBY', KEYS[3], user, -1)
+end
+if tonumber(redis.call('GET', KEYS[1]) or '0') == tonumber(row) + 1 then
+	redis.call('DECR', KEYS[1])
+end
+return 0
+`)
@@ -5,11 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// ErrNoSession is returned by edits to a sheet that has no collaborative editing session,
+// e.g. because the sheet was deleted while the edit was being made. Such edits are not
+// applied, as they would recreate the session without an expiry. Sessions are also
+// suspended while the columns of their sheet are being changed, see Store.LockColumns.
+var ErrNoSession = errors.New("sheet has no editing session")
+
 // Store is a struct that holds a Redis client for managing collaborative editing sessions.
 type Store struct {
 	rdb *redis.Client
@@ -26,17 +33,15 @@ func (s *Store) SheetExists(sheetID string) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	result, err := s.rdb.HGetAll(ctx, sheetID).Result()
+	// redis deletes hashes once they are empty, so checking the key is enough
+	// and avoids loading the whole sheet
+	result, err := s.rdb.Exists(ctx, sheetID).Result()
 	if err != nil {
 		slog.Error("failed to check if sheet HSET exists in redis", "err", err)
 		return false, fmt.Errorf("could not get sheet from redis: %w", err)
 	}
 
-	if len(result) == 0 {
-		return false, nil
-	}
-
-	return true, nil
+	return result == 1, nil
 }
 
 // InitRedisSheet initializes a collaborative editing session in Redis for the given sheet ID.
@@ -44,16 +49,73 @@ func (s *Store) SheetExists(sheetID string) (bool, error) {
 // The expiration time is set to 5 minutes after the deadline to allow time for processing and
 // storage of the data in the database.
 func (s *Store) InitRedisSheet(sheetID string, sheetDeadline time.Time, sheetData *[][]string) error {
-	ttl := time.Until(sheetDeadline.Add(5 * time.Minute))
+	version, err := s.ColumnsVersion(sheetID)
+	if err != nil {
+		return err
+	}
+	return s.InitSession(sheetID, sheetDeadline, Session{Data: *sheetData, ColumnsVersion: version})
+}
 
+// Session is the state of a collaborative editing session that is saved to the database,
+// so that the session can be initialized again once it has been removed.
+type Session struct {
+	Data      [][]string        // cells of the sheet, headers included
+	RowOwners map[int]string    // owners of the rows of the sheet, see Store.ClaimRow
+	Formats   map[string]string // formats of the sheet, see Store.FormatFields
+	// ColumnsVersion is the version of the columns (see Store.ColumnsVersion) read before
+	// the session was read from the database.
+	ColumnsVersion int64
+}
+
+// InitSession initializes a collaborative editing session in Redis for the given sheet
+// ID from a saved session, like InitRedisSheet. The number of rows each user owns is
+// counted from the owners of the rows.
+//
+// It returns ErrColumnsLocked if the columns of the sheet are locked, or have been
+// changed since the session was read, i.e. their version is not the one of the session.
+func (s *Store) InitSession(sheetID string, sheetDeadline time.Time, session Session) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	pipe := s.rdb.TxPipeline()
+	lockKey, versionKey := columnsLockKey(sheetID), columnsVersionKey(sheetID)
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		values, err := tx.MGet(ctx, lockKey, versionKey).Result()
+		if err != nil {
+			return err
+		}
+		version, err := columnsVersion(values[0], values[1])
+		if err != nil {
+			return err
+		}
+		if version != session.ColumnsVersion {
+			return ErrColumnsLocked
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			initSession(ctx, pipe, sheetID, sheetDeadline, session)
+			return nil
+		})
+		return err
+	}, lockKey, versionKey)
+	// the watched keys only change when the columns are locked
+	if err == redis.TxFailedErr || errors.Is(err, ErrColumnsLocked) {
+		return ErrColumnsLocked
+	}
+	if err != nil {
+		slog.Error("failed to initialize sheet in redis", "err", err)
+		return fmt.Errorf("could not initialize sheet in redis: %w", err)
+	}
+
+	return nil
+}
+
+// initSession queues the commands writing a session to `pipe`, see Store.InitSession.
+func initSession(ctx context.Context, pipe redis.Pipeliner, sheetID string, sheetDeadline time.Time, session Session) {
+	ttl := sessionTTL(sheetDeadline)
 
 	// flatten HSETs into one big call per hash
 	cells := make(map[string]string)
-	for i, row := range *sheetData {
+	for i, row := range session.Data {
 		for j, cell := range row {
 			key := fmt.Sprintf("%d:%d", i, j)
 			cells[key] = cell
@@ -63,19 +125,79 @@ func (s *Store) InitRedisSheet(sheetID string, sheetDeadline time.Time, sheetDat
 	pipe.HSet(ctx, sheetID, cells)
 	pipe.Expire(ctx, sheetID, ttl)
 
+	if len(session.RowOwners) > 0 {
+		owners := make(map[string]string, len(session.RowOwners))
+		counts := make(map[string]int)
+		for row, user := range session.RowOwners {
+			owners[strconv.Itoa(row)] = user
+			counts[user]++
+		}
+		pipe.HSet(ctx, rowOwnersKey(sheetID), owners)
+		for user, count := range counts {
+			pipe.HSet(ctx, rowCountsKey(sheetID), user, count)
+		}
+		pipe.Expire(ctx, rowOwnersKey(sheetID), ttl)
+		pipe.Expire(ctx, rowCountsKey(sheetID), ttl)
+	}
+
+	if len(session.Formats) > 0 {
+		pipe.HSet(ctx, formatsKey(sheetID), session.Formats)
+		pipe.Expire(ctx, formatsKey(sheetID), ttl)
+	}
+}
+
+// SetDeadline updates the expiration time of the collaborative editing session of the
+// sheet after its deadline changes. It does nothing if the sheet has no session.
+func (s *Store) SetDeadline(sheetID string, sheetDeadline time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	ttl := sessionTTL(sheetDeadline)
+	pipe := s.rdb.Pipeline()
+	for _, key := range sessionKeys(sheetID) {
+		pipe.Expire(ctx, key, ttl)
+	}
 	_, err := pipe.Exec(ctx)
 	if err != nil {
-		slog.Error("failed to initialize sheet in redis", "err", err)
-		return fmt.Errorf("could not initialize sheet in redis: %w", err)
+		slog.Error("failed to update sheet expiry", "err", err)
+		return fmt.Errorf("could not update sheet expiry in redis: %w", err)
 	}
 
 	return nil
 }
 
+// DeleteSheet removes the collaborative editing session of the sheet, if there is one,
+// along with the index of its unique columns, the owners of its rows and its formats.
+func (s *Store) DeleteSheet(sheetID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := s.rdb.Del(ctx, sessionKeys(sheetID)...).Err()
+	if err != nil {
+		slog.Error("failed to delete sheet", "err", err)
+		return fmt.Errorf("could not delete sheet from redis: %w", err)
+	}
+
+	return nil
+}
+
+// sessionKeys returns the keys holding the collaborative editing session of a sheet.
+func sessionKeys(sheetID string) []string {
+	return []string{sheetID, uniqueIndexKey(sheetID), rowOwnersKey(sheetID), rowCountsKey(sheetID), nextRowKey(sheetID),
+		formatsKey(sheetID)}
+}
+
+// sessionTTL returns how long the session of a sheet with the given deadline should be
+// kept in Redis. Sessions are kept for 5 minutes after the deadline to allow time for
+// processing and storage of the data in the database.
+func sessionTTL(sheetDeadline time.Time) time.Duration {
+	return time.Until(sheetDeadline.Add(5 * time.Minute))
+}
+
 // ApplyEdit applies an edit to a specific cell in the collaborative editing session identified by sheetID.
 // It updates the cell at the specified row and column with the provided data.
 // If the row is 0, it returns an error since the first row contains column headers
-// and should not be edited.
+// and should not be edited. It returns ErrNoSession if the sheet has no session.
 func (s *Store) ApplyEdit(sheetID string, edit EditMsg) error {
 	if edit.Row == 0 {
 		// the first row contains column headers, so don't allow edits to it
@@ -87,15 +209,138 @@ func (s *Store) ApplyEdit(sheetID string, edit EditMsg) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	err := s.rdb.HSet(ctx, sheetID, key, edit.Data).Err()
+	applied, err := applyEdit.Run(ctx, s.rdb, []string{sheetID, columnsLockKey(sheetID)}, key, edit.Data).Int()
 	if err != nil {
 		slog.Error("failed to apply edit", "err", err)
 		return err
 	}
+	if applied == 0 {
+		return ErrNoSession
+	}
 
 	return nil
 }
 
+// applyEdit sets a cell of a sheet and returns 1, or returns 0 if the sheet has no session
+// or its columns are locked.
+//
+// KEYS[1] is the sheet, KEYS[2] the lock of its columns. ARGV holds the cell and its value.
+var applyEdit = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 or redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+// ApplyCellEdit applies an edit like ApplyEdit, after checking that the value is
+// accepted by its column (see ValidateCell). Values rejected by the column are reported
+// as a *CellError and are not applied. With nil columns, any value is accepted.
+//
+// Values of unique columns are checked against every other row and applied in a single
+// script, so that two concurrent edits can never both store the same value.
+func (s *Store) ApplyCellEdit(sheetID string, columns []Column, edit EditMsg) error {
+	if columns == nil {
+		return s.ApplyEdit(sheetID, edit)
+	}
+	if err := ValidateCell(columns, edit.Col, edit.Data); err != nil {
+		return err
+	}
+	return s.setCell(sheetID, columns[edit.Col], edit)
+}
+
+// setCell applies an edit to a cell of `column` without validating its value, keeping
+// the index of unique columns up to date. It reports the value of a unique column that is
+// already in another row as a *CellError.
+func (s *Store) setCell(sheetID string, column Column, edit EditMsg) error {
+	if !column.Unique {
+		return s.ApplyEdit(sheetID, edit)
+	}
+	if edit.Row == 0 {
+		return errors.New("cannot edit column headers")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dup, err := applyUniqueEdit.Run(ctx, s.rdb, []string{sheetID, uniqueIndexKey(sheetID), columnsLockKey(sheetID)},
+		edit.Row, edit.Col, edit.Data).Int()
+	if err != nil {
+		slog.Error("failed to apply edit to unique column", "err", err)
+		return err
+	}
+	if dup < 0 {
+		return ErrNoSession
+	}
+	if dup > 0 {
+		err := column.duplicateError(edit.Data, dup).(*CellError)
+		err.Col = edit.Col
+		return err
+	}
+
+	return nil
+}
+
+// uniqueIndexKey returns the key of the hash indexing the values of the unique columns
+// of a sheet. Its fields are "<col>:<value>" and hold the row the value is in. The field
+// "<col>:" marks the columns that have been indexed, since empty values are not.
+func uniqueIndexKey(sheetID string) string {
+	return sheetID + ":unique"
+}
+
+// applyUniqueEdit sets a cell of a unique column unless another row of the column has
+// the same value, in which case it returns that row, and 0 otherwise. It returns -1 if
+// the sheet has no session or its columns are locked. The column is indexed the first
+// time it is edited.
+//
+// KEYS[1] is the sheet, KEYS[2] its unique index and KEYS[3] the lock of its columns.
+// ARGV holds the row, column and value.
+var applyUniqueEdit = redis.NewScript(`
+local row, col, value = ARGV[1], ARGV[2], ARGV[3]
+if redis.call('EXISTS', KEYS[1]) == 0 or redis.call('EXISTS', KEYS[3]) == 1 then
+	return -1
+end
+local prefix = col .. ':'
+
+if redis.call('HEXISTS', KEYS[2], prefix) == 0 then
+	local cursor = '0'
+	repeat
+		local res = redis.call('HSCAN', KEYS[1], cursor, 'MATCH', '*:' .. col, 'COUNT', 1000)
+		cursor = res[1]
+		local cells = res[2]
+		for i = 1, #cells, 2 do
+			local r = string.match(cells[i], '^(%d+):')
+			if r ~= '0' and cells[i + 1] ~= '' then
+				redis.call('HSET', KEYS[2], prefix .. cells[i + 1], r)
+			end
+		end
+	until cursor == '0'
+	redis.call('HSET', KEYS[2], prefix, '0')
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl > 0 then
+		redis.call('PEXPIRE', KEYS[2], ttl)
+	end
+end
+
+if value ~= '' then
+	local owner = redis.call('HGET', KEYS[2], prefix .. value)
+	if owner and owner ~= row then
+		return tonumber(owner)
+	end
+end
+
+local cell = row .. ':' .. col
+local old = redis.call('HGET', KEYS[1], cell)
+if old and old ~= '' and redis.call('HGET', KEYS[2], prefix .. old) == row then
+	redis.call('HDEL', KEYS[2], prefix .. old)
+end
+if value ~= '' then
+	redis.call('HSET', KEYS[2], prefix .. value, row)
+end
+redis.call('HSET', KEYS[1], cell, value)
+return 0
+`)
+
 // GetRedisSheetData retrieves all the data for a specific sheet from Redis.
 func (s *Store) GetRedisSheetData(sheetID string) (map[string]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -109,3 +354,103 @@ func (s *Store) GetRedisSheetData(sheetID string) (map[string]string, error) {
 
 	return redisData, nil
 }
+
+// ScanSheetData iterates over the cells of a sheet in batches using HSCAN, so that
+// the whole sheet is never held in memory at once. `batchSize` is a hint for the
+// number of cells per batch. `fn` is called with each batch and the iteration
+// stops at the first error it returns.
+func (s *Store) ScanSheetData(sheetID string, batchSize int64, fn func(cells map[string]string) error) error {
+	var cursor uint64
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		kvs, next, err := s.rdb.HScan(ctx, sheetID, cursor, "", batchSize).Result()
+		cancel()
+		if err != nil {
+			slog.Error("unable to scan redis sheet data", "err", err)
+			return err
+		}
+
+		if len(kvs) > 0 {
+			cells := make(map[string]string, len(kvs)/2)
+			for i := 0; i+1 < len(kvs); i += 2 {
+				cells[kvs[i]] = kvs[i+1]
+			}
+			if err := fn(cells); err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// cellBatchSize is the number of cells GetCells retrieves per call to Redis.
+const cellBatchSize = 1000
+
+// GetCells retrieves the cells of a sheet with the given "row:col" keys. Cells that
+// are not set in Redis are missing from the result.
+func (s *Store) GetCells(sheetID string, keys []string) (map[string]string, error) {
+	cells := make(map[string]string, len(keys))
+	for from := 0; from < len(keys); from += cellBatchSize {
+		batch := keys[from:min(from+cellBatchSize, len(keys))]
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		vals, err := s.rdb.HMGet(ctx, sheetID, batch...).Result()
+		cancel()
+		if err != nil {
+			slog.Error("unable to get redis sheet cells", "err", err)
+			return nil, err
+		}
+
+		for i, val := range vals {
+			if val, ok := val.(string); ok {
+				cells[batch[i]] = val
+			}
+		}
+	}
+	return cells, nil
+}
+
+// GetRows retrieves the rows of a sheet from `from` (inclusive) to `to` (exclusive),
+// each `colNum` cells wide. Cells that are not set in Redis are returned as empty strings.
+func (s *Store) GetRows(sheetID string, from, to, colNum int) ([][]string, error) {
+	if from < 0 || to < from || colNum <= 0 {
+		return nil, fmt.Errorf("invalid row range %d-%d", from, to)
+	}
+
+	fields := make([]string, 0, (to-from)*colNum)
+	for i := from; i < to; i++ {
+		for j := 0; j < colNum; j++ {
+			fields = append(fields, fmt.Sprintf("%d:%d", i, j))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rows := make([][]string, 0, to-from)
+	if len(fields) == 0 {
+		return rows, nil
+	}
+
+	vals, err := s.rdb.HMGet(ctx, sheetID, fields...).Result()
+	if err != nil {
+		slog.Error("unable to get redis sheet rows", "err", err)
+		return nil, err
+	}
+
+	for i := 0; i < to-from; i++ {
+		row := make([]string, colNum)
+		for j := range row {
+			if val, ok := vals[i*colNum+j].(string); ok {
+				row[j] = val
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
@@ -2,8 +2,11 @@ package collab
 
 import (
 	"context"
+	"errors"
 	"os"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -101,6 +104,57 @@ func TestInitRedisSheet(t *testing.T) {
 	}
 }
 
+func TestSetDeadline(t *testing.T) {
+	sheetID := utils.GenerateID()
+	sheetData := &[][]string{{"A1", "B1"}}
+
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(10*time.Minute), sheetData)
+	assert.NoError(t, err)
+
+	err = testStore.SetDeadline(sheetID, time.Now().Add(time.Hour))
+	assert.NoError(t, err, "should not return an error when extending the deadline")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	ttl, err := testStore.rdb.TTL(ctx, sheetID).Result()
+	assert.NoError(t, err)
+	assert.InDelta(t, (65 * time.Minute).Seconds(), ttl.Seconds(), 2, "TTL should follow the new deadline")
+}
+
+func TestDeleteSheet(t *testing.T) {
+	sheetID := utils.GenerateID()
+	sheetData := &[][]string{{"A1", "B1"}}
+
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(10*time.Minute), sheetData)
+	assert.NoError(t, err)
+
+	err = testStore.DeleteSheet(sheetID)
+	assert.NoError(t, err, "should not return an error when deleting a sheet")
+
+	exists, err := testStore.SheetExists(sheetID)
+	assert.NoError(t, err)
+	assert.False(t, exists, "the sheet should no longer exist")
+
+	err = testStore.DeleteSheet(sheetID)
+	assert.NoError(t, err, "deleting a sheet without a session should not return an error")
+
+	// edits that were in flight when the session was removed
+	columns := []Column{{Title: "A1", Type: ColumnText, Unique: true}, {Title: "B1", Type: ColumnText}}
+	err = testStore.ApplyEdit(sheetID, EditMsg{Row: 1, Col: 1, Data: "late"})
+	assert.ErrorIs(t, err, ErrNoSession)
+	err = testStore.ApplyCellEdit(sheetID, columns, EditMsg{Row: 1, Col: 0, Data: "late"})
+	assert.ErrorIs(t, err, ErrNoSession)
+	err = testStore.ClaimRow(sheetID, RowClaim{Row: 1, UserID: "brian", ColNum: 2, Restricted: true})
+	assert.ErrorIs(t, err, ErrNoSession)
+	_, err = testStore.AppendRow(sheetID, columns, []string{"late", ""}, nil)
+	assert.ErrorIs(t, err, ErrNoSession)
+
+	n, err := testStore.rdb.Exists(context.Background(), sessionKeys(sheetID)...).Result()
+	assert.NoError(t, err)
+	assert.Zero(t, n, "edits should not recreate the session")
+}
+
 func TestApplyEdit(t *testing.T) {
 	sheetID := utils.GenerateID()
 	sheetDeadline := time.Now().Add(10 * time.Minute)
@@ -134,3 +188,496 @@ func TestApplyEdit(t *testing.T) {
 	assert.Error(t, err, "should return an error when trying to edit the first row (column headers)")
 	assert.Equal(t, "cannot edit column headers", err.Error(), "should return the correct error message")
 }
+
+func TestApplyCellEdit(t *testing.T) {
+	sheetID := utils.GenerateID()
+	sheetData := &[][]string{
+		{"Employee ID", "Name"},
+		{"E1", "Amina"},
+		{"", "Brian"},
+		{"", "Chen"},
+	}
+	columns := []Column{{Title: "Employee ID", Type: ColumnText, Unique: true}, {Title: "Name", Type: ColumnText}}
+
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(10*time.Minute), sheetData)
+	assert.NoError(t, err, "should not return an error when initializing a sheet")
+	t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+	err = testStore.ApplyCellEdit(sheetID, columns, EditMsg{Row: 2, Col: 0, Data: "E1"})
+	var cellErr *CellError
+	if assert.ErrorAs(t, err, &cellErr, "should reject a value that is already in the column") {
+		assert.Equal(t, RuleUnique, cellErr.Rule)
+		assert.Equal(t, "0", cellErr.Param, "should report the row the value is in, without the header row")
+	}
+
+	err = testStore.ApplyCellEdit(sheetID, columns, EditMsg{Row: 2, Col: 0, Data: "E2"})
+	assert.NoError(t, err, "should accept a new value")
+
+	// rewriting a value to the row it is in is not a duplicate
+	err = testStore.ApplyCellEdit(sheetID, columns, EditMsg{Row: 2, Col: 0, Data: "E2"})
+	assert.NoError(t, err, "should accept a value in its own row")
+
+	// once a value is replaced, another row can take it
+	err = testStore.ApplyCellEdit(sheetID, columns, EditMsg{Row: 1, Col: 0, Data: "E3"})
+	assert.NoError(t, err)
+	err = testStore.ApplyCellEdit(sheetID, columns, EditMsg{Row: 3, Col: 0, Data: "E1"})
+	assert.NoError(t, err, "should accept a value that is no longer in the column")
+
+	err = testStore.ApplyCellEdit(sheetID, columns, EditMsg{Row: 1, Col: 1, Data: "Brian"})
+	assert.NoError(t, err, "should not check columns that are not unique")
+
+	rows, err := testStore.GetRows(sheetID, 1, 4, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"E3", "Brian"}, {"E2", "Brian"}, {"E1", "Chen"}}, rows)
+}
+
+func TestApplyCellEditConcurrentUnique(t *testing.T) {
+	sheetID := utils.GenerateID()
+	sheetData := &[][]string{{"Employee ID"}}
+	columns := []Column{{Title: "Employee ID", Type: ColumnText, Unique: true}}
+
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(10*time.Minute), sheetData)
+	assert.NoError(t, err, "should not return an error when initializing a sheet")
+	t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+	var wg sync.WaitGroup
+	var applied atomic.Int32
+	for row := 1; row <= 10; row++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if testStore.ApplyCellEdit(sheetID, columns, EditMsg{Row: row, Col: 0, Data: "E1"}) == nil {
+				applied.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), applied.Load(), "only one of the concurrent edits should store the value")
+}
+
+func TestChangeColumns(t *testing.T) {
+	sheetID := utils.GenerateID()
+	sheetData := &[][]string{
+		{"Employee ID", "Name", "Total"},
+		{"E1", "Amina", "=B2"},
+	}
+	columns := []Column{{Title: "Employee ID", Type: ColumnText, Unique: true}, {Title: "Name", Type: ColumnText}, {Title: "Total", Type: ColumnText}}
+
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(10*time.Minute), sheetData)
+	assert.NoError(t, err, "should not return an error when initializing a sheet")
+	t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+	// index the unique column
+	err = testStore.ApplyCellEdit(sheetID, columns, EditMsg{Row: 2, Col: 0, Data: "E2"})
+	assert.NoError(t, err)
+
+	change, err := ReorderColumns(columns, []int{1, 0, 2})
+	assert.NoError(t, err)
+	err = testStore.ChangeColumns(sheetID, change)
+	assert.NoError(t, err, "should not return an error when changing the columns")
+
+	rows, err := testStore.GetRows(sheetID, 0, 3, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"Name", "Employee ID", "Total"}, {"Amina", "E1", "=A2"}, {"", "E2", ""}}, rows)
+
+	// the unique index is rebuilt from the moved cells
+	err = testStore.ApplyCellEdit(sheetID, change.Columns, EditMsg{Row: 3, Col: 1, Data: "E1"})
+	var cellErr *CellError
+	if assert.ErrorAs(t, err, &cellErr, "should reject a value that is already in the moved column") {
+		assert.Equal(t, "0", cellErr.Param)
+	}
+
+	ttl, err := testStore.rdb.TTL(context.Background(), sheetID).Result()
+	assert.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0), "the session should keep its expiry")
+
+	err = testStore.ChangeColumns(utils.GenerateID(), change)
+	assert.NoError(t, err, "should do nothing for sheets without a session")
+}
+
+func TestFormats(t *testing.T) {
+	sheetID := utils.GenerateID()
+	sheetData := &[][]string{
+		{"Name", "Score", "Status"},
+		{"Amina", "10", "done"},
+	}
+	columns := []Column{{Title: "Name", Type: ColumnText}, {Title: "Score", Type: ColumnText}, {Title: "Status", Type: ColumnText}}
+
+	err := testStore.SetCellFormat(sheetID, 1, 0, Format{Bold: true})
+	assert.ErrorIs(t, err, ErrNoSession, "should not format sheets without a session")
+	formats, err := testStore.GetFormats(sheetID)
+	assert.NoError(t, err)
+	assert.True(t, formats.IsZero(), "should not store formats of sheets without a session")
+
+	err = testStore.InitRedisSheet(sheetID, time.Now().Add(10*time.Minute), sheetData)
+	assert.NoError(t, err, "should not return an error when initializing a sheet")
+	t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+	done := Format{Background: "#00ff00"}
+	assert.NoError(t, testStore.SetCellFormat(sheetID, 1, 2, done))
+	assert.NoError(t, testStore.SetCellFormat(sheetID, 1, 0, Format{Bold: true}))
+	assert.NoError(t, testStore.SetColumnFormat(sheetID, 1, Format{NumberFormat: "0.00", Align: AlignRight}))
+	assert.Error(t, testStore.SetCellFormat(sheetID, 0, 0, done), "should not format the headers")
+
+	formats, err = testStore.GetFormats(sheetID)
+	assert.NoError(t, err)
+	assert.Equal(t, Format{Bold: true}, formats.Of(1, 0))
+	assert.Equal(t, Format{NumberFormat: "0.00", Align: AlignRight}, formats.Of(2, 1), "cells should get the format of their column")
+	assert.Equal(t, Format{}, formats.Of(0, 1), "column formats should not apply to the headers")
+	assert.Equal(t, done, formats.Of(1, 2))
+
+	// clear the format of a cell
+	assert.NoError(t, testStore.SetCellFormat(sheetID, 1, 0, Format{}))
+
+	ttl, err := testStore.rdb.TTL(context.Background(), formatsKey(sheetID)).Result()
+	assert.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0), "formats should expire with the session")
+
+	// move the status column first and delete the name column
+	change, err := ReorderColumns(columns, []int{2, 0, 1})
+	assert.NoError(t, err)
+	assert.NoError(t, testStore.ChangeColumns(sheetID, change))
+	change, err = DeleteColumn(change.Columns, 1)
+	assert.NoError(t, err)
+	assert.NoError(t, testStore.ChangeColumns(sheetID, change))
+
+	formats, err = testStore.GetFormats(sheetID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[CellPos]Format{{Row: 1, Col: 0}: done}, formats.Cells, "cell formats should move with their column")
+	assert.Equal(t, map[int]Format{1: {NumberFormat: "0.00", Align: AlignRight}}, formats.Columns, "column formats should move with their column")
+
+	assert.NoError(t, testStore.DeleteSheet(sheetID))
+	formats, err = testStore.GetFormats(sheetID)
+	assert.NoError(t, err)
+	assert.True(t, formats.IsZero(), "formats should be deleted with the session")
+}
+
+func TestClaimRow(t *testing.T) {
+	sheetID := utils.GenerateID()
+	sheetData := &[][]string{
+		{"Name", "Score"},
+		{"Amina", "10"},
+	}
+
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(10*time.Minute), sheetData)
+	assert.NoError(t, err, "should not return an error when initializing a sheet")
+	t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+	claim := func(row int, userID string, restricted bool) error {
+		return testStore.ClaimRow(sheetID, RowClaim{Row: row, UserID: userID, ColNum: 2, MaxRows: 2, Restricted: restricted})
+	}
+	assertRejected := func(err error, rule string, msg string) {
+		t.Helper()
+		var cellErr *CellError
+		if assert.ErrorAs(t, err, &cellErr, msg) {
+			assert.Equal(t, rule, cellErr.Rule)
+		}
+	}
+
+	assertRejected(claim(1, "brian", true), RuleRowOwner, "restricted users should not claim rows that are not blank")
+	assert.NoError(t, claim(1, "owner", false), "unrestricted users should edit rows that are not blank")
+
+	assert.NoError(t, claim(2, "brian", true), "should claim a blank row")
+	assert.NoError(t, claim(2, "brian", true), "should edit an owned row")
+	assertRejected(claim(2, "chen", true), RuleRowOwner, "should not edit the row of another user")
+	assert.NoError(t, claim(2, "owner", false), "unrestricted users should edit the rows of others")
+	assertRejected(claim(3, "", true), RuleRowOwner, "anonymous users should not claim rows")
+
+	assert.NoError(t, claim(3, "brian", true))
+	err = claim(4, "brian", true)
+	assertRejected(err, RuleRowLimit, "should not claim more than MaxRows rows")
+	assert.Equal(t, "2", err.(*CellError).Param)
+	assert.NoError(t, claim(4, "chen", true), "the limit should apply to each user")
+
+	assert.Error(t, testStore.ClaimRow(sheetID, RowClaim{Row: 0, UserID: "brian"}), "should not claim the headers")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	owners, err := testStore.rdb.HGetAll(ctx, rowOwnersKey(sheetID)).Result()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"1": "owner", "2": "brian", "3": "brian", "4": "chen"}, owners)
+}
+
+func TestApplyRowEdit(t *testing.T) {
+	sheetID := utils.GenerateID()
+	sheetData := &[][]string{
+		{"Employee ID", "Name"},
+		{"E1", "Amina"},
+	}
+	columns := []Column{{Title: "Employee ID", Type: ColumnText, Unique: true}, {Title: "Name", Type: ColumnText}}
+	claim := RowClaim{UserID: "brian", ColNum: 2, MaxRows: 1, Restricted: true}
+
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(10*time.Minute), sheetData)
+	assert.NoError(t, err, "should not return an error when initializing a sheet")
+	t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+	var cellErr *CellError
+	err = testStore.ApplyRowEdit(sheetID, columns, claim, EditMsg{Row: 2, Col: 0, Data: "E1"})
+	if assert.ErrorAs(t, err, &cellErr, "should reject a duplicate value") {
+		assert.Equal(t, RuleUnique, cellErr.Rule)
+	}
+	owner, err := testStore.RowOwner(sheetID, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, owner, "a rejected edit should not claim the row")
+
+	err = testStore.ApplyRowEdit(sheetID, columns, claim, EditMsg{Row: 3, Col: 0, Data: "E2"})
+	assert.NoError(t, err, "a rejected edit should not count towards the rows of the user")
+	owner, err = testStore.RowOwner(sheetID, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "brian", owner)
+
+	err = testStore.ApplyRowEdit(sheetID, columns, claim, EditMsg{Row: 3, Col: 0, Data: "E1"})
+	assert.ErrorAs(t, err, &cellErr, "should reject a duplicate value in an owned row")
+	owner, err = testStore.RowOwner(sheetID, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "brian", owner, "a rejected edit should not give up a row owned before")
+}
+
+func TestInitSessionRowOwners(t *testing.T) {
+	sheetID := utils.GenerateID()
+	session := Session{
+		Data:      [][]string{{"Name"}, {"Amina"}, {"Brian"}},
+		RowOwners: map[int]string{1: "amina", 2: "brian"},
+		Formats:   map[string]string{"col:0": `{"bold":true}`},
+	}
+
+	err := testStore.InitSession(sheetID, time.Now().Add(10*time.Minute), session)
+	assert.NoError(t, err, "should not return an error when initializing a session")
+	t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+	owners, err := testStore.RowOwners(sheetID)
+	assert.NoError(t, err)
+	assert.Equal(t, session.RowOwners, owners, "should restore the owners of the rows")
+	formats, err := testStore.GetFormats(sheetID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[int]Format{0: {Bold: true}}, formats.Columns, "should restore the formats")
+
+	err = testStore.ClaimRow(sheetID, RowClaim{Row: 1, UserID: "brian", ColNum: 1, Restricted: true})
+	var cellErr *CellError
+	if assert.ErrorAs(t, err, &cellErr, "should keep the rows of other users") {
+		assert.Equal(t, RuleRowOwner, cellErr.Rule)
+	}
+	err = testStore.ClaimRow(sheetID, RowClaim{Row: 3, UserID: "brian", ColNum: 1, MaxRows: 1, Restricted: true})
+	if assert.ErrorAs(t, err, &cellErr, "should count the restored rows towards the limit") {
+		assert.Equal(t, RuleRowLimit, cellErr.Rule)
+	}
+}
+
+func TestClaimRowConcurrent(t *testing.T) {
+	sheetID := utils.GenerateID()
+	sheetData := &[][]string{{"Name"}}
+
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(10*time.Minute), sheetData)
+	assert.NoError(t, err, "should not return an error when initializing a sheet")
+	t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+	var wg sync.WaitGroup
+	var claimed atomic.Int32
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claim := RowClaim{Row: 1, UserID: strconv.Itoa(i), ColNum: 1, Restricted: true}
+			if testStore.ClaimRow(sheetID, claim) == nil {
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), claimed.Load(), "only one of the concurrent users should claim the row")
+}
+
+func TestAppendRow(t *testing.T) {
+	sheetID := utils.GenerateID()
+	sheetData := &[][]string{
+		{"Employee ID", "Name"},
+		{"E1", "Amina"},
+	}
+	columns := []Column{{Title: "Employee ID", Type: ColumnText, Unique: true}, {Title: "Name", Type: ColumnText, Required: true}}
+
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(10*time.Minute), sheetData)
+	assert.NoError(t, err, "should not return an error when initializing a sheet")
+	t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+	row, err := testStore.AppendRow(sheetID, columns, []string{"E2", "Brian"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, row, "should append after the last row")
+
+	var cellErr *CellError
+	_, err = testStore.AppendRow(sheetID, columns, []string{"E3", ""}, nil)
+	if assert.ErrorAs(t, err, &cellErr, "should reject invalid values") {
+		assert.Equal(t, RuleRequired, cellErr.Rule)
+	}
+	_, err = testStore.AppendRow(sheetID, columns, []string{"E1", "Chen"}, nil)
+	if assert.ErrorAs(t, err, &cellErr, "should reject duplicate values") {
+		assert.Equal(t, RuleUnique, cellErr.Rule)
+	}
+
+	// a row edited by a live client is not reused
+	err = testStore.ApplyEdit(sheetID, EditMsg{Row: 3, Col: 1, Data: "Dalia"})
+	assert.NoError(t, err)
+	row, err = testStore.AppendRow(sheetID, columns, []string{"E3", "Chen"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, row, "should skip rows that are not blank")
+
+	rows, err := testStore.GetRows(sheetID, 1, 5, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"E1", "Amina"}, {"E2", "Brian"}, {"", "Dalia"}, {"E3", "Chen"}}, rows)
+
+	claim := &RowClaim{UserID: "brian", MaxRows: 1, Restricted: true}
+	row, err = testStore.AppendRow(sheetID, columns, []string{"", "Eve"}, claim)
+	assert.NoError(t, err)
+	assert.NoError(t, testStore.ClaimRow(sheetID, RowClaim{Row: row, UserID: "brian", ColNum: 2, Restricted: true}),
+		"the appended row should belong to the user")
+	_, err = testStore.AppendRow(sheetID, columns, []string{"", "Fred"}, claim)
+	if assert.ErrorAs(t, err, &cellErr, "should not append more rows than the limit") {
+		assert.Equal(t, RuleRowLimit, cellErr.Rule)
+	}
+}
+
+func TestAppendRowConcurrent(t *testing.T) {
+	sheetID := utils.GenerateID()
+	sheetData := &[][]string{{"Name"}}
+	columns := []Column{{Title: "Name", Type: ColumnText}}
+
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(10*time.Minute), sheetData)
+	assert.NoError(t, err, "should not return an error when initializing a sheet")
+	t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	appended := make(map[int]bool)
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			row, err := testStore.AppendRow(sheetID, columns, []string{strconv.Itoa(i)}, nil)
+			assert.NoError(t, err)
+			mu.Lock()
+			appended[row] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, appended, 10, "concurrent appends should be stored in different rows")
+}
+
+func TestScanSheetData(t *testing.T) {
+	sheetID := utils.GenerateID()
+	sheetData := &[][]string{
+		{"A1", "B1"},
+		{"A2", "B2"},
+		{"A3", "B3"},
+	}
+
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(10*time.Minute), sheetData)
+	assert.NoError(t, err, "should not return an error when initializing a sheet")
+
+	result := make(map[string]string)
+	err = testStore.ScanSheetData(sheetID, 2, func(cells map[string]string) error {
+		for k, v := range cells {
+			result[k] = v
+		}
+		return nil
+	})
+	assert.NoError(t, err, "should not return an error when scanning a sheet")
+	assert.Equal(t, 6, len(result), "should visit every cell of the sheet")
+	assert.Equal(t, "B3", result["2:1"])
+
+	stopErr := errors.New("stop")
+	err = testStore.ScanSheetData(sheetID, 2, func(cells map[string]string) error {
+		return stopErr
+	})
+	assert.ErrorIs(t, err, stopErr, "should return the error returned by the callback")
+}
+
+func TestGetRows(t *testing.T) {
+	sheetID := utils.GenerateID()
+	sheetData := &[][]string{
+		{"A1", "B1"},
+		{"A2", "B2"},
+	}
+
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(10*time.Minute), sheetData)
+	assert.NoError(t, err, "should not return an error when initializing a sheet")
+
+	rows, err := testStore.GetRows(sheetID, 1, 3, 2)
+	assert.NoError(t, err, "should not return an error when getting rows")
+	assert.Equal(t, [][]string{{"A2", "B2"}, {"", ""}}, rows, "missing cells should be empty strings")
+
+	_, err = testStore.GetRows(sheetID, 2, 1, 2)
+	assert.Error(t, err, "should return an error for an invalid row range")
+}
+
+func TestGetCells(t *testing.T) {
+	sheetID := utils.GenerateID()
+	sheetData := &[][]string{
+		{"A", "B"},
+		{"1", "2"},
+	}
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(10*time.Minute), sheetData)
+	assert.NoError(t, err, "should not return an error when initializing a sheet")
+	t.Cleanup(func() { testStore.DeleteSheet(sheetID) })
+
+	cells, err := testStore.GetCells(sheetID, []string{"1:1", "0:0", "5:5"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"1:1": "2", "0:0": "A"}, cells, "should leave out missing cells")
+}
+
+func TestLockColumns(t *testing.T) {
+	sheetID := utils.GenerateID()
+	sheetData := [][]string{{"Name", "Score"}, {"Amina", "1"}}
+
+	err := testStore.InitRedisSheet(sheetID, time.Now().Add(10*time.Minute), &sheetData)
+	assert.NoError(t, err, "should not return an error when initializing a sheet")
+	t.Cleanup(func() {
+		testStore.DeleteSheet(sheetID)
+		testStore.rdb.Del(context.Background(), columnsLockKey(sheetID), columnsVersionKey(sheetID))
+	})
+
+	version, err := testStore.ColumnsVersion(sheetID)
+	assert.NoError(t, err)
+	assert.Zero(t, version, "columns that were never locked should be at version 0")
+
+	unlock, err := testStore.LockColumns(sheetID)
+	assert.NoError(t, err, "should lock the columns")
+
+	_, err = testStore.LockColumns(sheetID)
+	assert.ErrorIs(t, err, ErrColumnsLocked, "should not lock the columns twice")
+	_, err = testStore.ColumnsVersion(sheetID)
+	assert.ErrorIs(t, err, ErrColumnsLocked)
+
+	err = testStore.ApplyEdit(sheetID, EditMsg{Row: 1, Col: 0, Data: "Brian"})
+	assert.ErrorIs(t, err, ErrNoSession, "should not apply edits while the columns are locked")
+	unique := []Column{{Title: "Name", Type: ColumnText, Unique: true}, {Title: "Score", Type: ColumnText}}
+	err = testStore.ApplyCellEdit(sheetID, unique, EditMsg{Row: 1, Col: 0, Data: "Brian"})
+	assert.ErrorIs(t, err, ErrNoSession, "should not apply edits to unique columns while the columns are locked")
+	err = testStore.ClaimRow(sheetID, RowClaim{Row: 1, UserID: "amina", ColNum: 2})
+	assert.ErrorIs(t, err, ErrNoSession, "should not claim rows while the columns are locked")
+	_, err = testStore.AppendRow(sheetID, unique, []string{"Brian", "2"}, nil)
+	assert.ErrorIs(t, err, ErrNoSession, "should not append rows while the columns are locked")
+	err = testStore.SetCellFormat(sheetID, 1, 0, Format{Bold: true})
+	assert.ErrorIs(t, err, ErrNoSession, "should not format cells while the columns are locked")
+	err = testStore.SetColumnFormat(sheetID, 0, Format{Bold: true})
+	assert.ErrorIs(t, err, ErrNoSession, "should not format columns while the columns are locked")
+
+	err = testStore.InitSession(sheetID, time.Now().Add(10*time.Minute), Session{Data: sheetData})
+	assert.ErrorIs(t, err, ErrColumnsLocked, "should not initialize a session while the columns are locked")
+
+	unlock()
+
+	version, err = testStore.ColumnsVersion(sheetID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), version, "locking the columns should change their version")
+
+	err = testStore.InitSession(sheetID, time.Now().Add(10*time.Minute), Session{Data: sheetData})
+	assert.ErrorIs(t, err, ErrColumnsLocked, "should not initialize a session read before the columns changed")
+	err = testStore.InitSession(sheetID, time.Now().Add(10*time.Minute), Session{Data: sheetData, ColumnsVersion: version})
+	assert.NoError(t, err, "should initialize a session read after the columns changed")
+
+	err = testStore.ApplyEdit(sheetID, EditMsg{Row: 1, Col: 0, Data: "Brian"})
+	assert.NoError(t, err, "should apply edits once the columns are unlocked")
+}
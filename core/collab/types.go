@@ -6,13 +6,63 @@ type EditMsg struct {
 	Row  int    `json:"row"`
 	Col  int    `json:"col"`
 	Data string `json:"data"`
+	// Seq is an optional number chosen by the client to match the edit with its acknowledgement.
+	Seq int `json:"seq,omitempty"`
+}
+
+// Author identifies the user who made an edit.
+type Author struct {
+	ID   string `json:"id"` // subject of the user's access token
+	Name string `json:"name,omitempty"`
 }
 
 // BroadCastMsg represents a message to be broadcasted to sheet collaborators.
 // It has a SheetID field to identify the sheet whose clients should receive the
 // message and an Edit field, which is an EditMsg, holding the edit that will be
 // broadcasted.
+//
+// SenderID identifies the client the edit came from, so that it can be acknowledged
+// instead of echoed back, and Author is the user who made it, or nil for anonymous users.
+//
+// Messages that do not come from a client, such as a change to the sheet's deadline,
+// are carried in Event instead and are sent as they are to every subscriber.
 type BroadCastMsg struct {
-	SheetID string
-	Edit    EditMsg
+	SheetID  string
+	SenderID string
+	Author   *Author
+	Edit     EditMsg
+	Event    any
+}
+
+// Role is the level of access a collaborator has to a sheet.
+type Role string
+
+const (
+	// RoleViewer can watch a sheet but not edit it.
+	RoleViewer Role = "viewer"
+	// RoleEditor can edit the cells of a sheet.
+	RoleEditor Role = "editor"
+	// RoleManager can edit a sheet, including the rows of others in row ownership mode.
+	RoleManager Role = "manager"
+	// RoleOwner can edit a sheet and manage who has access to it.
+	RoleOwner Role = "owner"
+)
+
+// roleRanks orders the roles from the least to the most access.
+var roleRanks = map[Role]int{
+	RoleViewer:  1,
+	RoleEditor:  2,
+	RoleManager: 3,
+	RoleOwner:   4,
+}
+
+// AtLeast reports whether the role grants at least the access of `other`.
+// An empty or unknown role grants no access.
+func (r Role) AtLeast(other Role) bool {
+	return roleRanks[r] > 0 && roleRanks[r] >= roleRanks[other]
+}
+
+// CanEdit reports whether the role allows editing the cells of a sheet.
+func (r Role) CanEdit() bool {
+	return r.AtLeast(RoleEditor)
 }
@@ -0,0 +1,24 @@
+package collab
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleAtLeast(t *testing.T) {
+	assert.True(t, RoleOwner.AtLeast(RoleEditor))
+	assert.True(t, RoleEditor.AtLeast(RoleEditor))
+	assert.True(t, RoleEditor.AtLeast(RoleViewer))
+	assert.True(t, RoleOwner.AtLeast(RoleManager))
+	assert.True(t, RoleManager.AtLeast(RoleEditor))
+	assert.False(t, RoleEditor.AtLeast(RoleManager))
+	assert.False(t, RoleViewer.AtLeast(RoleEditor))
+	assert.False(t, Role("").AtLeast(RoleViewer), "an empty role should grant no access")
+	assert.False(t, Role("admin").AtLeast(RoleViewer), "an unknown role should grant no access")
+
+	assert.True(t, RoleOwner.CanEdit())
+	assert.True(t, RoleManager.CanEdit())
+	assert.True(t, RoleEditor.CanEdit())
+	assert.False(t, RoleViewer.CanEdit())
+}
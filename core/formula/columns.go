@@ -0,0 +1,122 @@
+package formula
+
+import "strings"
+
+// MoveColumns rewrites the references of a formula after columns of its sheet are added,
+// deleted or reordered. `moves` maps each column to its new index, or to -1 if it was
+// deleted. References to columns beyond `moves` are left as they are.
+//
+// References to deleted columns become #REF!. Ranges shrink to the columns they have
+// left and span them once they are moved, and only become #REF! if every one of their
+// columns is deleted. Contents that are not formulas, and formulas with characters that
+// are not part of the language, are returned unchanged.
+func MoveColumns(raw string, moves []int) string {
+	if !IsFormula(raw) {
+		return raw
+	}
+	src := raw[1:]
+	tokens, spans, err := lexSpans(src)
+	if err != nil {
+		return raw
+	}
+
+	var out strings.Builder
+	out.WriteByte('=')
+	last := 0
+	replace := func(from, to int, text string) {
+		out.WriteString(src[last:from])
+		out.WriteString(text)
+		last = to
+	}
+
+	// tokens end with tokenEOF, so the tokens after a name always exist
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.kind != tokenName || tokens[i+1].kind == tokenLParen {
+			continue
+		}
+		if _, ok := ParseRef(t.text); !ok {
+			continue
+		}
+
+		if tokens[i+1].kind == tokenColon && tokens[i+2].kind == tokenName {
+			if _, ok := ParseRef(tokens[i+2].text); ok {
+				if text, changed := moveRange(t.text, tokens[i+2].text, moves); changed {
+					replace(spans[i].start, spans[i+2].end, text)
+				}
+				i += 2
+				continue
+			}
+		}
+
+		if text, changed := moveRef(t.text, moves); changed {
+			replace(spans[i].start, spans[i].end, text)
+		}
+	}
+	out.WriteString(src[last:])
+	return out.String()
+}
+
+// movedColumn returns the new index of a column, see MoveColumns.
+func movedColumn(col int, moves []int) int {
+	if col >= len(moves) {
+		return col
+	}
+	return moves[col]
+}
+
+// moveRef returns the reference `ref` once its column is moved, and whether it changed.
+func moveRef(ref string, moves []int) (string, bool) {
+	cell, _ := ParseRef(ref)
+	col := movedColumn(cell.Col, moves)
+	switch col {
+	case cell.Col:
+		return ref, false
+	case -1:
+		return string(ErrRef), true
+	}
+	return withColumn(ref, col), true
+}
+
+// moveRange returns the range from `from` to `to` once its columns are moved, and
+// whether it changed.
+func moveRange(from, to string, moves []int) (string, bool) {
+	a, _ := ParseRef(from)
+	b, _ := ParseRef(to)
+	lo, hi := min(a.Col, b.Col), max(a.Col, b.Col)
+
+	newLo, newHi := -1, -1
+	for col := lo; col <= hi; col++ {
+		moved := movedColumn(col, moves)
+		if moved < 0 {
+			continue
+		}
+		if newLo < 0 || moved < newLo {
+			newLo = moved
+		}
+		newHi = max(newHi, moved)
+	}
+
+	switch {
+	case newLo < 0:
+		return string(ErrRef), true
+	case newLo == lo && newHi == hi:
+		return from + ":" + to, false
+	}
+	// keep the columns in the same order as the corners of the range
+	if a.Col > b.Col {
+		newLo, newHi = newHi, newLo
+	}
+	return withColumn(from, newLo) + ":" + withColumn(to, newHi), true
+}
+
+// withColumn returns the reference `ref` with its column replaced by `col`, keeping the
+// $ signs of absolute references.
+func withColumn(ref string, col int) string {
+	prefix := ""
+	if strings.HasPrefix(ref, "$") {
+		prefix, ref = "$", ref[1:]
+	}
+	rest := strings.TrimLeft(ref, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz")
+	return prefix + columnLetters(col) + rest
+}
@@ -0,0 +1,43 @@
+package formula
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoveColumns(t *testing.T) {
+	// B is deleted and C and D swap places
+	moves := []int{0, -1, 2, 1}
+
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"plain text", "plain text"},
+		{"=A1+1", "=A1+1"},
+		{"=D2*2", "=B2*2"},
+		{"=$D$2 & c3", "=$B$2 & c3"},
+		{"=B1+1", "=#REF!+1"},
+		{"=SUM(A1:B5)", "=SUM(A1:A5)"},
+		{"=SUM(B1:B5)", "=SUM(#REF!)"},
+		{"=SUM(A1:D5)", "=SUM(A1:C5)"},
+		{"=SUM(D5:A1)", "=SUM(C5:A1)"},
+		{"=CONCAT(\"D1\", E1)", "=CONCAT(\"D1\", E1)"},
+		{"=LOG10(D1)", "=LOG10(B1)"},
+		{"=D1 ? 2", "=D1 ? 2"},
+		{"=D1 +", "=B1 +"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, MoveColumns(tt.raw, moves), "MoveColumns(%q)", tt.raw)
+	}
+}
+
+func TestDeletedReference(t *testing.T) {
+	sheet := NewSheet()
+	contents := map[Cell]string{{Row: 1, Col: 0}: MoveColumns("=B1+1", []int{0, -1})}
+	err := sheet.Load(contents, func([]Cell) (map[Cell]string, error) { return nil, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, string(ErrRef), sheet.Values()[Cell{Row: 1, Col: 0}])
+}
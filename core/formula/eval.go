@@ -0,0 +1,353 @@
+package formula
+
+// scope gives expressions the values of the cells they reference.
+type scope interface {
+	cell(c Cell) Value
+}
+
+// expr is a parsed formula or part of one.
+type expr interface {
+	eval(s scope) Value
+}
+
+// valueExpr is a constant, including the ErrName of unknown names.
+type valueExpr struct {
+	v Value
+}
+
+func (e valueExpr) eval(scope) Value {
+	return e.v
+}
+
+// refExpr is a reference to a single cell.
+type refExpr struct {
+	cell Cell
+}
+
+func (e refExpr) eval(s scope) Value {
+	return s.cell(e.cell)
+}
+
+// rangeExpr is a range of cells, which can only be used as an argument of the
+// functions that accept ranges.
+type rangeExpr struct {
+	r cellRange
+}
+
+func (e rangeExpr) eval(scope) Value {
+	if e.r.size() > MaxRangeCells {
+		return ErrRef
+	}
+	return ErrValue
+}
+
+// negExpr negates a number.
+type negExpr struct {
+	x expr
+}
+
+func (e negExpr) eval(s scope) Value {
+	n, err := toNumber(e.x.eval(s))
+	if err != nil {
+		return err
+	}
+	return -n
+}
+
+// binaryExpr applies an operator to two operands.
+type binaryExpr struct {
+	op   string
+	x, y expr
+}
+
+func (e binaryExpr) eval(s scope) Value {
+	x, y := e.x.eval(s), e.y.eval(s)
+	if err, ok := x.(Error); ok {
+		return err
+	}
+	if err, ok := y.(Error); ok {
+		return err
+	}
+
+	switch e.op {
+	case "&":
+		a, _ := toText(x)
+		b, _ := toText(y)
+		return a + b
+	case "=", "<>", "<", ">", "<=", ">=":
+		c := compare(x, y)
+		switch e.op {
+		case "=":
+			return c == 0
+		case "<>":
+			return c != 0
+		case "<":
+			return c < 0
+		case ">":
+			return c > 0
+		case "<=":
+			return c <= 0
+		default:
+			return c >= 0
+		}
+	}
+
+	a, err := toNumber(x)
+	if err != nil {
+		return err
+	}
+	b, err := toNumber(y)
+	if err != nil {
+		return err
+	}
+	switch e.op {
+	case "+":
+		return number(a + b)
+	case "-":
+		return number(a - b)
+	case "*":
+		return number(a * b)
+	default:
+		if b == 0 {
+			return ErrDiv0
+		}
+		return number(a / b)
+	}
+}
+
+// callExpr calls a function.
+type callExpr struct {
+	name string
+	args []expr
+}
+
+func (e callExpr) eval(s scope) Value {
+	fn, ok := functions[e.name]
+	if !ok {
+		return ErrName
+	}
+	return fn(s, e.args)
+}
+
+// functions are the functions formulas can call, by name.
+var functions = map[string]func(s scope, args []expr) Value{
+	"SUM":     sum,
+	"AVERAGE": average,
+	"COUNT":   count,
+	"MIN":     minimum,
+	"MAX":     maximum,
+	"IF":      ifFunc,
+	"CONCAT":  concat,
+}
+
+// numbers returns the numbers in the arguments of a function. Cells referenced by the
+// arguments only count if they hold numbers, while other arguments are coerced to
+// numbers. The first error value found is returned instead.
+func numbers(s scope, args []expr) ([]float64, Value) {
+	var nums []float64
+	for _, arg := range args {
+		cells, ok := referencedCells(arg)
+		if !ok {
+			n, err := toNumber(arg.eval(s))
+			if err != nil {
+				return nil, err
+			}
+			nums = append(nums, n)
+			continue
+		}
+		if cells == nil {
+			return nil, ErrRef
+		}
+		for _, c := range cells {
+			switch v := s.cell(c).(type) {
+			case float64:
+				nums = append(nums, v)
+			case Error:
+				return nil, v
+			}
+		}
+	}
+	return nums, nil
+}
+
+// referencedCells returns the cells of an argument that is a reference or a range, and
+// false for other arguments. The cells are nil if the range is too large.
+func referencedCells(arg expr) ([]Cell, bool) {
+	switch arg := arg.(type) {
+	case refExpr:
+		return []Cell{arg.cell}, true
+	case rangeExpr:
+		if arg.r.size() > MaxRangeCells {
+			return nil, true
+		}
+		return arg.r.cells(), true
+	}
+	return nil, false
+}
+
+func sum(s scope, args []expr) Value {
+	nums, err := numbers(s, args)
+	if err != nil {
+		return err
+	}
+	total := 0.0
+	for _, n := range nums {
+		total += n
+	}
+	return number(total)
+}
+
+func average(s scope, args []expr) Value {
+	nums, err := numbers(s, args)
+	if err != nil {
+		return err
+	}
+	if len(nums) == 0 {
+		return ErrDiv0
+	}
+	total := 0.0
+	for _, n := range nums {
+		total += n
+	}
+	return number(total / float64(len(nums)))
+}
+
+// count counts the numbers in its arguments, ignoring anything else, errors included.
+func count(s scope, args []expr) Value {
+	n := 0
+	for _, arg := range args {
+		cells, ok := referencedCells(arg)
+		if !ok {
+			if _, err := toNumber(arg.eval(s)); err == nil {
+				n++
+			}
+			continue
+		}
+		for _, c := range cells {
+			if _, isNum := s.cell(c).(float64); isNum {
+				n++
+			}
+		}
+	}
+	return float64(n)
+}
+
+func minimum(s scope, args []expr) Value {
+	return extreme(s, args, func(a, b float64) bool { return a < b })
+}
+
+func maximum(s scope, args []expr) Value {
+	return extreme(s, args, func(a, b float64) bool { return a > b })
+}
+
+// extreme returns the number in the arguments that is `better` than every other, or 0
+// if there are none.
+func extreme(s scope, args []expr, better func(a, b float64) bool) Value {
+	nums, err := numbers(s, args)
+	if err != nil {
+		return err
+	}
+	if len(nums) == 0 {
+		return 0.0
+	}
+	result := nums[0]
+	for _, n := range nums[1:] {
+		if better(n, result) {
+			result = n
+		}
+	}
+	return result
+}
+
+// ifFunc returns its second argument if the first is true and its third, or FALSE if
+// there is none, otherwise. Only the chosen argument is evaluated.
+func ifFunc(s scope, args []expr) Value {
+	if len(args) < 2 || len(args) > 3 {
+		return ErrValue
+	}
+	cond, err := toBool(args[0].eval(s))
+	if err != nil {
+		return err
+	}
+	if cond {
+		return args[1].eval(s)
+	}
+	if len(args) == 3 {
+		return args[2].eval(s)
+	}
+	return false
+}
+
+// concat joins the text of its arguments, including every cell of ranges.
+func concat(s scope, args []expr) Value {
+	var text string
+	for _, arg := range args {
+		values := []Value{}
+		if cells, ok := referencedCells(arg); ok {
+			if cells == nil {
+				return ErrRef
+			}
+			for _, c := range cells {
+				values = append(values, s.cell(c))
+			}
+		} else {
+			values = append(values, arg.eval(s))
+		}
+		for _, v := range values {
+			t, err := toText(v)
+			if err != nil {
+				return err
+			}
+			text += t
+		}
+	}
+	return text
+}
+
+// referenceCount returns the number of cells referenced by the expression, counting
+// references to the same cell as many times as they appear, except the cells of ranges
+// that are too large, see precedents.
+func referenceCount(e expr) int {
+	n := 0
+	switch e := e.(type) {
+	case refExpr:
+		n = 1
+	case rangeExpr:
+		if size := e.r.size(); size <= MaxRangeCells {
+			n = size
+		}
+	case negExpr:
+		n = referenceCount(e.x)
+	case binaryExpr:
+		n = referenceCount(e.x) + referenceCount(e.y)
+	case callExpr:
+		for _, arg := range e.args {
+			n += referenceCount(arg)
+		}
+	}
+	return n
+}
+
+// precedents calls fn with every cell referenced by the expression, except the cells
+// of ranges that are too large, which evaluate to ErrRef.
+func precedents(e expr, fn func(c Cell)) {
+	switch e := e.(type) {
+	case refExpr:
+		fn(e.cell)
+	case rangeExpr:
+		if e.r.size() <= MaxRangeCells {
+			for _, c := range e.r.cells() {
+				fn(c)
+			}
+		}
+	case negExpr:
+		precedents(e.x, fn)
+	case binaryExpr:
+		precedents(e.x, fn)
+		precedents(e.y, fn)
+	case callExpr:
+		for _, arg := range e.args {
+			precedents(arg, fn)
+		}
+	}
+}
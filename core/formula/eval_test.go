@@ -0,0 +1,73 @@
+package formula
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cells is a scope with fixed cell contents, keyed by reference.
+type cells map[string]string
+
+func (c cells) cell(cell Cell) Value {
+	return literal(c[cell.String()])
+}
+
+func TestEval(t *testing.T) {
+	sheet := cells{
+		"A1": "10", "A2": "20", "A3": "", "A4": "apples", "A5": "-5",
+		"B1": "2.5", "B2": "TRUE", "B3": "0",
+	}
+
+	tests := []struct {
+		formula string
+		want    string
+	}{
+		{"=1+2*3", "7"},
+		{"=(1+2)*3", "9"},
+		{"=-A1+3", "-7"},
+		{"=0.1+0.2", "0.3"},
+		{"=A1/4", "2.5"},
+		{"=A1/B3", "#DIV/0!"},
+		{"=A1+A4", "#VALUE!"},
+		{"=A1+A3", "10"},
+		{`="Total: "&A1`, "Total: 10"},
+		{`=A4&" and "&B2`, "apples and TRUE"},
+		{"=SUM(A1:A5)", "25"},
+		{"=SUM(A1:A2, B1, 1)", "33.5"},
+		{"=AVERAGE(A1:A2)", "15"},
+		{"=AVERAGE(A3:A4)", "#DIV/0!"},
+		{"=COUNT(A1:B3)", "4"},
+		{"=MIN(A1:A5)", "-5"},
+		{"=MAX(A1:A5, 100)", "100"},
+		{"=MAX(A3)", "0"},
+		{`=IF(A1>A2, "more", "less")`, "less"},
+		{"=IF(B2, 1)", "1"},
+		{"=IF(B3, 1)", "FALSE"},
+		{`=IF(A4, 1, 2)`, "#VALUE!"},
+		{`=IF(A4="APPLES", 1, 2)`, "1"},
+		{"=A1<>A2", "TRUE"},
+		{`=CONCAT(A1:A2, "!")`, "1020!"},
+		{"=SUM(A1, A1/B3)", "#DIV/0!"},
+		{"=NOPE(A1)", "#NAME?"},
+		{"=nope", "#NAME?"},
+		{"=A1:A2", "#VALUE!"},
+		{"=SUM(A1:Z10000)", "#REF!"},
+		{"=1e3+1", "1001"},
+	}
+
+	for _, tt := range tests {
+		e, err := parse(tt.formula)
+		if !assert.NoError(t, err, "%s should parse", tt.formula) {
+			continue
+		}
+		assert.Equal(t, tt.want, Format(e.eval(sheet)), "%s", tt.formula)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, formula := range []string{"=", "=1+", "=(1", `="open`, "=SUM(A1", "=A1:", "=1 2", "=#"} {
+		_, err := parse(formula)
+		assert.Error(t, err, "%s should not parse", formula)
+	}
+}
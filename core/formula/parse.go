@@ -0,0 +1,315 @@
+package formula
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// tokenKind is the kind of a token of a formula.
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenName // a function name, reference, TRUE or FALSE
+	tokenOp
+	tokenLParen
+	tokenRParen
+	tokenComma
+	tokenColon
+	tokenError // an error value such as #REF!
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// lex splits a formula, without its leading "=", into tokens.
+func lex(src string) ([]token, error) {
+	tokens, _, err := lexSpans(src)
+	return tokens, err
+}
+
+// span is the position of a token in the source of a formula, from `start` (inclusive)
+// to `end` (exclusive).
+type span struct {
+	start, end int
+}
+
+// lexSpans splits a formula like lex, and also returns the position of each token.
+func lexSpans(src string) ([]token, []span, error) {
+	var tokens []token
+	var spans []span
+	for i := 0; i < len(src); {
+		c := src[i]
+		start, n := i, len(tokens)
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			// exponent, e.g. 1e3 or 1.5E-2
+			if j < len(src) && (src[j] == 'e' || src[j] == 'E') {
+				k := j + 1
+				if k < len(src) && (src[k] == '+' || src[k] == '-') {
+					k++
+				}
+				if k < len(src) && src[k] >= '0' && src[k] <= '9' {
+					for k < len(src) && src[k] >= '0' && src[k] <= '9' {
+						k++
+					}
+					j = k
+				}
+			}
+			tokens = append(tokens, token{tokenNumber, src[i:j]})
+			i = j
+		case c == '"':
+			var sb strings.Builder
+			j := i + 1
+			for {
+				if j >= len(src) {
+					return nil, nil, errors.New("unterminated string")
+				}
+				if src[j] == '"' {
+					// a doubled quote is a quote inside the string
+					if j+1 < len(src) && src[j+1] == '"' {
+						sb.WriteByte('"')
+						j += 2
+						continue
+					}
+					break
+				}
+				sb.WriteByte(src[j])
+				j++
+			}
+			tokens = append(tokens, token{tokenString, sb.String()})
+			i = j + 1
+		case isNameChar(c):
+			j := i
+			for j < len(src) && (isNameChar(src[j]) || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, token{tokenName, src[i:j]})
+			i = j
+		case c == '<' || c == '>':
+			j := i + 1
+			if j < len(src) && (src[j] == '=' || c == '<' && src[j] == '>') {
+				j++
+			}
+			tokens = append(tokens, token{tokenOp, src[i:j]})
+			i = j
+		case strings.IndexByte("+-*/&=", c) >= 0:
+			tokens = append(tokens, token{tokenOp, string(c)})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")"})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, ","})
+			i++
+		case c == ':':
+			tokens = append(tokens, token{tokenColon, ":"})
+			i++
+		case c == '#' && strings.HasPrefix(src[i:], string(ErrRef)):
+			// references to deleted columns are replaced with #REF!, see MoveColumns
+			tokens = append(tokens, token{tokenError, string(ErrRef)})
+			i += len(ErrRef)
+		default:
+			return nil, nil, fmt.Errorf("unexpected character %q", c)
+		}
+		if len(tokens) > n {
+			spans = append(spans, span{start, i})
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), append(spans, span{len(src), len(src)}), nil
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '_' || c == '$'
+}
+
+// parser is a recursive descent parser of formulas. From the lowest to the highest
+// precedence, expressions are comparisons, concatenations, sums, products, signs and
+// operands.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parse parses a formula, with or without its leading "=".
+func parse(formula string) (expr, error) {
+	tokens, err := lex(strings.TrimPrefix(formula, "="))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	e, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	return e, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// binary parses a left associative chain of the operators `ops` between operands
+// parsed by `operand`.
+func (p *parser) binary(operand func() (expr, error), ops ...string) (expr, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokenOp || !slices.Contains(ops, t.text) {
+			return x, nil
+		}
+		p.next()
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op: t.text, x: x, y: y}
+	}
+}
+
+func (p *parser) comparison() (expr, error) {
+	return p.binary(p.concat, "=", "<>", "<", ">", "<=", ">=")
+}
+
+func (p *parser) concat() (expr, error) {
+	return p.binary(p.sum, "&")
+}
+
+func (p *parser) sum() (expr, error) {
+	return p.binary(p.product, "+", "-")
+}
+
+func (p *parser) product() (expr, error) {
+	return p.binary(p.sign, "*", "/")
+}
+
+func (p *parser) sign() (expr, error) {
+	if t := p.peek(); t.kind == tokenOp && (t.text == "-" || t.text == "+") {
+		p.next()
+		x, err := p.sign()
+		if err != nil {
+			return nil, err
+		}
+		if t.text == "+" {
+			return x, nil
+		}
+		return negExpr{x: x}, nil
+	}
+	return p.operand()
+}
+
+func (p *parser) operand() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return valueExpr{n}, nil
+	case tokenString:
+		return valueExpr{t.text}, nil
+	case tokenError:
+		return valueExpr{Error(t.text)}, nil
+	case tokenLParen:
+		x, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokenRParen {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		return x, nil
+	case tokenName:
+		return p.name(t.text)
+	case tokenEOF:
+		return nil, errors.New("unexpected end of formula")
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+// name parses an operand that starts with a name, i.e. a function call, a reference,
+// a range or a boolean. Unknown names evaluate to ErrName.
+func (p *parser) name(name string) (expr, error) {
+	if p.peek().kind == tokenLParen {
+		p.next()
+		return p.call(strings.ToUpper(name))
+	}
+
+	if cell, ok := ParseRef(name); ok {
+		if p.peek().kind != tokenColon {
+			return refExpr{cell}, nil
+		}
+		p.next()
+		t := p.next()
+		to, ok := ParseRef(t.text)
+		if t.kind != tokenName || !ok {
+			return nil, fmt.Errorf("invalid range end %q", t.text)
+		}
+		return rangeExpr{newRange(cell, to)}, nil
+	}
+
+	switch strings.ToUpper(name) {
+	case "TRUE":
+		return valueExpr{true}, nil
+	case "FALSE":
+		return valueExpr{false}, nil
+	}
+	return valueExpr{ErrName}, nil
+}
+
+// call parses the arguments of a call to the function `name`, after its opening
+// parenthesis.
+func (p *parser) call(name string) (expr, error) {
+	var args []expr
+	if p.peek().kind == tokenRParen {
+		p.next()
+		return callExpr{name: name, args: args}, nil
+	}
+	for {
+		arg, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		switch p.next().kind {
+		case tokenComma:
+		case tokenRParen:
+			return callExpr{name: name, args: args}, nil
+		default:
+			return nil, fmt.Errorf("missing closing parenthesis of %s", name)
+		}
+	}
+}
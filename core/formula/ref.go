@@ -0,0 +1,92 @@
+package formula
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxRangeCells is the largest number of cells a range may cover. Formulas with larger
+// ranges evaluate to ErrRef.
+const MaxRangeCells = 100_000
+
+// MaxFormulaCells is the largest number of cells a formula may reference, counting every
+// cell of its ranges, and MaxSheetCells the largest number of cells the formulas of a
+// sheet may reference together. Formulas referencing more cells evaluate to ErrRef, so
+// that the cells a sheet keeps track of are bounded.
+const (
+	MaxFormulaCells = 100_000
+	MaxSheetCells   = 1_000_000
+)
+
+// refPattern matches a cell reference such as B3 or $B$3. Columns have at most 3 letters.
+var refPattern = regexp.MustCompile(`^\$?([A-Za-z]{1,3})\$?([0-9]{1,7})$`)
+
+// Cell is the position of a cell. Rows are counted the same way as in the collab
+// store, i.e. row 0 holds the column headers, so the reference A1 is row 1, column 0.
+type Cell struct {
+	Row int
+	Col int
+}
+
+// ParseRef parses a cell reference such as B3. It reports false if `ref` is not one.
+func ParseRef(ref string) (Cell, bool) {
+	m := refPattern.FindStringSubmatch(ref)
+	if m == nil {
+		return Cell{}, false
+	}
+	row, err := strconv.Atoi(m[2])
+	if err != nil || row == 0 {
+		return Cell{}, false
+	}
+
+	col := 0
+	for _, letter := range strings.ToUpper(m[1]) {
+		col = col*26 + int(letter-'A') + 1
+	}
+	return Cell{Row: row, Col: col - 1}, true
+}
+
+// String returns the reference of the cell, e.g. B3.
+func (c Cell) String() string {
+	return columnLetters(c.Col) + strconv.Itoa(c.Row)
+}
+
+// columnLetters returns the letters of a column in references, e.g. B for column 1.
+func columnLetters(col int) string {
+	var letters []byte
+	for col := col + 1; col > 0; col = (col - 1) / 26 {
+		letters = append([]byte{byte('A' + (col-1)%26)}, letters...)
+	}
+	return string(letters)
+}
+
+// cellRange is a rectangular range of cells, from its top left to its bottom right cell.
+type cellRange struct {
+	from Cell
+	to   Cell
+}
+
+// newRange returns the range between two opposite corners.
+func newRange(a, b Cell) cellRange {
+	return cellRange{
+		from: Cell{Row: min(a.Row, b.Row), Col: min(a.Col, b.Col)},
+		to:   Cell{Row: max(a.Row, b.Row), Col: max(a.Col, b.Col)},
+	}
+}
+
+// size returns the number of cells in the range.
+func (r cellRange) size() int {
+	return (r.to.Row - r.from.Row + 1) * (r.to.Col - r.from.Col + 1)
+}
+
+// cells returns the cells of the range, row by row.
+func (r cellRange) cells() []Cell {
+	cells := make([]Cell, 0, r.size())
+	for row := r.from.Row; row <= r.to.Row; row++ {
+		for col := r.from.Col; col <= r.to.Col; col++ {
+			cells = append(cells, Cell{Row: row, Col: col})
+		}
+	}
+	return cells
+}
@@ -0,0 +1,38 @@
+package formula
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want Cell
+		ok   bool
+	}{
+		{"A1", Cell{Row: 1, Col: 0}, true},
+		{"b3", Cell{Row: 3, Col: 1}, true},
+		{"$Z$10", Cell{Row: 10, Col: 25}, true},
+		{"AA2", Cell{Row: 2, Col: 26}, true},
+		{"A0", Cell{}, false},
+		{"A", Cell{}, false},
+		{"SUM", Cell{}, false},
+		{"ABCD1", Cell{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseRef(tt.ref)
+		assert.Equal(t, tt.ok, ok, "ParseRef(%q)", tt.ref)
+		assert.Equal(t, tt.want, got, "ParseRef(%q)", tt.ref)
+	}
+}
+
+func TestCellString(t *testing.T) {
+	for _, ref := range []string{"A1", "Z9", "AA10", "AZ3", "BA7", "ZZ1", "AAA4"} {
+		cell, ok := ParseRef(ref)
+		assert.True(t, ok)
+		assert.Equal(t, ref, cell.String(), "references should round trip")
+	}
+}
@@ -0,0 +1,273 @@
+package formula
+
+import "sync"
+
+// Lookup returns the contents of the given cells, as they are stored. Cells that are
+// missing from the result are blank.
+type Lookup func(cells []Cell) (map[Cell]string, error)
+
+// formulaCell is a cell holding a formula.
+type formulaCell struct {
+	expr       expr // nil if the formula cannot be parsed
+	precedents []Cell
+}
+
+// Sheet keeps the formulas of a sheet, the cells each of them references and their
+// current values. It only holds formula cells, and the contents of other cells are
+// looked up when they are needed. A Sheet is safe for concurrent use.
+type Sheet struct {
+	update     sync.Mutex // held by Update while it looks cells up, see Update
+	mu         sync.Mutex
+	formulas   map[Cell]formulaCell
+	dependents map[Cell]map[Cell]bool // formulas referencing each cell
+	references int                    // number of cells referenced by the formulas, see MaxSheetCells
+	values     map[Cell]Value
+}
+
+// NewSheet returns a sheet without formulas.
+func NewSheet() *Sheet {
+	return &Sheet{
+		formulas:   make(map[Cell]formulaCell),
+		dependents: make(map[Cell]map[Cell]bool),
+		values:     make(map[Cell]Value),
+	}
+}
+
+// Load adds the formulas among `contents` to the sheet and computes their values.
+func (s *Sheet) Load(contents map[Cell]string, lookup Lookup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dirty := make(map[Cell]bool)
+	for cell, raw := range contents {
+		if IsFormula(raw) {
+			s.set(cell, raw)
+			dirty[cell] = true
+		}
+	}
+	_, err := s.recalculate(dirty, nil, lookup)
+	return err
+}
+
+// Update records the new contents of a cell and recomputes the formulas affected by it,
+// i.e. the cell itself if it holds a formula and every formula that depends on it,
+// directly or not. It returns the values of the formulas that changed, always
+// including the cell itself if it holds a formula.
+//
+// The cells the affected formulas reference are looked up without locking the sheet, so
+// that its values can be read meanwhile. Updates are still made one at a time.
+func (s *Sheet) Update(cell Cell, raw string, lookup Lookup) (map[Cell]string, error) {
+	s.update.Lock()
+	defer s.update.Unlock()
+
+	s.mu.Lock()
+	s.set(cell, raw)
+
+	dirty := make(map[Cell]bool)
+	queue := []Cell{cell}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		for dependent := range s.dependents[c] {
+			if !dirty[dependent] {
+				dirty[dependent] = true
+				queue = append(queue, dependent)
+			}
+		}
+	}
+	if _, ok := s.formulas[cell]; ok {
+		dirty[cell] = true
+	}
+
+	old := make(map[Cell]string, len(dirty))
+	for c := range dirty {
+		if v, ok := s.values[c]; ok {
+			old[c] = Format(v)
+		}
+	}
+
+	// the edited cell is looked up from `raw`, in case the lookup is not up to date yet
+	known := map[Cell]string{cell: raw}
+	missing := s.missing(dirty, known)
+	s.mu.Unlock()
+
+	contents, err := lookupContents(missing, known, lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := s.evaluate(dirty, contents)
+	changed := make(map[Cell]string)
+	for c, v := range values {
+		if prev, ok := old[c]; !ok || prev != v || c == cell {
+			changed[c] = v
+		}
+	}
+	return changed, nil
+}
+
+// Values returns the current values of every formula of the sheet.
+func (s *Sheet) Values() map[Cell]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := make(map[Cell]string, len(s.values))
+	for c, v := range s.values {
+		values[c] = Format(v)
+	}
+	return values
+}
+
+// set records the contents of a cell, updating the cells it references. Formulas that
+// reference too many cells, see MaxFormulaCells, are kept as ErrRef without references.
+func (s *Sheet) set(cell Cell, raw string) {
+	if old, ok := s.formulas[cell]; ok {
+		s.references -= len(old.precedents)
+		for _, p := range old.precedents {
+			delete(s.dependents[p], cell)
+			if len(s.dependents[p]) == 0 {
+				delete(s.dependents, p)
+			}
+		}
+		delete(s.formulas, cell)
+		delete(s.values, cell)
+	}
+	if !IsFormula(raw) {
+		return
+	}
+
+	f := formulaCell{}
+	if e, err := parse(raw); err == nil {
+		if n := referenceCount(e); n > MaxFormulaCells || s.references+n > MaxSheetCells {
+			s.formulas[cell] = formulaCell{expr: valueExpr{v: ErrRef}}
+			return
+		}
+		f.expr = e
+		seen := make(map[Cell]bool)
+		precedents(e, func(p Cell) {
+			if !seen[p] {
+				seen[p] = true
+				f.precedents = append(f.precedents, p)
+			}
+		})
+	}
+	for _, p := range f.precedents {
+		if s.dependents[p] == nil {
+			s.dependents[p] = make(map[Cell]bool)
+		}
+		s.dependents[p][cell] = true
+	}
+	s.references += len(f.precedents)
+	s.formulas[cell] = f
+}
+
+// recalculate computes the values of the `dirty` formulas and returns them. The
+// contents of the other cells they reference are taken from `known`, or looked up.
+func (s *Sheet) recalculate(dirty map[Cell]bool, known map[Cell]string, lookup Lookup) (map[Cell]string, error) {
+	contents, err := lookupContents(s.missing(dirty, known), known, lookup)
+	if err != nil {
+		return nil, err
+	}
+	return s.evaluate(dirty, contents), nil
+}
+
+// missing returns the cells referenced by the `dirty` formulas whose contents are
+// neither `known` nor formulas, and must be looked up.
+func (s *Sheet) missing(dirty map[Cell]bool, known map[Cell]string) []Cell {
+	var missing []Cell
+	seen := make(map[Cell]bool)
+	for c := range dirty {
+		for _, p := range s.formulas[c].precedents {
+			_, isFormula := s.formulas[p]
+			_, isKnown := known[p]
+			if !isFormula && !isKnown && !seen[p] {
+				seen[p] = true
+				missing = append(missing, p)
+			}
+		}
+	}
+	return missing
+}
+
+// lookupContents looks the `missing` cells up and returns their contents along with the
+// `known` ones.
+func lookupContents(missing []Cell, known map[Cell]string, lookup Lookup) (map[Cell]string, error) {
+	contents := make(map[Cell]string, len(missing)+len(known))
+	if len(missing) > 0 {
+		found, err := lookup(missing)
+		if err != nil {
+			return nil, err
+		}
+		for c, raw := range found {
+			contents[c] = raw
+		}
+	}
+	for c, raw := range known {
+		contents[c] = raw
+	}
+	return contents, nil
+}
+
+// evaluate computes the values of the `dirty` formulas from the `contents` of the cells
+// they reference, and returns them.
+func (s *Sheet) evaluate(dirty map[Cell]bool, contents map[Cell]string) map[Cell]string {
+	ev := &evaluation{sheet: s, contents: contents, dirty: dirty, state: make(map[Cell]evalState)}
+	values := make(map[Cell]string, len(dirty))
+	for c := range dirty {
+		values[c] = Format(ev.evalCell(c))
+	}
+	return values
+}
+
+type evalState int
+
+const (
+	evaluating evalState = iota + 1
+	evaluated
+)
+
+// evaluation is the scope formulas are evaluated in by recalculate. Dirty formulas are
+// evaluated the first time they are referenced, and other formulas keep their value.
+type evaluation struct {
+	sheet    *Sheet
+	contents map[Cell]string
+	dirty    map[Cell]bool
+	state    map[Cell]evalState
+}
+
+func (ev *evaluation) cell(c Cell) Value {
+	if _, ok := ev.sheet.formulas[c]; !ok {
+		return literal(ev.contents[c])
+	}
+	if ev.dirty[c] {
+		return ev.evalCell(c)
+	}
+	return ev.sheet.values[c]
+}
+
+// evalCell evaluates the dirty formula in cell `c` and stores its value. A formula that
+// is referenced while it is being evaluated depends on itself, and is an ErrCycle.
+func (ev *evaluation) evalCell(c Cell) Value {
+	switch ev.state[c] {
+	case evaluating:
+		return ErrCycle
+	case evaluated:
+		return ev.sheet.values[c]
+	}
+
+	ev.state[c] = evaluating
+	var v Value = ErrParse
+	if e := ev.sheet.formulas[c].expr; e != nil {
+		v = e.eval(ev)
+	}
+	// a formula that is a reference to a blank cell is 0, as in other spreadsheets
+	if v == nil {
+		v = 0.0
+	}
+	ev.state[c] = evaluated
+	ev.sheet.values[c] = v
+	return v
+}
@@ -0,0 +1,157 @@
+package formula
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// store is the contents of a sheet, keyed by reference, that formulas are looked up in.
+type store map[string]string
+
+func (s store) lookup(cells []Cell) (map[Cell]string, error) {
+	found := make(map[Cell]string)
+	for _, c := range cells {
+		if raw, ok := s[c.String()]; ok {
+			found[c] = raw
+		}
+	}
+	return found, nil
+}
+
+// edit sets a cell of the store and updates the sheet, like an edit to a live sheet.
+func (s store) edit(t *testing.T, sheet *Sheet, ref, raw string) map[string]string {
+	t.Helper()
+	cell, _ := ParseRef(ref)
+	s[ref] = raw
+	changed, err := sheet.Update(cell, raw, s.lookup)
+	assert.NoError(t, err)
+	return byRef(changed)
+}
+
+func byRef(values map[Cell]string) map[string]string {
+	refs := make(map[string]string, len(values))
+	for c, v := range values {
+		refs[c.String()] = v
+	}
+	return refs
+}
+
+func load(t *testing.T, s store) *Sheet {
+	t.Helper()
+	contents := make(map[Cell]string)
+	for ref, raw := range s {
+		cell, _ := ParseRef(ref)
+		contents[cell] = raw
+	}
+	sheet := NewSheet()
+	assert.NoError(t, sheet.Load(contents, s.lookup))
+	return sheet
+}
+
+func TestSheetLoad(t *testing.T) {
+	s := store{"A1": "1", "A2": "2", "A3": "=SUM(A1:A2)", "A4": "=A3*10", "A5": "=A1+"}
+	sheet := load(t, s)
+
+	assert.Equal(t, map[string]string{"A3": "3", "A4": "30", "A5": "#ERROR!"}, byRef(sheet.Values()))
+}
+
+func TestSheetUpdate(t *testing.T) {
+	s := store{"A1": "1", "A2": "2", "A3": "=SUM(A1:A2)", "A4": "=A3*10", "B1": "=A2", "C1": "unrelated"}
+	sheet := load(t, s)
+
+	t.Run("recomputes only the affected formulas", func(t *testing.T) {
+		changed := s.edit(t, sheet, "A1", "5")
+		assert.Equal(t, map[string]string{"A3": "7", "A4": "70"}, changed)
+	})
+
+	t.Run("edits outside references recompute nothing", func(t *testing.T) {
+		assert.Empty(t, s.edit(t, sheet, "C1", "still unrelated"))
+	})
+
+	t.Run("unchanged values are not reported", func(t *testing.T) {
+		changed := s.edit(t, sheet, "A2", "2")
+		assert.Empty(t, changed)
+	})
+
+	t.Run("new formulas are computed and tracked", func(t *testing.T) {
+		changed := s.edit(t, sheet, "C2", "=A4+B1")
+		assert.Equal(t, map[string]string{"C2": "72"}, changed)
+
+		changed = s.edit(t, sheet, "A2", "3")
+		assert.Equal(t, map[string]string{"A3": "8", "A4": "80", "B1": "3", "C2": "83"}, changed)
+	})
+
+	t.Run("replacing a formula stops tracking its references", func(t *testing.T) {
+		s.edit(t, sheet, "C2", "plain")
+		changed := s.edit(t, sheet, "A2", "4")
+		assert.NotContains(t, changed, "C2")
+		assert.NotContains(t, byRef(sheet.Values()), "C2")
+	})
+}
+
+func TestSheetCycles(t *testing.T) {
+	s := store{"A1": "1", "B1": "=A1+1", "C1": "=B1*2"}
+	sheet := load(t, s)
+
+	changed := s.edit(t, sheet, "A1", "=C1")
+	assert.Equal(t, map[string]string{"A1": "#CYCLE!", "B1": "#CYCLE!", "C1": "#CYCLE!"}, changed)
+
+	changed = s.edit(t, sheet, "A1", "2")
+	assert.Equal(t, map[string]string{"B1": "3", "C1": "6"}, changed, "breaking the cycle should restore the values")
+
+	changed = s.edit(t, sheet, "D1", "=D1+1")
+	assert.Equal(t, map[string]string{"D1": "#CYCLE!"}, changed, "formulas referencing themselves are cycles")
+}
+
+func TestSheetReferenceLimits(t *testing.T) {
+	s := store{"A1": "1", "B1": "2"}
+	sheet := load(t, s)
+
+	changed := s.edit(t, sheet, "C1", "=SUM(A1:A60000)+SUM(B1:B60000)")
+	assert.Equal(t, map[string]string{"C1": "#REF!"}, changed, "formulas referencing too many cells should be #REF!")
+	assert.Empty(t, sheet.dependents, "formulas referencing too many cells should not be tracked")
+	assert.Zero(t, sheet.references)
+
+	changed = s.edit(t, sheet, "C1", "=A1+B1")
+	assert.Equal(t, map[string]string{"C1": "3"}, changed)
+	assert.Equal(t, 2, sheet.references)
+
+	sheet.references = MaxSheetCells - 1
+	changed = s.edit(t, sheet, "C2", "=A1+B1")
+	assert.Equal(t, map[string]string{"C2": "#REF!"}, changed, "formulas beyond the limit of the sheet should be #REF!")
+	assert.Len(t, sheet.dependents[Cell{Row: 1, Col: 0}], 1, "formulas beyond the limit of the sheet should not be tracked")
+
+	s.edit(t, sheet, "C1", "plain")
+	assert.Equal(t, MaxSheetCells-3, sheet.references, "replaced formulas should free their references")
+}
+
+func TestSheetLookupError(t *testing.T) {
+	sheet := NewSheet()
+	cell, _ := ParseRef("A2")
+	_, err := sheet.Update(cell, "=A1", func([]Cell) (map[Cell]string, error) {
+		return nil, errors.New("store unavailable")
+	})
+	assert.Error(t, err)
+}
+
+func TestSheetValuesDuringLookup(t *testing.T) {
+	s := store{"A1": "1", "B1": "=A1*2"}
+	sheet := load(t, s)
+
+	cell, _ := ParseRef("C1")
+	_, err := sheet.Update(cell, "=A1+B1", func(cells []Cell) (map[Cell]string, error) {
+		read := make(chan map[Cell]string)
+		go func() { read <- sheet.Values() }()
+		select {
+		case values := <-read:
+			assert.Equal(t, map[string]string{"B1": "2"}, byRef(values))
+		case <-time.After(time.Second):
+			t.Error("values should be readable while cells are looked up")
+		}
+		return s.lookup(cells)
+	})
+	assert.NoError(t, err)
+}
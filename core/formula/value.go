@@ -0,0 +1,221 @@
+// Package formula evaluates the formulas of spreadsheet cells, i.e. cells whose
+// content starts with "=", and keeps track of the cells each formula depends on so
+// that an edit only recomputes the formulas it affects.
+//
+// The language supports numbers, strings in double quotes, TRUE and FALSE, cell
+// references such as B3 and ranges such as A1:B10, the operators + - * / & and the
+// comparisons = <> < > <= >=, and the functions listed in functions. Problems are
+// reported with spreadsheet-style error values such as #DIV/0! rather than failing.
+package formula
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Value is the value of an expression or a cell. It is nil for blank cells, or a
+// float64, string, bool or Error.
+type Value any
+
+// Error is an error value, which is propagated by every operation it is used in.
+type Error string
+
+const (
+	ErrDiv0  Error = "#DIV/0!" // division by zero
+	ErrValue Error = "#VALUE!" // value of the wrong type
+	ErrRef   Error = "#REF!"   // invalid reference, e.g. a range that is too large
+	ErrName  Error = "#NAME?"  // unknown function or name
+	ErrNum   Error = "#NUM!"   // result that is not a finite number
+	ErrParse Error = "#ERROR!" // formula that cannot be parsed
+	ErrCycle Error = "#CYCLE!" // formula that depends on itself
+)
+
+// numberPattern matches the cell contents that are numbers.
+var numberPattern = regexp.MustCompile(`^[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
+
+// IsFormula reports whether the content of a cell is a formula.
+func IsFormula(raw string) bool {
+	return strings.HasPrefix(raw, "=")
+}
+
+// literal returns the value of the content of a cell that is not a formula.
+func literal(raw string) Value {
+	if raw == "" {
+		return nil
+	}
+	if numberPattern.MatchString(raw) {
+		if n, err := strconv.ParseFloat(raw, 64); err == nil {
+			return n
+		}
+	}
+	switch strings.ToUpper(raw) {
+	case "TRUE":
+		return true
+	case "FALSE":
+		return false
+	}
+	return raw
+}
+
+// Format returns the text a value is displayed as.
+func Format(v Value) string {
+	switch v := v.(type) {
+	case float64:
+		return formatNumber(v)
+	case string:
+		return v
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case Error:
+		return string(v)
+	default:
+		return ""
+	}
+}
+
+// formatNumber formats a number with at most 15 significant digits, as spreadsheets
+// do, so that e.g. 0.1+0.2 is displayed as 0.3.
+func formatNumber(n float64) string {
+	n, _ = strconv.ParseFloat(strconv.FormatFloat(n, 'g', 15, 64), 64)
+	if n == 0 {
+		return "0" // no negative zero
+	}
+	if math.Abs(n) >= 1e21 {
+		return strconv.FormatFloat(n, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// toNumber coerces a value to a number. Blank is 0, booleans are 1 and 0 and strings
+// must be numbers.
+func toNumber(v Value) (float64, Value) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		if n, ok := literal(strings.TrimSpace(v)).(float64); ok {
+			return n, nil
+		}
+		return 0, ErrValue
+	case Error:
+		return 0, v
+	}
+	return 0, ErrValue
+}
+
+// toText coerces a value to text.
+func toText(v Value) (string, Value) {
+	if err, ok := v.(Error); ok {
+		return "", err
+	}
+	return Format(v), nil
+}
+
+// toBool coerces a value to a boolean. Numbers are true unless they are 0, and
+// strings must be TRUE or FALSE.
+func toBool(v Value) (bool, Value) {
+	switch v := v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	case float64:
+		return v != 0, nil
+	case string:
+		switch strings.ToUpper(v) {
+		case "TRUE":
+			return true, nil
+		case "FALSE":
+			return false, nil
+		}
+		return false, ErrValue
+	case Error:
+		return false, v
+	}
+	return false, ErrValue
+}
+
+// number returns n, or ErrNum if it is not finite.
+func number(n float64) Value {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return ErrNum
+	}
+	return n
+}
+
+// compare compares two values that are not errors, returning -1, 0 or 1. Blank is
+// compared as the zero value of the other operand's type, strings are compared
+// regardless of case, and values of different types are ordered numbers first, then
+// strings, then booleans.
+func compare(a, b Value) int {
+	a, b = blankAs(a, b), blankAs(b, a)
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		return cmp(ra, rb)
+	}
+
+	switch a := a.(type) {
+	case float64:
+		return cmp(a, b.(float64))
+	case string:
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b.(string)))
+	case bool:
+		return cmp(boolRank(a), boolRank(b.(bool)))
+	}
+	return 0
+}
+
+// blankAs returns the zero value of the type of `other` if v is blank.
+func blankAs(v, other Value) Value {
+	if v != nil {
+		return v
+	}
+	switch other.(type) {
+	case string:
+		return ""
+	case bool:
+		return false
+	default:
+		return 0.0
+	}
+}
+
+func typeRank(v Value) int {
+	switch v.(type) {
+	case float64:
+		return 0
+	case string:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func cmp[T int | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
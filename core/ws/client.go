@@ -1,34 +1,84 @@
 package ws
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/waynekn/tablesync/core/collab"
 )
 
+// sessionEndedReason is the reason clients are disconnected with when they edit a sheet
+// whose editing session has ended, see collab.ErrNoSession.
+const sessionEndedReason = "This sheet is no longer open for editing."
+
 // Client represents a websocket connection to a spreadsheet.
 type Client struct {
+	ID          string
 	Conn        *websocket.Conn
 	SheetID     string
-	Send        chan collab.EditMsg
+	Send        chan collab.BroadCastMsg
 	collabStore *collab.Store
 	hub         *Hub
+	codec       codec
+	snapshot    SnapshotMode
+	role        collab.Role
+	columns     []collab.Column
+	rows        collab.RowOwnership
+	colNum      int
+	author      *collab.Author
+	viewports   chan viewport
+	replies     chan any
 	done        chan struct{}
 	closeOnce   sync.Once
 }
 
+// ClientOptions holds the per connection settings of a Client.
+type ClientOptions struct {
+	// Snapshot is how the initial sheet data is sent. Defaults to SnapshotFull.
+	Snapshot SnapshotMode
+	// Role is the access the connection has to the sheet. Defaults to collab.RoleViewer.
+	Role collab.Role
+	// Author is the user the connection belongs to, or nil for anonymous users.
+	Author *collab.Author
+	// Columns are the columns of the sheet, which edits are validated against and
+	// which are sent to the client. If nil, edits are not validated.
+	Columns []collab.Column
+	// Rows is the row ownership mode of the sheet. Connections with a role below
+	// collab.RoleManager can only edit their own rows when it is enabled.
+	Rows collab.RowOwnership
+}
+
 // NewClient instantiates and returns a new Client
-func NewClient(sheetID string, colNum int, conn *websocket.Conn, collabStore *collab.Store, hub *Hub) *Client {
+func NewClient(sheetID string, colNum int, conn *websocket.Conn, collabStore *collab.Store, hub *Hub, opts ClientOptions) *Client {
+	if !opts.Snapshot.Valid() {
+		opts.Snapshot = SnapshotFull
+	}
+	if opts.Role == "" {
+		opts.Role = collab.RoleViewer
+	}
+
 	client := &Client{
+		ID:          uuid.NewString(),
 		Conn:        conn,
 		SheetID:     sheetID,
-		Send:        make(chan collab.EditMsg, 50),
+		Send:        make(chan collab.BroadCastMsg, 50),
 		collabStore: collabStore,
 		hub:         hub,
+		codec:       codecFor(conn.Subprotocol()),
+		snapshot:    opts.Snapshot,
+		role:        opts.Role,
+		columns:     opts.Columns,
+		rows:        opts.Rows,
+		colNum:      colNum,
+		author:      opts.Author,
+		viewports:   make(chan viewport, 1),
+		replies:     make(chan any, 10),
 		done:        make(chan struct{}),
 		closeOnce:   sync.Once{},
 	}
@@ -38,9 +88,43 @@ func NewClient(sheetID string, colNum int, conn *websocket.Conn, collabStore *co
 	return client
 }
 
+// Sheet returns the ID of the sheet the client is editing.
+func (c *Client) Sheet() string {
+	return c.SheetID
+}
+
+// User returns the ID of the user the client belongs to, or an empty string for
+// anonymous users.
+func (c *Client) User() string {
+	if c.author == nil {
+		return ""
+	}
+	return c.author.ID
+}
+
+// Deliver queues a broadcasted edit to be written to the client. Clients that fell
+// behind, e.g. because their writer stopped, are disconnected rather than blocking the
+// hub.
+func (c *Client) Deliver(msg collab.BroadCastMsg) {
+	select {
+	case c.Send <- msg:
+	default:
+		slog.Warn("closing client that fell behind", "sheetID", c.SheetID)
+		c.Disconnect("Your connection fell behind the edits of the sheet, please reconnect.")
+	}
+}
+
+// Disconnect closes the connection with the given reason without blocking the caller.
+func (c *Client) Disconnect(reason string) {
+	go c.Close(reason)
+}
+
 // readEdits listens for incoming edits from the client.
-// It reads JSON messages from the websocket connection, applies them to Redis,
+// It reads messages from the websocket connection, applies them to Redis,
 // and broadcasts them to other clients connected to the same sheet.
+// Edits from clients whose role does not allow editing are rejected, and so are edits
+// whose value is not accepted by the column or that are made to rows the user may not
+// edit, see Client.applyEdit.
 func (c *Client) readEdits() {
 	defer func() {
 		c.hub.Unregister <- c
@@ -48,19 +132,43 @@ func (c *Client) readEdits() {
 	}()
 
 	for {
-		var edit collab.EditMsg
-		err := c.Conn.ReadJSON(&edit)
+		var msg clientMsg
+		err := c.readMsg(&msg)
 
 		if websocket.IsCloseError(err) {
 			break
 		}
 
 		if err != nil {
-			slog.Error("failed to read JSON", "err", err)
+			slog.Error("failed to read message", "err", err)
 			c.Close("The server was unable to read your edits")
 			break
 		}
 
+		switch msg.Type {
+		case "", msgTypeEdit:
+		case msgTypeViewport:
+			c.requestViewport(viewport{from: msg.From, to: msg.To})
+			continue
+		case msgTypeFormatCell, msgTypeFormatColumn:
+			if err := c.applyFormat(msg); err != nil {
+				slog.Error("error applying format", "err", err)
+				c.Close("Your changes couldn’t be saved due to a server error")
+				return
+			}
+			continue
+		default:
+			c.writeError("Unknown message type " + msg.Type)
+			continue
+		}
+
+		if !c.role.CanEdit() {
+			c.writeError("You have read-only access to this sheet.")
+			continue
+		}
+
+		edit := msg.EditMsg
+
 		// Add 1 to the row index to account for the offset caused by how data is handled:
 		// The server stores both the column headers and the sheet data in a single 2D array,
 		// with headers at index 0. However, the client separates headers from data — it
@@ -72,39 +180,172 @@ func (c *Client) readEdits() {
 			Data: edit.Data,
 		}
 
-		err = c.collabStore.ApplyEdit(c.SheetID, redisEdit)
+		err = c.edit(edit, redisEdit)
+		var cellErr *collab.CellError
+		if errors.As(err, &cellErr) {
+			c.reply(newRejectMsg(edit, cellErr))
+			continue
+		}
+		if errors.Is(err, collab.ErrNoSession) {
+			c.Close(sessionEndedReason)
+			break
+		}
 		if err != nil {
 			slog.Error("error applying edit", "err", err)
 			c.Close("Your changes couldn’t be saved due to a server error")
 			break
 		}
-		c.hub.Broadcast <- collab.BroadCastMsg{SheetID: c.SheetID, Edit: edit}
 	}
 }
 
-// writeEdits sends the initial sheet data to the client and listens for edits broadcasted
-// to the clients `Send` channel and sends them to the client.
+// edit applies an edit of the client, whose row is `redisEdit` in the collab store, and
+// broadcasts it along with the formulas it changes. The edits of the sheet are locked
+// meanwhile, see Hub.LockEdits.
+func (c *Client) edit(edit, redisEdit collab.EditMsg) error {
+	unlock := c.hub.LockEdits(c.SheetID)
+	defer unlock()
+	if c.closed() {
+		// e.g. disconnected because the columns changed, see Hub.ResetSheet
+		return collab.ErrNoSession
+	}
+
+	if err := c.applyEdit(redisEdit); err != nil {
+		return err
+	}
+	c.hub.Broadcast <- collab.BroadCastMsg{
+		SheetID:  c.SheetID,
+		SenderID: c.ID,
+		Author:   c.author,
+		Edit:     edit,
+	}
+
+	if err := c.hub.Recalculate(c.collabStore, c.SheetID, redisEdit); err != nil {
+		slog.Error("error recalculating formulas", "sheetID", c.SheetID, "err", err)
+	}
+	return nil
+}
+
+// applyEdit applies an edit to the collab store, see collab.Store.ApplyCellEdit. In row
+// ownership mode, the user must also be allowed to edit the row, see
+// collab.Store.ApplyRowEdit.
+func (c *Client) applyEdit(edit collab.EditMsg) error {
+	if !c.rows.Enabled {
+		return c.collabStore.ApplyCellEdit(c.SheetID, c.columns, edit)
+	}
+	claim := collab.RowClaim{
+		UserID:     c.User(),
+		ColNum:     c.colNum,
+		MaxRows:    c.rows.MaxRows,
+		Restricted: !c.role.AtLeast(collab.RoleManager),
+	}
+	return c.collabStore.ApplyRowEdit(c.SheetID, c.columns, claim, edit)
+}
+
+// applyFormat applies a formatCell or formatColumn message to the collab store and
+// broadcasts it to every client of the sheet, including this one. Formats go through
+// this path rather than the edits so that they never change the values of the sheet.
+//
+// Cells can be formatted by anyone who can edit them, i.e. only in the rows they own in
+// row ownership mode unless their role is at least collab.RoleManager, while columns can
+// only be formatted by the owner of the sheet. Rows after the last row of the sheet
+// cannot be formatted. Messages that are not allowed are answered with an error, and so
+// are formats that were not stored because the session ended or the columns of the sheet
+// are being changed. Only the other errors of the collab store are returned.
+func (c *Client) applyFormat(msg clientMsg) error {
+	if !c.role.CanEdit() {
+		c.writeError("You have read-only access to this sheet.")
+		return nil
+	}
+	if msg.Col < 0 || msg.Col >= c.colNum {
+		c.writeError(fmt.Sprintf("Column %d does not exist", msg.Col))
+		return nil
+	}
+	if err := msg.Format.Check(); err != nil {
+		c.writeError("Invalid format: " + err.Error())
+		return nil
+	}
+
+	// like edits, formats must not be stored once the client is disconnected
+	unlock := c.hub.LockEdits(c.SheetID)
+	defer unlock()
+	if c.closed() {
+		return nil
+	}
+
+	event := formatMsg{Type: msgTypeFormat, Col: msg.Col, Format: msg.Format, Author: c.author, ClientID: c.ID}
+	if msg.Type == msgTypeFormatColumn {
+		if c.role != collab.RoleOwner {
+			c.writeError("Only the owner of the sheet can format its columns.")
+			return nil
+		}
+		if err := c.collabStore.SetColumnFormat(c.SheetID, msg.Col, msg.Format); err != nil {
+			return c.formatError(err)
+		}
+	} else {
+		// rows are offset by the headers in the collab store, see readEdits
+		row := msg.Row + 1
+		exists := false
+		if msg.Row >= 0 {
+			var err error
+			if exists, err = hasRow(c.collabStore, c.SheetID, row, c.colNum); err != nil {
+				return err
+			}
+		}
+		if !exists {
+			c.writeError(fmt.Sprintf("Row %d does not exist", msg.Row))
+			return nil
+		}
+		if c.rows.Enabled && !c.role.AtLeast(collab.RoleManager) {
+			owner, err := c.collabStore.RowOwner(c.SheetID, row)
+			if err != nil {
+				return err
+			}
+			if owner == "" || owner != c.User() {
+				c.writeError("You can only format the rows you created")
+				return nil
+			}
+		}
+		if err := c.collabStore.SetCellFormat(c.SheetID, row, msg.Col, msg.Format); err != nil {
+			return c.formatError(err)
+		}
+		event.Row = &msg.Row
+	}
+
+	c.hub.Broadcast <- collab.BroadCastMsg{SheetID: c.SheetID, SenderID: c.ID, Author: c.author, Event: event}
+	return nil
+}
+
+// formatError answers the client with an error if its format was not stored because the
+// sheet has no session, and returns the other errors.
+func (c *Client) formatError(err error) error {
+	if errors.Is(err, collab.ErrNoSession) {
+		c.writeError("Your format couldn’t be saved as the sheet is not open for editing right now.")
+		return nil
+	}
+	return err
+}
+
+// writeEdits sends the initial sheet data, followed by the values of its formulas and its
+// formats, to the client and listens for edits broadcasted to the clients `Send` channel
+// and sends them to the client.
+// Edits made by the client itself are acknowledged instead of being echoed back.
+// Clients in viewport mode only receive the edits to rows in their current viewport.
 func (c *Client) writeEdits(colNum int) {
 	defer func() {
 		c.hub.Unregister <- c
 		c.Close("")
 	}()
 
-	// collect previous sheet data in redis and send it to the client
-	redisData, err := c.collabStore.GetRedisSheetData(c.SheetID)
-	if err != nil {
-		slog.Error("failed to retrieve sheet data", "sheetID", c.SheetID, "err", err)
-		c.Close("Could not retrieve sheet data.")
-		return
+	err := c.writeMsg(sessionMsg{Type: msgTypeSession, ClientID: c.ID, Role: c.role, Schema: c.columns})
+	if err == nil {
+		err = c.sendSnapshot(colNum)
 	}
-
-	sheetData, err := mapToMatrix(redisData, colNum)
-	if err != nil {
-		c.Close("Unable to initialize sheet data")
-		return
+	if err == nil {
+		err = c.sendComputedValues()
+	}
+	if err == nil {
+		err = c.sendFormats()
 	}
-
-	err = c.Conn.WriteJSON(sheetData)
 	if err != nil {
 		slog.Error("failed to send initial sheet data",
 			"sheetID", c.SheetID,
@@ -114,20 +355,106 @@ func (c *Client) writeEdits(colNum int) {
 		return
 	}
 
+	// viewport mode clients receive nothing until they subscribe to a viewport
+	var view *viewport
+	if c.snapshot == SnapshotViewport {
+		view = &viewport{}
+	}
+
 	for {
 		select {
-		case edit := <-c.Send:
-			err := c.Conn.WriteJSON(edit)
+		case broadcast := <-c.Send:
+			if broadcast.Event == nil && broadcast.SenderID != c.ID && !view.contains(broadcast.Edit.Row) {
+				continue
+			}
+			err := c.writeMsg(outgoingEdit(broadcast, c.ID))
 			if err != nil {
 				c.Close("We couldn't send changes to your browser, please refresh to reconnect.")
 				return
 			}
+		case reply := <-c.replies:
+			if err := c.writeMsg(reply); err != nil {
+				c.Close("We couldn't send changes to your browser, please refresh to reconnect.")
+				return
+			}
+		case v := <-c.viewports:
+			if err := c.sendViewport(v, colNum); err != nil {
+				slog.Error("failed to send viewport", "sheetID", c.SheetID, "err", err)
+				c.Close("The server was unable to send the sheet data")
+				return
+			}
+			view = &v
 		case <-c.done:
 			return
 		}
 	}
 }
 
+// requestViewport validates a viewport subscription and hands it to the writer.
+// A pending subscription that has not been sent yet is replaced by the new one.
+func (c *Client) requestViewport(v viewport) {
+	if c.snapshot != SnapshotViewport {
+		c.writeError("Viewport subscriptions require the viewport snapshot mode")
+		return
+	}
+	if err := v.validate(); err != nil {
+		c.writeError(err.Error())
+		return
+	}
+
+	for {
+		select {
+		case c.viewports <- v:
+			return
+		case <-c.viewports:
+		}
+	}
+}
+
+// reply queues a message for this client only. Replies are dropped if the client
+// is not reading its messages fast enough.
+func (c *Client) reply(msg any) {
+	select {
+	case c.replies <- msg:
+	default:
+		slog.Warn("dropping reply to slow client", "sheetID", c.SheetID)
+	}
+}
+
+// writeError sends an error message to the client.
+func (c *Client) writeError(message string) {
+	c.reply(errorMsg{Type: msgTypeError, Message: message})
+}
+
+// readMsg reads the next message from the connection and decodes it into v
+// using the client's codec.
+func (c *Client) readMsg(v any) error {
+	_, data, err := c.Conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return c.codec.unmarshal(data, v)
+}
+
+// writeMsg encodes v using the client's codec and writes it to the connection.
+func (c *Client) writeMsg(v any) error {
+	data, err := c.codec.marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Conn.WriteMessage(c.codec.messageType(), data)
+}
+
+// closed reports whether the client has been closed.
+func (c *Client) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
 // Close gracefully closes the websocket connection.
 // It sends a close message with an optional reason and ensures that the connection is closed only once
 func (c *Client) Close(reason string) {
@@ -0,0 +1,76 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// JSONSubprotocol is the websocket subprotocol for JSON encoded text frames.
+	// It is also the encoding used when a client does not request a subprotocol.
+	JSONSubprotocol = "tablesync.json"
+	// MsgpackSubprotocol is the websocket subprotocol for MessagePack encoded binary frames.
+	MsgpackSubprotocol = "tablesync.msgpack"
+)
+
+// Subprotocols lists the subprotocols supported by the server in order of preference.
+// It is meant to be passed to the websocket.Upgrader.
+var Subprotocols = []string{MsgpackSubprotocol, JSONSubprotocol}
+
+// codec encodes and decodes the messages exchanged with a client.
+type codec interface {
+	// messageType returns the websocket frame type the codec writes.
+	messageType() int
+	marshal(v any) ([]byte, error)
+	unmarshal(data []byte, v any) error
+}
+
+// codecFor returns the codec for the negotiated subprotocol, falling back to JSON.
+func codecFor(subprotocol string) codec {
+	if subprotocol == MsgpackSubprotocol {
+		return msgpackCodec{}
+	}
+	return jsonCodec{}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) messageType() int {
+	return websocket.TextMessage
+}
+
+func (jsonCodec) marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// msgpackCodec encodes messages as MessagePack. It reads the `json` struct tags
+// so that field names are the same in both encodings.
+type msgpackCodec struct{}
+
+func (msgpackCodec) messageType() int {
+	return websocket.BinaryMessage
+}
+
+func (msgpackCodec) marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
@@ -0,0 +1,84 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/waynekn/tablesync/core/collab"
+)
+
+func TestCodecFor(t *testing.T) {
+	assert.IsType(t, jsonCodec{}, codecFor(""), "should default to JSON when no subprotocol is negotiated")
+	assert.IsType(t, jsonCodec{}, codecFor(JSONSubprotocol))
+	assert.IsType(t, msgpackCodec{}, codecFor(MsgpackSubprotocol))
+
+	assert.Equal(t, websocket.TextMessage, jsonCodec{}.messageType())
+	assert.Equal(t, websocket.BinaryMessage, msgpackCodec{}.messageType())
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	codecs := map[string]codec{
+		"json":    jsonCodec{},
+		"msgpack": msgpackCodec{},
+	}
+
+	for name, cd := range codecs {
+		t.Run(name, func(t *testing.T) {
+			edit := collab.EditMsg{Row: 3, Col: 1, Data: "hello"}
+			data, err := cd.marshal(edit)
+			assert.NoError(t, err, "should encode an edit")
+
+			var gotEdit collab.EditMsg
+			assert.NoError(t, cd.unmarshal(data, &gotEdit), "should decode an edit")
+			assert.Equal(t, edit, gotEdit)
+
+			matrix := [][]string{{"name", "age"}, {"abc", "12"}}
+			data, err = cd.marshal(matrix)
+			assert.NoError(t, err, "should encode sheet data")
+
+			var gotMatrix [][]string
+			assert.NoError(t, cd.unmarshal(data, &gotMatrix), "should decode sheet data")
+			assert.Equal(t, matrix, gotMatrix)
+		})
+	}
+}
+
+func TestMsgpackCodecUsesJSONFieldNames(t *testing.T) {
+	data, err := msgpackCodec{}.marshal(collab.EditMsg{Row: 1, Col: 2, Data: "x"})
+	assert.NoError(t, err)
+
+	var fields map[string]any
+	assert.NoError(t, msgpackCodec{}.unmarshal(data, &fields))
+	assert.Contains(t, fields, "row")
+	assert.Contains(t, fields, "col")
+	assert.Contains(t, fields, "data")
+}
+
+func TestCodecDecodesClientMessages(t *testing.T) {
+	codecs := map[string]codec{
+		"json":    jsonCodec{},
+		"msgpack": msgpackCodec{},
+	}
+
+	for name, cd := range codecs {
+		t.Run(name, func(t *testing.T) {
+			data, err := cd.marshal(map[string]any{"row": 2, "col": 1, "data": "abc"})
+			assert.NoError(t, err)
+
+			var msg clientMsg
+			assert.NoError(t, cd.unmarshal(data, &msg), "should decode an edit without a type")
+			assert.Equal(t, "", msg.Type)
+			assert.Equal(t, collab.EditMsg{Row: 2, Col: 1, Data: "abc"}, msg.EditMsg)
+
+			data, err = cd.marshal(map[string]any{"type": msgTypeViewport, "from": 10, "to": 60})
+			assert.NoError(t, err)
+
+			msg = clientMsg{}
+			assert.NoError(t, cd.unmarshal(data, &msg), "should decode a viewport message")
+			assert.Equal(t, msgTypeViewport, msg.Type)
+			assert.Equal(t, 10, msg.From)
+			assert.Equal(t, 60, msg.To)
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package ws
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/waynekn/tablesync/core/collab"
+	"github.com/waynekn/tablesync/core/formula"
+)
+
+// formulaSheets keeps the formulas of the sheets that have subscribers, see
+// formula.Sheet. The formulas of a sheet are loaded from the collab store the first
+// time they are needed and are dropped once the sheet has no subscribers left.
+type formulaSheets struct {
+	mu     sync.Mutex
+	sheets map[string]*formulaEntry
+}
+
+// formulaEntry loads the formulas of a sheet once, even if they are requested by many
+// subscribers at the same time.
+type formulaEntry struct {
+	once  sync.Once
+	sheet *formula.Sheet
+	err   error
+}
+
+func newFormulaSheets() *formulaSheets {
+	return &formulaSheets{sheets: make(map[string]*formulaEntry)}
+}
+
+// get returns the formulas of the sheet, loading them if needed.
+func (f *formulaSheets) get(store *collab.Store, sheetID string) (*formula.Sheet, error) {
+	return f.load(store, sheetID, true)
+}
+
+// getLoaded returns the formulas of the sheet if they have been requested before and
+// not dropped since, and nil otherwise.
+func (f *formulaSheets) getLoaded(store *collab.Store, sheetID string) (*formula.Sheet, error) {
+	return f.load(store, sheetID, false)
+}
+
+// load returns the formulas of the sheet, waiting for them to be loaded. Formulas that
+// have not been requested are only loaded if `create` is set.
+func (f *formulaSheets) load(store *collab.Store, sheetID string, create bool) (*formula.Sheet, error) {
+	f.mu.Lock()
+	entry, ok := f.sheets[sheetID]
+	if !ok {
+		if !create {
+			f.mu.Unlock()
+			return nil, nil
+		}
+		entry = &formulaEntry{}
+		f.sheets[sheetID] = entry
+	}
+	f.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.sheet, entry.err = loadFormulas(store, sheetID)
+	})
+	if entry.err != nil {
+		// let the next call try again
+		f.mu.Lock()
+		if f.sheets[sheetID] == entry {
+			delete(f.sheets, sheetID)
+		}
+		f.mu.Unlock()
+		return nil, entry.err
+	}
+	return entry.sheet, nil
+}
+
+// drop forgets the formulas of the sheet.
+func (f *formulaSheets) drop(sheetID string) {
+	f.mu.Lock()
+	delete(f.sheets, sheetID)
+	f.mu.Unlock()
+}
+
+// loadFormulas reads the formulas of a sheet from the collab store and computes them.
+func loadFormulas(store *collab.Store, sheetID string) (*formula.Sheet, error) {
+	contents := make(map[formula.Cell]string)
+	err := store.ScanSheetData(sheetID, snapshotChunkSize, func(data map[string]string) error {
+		for key, val := range data {
+			if !formula.IsFormula(val) {
+				continue
+			}
+			row, col, err := coordsFromString(key)
+			if err != nil {
+				return err
+			}
+			// headers are never formulas
+			if row > 0 {
+				contents[formula.Cell{Row: row, Col: col}] = val
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sheet := formula.NewSheet()
+	if err := sheet.Load(contents, cellLookup(store, sheetID)); err != nil {
+		return nil, err
+	}
+	return sheet, nil
+}
+
+// cellLookup returns a formula.Lookup reading the cells of a sheet from the collab store.
+func cellLookup(store *collab.Store, sheetID string) formula.Lookup {
+	return func(cells []formula.Cell) (map[formula.Cell]string, error) {
+		keys := make([]string, len(cells))
+		for i, c := range cells {
+			keys[i] = fmt.Sprintf("%d:%d", c.Row, c.Col)
+		}
+		found, err := store.GetCells(sheetID, keys)
+		if err != nil {
+			return nil, err
+		}
+		contents := make(map[formula.Cell]string, len(found))
+		for i, c := range cells {
+			if raw, ok := found[keys[i]]; ok {
+				contents[c] = raw
+			}
+		}
+		return contents, nil
+	}
+}
+
+// computedCells returns the values of formula cells as cells of a computedMsg, in
+// the order of the sheet.
+func computedCells(values map[formula.Cell]string) []cell {
+	cells := make([]cell, 0, len(values))
+	for c, v := range values {
+		cells = append(cells, cell{Row: c.Row - 1, Col: c.Col, Data: v})
+	}
+	slices.SortFunc(cells, func(a, b cell) int {
+		return cmp.Or(cmp.Compare(a.Row, b.Row), cmp.Compare(a.Col, b.Col))
+	})
+	return cells
+}
+
+// editLocks make the edits of each sheet one after the other, see Hub.LockEdits.
+type editLocks struct {
+	mu    sync.Mutex
+	locks map[string]*editLock
+}
+
+// editLock is the lock of a sheet, kept while anyone holds it or waits for it.
+type editLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newEditLocks() *editLocks {
+	return &editLocks{locks: make(map[string]*editLock)}
+}
+
+// lock locks the edits of the sheet and returns the function unlocking them.
+func (l *editLocks) lock(sheetID string) func() {
+	l.mu.Lock()
+	lock, ok := l.locks[sheetID]
+	if !ok {
+		lock = &editLock{}
+		l.locks[sheetID] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, sheetID)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// LockEdits locks the edits of the sheet until the returned function is called. Edits
+// are applied to the collab store and recalculated (see Recalculate) while holding the
+// lock, so that formulas see the edits of a cell in the order they were stored.
+func (h *Hub) LockEdits(sheetID string) (unlock func()) {
+	return h.edits.lock(sheetID)
+}
+
+// Recalculate recomputes the formulas of the sheet affected by an edit that has been
+// applied to the collab store, and broadcasts the values that changed. The row of the
+// edit is counted as in the collab store, i.e. with the headers as row 0. The edits of
+// the sheet must be locked since the edit was applied, see LockEdits.
+//
+// Only sheets whose formulas are loaded, i.e. that have subscribers, are recalculated.
+// The formulas of other sheets are computed from the collab store once they are needed.
+func (h *Hub) Recalculate(store *collab.Store, sheetID string, edit collab.EditMsg) error {
+	sheet, err := h.formulas.getLoaded(store, sheetID)
+	if err != nil || sheet == nil {
+		return err
+	}
+
+	changed, err := sheet.Update(formula.Cell{Row: edit.Row, Col: edit.Col}, edit.Data, cellLookup(store, sheetID))
+	if err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		h.Broadcast <- collab.BroadCastMsg{
+			SheetID: sheetID,
+			Event:   computedMsg{Type: msgTypeComputed, Cells: computedCells(changed)},
+		}
+	}
+	return nil
+}
+
+// FormulaValues returns the values of every formula of the sheet, keyed by cell as in
+// the collab store. Unless the formulas of the sheet are loaded, they are computed from
+// the collab store without being kept, as nothing would keep them up to date.
+func (h *Hub) FormulaValues(store *collab.Store, sheetID string) (map[formula.Cell]string, error) {
+	sheet, err := h.formulas.getLoaded(store, sheetID)
+	if err != nil {
+		return nil, err
+	}
+	if sheet == nil {
+		if sheet, err = loadFormulas(store, sheetID); err != nil {
+			return nil, err
+		}
+	}
+	return sheet.Values(), nil
+}
+
+// ComputedValues returns the message carrying the values of every formula of the sheet,
+// which is sent after a snapshot, or nil if the sheet has no formulas.
+func (h *Hub) ComputedValues(store *collab.Store, sheetID string) (any, error) {
+	sheet, err := h.formulas.get(store, sheetID)
+	if err != nil {
+		return nil, err
+	}
+
+	values := sheet.Values()
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return computedMsg{Type: msgTypeComputed, Cells: computedCells(values)}, nil
+}
@@ -8,14 +8,41 @@ import (
 	"github.com/waynekn/tablesync/core/collab"
 )
 
+// Subscriber is anything that can receive the messages broadcasted to a sheet,
+// e.g. a websocket Client or a read-only Viewer.
+type Subscriber interface {
+	// Sheet returns the ID of the sheet the subscriber receives messages for.
+	Sheet() string
+	// User returns the ID of the user the subscriber belongs to, or an empty
+	// string for anonymous users.
+	User() string
+	// Deliver hands a broadcasted message to the subscriber.
+	Deliver(msg collab.BroadCastMsg)
+	// Disconnect ends the subscription, telling the subscriber why. It must not block.
+	Disconnect(reason string)
+}
+
+// SheetClosure asks the Hub to disconnect every subscriber of a sheet, e.g. because
+// the sheet was deleted. If UserID is set, only the subscribers of that user are
+// disconnected, e.g. because their access to the sheet changed.
+type SheetClosure struct {
+	SheetID string
+	UserID  string
+	Reason  string
+}
+
 // Hub is a long-running in-memory struct that keeps track of all
-// websocket clients currently connected. It handles broadcasting a message
-// to all clients on the same sheetID
+// subscribers currently connected. It handles broadcasting a message
+// to all subscribers on the same sheetID
 type Hub struct {
-	Clients    map[string][]*Client // map[sheetID]clients
-	Register   chan *Client
-	Unregister chan *Client
+	Clients    map[string][]Subscriber // map[sheetID]subscribers
+	Register   chan Subscriber
+	Unregister chan Subscriber
 	Broadcast  chan collab.BroadCastMsg
+	CloseSheet chan SheetClosure
+	formulas   *formulaSheets
+	edits      *editLocks
+	inspect    chan func()
 }
 
 // NewHub creates and returns a new Hub instance.
@@ -23,17 +50,21 @@ type Hub struct {
 // and broadcast messages to all clients connected to the same sheetID.
 func NewHub() *Hub {
 	hub := &Hub{
-		Clients:    make(map[string][]*Client),
-		Register:   make(chan *Client, 100),
-		Unregister: make(chan *Client, 100),
+		Clients:    make(map[string][]Subscriber),
+		Register:   make(chan Subscriber, 100),
+		Unregister: make(chan Subscriber, 100),
 		Broadcast:  make(chan collab.BroadCastMsg, 100),
+		CloseSheet: make(chan SheetClosure, 100),
+		formulas:   newFormulaSheets(),
+		edits:      newEditLocks(),
+		inspect:    make(chan func()),
 	}
 	go hub.run()
 	return hub
 }
 
 // run starts the Hub's event loop, which listens for client registration,
-// unregistration, and broadcast messages.
+// unregistration, broadcast messages and sheet closures.
 func (h *Hub) run() {
 	for {
 		func() {
@@ -45,25 +76,71 @@ func (h *Hub) run() {
 
 			select {
 			case client := <-h.Register:
-				h.Clients[client.SheetID] = append(h.Clients[client.SheetID], client)
+				h.Clients[client.Sheet()] = append(h.Clients[client.Sheet()], client)
 			case client := <-h.Unregister:
-				i := 0
-				h.Clients[client.SheetID] = slices.DeleteFunc(h.Clients[client.SheetID], func(c *Client) bool {
-					i++
+				sheetID := client.Sheet()
+				h.Clients[sheetID] = slices.DeleteFunc(h.Clients[sheetID], func(c Subscriber) bool {
 					return c == client
 				})
 
-				// if the sheet only had one client and they have been unregistred, delete the empty key
-				if i == 1 {
-					delete(h.Clients, client.SheetID)
+				// clients unregister once from each of their goroutines, so only delete the
+				// key once the sheet has no clients left
+				if len(h.Clients[sheetID]) == 0 {
+					delete(h.Clients, sheetID)
+					h.formulas.drop(sheetID)
 				}
 			case broadcast := <-h.Broadcast:
 				if clients, ok := h.Clients[broadcast.SheetID]; ok {
 					for _, client := range clients {
-						client.Send <- broadcast.Edit
+						client.Deliver(broadcast)
 					}
 				}
+			case closure := <-h.CloseSheet:
+				h.closeSheet(closure)
+			case fn := <-h.inspect:
+				fn()
 			}
 		}()
 	}
 }
+
+// closeSheet disconnects the subscribers of a sheet, see SheetClosure.
+func (h *Hub) closeSheet(closure SheetClosure) {
+	sheetID := closure.SheetID
+	h.Clients[sheetID] = slices.DeleteFunc(h.Clients[sheetID], func(c Subscriber) bool {
+		if closure.UserID != "" && c.User() != closure.UserID {
+			return false
+		}
+		c.Disconnect(closure.Reason)
+		return true
+	})
+
+	// disconnected clients still unregister, which is a no-op once they are removed
+	if len(h.Clients[sheetID]) == 0 {
+		delete(h.Clients, sheetID)
+		h.formulas.drop(sheetID)
+	}
+}
+
+// ResetSheet disconnects every subscriber of a sheet like CloseSheet and forgets its
+// formulas, and returns once it is done. It is used when the sheet changes in a way its
+// subscribers and formulas cannot follow, e.g. when its columns change.
+func (h *Hub) ResetSheet(sheetID, reason string) {
+	done := make(chan struct{})
+	h.inspect <- func() {
+		h.closeSheet(SheetClosure{SheetID: sheetID, Reason: reason})
+		h.formulas.drop(sheetID)
+		close(done)
+	}
+	<-done
+}
+
+// subscribers returns a copy of the subscribers of a sheet. Clients is only used by the
+// hub's goroutine, so it is read there.
+func (h *Hub) subscribers(sheetID string) []Subscriber {
+	result := make(chan []Subscriber, 1)
+	h.inspect <- func() {
+		result <- slices.Clone(h.Clients[sheetID])
+	}
+	return <-result
+}
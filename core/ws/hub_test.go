@@ -1,6 +1,9 @@
 package ws
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -10,13 +13,25 @@ import (
 	"github.com/waynekn/tablesync/core/collab"
 )
 
+// subscribersOf waits for the hub to process the pending registrations, unregistrations
+// and closures, and returns the subscribers of the sheet.
+func subscribersOf(t *testing.T, hub *Hub, sheetID string) []Subscriber {
+	t.Helper()
+	assert.Eventually(t, func() bool {
+		return len(hub.Register) == 0 && len(hub.Unregister) == 0 && len(hub.CloseSheet) == 0
+	}, time.Second, time.Millisecond, "the hub should process pending operations")
+	// the hub handles one operation at a time, so the last one has been handled by the
+	// time it reads its subscribers
+	return hub.subscribers(sheetID)
+}
+
 func TestRun(t *testing.T) {
 	hub := NewHub()
 
 	client := &Client{
 		Conn:    &websocket.Conn{},
 		SheetID: "test-sheet",
-		Send:    make(chan collab.EditMsg, 1),
+		Send:    make(chan collab.BroadCastMsg, 1),
 	}
 
 	var wg sync.WaitGroup
@@ -30,10 +45,10 @@ func TestRun(t *testing.T) {
 	}()
 
 	// Wait for the register operation to be processed
-	time.Sleep(50 * time.Millisecond)
+	wg.Wait()
 
 	// Check if the client is registered
-	assert.Equal(t, 1, len(hub.Clients[client.SheetID]),
+	assert.Equal(t, 1, len(subscribersOf(t, hub, client.SheetID)),
 		"After registering the client, the client count for SheetID '%s' should be 1", client.SheetID)
 
 	// unregister the client
@@ -44,15 +59,254 @@ func TestRun(t *testing.T) {
 	}()
 
 	// Wait for the unregister operation
-	time.Sleep(50 * time.Millisecond)
+	wg.Wait()
 
 	// Check if the client is unregistered
-	assert.Equal(t, 0, len(hub.Clients[client.SheetID]),
+	assert.Equal(t, 0, len(subscribersOf(t, hub, client.SheetID)),
 		"After unregistering the client, the client count for SheetID '%s' should be 0", client.SheetID)
 
 	// check that the now sheet has been removed
-	_, exists := hub.Clients[client.SheetID]
-	assert.False(t, exists, "Expected sheetID %q to be removed after last client unregistered", client.SheetID)
+	exists := make(chan bool, 1)
+	hub.inspect <- func() {
+		_, ok := hub.Clients[client.SheetID]
+		exists <- ok
+	}
+	assert.False(t, <-exists, "Expected sheetID %q to be removed after last client unregistered", client.SheetID)
+}
 
-	wg.Wait()
+func TestRunUnregisterTwice(t *testing.T) {
+	hub := NewHub()
+
+	first := &Client{SheetID: "test-sheet", Send: make(chan collab.BroadCastMsg, 1)}
+	second := &Client{SheetID: "test-sheet", Send: make(chan collab.BroadCastMsg, 1)}
+
+	hub.Register <- first
+	hub.Register <- second
+
+	// wait for the register operations to be processed
+	subscribersOf(t, hub, "test-sheet")
+
+	// clients unregister from both their read and write goroutines
+	hub.Unregister <- first
+	hub.Unregister <- first
+
+	assert.Equal(t, []Subscriber{second}, subscribersOf(t, hub, "test-sheet"),
+		"Unregistering a client twice should not remove the other clients of the sheet")
+}
+
+func TestRunBroadcast(t *testing.T) {
+	hub := NewHub()
+
+	client := &Client{SheetID: "test-sheet", Send: make(chan collab.BroadCastMsg, 1)}
+	viewer := NewViewer("test-sheet", "")
+	other := NewViewer("other-sheet", "")
+
+	hub.Register <- client
+	hub.Register <- viewer
+	hub.Register <- other
+
+	// wait for the register operations to be processed
+	subscribersOf(t, hub, "test-sheet")
+
+	author := &collab.Author{ID: "test-user"}
+	broadcast := collab.BroadCastMsg{
+		SheetID:  "test-sheet",
+		SenderID: "sender",
+		Author:   author,
+		Edit:     collab.EditMsg{Row: 1, Col: 1, Data: "value"},
+	}
+	hub.Broadcast <- broadcast
+
+	assert.Equal(t, broadcast, <-client.Send, "client should receive the broadcast")
+	assert.Equal(t, editMsg{Type: msgTypeEdit, Row: 1, Col: 1, Data: "value", Author: author, ClientID: "sender"},
+		<-viewer.Send, "viewer should receive the edit with its author")
+	assert.Empty(t, other.Send, "subscribers of other sheets should not receive the edit")
+}
+
+func TestRunCloseSheet(t *testing.T) {
+	hub := NewHub()
+
+	first := NewViewer("test-sheet", "")
+	second := NewViewer("test-sheet", "")
+	other := NewViewer("other-sheet", "")
+
+	hub.Register <- first
+	hub.Register <- second
+	hub.Register <- other
+
+	// wait for the register operations to be processed
+	subscribersOf(t, hub, "test-sheet")
+
+	hub.CloseSheet <- SheetClosure{SheetID: "test-sheet", Reason: "deleted"}
+
+	// the subscribers are disconnected by the time the closure is processed
+	remaining := subscribersOf(t, hub, "test-sheet")
+
+	for _, viewer := range []*Viewer{first, second} {
+		select {
+		case <-viewer.Done():
+			assert.Equal(t, "deleted", viewer.Reason())
+		default:
+			t.Fatal("every subscriber of the closed sheet should be disconnected")
+		}
+	}
+
+	select {
+	case <-other.Done():
+		t.Fatal("subscribers of other sheets should not be disconnected")
+	default:
+	}
+
+	assert.Empty(t, remaining, "the closed sheet should be removed from the hub")
+	assert.Equal(t, []Subscriber{other}, subscribersOf(t, hub, "other-sheet"))
+}
+
+func TestRunCloseSheetForUser(t *testing.T) {
+	hub := NewHub()
+
+	removed := NewViewer("test-sheet", "removed-user")
+	remaining := NewViewer("test-sheet", "another-user")
+
+	hub.Register <- removed
+	hub.Register <- remaining
+
+	// wait for the register operations to be processed
+	subscribersOf(t, hub, "test-sheet")
+
+	hub.CloseSheet <- SheetClosure{SheetID: "test-sheet", UserID: "removed-user", Reason: "access changed"}
+
+	// the subscribers are disconnected by the time the closure is processed
+	subscribers := subscribersOf(t, hub, "test-sheet")
+
+	select {
+	case <-removed.Done():
+		assert.Equal(t, "access changed", removed.Reason())
+	default:
+		t.Fatal("the subscribers of the user should be disconnected")
+	}
+
+	select {
+	case <-remaining.Done():
+		t.Fatal("the subscribers of other users should not be disconnected")
+	default:
+	}
+
+	assert.Equal(t, []Subscriber{remaining}, subscribers)
+}
+
+func TestLockEdits(t *testing.T) {
+	hub := NewHub()
+
+	unlock := hub.LockEdits("sheet-1")
+	otherUnlock := hub.LockEdits("sheet-2")
+	otherUnlock()
+
+	locked := make(chan struct{})
+	go func() {
+		unlock := hub.LockEdits("sheet-1")
+		close(locked)
+		unlock()
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("edits of a sheet should wait for the previous ones")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	<-locked
+	assert.Eventually(t, func() bool {
+		hub.edits.mu.Lock()
+		defer hub.edits.mu.Unlock()
+		return len(hub.edits.locks) == 0
+	}, time.Second, 10*time.Millisecond, "locks should be dropped once released")
+}
+
+func TestRecalculateWithoutSubscribers(t *testing.T) {
+	hub := NewHub()
+
+	err := hub.Recalculate(nil, "sheet-1", collab.EditMsg{Row: 1, Col: 0, Data: "=1+1"})
+	assert.NoError(t, err)
+
+	hub.formulas.mu.Lock()
+	defer hub.formulas.mu.Unlock()
+	assert.Empty(t, hub.formulas.sheets, "the formulas of sheets without subscribers should not be loaded")
+}
+
+func TestResetSheet(t *testing.T) {
+	hub := NewHub()
+
+	viewer := NewViewer("test-sheet", "")
+	hub.Register <- viewer
+	subscribersOf(t, hub, "test-sheet")
+
+	hub.formulas.mu.Lock()
+	hub.formulas.sheets["test-sheet"] = &formulaEntry{}
+	hub.formulas.mu.Unlock()
+
+	hub.ResetSheet("test-sheet", "columns changed")
+
+	// the reset is done by the time it returns
+	select {
+	case <-viewer.Done():
+		assert.Equal(t, "columns changed", viewer.Reason())
+	default:
+		t.Fatal("every subscriber of the sheet should be disconnected")
+	}
+	assert.Empty(t, hub.subscribers("test-sheet"))
+
+	hub.formulas.mu.Lock()
+	defer hub.formulas.mu.Unlock()
+	assert.NotContains(t, hub.formulas.sheets, "test-sheet", "the formulas of the sheet should be dropped")
+}
+
+func TestRunBroadcastToStalledClient(t *testing.T) {
+	hub := NewHub()
+
+	// a client whose writer has stopped, so that nothing reads its Send channel
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	stalled := &Client{
+		Conn:    conn,
+		SheetID: "test-sheet",
+		Send:    make(chan collab.BroadCastMsg, 1),
+		done:    make(chan struct{}),
+	}
+	other := NewViewer("other-sheet", "")
+
+	hub.Register <- stalled
+	hub.Register <- other
+	subscribersOf(t, hub, "test-sheet")
+
+	for range 3 {
+		hub.Broadcast <- collab.BroadCastMsg{SheetID: "test-sheet", Edit: collab.EditMsg{Row: 1, Col: 0, Data: "x"}}
+	}
+	hub.Broadcast <- collab.BroadCastMsg{SheetID: "other-sheet", Edit: collab.EditMsg{Row: 1, Col: 0, Data: "y"}}
+
+	select {
+	case <-other.Send:
+	case <-time.After(time.Second):
+		t.Fatal("a stalled client should not block the hub")
+	}
+	select {
+	case <-stalled.done:
+	case <-time.After(time.Second):
+		t.Fatal("a stalled client should be disconnected")
+	}
 }
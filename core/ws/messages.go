@@ -0,0 +1,266 @@
+package ws
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/waynekn/tablesync/core/collab"
+)
+
+// Message types exchanged with clients. Edits sent by the client may have no type for
+// compatibility with older clients, while the edits broadcasted by the server always
+// have msgTypeEdit.
+const (
+	msgTypeSession       = "session"
+	msgTypeEdit          = "edit"
+	msgTypeAck           = "ack"
+	msgTypeReject        = "reject"
+	msgTypeViewport      = "viewport"
+	msgTypeSnapshotStart = "snapshotStart"
+	msgTypeSnapshotChunk = "snapshotChunk"
+	msgTypeSnapshotEnd   = "snapshotEnd"
+	msgTypeError         = "error"
+	msgTypeSheetUpdated  = "sheetUpdated"
+	msgTypeComputed      = "computed"
+	msgTypeCommentThread = "commentThread"
+	msgTypeFormatCell    = "formatCell"
+	msgTypeFormatColumn  = "formatColumn"
+	msgTypeFormat        = "format"
+	msgTypeFormats       = "formats"
+)
+
+// sessionMsg is the first message sent to a client and describes its session,
+// including the types of the columns of the sheet so that the right editors can be
+// shown before the snapshot arrives.
+type sessionMsg struct {
+	Type     string          `json:"type"`
+	ClientID string          `json:"clientId"`
+	Role     collab.Role     `json:"role"`
+	Schema   []collab.Column `json:"schema"`
+}
+
+// clientMsg is a message received from a client. Messages without a type are edits.
+type clientMsg struct {
+	Type string `json:"type"`
+	collab.EditMsg
+	// From and To hold the row range of a viewport message.
+	From int `json:"from"`
+	To   int `json:"to"`
+	// Format is the new format of a formatCell or formatColumn message, which use Row and
+	// Col to identify the cell or column.
+	Format collab.Format `json:"format"`
+}
+
+// editMsg is an edit broadcasted to every client other than the one that made it.
+// Row, Col and Data are kept at the top level for compatibility with older clients.
+type editMsg struct {
+	Type     string         `json:"type"`
+	Row      int            `json:"row"`
+	Col      int            `json:"col"`
+	Data     string         `json:"data"`
+	Author   *collab.Author `json:"author,omitempty"`
+	ClientID string         `json:"clientId"`
+}
+
+// ackMsg confirms to a client that its edit has been applied and broadcasted.
+type ackMsg struct {
+	Type string `json:"type"`
+	Row  int    `json:"row"`
+	Col  int    `json:"col"`
+	Seq  int    `json:"seq,omitempty"`
+}
+
+// rejectMsg tells a client that its edit was not applied because the value is not
+// accepted by the column. Rule is the rule the value breaks (see collab.CellError) and
+// Message describes the problem to the user.
+type rejectMsg struct {
+	Type    string `json:"type"`
+	Row     int    `json:"row"`
+	Col     int    `json:"col"`
+	Seq     int    `json:"seq,omitempty"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// newRejectMsg returns the message rejecting the edit for the reason in `err`.
+func newRejectMsg(edit collab.EditMsg, err *collab.CellError) rejectMsg {
+	return rejectMsg{
+		Type:    msgTypeReject,
+		Row:     edit.Row,
+		Col:     edit.Col,
+		Seq:     edit.Seq,
+		Rule:    err.Rule,
+		Param:   err.Param,
+		Message: err.Message,
+	}
+}
+
+// outgoingEdit returns the message a subscriber with the ID `subscriberID` receives
+// for the broadcast, i.e. an acknowledgement if it made the edit or the edit otherwise.
+// Broadcasted events are returned as they are.
+func outgoingEdit(msg collab.BroadCastMsg, subscriberID string) any {
+	if msg.Event != nil {
+		return msg.Event
+	}
+	if msg.SenderID != "" && msg.SenderID == subscriberID {
+		return ackMsg{Type: msgTypeAck, Row: msg.Edit.Row, Col: msg.Edit.Col, Seq: msg.Edit.Seq}
+	}
+	return editMsg{
+		Type:     msgTypeEdit,
+		Row:      msg.Edit.Row,
+		Col:      msg.Edit.Col,
+		Data:     msg.Edit.Data,
+		Author:   msg.Author,
+		ClientID: msg.SenderID,
+	}
+}
+
+// formatMsg is a change to the format of a cell, or of a whole column if Row is nil,
+// broadcasted to every client including the one that made it. The zero format clears
+// the format of the cell or column.
+type formatMsg struct {
+	Type     string         `json:"type"`
+	Row      *int           `json:"row,omitempty"`
+	Col      int            `json:"col"`
+	Format   collab.Format  `json:"format"`
+	Author   *collab.Author `json:"author,omitempty"`
+	ClientID string         `json:"clientId"`
+}
+
+// cell is a single cell sent as part of a snapshot. Rows are indexed the same way as
+// client edits, i.e. without the header row.
+type cell struct {
+	Row  int    `json:"row"`
+	Col  int    `json:"col"`
+	Data string `json:"data"`
+}
+
+// snapshotStartMsg opens a chunked or viewport snapshot and carries the column headers.
+type snapshotStartMsg struct {
+	Type    string   `json:"type"`
+	Columns []string `json:"columns"`
+}
+
+// snapshotChunkMsg carries a batch of cells of a snapshot.
+type snapshotChunkMsg struct {
+	Type  string `json:"type"`
+	Cells []cell `json:"cells"`
+}
+
+// snapshotEndMsg marks the end of a chunked snapshot. Rows holds the number of
+// data rows in the sheet.
+type snapshotEndMsg struct {
+	Type string `json:"type"`
+	Rows int    `json:"rows"`
+}
+
+// viewportMsg confirms that the cells of a viewport have been sent and that only
+// edits to rows `From` (inclusive) to `To` (exclusive) will be sent from now on.
+type viewportMsg struct {
+	Type string `json:"type"`
+	From int    `json:"from"`
+	To   int    `json:"to"`
+}
+
+// computedMsg carries the values of formula cells, i.e. cells whose content starts
+// with "=". It follows every snapshot of a sheet with formulas, and every edit that
+// changes the value of a formula.
+type computedMsg struct {
+	Type  string `json:"type"`
+	Cells []cell `json:"cells"`
+}
+
+// formatsMsg carries the formats of the columns and cells of a sheet. It follows every
+// snapshot of a sheet with formats. The format of a cell replaces the format of its
+// column, see collab.Formats.Of.
+type formatsMsg struct {
+	Type    string         `json:"type"`
+	Columns []columnFormat `json:"columns"`
+	Cells   []cellFormat   `json:"cells"`
+}
+
+// columnFormat is the format of a column sent as part of a formatsMsg.
+type columnFormat struct {
+	Col    int           `json:"col"`
+	Format collab.Format `json:"format"`
+}
+
+// cellFormat is the format of a cell sent as part of a formatsMsg. Rows are indexed the
+// same way as client edits, i.e. without the header row.
+type cellFormat struct {
+	Row    int           `json:"row"`
+	Col    int           `json:"col"`
+	Format collab.Format `json:"format"`
+}
+
+// newFormatsMsg returns the message carrying the formats of a sheet, sorted by position.
+func newFormatsMsg(formats collab.Formats) formatsMsg {
+	msg := formatsMsg{
+		Type:    msgTypeFormats,
+		Columns: make([]columnFormat, 0, len(formats.Columns)),
+		Cells:   make([]cellFormat, 0, len(formats.Cells)),
+	}
+	for col, format := range formats.Columns {
+		msg.Columns = append(msg.Columns, columnFormat{Col: col, Format: format})
+	}
+	for pos, format := range formats.Cells {
+		msg.Cells = append(msg.Cells, cellFormat{Row: pos.Row - 1, Col: pos.Col, Format: format})
+	}
+
+	slices.SortFunc(msg.Columns, func(a, b columnFormat) int { return cmp.Compare(a.Col, b.Col) })
+	slices.SortFunc(msg.Cells, func(a, b cellFormat) int {
+		return cmp.Or(cmp.Compare(a.Row, b.Row), cmp.Compare(a.Col, b.Col))
+	})
+	return msg
+}
+
+// errorMsg reports a problem with a client message that does not require closing the connection.
+type errorMsg struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// SheetUpdatedMsg notifies clients that the metadata of the sheet they are editing
+// has changed, e.g. that its deadline has been extended.
+type SheetUpdatedMsg struct {
+	Type        string    `json:"type"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Deadline    time.Time `json:"deadline"`
+	LinkAccess  string    `json:"linkAccess"`
+}
+
+// NewSheetUpdatedMsg returns a message notifying clients of the new metadata of a sheet.
+func NewSheetUpdatedMsg(title, description string, deadline time.Time, linkAccess string) SheetUpdatedMsg {
+	return SheetUpdatedMsg{
+		Type:        msgTypeSheetUpdated,
+		Title:       title,
+		Description: description,
+		Deadline:    deadline,
+		LinkAccess:  linkAccess,
+	}
+}
+
+// Changes to a comment thread that clients are notified of, see CommentThreadMsg.
+const (
+	CommentThreadCreated  = "created"
+	CommentThreadReplied  = "replied"
+	CommentThreadResolved = "resolved"
+	CommentThreadReopened = "reopened"
+)
+
+// CommentThreadMsg notifies clients that a comment thread of the sheet they are editing
+// has been started, replied to, resolved or reopened. Thread is the thread after the
+// change, as returned by the REST API.
+type CommentThreadMsg struct {
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	Thread any    `json:"thread"`
+}
+
+// NewCommentThreadMsg returns a message notifying clients of a change to a comment thread.
+func NewCommentThreadMsg(action string, thread any) CommentThreadMsg {
+	return CommentThreadMsg{Type: msgTypeCommentThread, Action: action, Thread: thread}
+}
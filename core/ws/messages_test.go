@@ -0,0 +1,78 @@
+package ws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/waynekn/tablesync/core/collab"
+	"github.com/waynekn/tablesync/core/formula"
+)
+
+func TestOutgoingEdit(t *testing.T) {
+	author := &collab.Author{ID: "user-1", Name: "User One"}
+	broadcast := collab.BroadCastMsg{
+		SheetID:  "test-sheet",
+		SenderID: "client-1",
+		Author:   author,
+		Edit:     collab.EditMsg{Row: 2, Col: 3, Data: "value", Seq: 7},
+	}
+
+	t.Run("sender receives an ack", func(t *testing.T) {
+		got := outgoingEdit(broadcast, "client-1")
+		assert.Equal(t, ackMsg{Type: msgTypeAck, Row: 2, Col: 3, Seq: 7}, got)
+	})
+
+	t.Run("other clients receive the edit and its author", func(t *testing.T) {
+		got := outgoingEdit(broadcast, "client-2")
+		assert.Equal(t, editMsg{
+			Type:     msgTypeEdit,
+			Row:      2,
+			Col:      3,
+			Data:     "value",
+			Author:   author,
+			ClientID: "client-1",
+		}, got)
+	})
+
+	t.Run("broadcasts without a sender are never acknowledged", func(t *testing.T) {
+		anonymous := collab.BroadCastMsg{SheetID: "test-sheet", Edit: collab.EditMsg{Row: 1}}
+		got := outgoingEdit(anonymous, "")
+		assert.IsType(t, editMsg{}, got)
+	})
+
+	t.Run("events are sent as they are", func(t *testing.T) {
+		event := NewSheetUpdatedMsg("title", "description", time.Now(), "edit")
+		got := outgoingEdit(collab.BroadCastMsg{SheetID: "test-sheet", Event: event}, "client-1")
+		assert.Equal(t, event, got)
+	})
+}
+
+func TestNewRejectMsg(t *testing.T) {
+	edit := collab.EditMsg{Row: 4, Col: 1, Data: "150", Seq: 9}
+	err := &collab.CellError{Col: 1, Rule: collab.RuleMax, Param: "100", Message: "Score must be 100 or less"}
+
+	assert.Equal(t, rejectMsg{
+		Type:    msgTypeReject,
+		Row:     4,
+		Col:     1,
+		Seq:     9,
+		Rule:    collab.RuleMax,
+		Param:   "100",
+		Message: "Score must be 100 or less",
+	}, newRejectMsg(edit, err), "the client should be able to match the rejection with its edit")
+}
+
+func TestComputedCells(t *testing.T) {
+	values := map[formula.Cell]string{
+		{Row: 2, Col: 0}: "3",
+		{Row: 1, Col: 1}: "#DIV/0!",
+		{Row: 1, Col: 0}: "1",
+	}
+
+	assert.Equal(t, []cell{
+		{Row: 0, Col: 0, Data: "1"},
+		{Row: 0, Col: 1, Data: "#DIV/0!"},
+		{Row: 1, Col: 0, Data: "3"},
+	}, computedCells(values), "cells should be indexed like client edits, in the order of the sheet")
+}
@@ -0,0 +1,71 @@
+package ws
+
+import (
+	"fmt"
+
+	"github.com/waynekn/tablesync/core/collab"
+)
+
+// rowBatchSize is the number of rows retrieved from Redis at once by EachRow.
+const rowBatchSize = 500
+
+// CountRows returns the number of rows of a live sheet, headers included. The cells of
+// the sheet are scanned in batches so that it is never held in memory as a whole.
+func CountRows(store *collab.Store, sheetID string) (int, error) {
+	rows := 0
+	err := store.ScanSheetData(sheetID, snapshotChunkSize, func(cells map[string]string) error {
+		for key := range cells {
+			row, _, err := coordsFromString(key)
+			if err != nil {
+				return err
+			}
+			rows = max(rows, row+1)
+		}
+		return nil
+	})
+	return rows, err
+}
+
+// hasRow reports whether a live sheet has the row `row`, headers included, i.e. whether
+// the row is before the end of the sheet (see CountRows). Rows with a cell in one of
+// their `colNum` columns are found without counting the rows of the sheet.
+func hasRow(store *collab.Store, sheetID string, row, colNum int) (bool, error) {
+	keys := make([]string, colNum)
+	for col := range keys {
+		keys[col] = fmt.Sprintf("%d:%d", row, col)
+	}
+	cells, err := store.GetCells(sheetID, keys)
+	if err != nil {
+		return false, err
+	}
+	if len(cells) > 0 {
+		return true, nil
+	}
+
+	rowNum, err := CountRows(store, sheetID)
+	return row < rowNum, err
+}
+
+// EachRow calls fn with the index and cells of each data row of a live sheet, each
+// `colNum` cells wide. Rows are indexed the same way as client edits, i.e. without the
+// header row. They are retrieved in batches so that the sheet is never held in memory
+// as a whole, and the iteration stops at the first error fn returns.
+func EachRow(store *collab.Store, sheetID string, colNum int, fn func(index int, row []string) error) error {
+	rowNum, err := CountRows(store, sheetID)
+	if err != nil {
+		return err
+	}
+
+	for from := 1; from < rowNum; from += rowBatchSize {
+		rows, err := store.GetRows(sheetID, from, min(from+rowBatchSize, rowNum), colNum)
+		if err != nil {
+			return err
+		}
+		for i, row := range rows {
+			if err := fn(from+i-1, row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
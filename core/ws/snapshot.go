@@ -0,0 +1,195 @@
+package ws
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/waynekn/tablesync/core/collab"
+)
+
+// SnapshotMode controls how the initial sheet data is sent to a client.
+type SnapshotMode string
+
+const (
+	// SnapshotFull sends the whole sheet, headers included, as a single 2D array.
+	SnapshotFull SnapshotMode = "full"
+	// SnapshotChunked streams the sheet as batches of cells.
+	SnapshotChunked SnapshotMode = "chunked"
+	// SnapshotViewport only sends the cells of the row range the client subscribes to.
+	SnapshotViewport SnapshotMode = "viewport"
+)
+
+const (
+	// snapshotChunkSize is the number of cells sent per snapshot chunk.
+	snapshotChunkSize = 500
+	// maxViewportRows is the largest row range a client can subscribe to at once.
+	maxViewportRows = 500
+)
+
+// Valid reports whether m is a known snapshot mode.
+func (m SnapshotMode) Valid() bool {
+	switch m {
+	case SnapshotFull, SnapshotChunked, SnapshotViewport:
+		return true
+	}
+	return false
+}
+
+// viewport is a row range a client is subscribed to. Rows are indexed the
+// same way as client edits, i.e. without the header row.
+type viewport struct {
+	from int
+	to   int
+}
+
+// validate checks that the viewport is a non empty range of at most `maxViewportRows` rows.
+func (v viewport) validate() error {
+	if v.from < 0 || v.to <= v.from {
+		return fmt.Errorf("invalid viewport %d-%d", v.from, v.to)
+	}
+	if v.to-v.from > maxViewportRows {
+		return fmt.Errorf("viewport cannot span more than %d rows", maxViewportRows)
+	}
+	return nil
+}
+
+// contains reports whether the row is within the viewport.
+// A nil viewport contains every row.
+func (v *viewport) contains(row int) bool {
+	return v == nil || (row >= v.from && row < v.to)
+}
+
+// sendSnapshot sends the initial sheet data to the client according to its snapshot mode.
+func (c *Client) sendSnapshot(colNum int) error {
+	switch c.snapshot {
+	case SnapshotChunked:
+		return StreamSnapshot(c.collabStore, c.SheetID, colNum, c.writeMsg)
+	case SnapshotViewport:
+		return sendSnapshotStart(c.collabStore, c.SheetID, colNum, c.writeMsg)
+	default:
+		return c.sendFullSnapshot(colNum)
+	}
+}
+
+// sendFullSnapshot sends the whole sheet in a single message.
+func (c *Client) sendFullSnapshot(colNum int) error {
+	sheetData, err := LoadSheetData(c.collabStore, c.SheetID, colNum)
+	if err != nil {
+		return err
+	}
+
+	return c.writeMsg(sheetData)
+}
+
+// sendComputedValues sends the values of the formulas of the sheet, if it has any.
+func (c *Client) sendComputedValues() error {
+	msg, err := c.hub.ComputedValues(c.collabStore, c.SheetID)
+	if err != nil || msg == nil {
+		return err
+	}
+	return c.writeMsg(msg)
+}
+
+// sendFormats sends the formats of the sheet, if it has any.
+func (c *Client) sendFormats() error {
+	msg, err := SheetFormats(c.collabStore, c.SheetID)
+	if err != nil || msg == nil {
+		return err
+	}
+	return c.writeMsg(msg)
+}
+
+// SheetFormats returns the message carrying the formats of the columns and cells of a
+// live sheet, or nil if it has none.
+func SheetFormats(store *collab.Store, sheetID string) (any, error) {
+	formats, err := store.GetFormats(sheetID)
+	if err != nil || formats.IsZero() {
+		return nil, err
+	}
+	return newFormatsMsg(formats), nil
+}
+
+// LoadSheetData retrieves the whole live sheet, headers included, from Redis as a 2D array.
+func LoadSheetData(store *collab.Store, sheetID string, colNum int) ([][]string, error) {
+	redisData, err := store.GetRedisSheetData(sheetID)
+	if err != nil {
+		slog.Error("failed to retrieve sheet data", "sheetID", sheetID, "err", err)
+		return nil, err
+	}
+
+	return mapToMatrix(redisData, colNum)
+}
+
+// sendSnapshotStart sends the column headers of the sheet through `write`.
+func sendSnapshotStart(store *collab.Store, sheetID string, colNum int, write func(msg any) error) error {
+	headers, err := store.GetRows(sheetID, 0, 1, colNum)
+	if err != nil {
+		return err
+	}
+	return write(snapshotStartMsg{Type: msgTypeSnapshotStart, Columns: headers[0]})
+}
+
+// StreamSnapshot streams the cells of a sheet through `write` as a chunked snapshot,
+// so that only one chunk of the sheet is held in memory at a time.
+func StreamSnapshot(store *collab.Store, sheetID string, colNum int, write func(msg any) error) error {
+	if err := sendSnapshotStart(store, sheetID, colNum, write); err != nil {
+		return err
+	}
+
+	rows := 0
+	err := store.ScanSheetData(sheetID, snapshotChunkSize, func(data map[string]string) error {
+		cells := make([]cell, 0, len(data))
+		for key, val := range data {
+			row, col, err := coordsFromString(key)
+			if err != nil {
+				return err
+			}
+			// skip the headers, which have already been sent
+			if row == 0 || col >= colNum {
+				continue
+			}
+			cells = append(cells, cell{Row: row - 1, Col: col, Data: val})
+			rows = max(rows, row)
+		}
+		return writeCells(cells, write)
+	})
+	if err != nil {
+		return err
+	}
+
+	return write(snapshotEndMsg{Type: msgTypeSnapshotEnd, Rows: rows})
+}
+
+// sendViewport sends every cell in the viewport to the client followed by a
+// message confirming the viewport.
+func (c *Client) sendViewport(v viewport, colNum int) error {
+	// add 1 to skip the header row
+	rows, err := c.collabStore.GetRows(c.SheetID, v.from+1, v.to+1, colNum)
+	if err != nil {
+		return err
+	}
+
+	cells := make([]cell, 0, len(rows)*colNum)
+	for i, row := range rows {
+		for j, val := range row {
+			cells = append(cells, cell{Row: v.from + i, Col: j, Data: val})
+		}
+	}
+	if err := writeCells(cells, c.writeMsg); err != nil {
+		return err
+	}
+
+	return c.writeMsg(viewportMsg{Type: msgTypeViewport, From: v.from, To: v.to})
+}
+
+// writeCells writes the cells through `write` in chunks of at most `snapshotChunkSize` cells.
+func writeCells(cells []cell, write func(msg any) error) error {
+	for len(cells) > 0 {
+		n := min(len(cells), snapshotChunkSize)
+		if err := write(snapshotChunkMsg{Type: msgTypeSnapshotChunk, Cells: cells[:n]}); err != nil {
+			return err
+		}
+		cells = cells[n:]
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotModeValid(t *testing.T) {
+	assert.True(t, SnapshotFull.Valid())
+	assert.True(t, SnapshotChunked.Valid())
+	assert.True(t, SnapshotViewport.Valid())
+	assert.False(t, SnapshotMode("").Valid(), "empty snapshot mode should be invalid")
+	assert.False(t, SnapshotMode("partial").Valid(), "unknown snapshot mode should be invalid")
+}
+
+func TestViewportValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		view    viewport
+		wantErr bool
+	}{
+		{"valid range", viewport{from: 0, to: 50}, false},
+		{"max range", viewport{from: 100, to: 100 + maxViewportRows}, false},
+		{"empty range", viewport{from: 10, to: 10}, true},
+		{"reversed range", viewport{from: 10, to: 5}, true},
+		{"negative start", viewport{from: -1, to: 5}, true},
+		{"too many rows", viewport{from: 0, to: maxViewportRows + 1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.view.validate()
+			if tt.wantErr {
+				assert.Error(t, err, "validate should return an error")
+			} else {
+				assert.NoError(t, err, "validate should not return an error")
+			}
+		})
+	}
+}
+
+func TestViewportContains(t *testing.T) {
+	var all *viewport
+	assert.True(t, all.contains(1000), "a nil viewport should contain every row")
+
+	view := &viewport{from: 10, to: 20}
+	assert.True(t, view.contains(10))
+	assert.True(t, view.contains(19))
+	assert.False(t, view.contains(20))
+	assert.False(t, view.contains(9))
+
+	empty := &viewport{}
+	assert.False(t, empty.contains(0), "an empty viewport should not contain any row")
+}
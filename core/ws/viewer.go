@@ -0,0 +1,80 @@
+package ws
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/waynekn/tablesync/core/collab"
+)
+
+// Viewer is a read-only subscriber to the edits of a sheet that is not backed by a
+// websocket connection, e.g. a Server-Sent Events stream.
+//
+// A Viewer never blocks the Hub. If it falls too far behind, it is closed and the
+// owner of the stream is expected to end it so that the viewer can reconnect and
+// receive a fresh snapshot.
+type Viewer struct {
+	SheetID   string
+	UserID    string
+	Send      chan any
+	done      chan struct{}
+	reason    string
+	closeOnce sync.Once
+}
+
+// NewViewer instantiates and returns a new Viewer for the sheet. `userID` identifies
+// the user watching the sheet and is empty for anonymous users.
+func NewViewer(sheetID, userID string) *Viewer {
+	return &Viewer{
+		SheetID: sheetID,
+		UserID:  userID,
+		Send:    make(chan any, 100),
+		done:    make(chan struct{}),
+	}
+}
+
+// Sheet returns the ID of the sheet the viewer is watching.
+func (v *Viewer) Sheet() string {
+	return v.SheetID
+}
+
+// User returns the ID of the user watching the sheet.
+func (v *Viewer) User() string {
+	return v.UserID
+}
+
+// Deliver queues a broadcasted edit or event for the viewer, closing the viewer if its queue is full.
+// The queued messages are ready to be encoded and sent as they are.
+func (v *Viewer) Deliver(msg collab.BroadCastMsg) {
+	select {
+	case v.Send <- outgoingEdit(msg, ""):
+	default:
+		slog.Warn("closing viewer that fell behind", "sheetID", v.SheetID)
+		v.Close()
+	}
+}
+
+// Done returns a channel that is closed once the viewer has been closed.
+func (v *Viewer) Done() <-chan struct{} {
+	return v.done
+}
+
+// Disconnect closes the viewer, recording why so that it can be told to the stream's
+// client. See Reason.
+func (v *Viewer) Disconnect(reason string) {
+	v.closeOnce.Do(func() {
+		v.reason = reason
+		close(v.done)
+	})
+}
+
+// Reason returns why the viewer was disconnected, if it was. It must only be called
+// once Done is closed.
+func (v *Viewer) Reason() string {
+	return v.reason
+}
+
+// Close closes the viewer. It is safe to call more than once.
+func (v *Viewer) Close() {
+	v.Disconnect("")
+}
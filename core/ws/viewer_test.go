@@ -0,0 +1,51 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/waynekn/tablesync/core/collab"
+)
+
+func TestViewerDeliver(t *testing.T) {
+	viewer := NewViewer("test-sheet", "")
+	assert.Equal(t, "test-sheet", viewer.Sheet())
+
+	for i := range cap(viewer.Send) {
+		viewer.Deliver(collab.BroadCastMsg{SheetID: "test-sheet", Edit: collab.EditMsg{Row: i}})
+	}
+
+	select {
+	case <-viewer.Done():
+		t.Fatal("viewer should not be closed before its queue is full")
+	default:
+	}
+
+	// the queue is full, so the next edit should close the viewer instead of blocking
+	viewer.Deliver(collab.BroadCastMsg{SheetID: "test-sheet", Edit: collab.EditMsg{Row: 1}})
+
+	select {
+	case <-viewer.Done():
+	default:
+		t.Fatal("viewer should be closed once it falls behind")
+	}
+
+	// closing again should not panic
+	viewer.Close()
+}
+
+func TestViewerDisconnect(t *testing.T) {
+	viewer := NewViewer("test-sheet", "")
+	viewer.Disconnect("sheet deleted")
+
+	select {
+	case <-viewer.Done():
+	default:
+		t.Fatal("viewer should be closed once disconnected")
+	}
+	assert.Equal(t, "sheet deleted", viewer.Reason())
+
+	// the first reason is kept
+	viewer.Disconnect("another reason")
+	assert.Equal(t, "sheet deleted", viewer.Reason())
+}
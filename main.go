@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/waynekn/tablesync/api"
 	"github.com/waynekn/tablesync/api/db"
+	"github.com/waynekn/tablesync/api/db/repo"
+	"github.com/waynekn/tablesync/api/jobs"
 	"github.com/waynekn/tablesync/api/logging"
 	"github.com/waynekn/tablesync/api/router"
 	"github.com/waynekn/tablesync/core/rdb"
@@ -45,6 +49,18 @@ func main() {
 	}
 	defer redisClient.Close()
 
+	trashRetention := jobs.DefaultTrashRetention
+	if days := os.Getenv("TRASH_RETENTION_DAYS"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			slog.Error("TRASH_RETENTION_DAYS must be a non-negative number of days", "value", days)
+			os.Exit(1)
+		}
+		trashRetention = time.Duration(n) * 24 * time.Hour
+	}
+
+	go jobs.PurgeTrash(context.Background(), repo.NewSpreadsheetRepo(conn), trashRetention)
+
 	api.RegisterJSONTagNameFormatter()
 
 	router := router.New(conn, redisClient)